@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/scheduler"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	settings, err := config.Load()
+	if err != nil {
+		logging.Fatal("error loading the configuration", "error", err)
+	}
+
+	logging.Setup(settings.LogLevel)
+	slog.Debug("configuration loaded", "settings", settings)
+
+	shutdownTracing, err := tracing.Setup(ctx, "wishmate-scheduler", settings.TracesExporter, settings.OTLPEndpoint)
+	if err != nil {
+		logging.Fatal("invalid tracing config", "error", err)
+	}
+	defer func() {
+		// ctx is cancelled by now, the spans left still get a few seconds to be exported
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Error("error flushing traces", "error", err)
+		}
+	}()
+
+	db, err := config.ConnectDB(ctx, settings)
+	if err != nil {
+		logging.Fatal("error connecting to the database", "error", err)
+	}
+	defer db.Close()
+
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db))
+
+	// the worker and scheduler have no http server, their metrics get one of their own
+	if addr := settings.MetricsAddr; addr != "" {
+		go func() {
+			if err := metrics.Serve(ctx, addr); err != nil {
+				slog.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	qc, err := queue.NewClient(ctxWithTimeout, settings.RedisURL.Reveal())
+	if err != nil {
+		logging.Fatal("error connecting to the queue", "error", err)
+	}
+
+	redisOpts, err := redis.ParseURL(settings.RedisURL.Reveal())
+	if err != nil {
+		logging.Fatal("error parsing redis url", "error", err)
+	}
+	rdb := redis.NewClient(redisOpts)
+	defer rdb.Close()
+
+	// only the instance holding the lock runs the jobs, the rest stand by
+	lock, err := scheduler.NewLeaderLock(rdb, scheduler.LeaderKey, scheduler.LeaderTTL)
+	if err != nil {
+		logging.Fatal("error creating the leader lock", "error", err)
+	}
+
+	if err := scheduler.Run(ctx, qc, db, lock); err != nil {
+		logging.Fatal("scheduler stopped", "error", err)
+	}
+}
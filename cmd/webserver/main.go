@@ -3,122 +3,217 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/health"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/Adedunmol/wish-mate/internal/migrate"
+	"github.com/Adedunmol/wish-mate/internal/migrations"
 	"github.com/Adedunmol/wish-mate/internal/queue"
-	"github.com/Adedunmol/wish-mate/internal/reminder"
 	"github.com/Adedunmol/wish-mate/internal/routes"
+	"github.com/Adedunmol/wish-mate/internal/scheduler"
+	"github.com/Adedunmol/wish-mate/internal/templates"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-co-op/gocron/v2"
-	"github.com/jackc/pgx/v5"
-	"github.com/joho/godotenv"
-	"log"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 )
 
 func main() {
-	ctx := context.Background()
-	err := godotenv.Load()
+	// the worker and scheduler also ship as their own binaries (cmd/worker, cmd/scheduler).
+	// They run in-process by default, as they did before the split, so a single binary
+	// deployment keeps sending emails and reminders. Deployments running them on their
+	// own pass -all-in-one=false.
+	allInOne := flag.Bool("all-in-one", true, "run the queue worker and the scheduler alongside the web server, -all-in-one=false when they run as their own processes")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	settings, err := config.Load()
 	if err != nil {
-		log.Fatalf("error loading .env file: %s", err)
+		logging.Fatal("error loading the configuration", "error", err)
 	}
 
+	logging.Setup(settings.LogLevel)
+	slog.Debug("configuration loaded", "settings", settings)
+
 	defer handlePanics()
 
-	db, err := config.ConnectDB()
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(ctx, settings, flag.Args()[1:]); err != nil {
+			logging.Fatal("migration failed", "error", err)
+		}
+		return
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, "wishmate-webserver", settings.TracesExporter, settings.OTLPEndpoint)
+	if err != nil {
+		logging.Fatal("invalid tracing config", "error", err)
+	}
+	defer func() {
+		// ctx is cancelled by now, the spans left still get a few seconds to be exported
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			slog.Error("error flushing traces", "error", err)
+		}
+	}()
+
+	db, err := config.ConnectDB(ctx, settings)
 	if err != nil {
-		log.Fatal(errors.Unwrap(err))
+		logging.Fatal("error connecting to the database", "error", err)
 	}
+	defer db.Close()
 
-	defer db.Close(ctx)
+	metrics.Registry.MustRegister(metrics.NewPoolCollector(db))
+
+	migrator, err := migrate.NewMigrator(db, migrations.FS)
+	if err != nil {
+		logging.Fatal("error loading migrations", "error", err)
+	}
+
+	// refuse to serve against a schema the code does not match
+	if settings.CheckMigrations {
+		if err := migrator.Check(ctx); err != nil {
+			logging.Fatal("the database schema is not up to date, run `wish-mate migrate up` first", "error", err)
+		}
+	}
 
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	qc, err := queue.NewClient(ctxWithTimeout)
+	qc, err := queue.NewClient(ctxWithTimeout, settings.RedisURL.Reveal())
 	if err != nil {
-		log.Fatal(errors.Unwrap(err))
+		logging.Fatal("error connecting to the queue", "error", err)
 	}
 
-	// create a new scheduler
-	scheduler, err := gocron.NewScheduler()
+	// the admin endpoints preview and test-send emails, so the web server needs these too
+	mailTemplates, err := email.LoadTemplates(templates.FS)
 	if err != nil {
-		log.Fatal(fmt.Errorf("error starting gocron scheduler: %v", errors.Unwrap(err)))
+		logging.Fatal("error loading email templates", "error", err)
 	}
 
-	// schedule a task to run every minute
-	_, err = scheduler.NewJob(
-		gocron.DurationJob(time.Minute),
-		gocron.NewTask(func() {
-			enqueueReminders(qc, db)
-		}),
-	)
+	mailer, err := email.NewMailer(settings.Mail)
 	if err != nil {
-		log.Fatalf("failed to schedule job: %v", errors.Unwrap(err))
+		logging.Fatal("error creating the mailer", "error", err)
 	}
 
-	go scheduler.Start()
+	redisOpts, err := redis.ParseURL(settings.RedisURL.Reveal())
+	if err != nil {
+		logging.Fatal("error parsing redis url", "error", err)
+	}
+	rdb := redis.NewClient(redisOpts)
+	defer rdb.Close()
+
+	inspector := asynq.NewInspectorFromRedisClient(rdb)
+
+	healthHandler := &health.Handler{
+		Checks: map[string]health.Check{
+			"database":   health.DatabaseCheck(db),
+			"redis":      health.RedisCheck(rdb),
+			"queue":      health.QueueCheck(inspector),
+			"migrations": health.MigrationCheck(migrator),
+		},
+	}
 
-	r := chi.NewRouter()
+	tokens, err := settings.TokenKeys()
+	if err != nil {
+		logging.Fatal("error loading the token signing keys", "error", err)
+	}
+	if !tokens.Asymmetric() {
+		slog.Info("access tokens are signed with SECRET_KEY, set JWT_KEYS_DIR for other services to verify them")
+	}
 
-	routes.SetupRoutes(config.Config{DB: db, Router: r, Queue: qc})
+	var rateLimiter middlewares.Limiter = middlewares.NewRedisLimiter(rdb)
+	if settings.RateLimitStore == middlewares.RateLimitStoreMemory {
+		rateLimiter = middlewares.NewMemoryLimiter()
+	}
 
-	go qc.Run(ctx, db)
+	var wg sync.WaitGroup
 
-	// handle graceful shutdown
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt)
+	if *allInOne {
+		lock, err := scheduler.NewLeaderLock(rdb, scheduler.LeaderKey, scheduler.LeaderTTL)
+		if err != nil {
+			logging.Fatal("error creating the leader lock", "error", err)
+		}
+
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := scheduler.Run(ctx, qc, db, lock); err != nil {
+				slog.Error("scheduler stopped", "error", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := qc.Run(ctx, db, mailer, mailTemplates); err != nil {
+				slog.Error("queue worker stopped", "error", err)
+			}
+		}()
+	}
+
+	r := chi.NewRouter()
+
+	routes.SetupRoutes(config.Config{
+		DB:          db,
+		Router:      r,
+		Queue:       qc,
+		Mailer:      mailer,
+		Templates:   mailTemplates,
+		Health:      healthHandler,
+		Settings:    settings,
+		Tokens:      tokens,
+		RateLimiter: rateLimiter,
+		Images:      settings.Images(),
+	})
+
+	server := &http.Server{Addr: fmt.Sprintf(":%d", settings.Port), Handler: r}
 
-	server := &http.Server{Addr: fmt.Sprintf(":%d", os.Getenv("PORT")), Handler: r}
 	go func() {
-		log.Printf("starting web server on port %d", os.Getenv("PORT"))
-		if err := server.ListenAndServe(); err != nil {
-			log.Fatalf("error starting web server on port %d: %v", os.Getenv("PORT"), err)
+		slog.Info("starting web server", "port", settings.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logging.Fatal("error starting web server", "port", settings.Port, "error", err)
 		}
 	}()
 
-	<-stop
+	// handle graceful shutdown
+	<-ctx.Done()
 
-	err = scheduler.Shutdown()
-	if err != nil {
-		log.Fatal(fmt.Errorf("error shutting down scheduler: %v", errors.Unwrap(err)))
-	}
+	// fail readiness first and give the load balancer time to notice, requests keep
+	// being served meanwhile
+	healthHandler.Shutdown()
+	slog.Info("readiness switched off, draining", "delay", settings.ShutdownDrainDelay.String())
+	time.Sleep(settings.ShutdownDrainDelay)
 
 	// gracefully shutdown the server
-	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("server forced to shut down: %v", err)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logging.Fatal("server forced to shut down", "error", err)
 	}
 
-	log.Println("server exited properly")
+	// the worker and scheduler observe the same cancelled context
+	wg.Wait()
+
+	slog.Info("server exited properly")
 }
 
 func handlePanics() {
 	if r := recover(); r != nil {
-		log.Printf("panic occurred: %v", r)
-	}
-}
-
-func enqueueReminders(client *queue.Client, db *pgx.Conn) {
-	currentTime := time.Now()
-	taskStore := &reminder.ReminderStore{DB: db}
-
-	// check db for reminders where scheduled = pending AND scheduled_at <= now
-	log.Printf("checking due scheduled reminders at: %v", currentTime.UTC())
-
-	if err := reminder.EnqueueReminders(taskStore, client, &currentTime); err != nil {
-		log.Printf(errors.Unwrap(err).Error())
-	}
-
-	// get today's birthdays and send notifications and mails to their friends
-	log.Printf("checking birthdays due today: %v", currentTime.UTC())
-
-	if err := reminder.EnqueueBirthdays(taskStore, client, &currentTime); err != nil {
-		log.Printf(errors.Unwrap(err).Error())
+		slog.Error("panic occurred", "panic", r)
 	}
 }
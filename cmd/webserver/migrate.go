@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/migrate"
+	"github.com/Adedunmol/wish-mate/internal/migrations"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = `usage: wish-mate migrate <command>
+
+commands:
+  up                apply every pending migration
+  down [-steps n]   roll back the latest n migrations (default 1)
+  status            list the migrations and when they were applied
+  create <name>     add an empty migration to internal/migrations (-dir to change)`
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(ctx context.Context, settings config.Settings, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	command, args := args[0], args[1:]
+
+	if command == "create" {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		dir := flags.String("dir", "internal/migrations", "directory holding the migration files")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		if flags.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		up, down, err := migrate.Create(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	db, err := config.ConnectDB(ctx, settings)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := migrate.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("the schema is up to date")
+		}
+	case "down":
+		flags := flag.NewFlagSet("down", flag.ContinueOnError)
+		steps := flags.Int("steps", 1, "number of migrations to roll back")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+
+		rolledBack, err := migrator.Down(ctx, *steps)
+		for _, migration := range rolledBack {
+			fmt.Printf("rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			return err
+		}
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+// Command wishmatectl is the operator CLI. It works on the same stores as the API,
+// so it follows the application's rules instead of editing rows by hand.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/friendship"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/reminder"
+	"github.com/Adedunmol/wish-mate/internal/wishlist"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const usage = `usage: wishmatectl [-o table|json] <command> [arguments]
+
+commands:
+  users get <email|id>                      show a user
+  users verify <email|id>                   mark a user as verified
+  users disable <email|id>                  stop a user from logging in
+  users delete -yes <email|id>              delete a user and everything they own
+  users resend-code <email|id>              send a new verification code
+  users friendships [-status s] <email|id>  list a user's friendships (accepted, pending, blocked or all)
+  users wishlists <email|id>                list a user's wishlists and items
+  run birthdays|reminders [-date d] [-dry-run=false]
+                                            run the scheduler job for a date (default today), as a dry run unless told otherwise
+  seed [-users n] [-password p]             fill a development database with fake data`
+
+func main() {
+	output := flag.String("o", "table", "output format: table or json")
+	flag.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	flag.Parse()
+
+	if *output != "table" && *output != "json" {
+		fail(fmt.Errorf("unknown output format %q", *output))
+	}
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	settings, err := config.Load()
+	if err != nil {
+		fail(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := config.ConnectDB(ctx, settings)
+	if err != nil {
+		fail(err)
+	}
+	defer db.Close()
+
+	app := &App{
+		Users:     auth.NewUserStore(db),
+		OTPs:      auth.NewOTPStore(db),
+		Friends:   friendship.NewFriendshipStore(db),
+		Wishlists: wishlist.NewWishlistStore(db),
+		Reminders: &reminder.ReminderStore{DB: db},
+		NewQueue: func(ctx context.Context) (queue.Queue, error) {
+			return queue.NewClient(ctx, settings.RedisURL.Reveal())
+		},
+		Out: NewPrinter(os.Stdout, *output),
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	switch command {
+	case "users":
+		err = app.UsersCommand(ctx, args)
+	case "run":
+		err = app.RunCommand(ctx, args)
+	case "seed":
+		err = app.SeedCommand(ctx, args)
+	default:
+		err = errUsage
+	}
+
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fail(err)
+	}
+}
+
+var errUsage = errors.New("invalid usage")
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "wishmatectl: %v\n", err)
+	os.Exit(1)
+}
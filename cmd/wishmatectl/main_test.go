@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/reminder"
+	"strings"
+	"testing"
+	"time"
+)
+
+type StubUserStore struct {
+	auth.Store
+	users   []auth.User
+	deleted []int
+}
+
+func (s *StubUserStore) FindUserByEmail(ctx context.Context, email string) (auth.User, error) {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) FindUserByID(ctx context.Context, id int) (auth.User, error) {
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) UpdateUser(ctx context.Context, id int, data auth.UpdateUserBody) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].Verified = data.Verified
+			return s.users[i], nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DeleteUser(ctx context.Context, id int) error {
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+type StubReminderStore struct {
+	reminder.Store
+	birthdays []reminder.ReminderResponse
+	updated   []int
+}
+
+func (s *StubReminderStore) GetBirthdays(ctx context.Context, currentTime *time.Time) ([]reminder.ReminderResponse, error) {
+	return s.birthdays, nil
+}
+
+func (s *StubReminderStore) UpdateReminder(ctx context.Context, ID int) error {
+	s.updated = append(s.updated, ID)
+	return nil
+}
+
+type StubQueue struct {
+	Tasks []queue.TaskPayload
+}
+
+func (q *StubQueue) Enqueue(taskPayload *queue.TaskPayload) error {
+	q.Tasks = append(q.Tasks, *taskPayload)
+	return nil
+}
+
+func newApp(out *bytes.Buffer, format string) (*App, *StubUserStore, *StubReminderStore, *StubQueue) {
+	users := &StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Email: "adedunmola@gmail.com", Username: "Adedunmola", Locale: "en"},
+	}}
+	reminders := &StubReminderStore{birthdays: []reminder.ReminderResponse{
+		{ID: 3, UserID: 1, Email: "adedunmola@gmail.com", Locale: "en", Type: "birthday"},
+	}}
+	q := &StubQueue{}
+
+	app := &App{
+		Users:     users,
+		Reminders: reminders,
+		NewQueue: func(ctx context.Context) (queue.Queue, error) {
+			return q, nil
+		},
+		Out: NewPrinter(out, format),
+	}
+
+	return app, users, reminders, q
+}
+
+func TestUsersCommand(t *testing.T) {
+	t.Run("shows a user by email as json", func(t *testing.T) {
+		var out bytes.Buffer
+		app, _, _, _ := newApp(&out, "json")
+
+		if err := app.UsersCommand(context.Background(), []string{"get", "adedunmola@gmail.com"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+			t.Fatalf("invalid json %q: %v", out.String(), err)
+		}
+
+		if got["username"] != "Adedunmola" {
+			t.Errorf("got username %v, want %q", got["username"], "Adedunmola")
+		}
+
+		if _, ok := got["password"]; ok {
+			t.Error("the password should not be printed")
+		}
+	})
+
+	t.Run("verifies a user by id", func(t *testing.T) {
+		var out bytes.Buffer
+		app, users, _, _ := newApp(&out, "table")
+
+		if err := app.UsersCommand(context.Background(), []string{"verify", "1"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if !users.users[0].Verified {
+			t.Error("user was not verified")
+		}
+	})
+
+	t.Run("refuses to delete without confirmation", func(t *testing.T) {
+		var out bytes.Buffer
+		app, users, _, _ := newApp(&out, "table")
+
+		err := app.UsersCommand(context.Background(), []string{"delete", "1"})
+		if err == nil || !strings.Contains(err.Error(), "-yes") {
+			t.Errorf("got error %v, want a request for -yes", err)
+		}
+
+		if len(users.deleted) != 0 {
+			t.Errorf("got %d deleted users, want 0", len(users.deleted))
+		}
+	})
+
+	t.Run("deletes with confirmation", func(t *testing.T) {
+		var out bytes.Buffer
+		app, users, _, _ := newApp(&out, "table")
+
+		if err := app.UsersCommand(context.Background(), []string{"delete", "-yes", "1"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(users.deleted) != 1 || users.deleted[0] != 1 {
+			t.Errorf("got deleted users %v, want [1]", users.deleted)
+		}
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		var out bytes.Buffer
+		app, _, _, _ := newApp(&out, "table")
+
+		err := app.UsersCommand(context.Background(), []string{"get", "nobody@gmail.com"})
+		if !errors.Is(err, helpers.ErrNotFound) {
+			t.Errorf("got error %v, want %v", err, helpers.ErrNotFound)
+		}
+	})
+}
+
+func TestRunCommand(t *testing.T) {
+	t.Run("dry run lists the tasks without enqueuing them", func(t *testing.T) {
+		var out bytes.Buffer
+		app, _, reminders, q := newApp(&out, "table")
+
+		if err := app.RunCommand(context.Background(), []string{"birthdays", "-date", "2024-05-01"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(q.Tasks) != 0 || len(reminders.updated) != 0 {
+			t.Errorf("got %d tasks and %d updated reminders, want none", len(q.Tasks), len(reminders.updated))
+		}
+
+		if !strings.Contains(out.String(), "birthday_mail") {
+			t.Errorf("output %q does not list the birthday email", out.String())
+		}
+	})
+
+	t.Run("enqueues the tasks when asked to", func(t *testing.T) {
+		var out bytes.Buffer
+		app, _, _, q := newApp(&out, "table")
+
+		if err := app.RunCommand(context.Background(), []string{"birthdays", "-dry-run=false"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(q.Tasks) != 2 {
+			t.Errorf("got %d tasks, want 2", len(q.Tasks))
+		}
+	})
+
+	t.Run("rejects an invalid date", func(t *testing.T) {
+		var out bytes.Buffer
+		app, _, _, _ := newApp(&out, "table")
+
+		if err := app.RunCommand(context.Background(), []string{"birthdays", "-date", "tomorrow"}); err == nil {
+			t.Error("expected an error")
+		}
+	})
+}
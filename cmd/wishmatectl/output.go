@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Printer writes results as indented JSON or as an aligned table.
+type Printer struct {
+	w      io.Writer
+	format string
+}
+
+func NewPrinter(w io.Writer, format string) *Printer {
+	return &Printer{w: w, format: format}
+}
+
+// Print writes data as JSON, or the headers and rows as a table.
+func (p *Printer) Print(data interface{}, headers []string, rows [][]string) error {
+	if p.format == "json" {
+		encoder := json.NewEncoder(p.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// Message writes a one line confirmation, wrapped in an object for JSON output.
+func (p *Printer) Message(format string, args ...interface{}) error {
+	message := fmt.Sprintf(format, args...)
+
+	if p.format == "json" {
+		return p.Print(map[string]string{"message": message}, nil, nil)
+	}
+
+	_, err := fmt.Fprintln(p.w, message)
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/reminder"
+	"time"
+)
+
+// recordingQueue keeps every task it is given and forwards them to next, when there is one.
+type recordingQueue struct {
+	next  queue.Queue
+	tasks []queue.TaskPayload
+}
+
+func (q *recordingQueue) Enqueue(taskPayload *queue.TaskPayload) error {
+	q.tasks = append(q.tasks, *taskPayload)
+
+	if q.next == nil {
+		return nil
+	}
+
+	return q.next.Enqueue(taskPayload)
+}
+
+// dryRunStore reads due reminders from the real store but leaves them pending.
+type dryRunStore struct {
+	reminder.Store
+}
+
+func (s dryRunStore) UpdateReminder(ctx context.Context, ID int) error {
+	return nil
+}
+
+func (a *App) RunCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	job, args := args[0], args[1:]
+
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	date := flags.String("date", "", "day to run the job for, as 2006-01-02 (default now)")
+	dryRun := flags.Bool("dry-run", true, "list the tasks the job would enqueue without enqueuing them")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	// a past or future day covers everything due by its end
+	currentTime := time.Now()
+	if *date != "" {
+		day, err := time.ParseInLocation(time.DateOnly, *date, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid date %q: %w", *date, err)
+		}
+		currentTime = day.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	q := &recordingQueue{}
+	var store reminder.Store = dryRunStore{a.Reminders}
+
+	if !*dryRun {
+		next, err := a.NewQueue(ctx)
+		if err != nil {
+			return err
+		}
+		q.next = next
+		store = a.Reminders
+	}
+
+	var err error
+	switch job {
+	case "birthdays":
+		err = reminder.EnqueueBirthdays(ctx, store, q, &currentTime)
+	case "reminders":
+		err = reminder.EnqueueReminders(ctx, store, q, &currentTime)
+	default:
+		return errUsage
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(q.tasks))
+	for _, task := range q.tasks {
+		rows = append(rows, describeTask(task))
+	}
+
+	return a.Out.Print(q.tasks, []string{"TYPE", "RECIPIENT", "TEMPLATE", "TITLE", "LOCALE"}, rows)
+}
+
+func describeTask(task queue.TaskPayload) []string {
+	get := func(key string) string {
+		if value, ok := task.Payload[key]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	if task.Type == queue.TypeEmailDelivery {
+		return []string{task.Type, get("email"), get("template"), get("subject"), get("locale")}
+	}
+
+	return []string{task.Type, "user " + get("user_id"), "", get("title"), ""}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/wishlist"
+	"golang.org/x/crypto/bcrypt"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = []string{"Adedunmola", "Tobi", "Chiamaka", "Femi", "Ngozi", "Kemi", "Emeka", "Zainab", "Camille", "Lucas", "Amelie", "Hugo", "Olivia", "James", "Amara", "Tunde", "Ifeoma", "Bola", "Louis", "Chloe"}
+	lastNames  = []string{"Oyewale", "Adeyemi", "Okafor", "Balogun", "Eze", "Bello", "Martin", "Bernard", "Dubois", "Smith", "Johnson", "Okonkwo", "Adebayo", "Lefebvre", "Williams"}
+	locales    = []string{"en", "en", "fr", "yo"}
+	occasions  = []string{"Birthday list", "Wedding registry", "Graduation", "Christmas", "Housewarming", "Baby shower"}
+	gifts      = []wishlist.Item{
+		{Name: "Noise cancelling headphones", Description: "Over-ear, any colour", Link: "https://example.com/headphones"},
+		{Name: "Cast iron pot", Description: "Big enough for jollof for ten"},
+		{Name: "Kindle", Description: "The paperwhite one", Link: "https://example.com/kindle"},
+		{Name: "Ankara fabric", Description: "Six yards, bright colours"},
+		{Name: "Running shoes", Description: "Size 42"},
+		{Name: "Espresso machine", Description: "Manual is fine", Link: "https://example.com/espresso"},
+		{Name: "Board game", Description: "Something for four players"},
+		{Name: "Plant", Description: "Hard to kill"},
+		{Name: "Cookbook", Description: "West African recipes"},
+		{Name: "Backpack", Description: "Fits a 15 inch laptop"},
+	}
+)
+
+type seedResult struct {
+	Users       int `json:"users"`
+	Friendships int `json:"friendships"`
+	Wishlists   int `json:"wishlists"`
+}
+
+// SeedCommand fills a development database with users, friendships and wishlists.
+// A few users have their birthday today so `run birthdays` has something to show.
+func (a *App) SeedCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := flags.Int("users", 20, "number of users to create")
+	password := flags.String("password", "password123", "password of every seeded user")
+	seed := flags.Uint64("seed", uint64(time.Now().UnixNano()), "random seed, to reproduce a data set")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 || *count < 2 {
+		return errUsage
+	}
+
+	random := rand.New(rand.NewPCG(*seed, *seed))
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*password), 10)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+
+	var result seedResult
+	// usernames are made unique with the run's seed so seeding twice does not conflict
+	suffix := *seed % 10000
+	userIDs := make([]int, 0, *count)
+
+	for i := 0; i < *count; i++ {
+		firstName := firstNames[random.IntN(len(firstNames))]
+		lastName := lastNames[random.IntN(len(lastNames))]
+		username := fmt.Sprintf("%s%d_%d", strings.ToLower(firstName), suffix, i)
+
+		birthday := time.Date(1970+random.IntN(35), time.Month(1+random.IntN(12)), 1+random.IntN(28), 0, 0, 0, 0, time.UTC)
+		if i%5 == 0 {
+			today := time.Now()
+			birthday = time.Date(birthday.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+		}
+
+		user, err := a.Users.CreateUser(ctx, &auth.CreateUserBody{
+			FirstName: firstName,
+			LastName:  lastName,
+			Username:  username,
+			Email:     username + "@example.com",
+			Password:  string(hashedPassword),
+			Locale:    locales[random.IntN(len(locales))],
+		})
+		if err != nil {
+			return fmt.Errorf("error creating user %s: %w", username, err)
+		}
+
+		dateOfBirth := birthday.Format(time.DateOnly)
+		if _, err := a.Users.UpdateUser(ctx, user.ID, auth.UpdateUserBody{Verified: true, DateOfBirth: &dateOfBirth}); err != nil {
+			return fmt.Errorf("error verifying user %s: %w", username, err)
+		}
+
+		userIDs = append(userIDs, user.ID)
+		result.Users++
+	}
+
+	for i, userID := range userIDs {
+		for _, j := range random.Perm(len(userIDs))[:min(3, len(userIDs)-1)] {
+			if j == i {
+				continue
+			}
+
+			friendship, err := a.Friends.CreateFriendship(ctx, userID, userIDs[j])
+			if err != nil {
+				// the other user may have sent a request first
+				continue
+			}
+			result.Friendships++
+
+			// leave some requests pending
+			if random.IntN(4) != 0 {
+				if _, err := a.Friends.UpdateFriendship(ctx, friendship.ID, "accepted"); err != nil {
+					return fmt.Errorf("error accepting friendship %d: %w", friendship.ID, err)
+				}
+			}
+		}
+
+		for n := 1 + random.IntN(2); n > 0; n-- {
+			items := make([]wishlist.Item, 0, 4)
+			for _, k := range random.Perm(len(gifts))[:2+random.IntN(3)] {
+				items = append(items, gifts[k])
+			}
+
+			_, err := a.Wishlists.CreateWishlist(ctx, userID, wishlist.Wishlist{
+				Name:         occasions[random.IntN(len(occasions))],
+				Description:  "Seeded for development",
+				Items:        items,
+				NotifyBefore: 7,
+				Date:         time.Now().AddDate(0, 0, random.IntN(90)).Format(time.DateOnly),
+			})
+			if err != nil {
+				return fmt.Errorf("error creating wishlist for user %d: %w", userID, err)
+			}
+			result.Wishlists++
+		}
+	}
+
+	row := []string{fmt.Sprint(result.Users), fmt.Sprint(result.Friendships), fmt.Sprint(result.Wishlists)}
+
+	return a.Out.Print(result, []string{"USERS", "FRIENDSHIPS", "WISHLISTS"}, [][]string{row})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/friendship"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/reminder"
+	"github.com/Adedunmol/wish-mate/internal/wishlist"
+	"strconv"
+	"time"
+)
+
+type App struct {
+	Users     auth.Store
+	OTPs      auth.OTPStore
+	Friends   friendship.FriendStore
+	Wishlists wishlist.Store
+	Reminders reminder.Store
+	// NewQueue connects to the queue the first time a command enqueues, so the
+	// read-only commands work without Redis.
+	NewQueue func(ctx context.Context) (queue.Queue, error)
+	Out      *Printer
+}
+
+// UserView is a user without the password hash.
+type UserView struct {
+	ID          int        `json:"id"`
+	Username    string     `json:"username"`
+	Email       string     `json:"email"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	DateOfBirth string     `json:"date_of_birth,omitempty"`
+	Locale      string     `json:"locale"`
+	Verified    bool       `json:"verified"`
+	DisabledAt  *time.Time `json:"disabled_at,omitempty"`
+}
+
+func (a *App) UsersCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "get":
+		return a.withUser(ctx, args, nil, func(user auth.User) error {
+			return a.printUser(user)
+		})
+	case "verify":
+		return a.withUser(ctx, args, nil, func(user auth.User) error {
+			user, err := a.Users.UpdateUser(ctx, user.ID, auth.UpdateUserBody{Verified: true})
+			if err != nil {
+				return err
+			}
+			return a.printUser(user)
+		})
+	case "disable":
+		return a.withUser(ctx, args, nil, func(user auth.User) error {
+			user, err := a.Users.DisableUser(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			return a.printUser(user)
+		})
+	case "delete":
+		flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+		yes := flags.Bool("yes", false, "confirm the deletion")
+
+		return a.withUser(ctx, args, flags, func(user auth.User) error {
+			if !*yes {
+				return fmt.Errorf("deleting %s removes their wishlists, friendships and reminders too, pass -yes to confirm", user.Email)
+			}
+
+			if err := a.Users.DeleteUser(ctx, user.ID); err != nil {
+				return err
+			}
+			return a.Out.Message("deleted user %d (%s)", user.ID, user.Email)
+		})
+	case "resend-code":
+		return a.withUser(ctx, args, nil, func(user auth.User) error {
+			if user.Verified {
+				return fmt.Errorf("%s is already verified", user.Email)
+			}
+
+			q, err := a.NewQueue(ctx)
+			if err != nil {
+				return err
+			}
+
+			if err := auth.SendVerificationCode(ctx, a.OTPs, q, user); err != nil {
+				return err
+			}
+			return a.Out.Message("sent a new verification code to %s", user.Email)
+		})
+	case "friendships":
+		flags := flag.NewFlagSet("friendships", flag.ContinueOnError)
+		status := flags.String("status", "all", "accepted, pending, blocked or all")
+
+		return a.withUser(ctx, args, flags, func(user auth.User) error {
+			friendships, err := a.Friends.GetAllFriendships(ctx, user.ID, *status)
+			if err != nil {
+				return err
+			}
+
+			rows := make([][]string, 0, len(friendships))
+			for _, f := range friendships {
+				rows = append(rows, []string{strconv.Itoa(f.ID), strconv.Itoa(f.FriendID), f.Status, formatTime(f.FriendSince)})
+			}
+
+			if friendships == nil {
+				friendships = []friendship.FriendshipResponse{}
+			}
+			return a.Out.Print(friendships, []string{"ID", "FRIEND ID", "STATUS", "FRIEND SINCE"}, rows)
+		})
+	case "wishlists":
+		return a.withUser(ctx, args, nil, func(user auth.User) error {
+			wishlists, err := a.Wishlists.GetUserWishlists(ctx, user.ID, true, policy.Visibilities)
+			if err != nil {
+				return err
+			}
+
+			var rows [][]string
+			for _, w := range wishlists {
+				rows = append(rows, []string{strconv.Itoa(w.ID), w.Name, w.Date, "", ""})
+				for _, item := range w.Items {
+					pickedBy := ""
+					if item.PickedBy.ID != 0 {
+						pickedBy = item.PickedBy.Username
+					}
+					rows = append(rows, []string{"", "", "", item.Name, pickedBy})
+				}
+			}
+
+			if wishlists == nil {
+				wishlists = []wishlist.WishlistResponse{}
+			}
+			return a.Out.Print(wishlists, []string{"ID", "NAME", "DATE", "ITEM", "PICKED BY"}, rows)
+		})
+	default:
+		return errUsage
+	}
+}
+
+// withUser parses the command's flags, when it has any, then looks up the user
+// given as its only argument, by id when numeric and by email otherwise.
+func (a *App) withUser(ctx context.Context, args []string, flags *flag.FlagSet, fn func(user auth.User) error) error {
+	if flags != nil {
+		if err := flags.Parse(args); err != nil {
+			return errUsage
+		}
+		args = flags.Args()
+	}
+
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	var user auth.User
+	var err error
+
+	if id, convErr := strconv.Atoi(args[0]); convErr == nil {
+		user, err = a.Users.FindUserByID(ctx, id)
+	} else {
+		user, err = a.Users.FindUserByEmail(ctx, args[0])
+	}
+
+	if errors.Is(err, helpers.ErrNotFound) {
+		return fmt.Errorf("user %s not found: %w", args[0], err)
+	}
+	if err != nil {
+		return fmt.Errorf("error finding user %s: %w", args[0], err)
+	}
+
+	return fn(user)
+}
+
+func (a *App) printUser(user auth.User) error {
+	view := UserView{
+		ID:          user.ID,
+		Username:    user.Username,
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		DateOfBirth: user.DateOfBirth,
+		Locale:      user.Locale,
+		Verified:    user.Verified,
+		DisabledAt:  user.DisabledAt,
+	}
+
+	row := []string{
+		strconv.Itoa(view.ID), view.Username, view.Email, view.FirstName + " " + view.LastName,
+		view.DateOfBirth, view.Locale, strconv.FormatBool(view.Verified), formatTime(view.DisabledAt),
+	}
+
+	return a.Out.Print(view, []string{"ID", "USERNAME", "EMAIL", "NAME", "BIRTHDAY", "LOCALE", "VERIFIED", "DISABLED AT"}, [][]string{row})
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,211 @@
+package admin
+
+import (
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"net/http"
+	"time"
+)
+
+type Response struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// PoolStater is satisfied by *pgxpool.Pool.
+type PoolStater interface {
+	Stat() *pgxpool.Stat
+}
+
+type Handler struct {
+	Templates *email.Templates
+	Mailer    email.Mailer
+	Pool      PoolStater
+}
+
+func (h *Handler) ListEmailTemplatesHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	data := make([]TemplateResponse, 0)
+
+	for _, name := range h.Templates.Names() {
+		fields, err := h.Templates.Fields(name)
+		if err != nil {
+			helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+			return
+		}
+
+		data = append(data, TemplateResponse{Name: name, Fields: fields, SampleData: email.SampleData[name]})
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Email templates retrieved successfully",
+		Data:    data,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// GetEmailPreviewHandler renders a template with its sample data straight to the
+// browser, as HTML or (with format=text) as plain text.
+func (h *Handler) GetEmailPreviewHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	name := chi.URLParam(request, "name")
+	locale := request.URL.Query().Get("locale")
+
+	preview, err := h.render(name, locale, nil)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if request.URL.Query().Get("format") == "text" {
+		responseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		responseWriter.WriteHeader(http.StatusOK)
+		responseWriter.Write([]byte(preview.Text))
+		return
+	}
+
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusOK)
+	responseWriter.Write([]byte(preview.HTML))
+}
+
+func (h *Handler) PreviewEmailHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*PreviewEmailBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	preview, err := h.render(chi.URLParam(request, "name"), body.Locale, body.Data)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Email rendered successfully",
+		Data:    preview,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+func (h *Handler) SendTestEmailHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*TestEmailBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	name := chi.URLParam(request, "name")
+
+	preview, err := h.render(name, body.Locale, body.Data)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	subject := body.Subject
+	if subject == "" {
+		subject = "[Test] " + name
+	}
+
+	err = h.Mailer.Send(request.Context(), &email.Message{
+		To:      []string{body.To},
+		Subject: subject,
+		HTML:    preview.HTML,
+		Text:    preview.Text,
+	})
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadGateway, "error sending test email", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Test email sent successfully",
+		Data:    preview,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+func (h *Handler) DatabaseStatsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	stat := h.Pool.Stat()
+
+	response := Response{
+		Status:  "Success",
+		Message: "Database pool stats retrieved successfully",
+		Data: PoolStatsResponse{
+			MaxConns:                stat.MaxConns(),
+			TotalConns:              stat.TotalConns(),
+			IdleConns:               stat.IdleConns(),
+			AcquiredConns:           stat.AcquiredConns(),
+			ConstructingConns:       stat.ConstructingConns(),
+			AcquireCount:            stat.AcquireCount(),
+			AcquireDurationMs:       float64(stat.AcquireDuration()) / float64(time.Millisecond),
+			EmptyAcquireCount:       stat.EmptyAcquireCount(),
+			CanceledAcquireCount:    stat.CanceledAcquireCount(),
+			NewConnsCount:           stat.NewConnsCount(),
+			MaxLifetimeDestroyCount: stat.MaxLifetimeDestroyCount(),
+			MaxIdleDestroyCount:     stat.MaxIdleDestroyCount(),
+		},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// render falls back to the template's sample data when none is supplied and
+// rejects data that does not provide every field the template reads.
+func (h *Handler) render(name, locale string, data map[string]interface{}) (PreviewResponse, error) {
+	if data == nil {
+		data = email.SampleData[name]
+	}
+
+	missing, err := h.Templates.MissingFields(name, data)
+	if err != nil {
+		return PreviewResponse{}, helpers.NewHTTPError(err, http.StatusNotFound, "email template not found", nil)
+	}
+
+	if len(missing) != 0 {
+		problems := make(map[string][]string)
+		for _, field := range missing {
+			problems[field] = append(problems[field], "field is required by the template")
+		}
+
+		return PreviewResponse{}, helpers.NewHTTPError(nil, http.StatusBadRequest, "data is missing template fields", problems)
+	}
+
+	locale = i18n.Normalize(locale)
+
+	html, text, err := h.Templates.Render(name, locale, data)
+	if err != nil {
+		return PreviewResponse{}, helpers.NewHTTPError(err, http.StatusBadRequest, "error rendering template", nil)
+	}
+
+	return PreviewResponse{Name: name, Locale: locale, HTML: html, Text: text}, nil
+}
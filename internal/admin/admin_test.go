@@ -0,0 +1,226 @@
+package admin_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/admin"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/templates"
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type StubMailer struct {
+	messages []*email.Message
+	err      error
+}
+
+func (m *StubMailer) Send(ctx context.Context, msg *email.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+func newHandler(t *testing.T, mailer email.Mailer) *admin.Handler {
+	t.Helper()
+
+	mailTemplates, err := email.LoadTemplates(templates.FS)
+	if err != nil {
+		t.Fatalf("error loading templates: %v", err)
+	}
+
+	return &admin.Handler{Templates: mailTemplates, Mailer: mailer}
+}
+
+func TestListEmailTemplates(t *testing.T) {
+	server := newHandler(t, &StubMailer{})
+
+	t.Run("lists every template with its fields", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/admin/emails/templates", nil)
+		response := httptest.NewRecorder()
+
+		server.ListEmailTemplatesHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var got struct {
+			Data []admin.TemplateResponse `json:"data"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		if len(got.Data) != len(email.RequiredTemplates) {
+			t.Fatalf("got %d templates, want %d", len(got.Data), len(email.RequiredTemplates))
+		}
+
+		for _, tmpl := range got.Data {
+			if tmpl.Name == "verification_mail" && strings.Join(tmpl.Fields, ",") != "code,expiration,username" {
+				t.Errorf("verification_mail fields = %v", tmpl.Fields)
+			}
+		}
+	})
+}
+
+func TestPreviewEmail(t *testing.T) {
+	server := newHandler(t, &StubMailer{})
+
+	t.Run("renders the sample data when no data is given", func(t *testing.T) {
+		request := templateRequest(http.MethodPost, "verification_mail", []byte(`{ "locale": "fr" }`))
+		response := httptest.NewRecorder()
+
+		server.PreviewEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var got struct {
+			Data admin.PreviewResponse `json:"data"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		if got.Data.Locale != "fr" || !strings.Contains(got.Data.Text, "482913") || !strings.Contains(got.Data.HTML, "482913") {
+			t.Errorf("unexpected preview: %+v", got.Data)
+		}
+	})
+
+	t.Run("returns problems for missing fields", func(t *testing.T) {
+		request := templateRequest(http.MethodPost, "verification_mail", []byte(`{ "data": { "username": "tobi" } }`))
+		response := httptest.NewRecorder()
+
+		server.PreviewEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+
+		var got map[string]interface{}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		problems, _ := got["problems"].(map[string]interface{})
+		if _, ok := problems["code"]; !ok {
+			t.Errorf("expected a problem for code, got %v", got)
+		}
+		if _, ok := problems["expiration"]; !ok {
+			t.Errorf("expected a problem for expiration, got %v", got)
+		}
+	})
+
+	t.Run("unknown template", func(t *testing.T) {
+		request := templateRequest(http.MethodPost, "missing_mail", []byte(`{}`))
+		response := httptest.NewRecorder()
+
+		server.PreviewEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusNotFound)
+	})
+
+	t.Run("serves the text variant to the browser", func(t *testing.T) {
+		request := templateRequest(http.MethodGet, "welcome_mail", nil)
+		request.URL.RawQuery = "format=text"
+		response := httptest.NewRecorder()
+
+		server.GetEmailPreviewHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if got := response.Header().Get("Content-Type"); got != "text/plain; charset=utf-8" {
+			t.Errorf("content type = %q", got)
+		}
+	})
+}
+
+func TestSendTestEmail(t *testing.T) {
+
+	t.Run("sends the rendered template", func(t *testing.T) {
+		mailer := &StubMailer{}
+		server := newHandler(t, mailer)
+
+		request := templateRequest(http.MethodPost, "welcome_mail", []byte(`{ "to": "ade@gmail.com" }`))
+		response := httptest.NewRecorder()
+
+		server.SendTestEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if len(mailer.messages) != 1 {
+			t.Fatalf("sent %d messages, want 1", len(mailer.messages))
+		}
+
+		msg := mailer.messages[0]
+		if msg.To[0] != "ade@gmail.com" || msg.Subject != "[Test] welcome_mail" || msg.HTML == "" || msg.Text == "" {
+			t.Errorf("unexpected message: %+v", msg)
+		}
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		server := newHandler(t, &StubMailer{})
+
+		request := templateRequest(http.MethodPost, "welcome_mail", []byte(`{ "to": "not-an-email" }`))
+		response := httptest.NewRecorder()
+
+		server.SendTestEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("mailer failure", func(t *testing.T) {
+		server := newHandler(t, &StubMailer{err: errors.New("connection refused")})
+
+		request := templateRequest(http.MethodPost, "welcome_mail", []byte(`{ "to": "ade@gmail.com" }`))
+		response := httptest.NewRecorder()
+
+		server.SendTestEmailHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusBadGateway)
+	})
+}
+
+func TestDatabaseStats(t *testing.T) {
+
+	t.Run("returns the pool stats", func(t *testing.T) {
+		// the pool only dials when a connection is acquired
+		pool, err := pgxpool.New(context.Background(), "postgres://wishmate@127.0.0.1:1/wishmate?pool_max_conns=7")
+		if err != nil {
+			t.Fatalf("error creating pool: %v", err)
+		}
+		defer pool.Close()
+
+		server := &admin.Handler{Pool: pool}
+
+		request, _ := http.NewRequest(http.MethodGet, "/admin/db/stats", nil)
+		response := httptest.NewRecorder()
+
+		server.DatabaseStatsHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var got struct {
+			Data admin.PoolStatsResponse `json:"data"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&got)
+
+		if got.Data.MaxConns != 7 || got.Data.TotalConns != 0 {
+			t.Errorf("unexpected stats: %+v", got.Data)
+		}
+	})
+}
+
+func templateRequest(method, name string, data []byte) *http.Request {
+	request, _ := http.NewRequest(method, "/admin/emails/templates/"+name+"/preview", bytes.NewReader(data))
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("name", name)
+
+	return request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+}
+
+func assertResponseCode(t *testing.T, got, want int) {
+	t.Helper()
+	if got != want {
+		t.Errorf("response code = %d, want %d", got, want)
+	}
+}
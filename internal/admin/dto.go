@@ -0,0 +1,45 @@
+package admin
+
+import "github.com/Adedunmol/wish-mate/internal/helpers"
+
+type PreviewEmailBody struct {
+	helpers.Validation
+	Locale string                 `json:"locale" validate:"omitempty,oneof=en fr yo"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+type TestEmailBody struct {
+	helpers.Validation
+	To      string                 `json:"to" validate:"required,email"`
+	Subject string                 `json:"subject"`
+	Locale  string                 `json:"locale" validate:"omitempty,oneof=en fr yo"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+}
+
+type TemplateResponse struct {
+	Name       string                 `json:"name"`
+	Fields     []string               `json:"fields"`
+	SampleData map[string]interface{} `json:"sample_data"`
+}
+
+type PreviewResponse struct {
+	Name   string `json:"name"`
+	Locale string `json:"locale"`
+	HTML   string `json:"html"`
+	Text   string `json:"text"`
+}
+
+type PoolStatsResponse struct {
+	MaxConns                int32   `json:"max_conns"`
+	TotalConns              int32   `json:"total_conns"`
+	IdleConns               int32   `json:"idle_conns"`
+	AcquiredConns           int32   `json:"acquired_conns"`
+	ConstructingConns       int32   `json:"constructing_conns"`
+	AcquireCount            int64   `json:"acquire_count"`
+	AcquireDurationMs       float64 `json:"acquire_duration_ms"`
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`
+	NewConnsCount           int64   `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`
+}
@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+func AdminRoutes(config config.Config) {
+
+	adminRouter := chi.NewRouter()
+
+	adminRouter.Use(middlewares.AdminMiddleware(config.Settings.AdminAPIKey.Reveal()))
+
+	handler := Handler{Templates: config.Templates, Mailer: config.Mailer, Pool: config.DB}
+
+	adminRouter.Get("/emails/templates", http.HandlerFunc(handler.ListEmailTemplatesHandler))
+	adminRouter.Get("/emails/templates/{name}/preview", http.HandlerFunc(handler.GetEmailPreviewHandler))
+	adminRouter.Post("/emails/templates/{name}/preview", http.HandlerFunc(handler.PreviewEmailHandler))
+	adminRouter.Post("/emails/templates/{name}/test", http.HandlerFunc(handler.SendTestEmailHandler))
+
+	adminRouter.Get("/db/stats", http.HandlerFunc(handler.DatabaseStatsHandler))
+
+	config.Router.Mount("/admin", adminRouter)
+}
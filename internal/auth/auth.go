@@ -1,14 +1,19 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
 	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
 	"golang.org/x/crypto/bcrypt"
-	"log"
+	"log/slog"
 	"net/http"
-	"time"
 )
 
 type Response struct {
@@ -18,9 +23,31 @@ type Response struct {
 }
 
 type Handler struct {
-	Store    Store
-	Queue    queue.Queue
-	OTPStore OTPStore
+	Store          Store
+	Queue          queue.Queue
+	OTPStore       OTPStore
+	TwoFactorStore TwoFactorStore
+	IdentityStore  IdentityStore
+	MagicLinkStore MagicLinkStore
+	// PersonalTokenStore keeps the personal access tokens users create for scripts.
+	PersonalTokenStore PersonalTokenStore
+	// SessionStore keeps the sign ins, which the access tokens belong to.
+	SessionStore SessionStore
+	// Providers are the OpenID Connect providers users may sign in with, by name.
+	Providers map[string]*oidc.Provider
+	// Tokens sign the access tokens.
+	Tokens *helpers.Keys
+	// SecretKey signs the two-factor challenges and the sign in links, which only this
+	// API reads.
+	SecretKey []byte
+	// EncryptionKey seals the TOTP secrets.
+	EncryptionKey []byte
+	Lockout       LockoutPolicy
+	MagicLink     MagicLinkPolicy
+	// AppURL is the address of the client app, the emails link to its pages.
+	AppURL string
+	// Images stores the avatars, none are linked to when nil.
+	Images *media.Images
 }
 
 const OtpExpiration = 30
@@ -51,7 +78,7 @@ func (h *Handler) CreateUserHandler(responseWriter http.ResponseWriter, request
 
 	body.Password = string(hashedPassword)
 
-	data, err := h.Store.CreateUser(body)
+	data, err := h.Store.CreateUser(request.Context(), body)
 	if err != nil {
 		var clientError helpers.ClientError
 		ok := errors.As(err, &clientError)
@@ -71,43 +98,10 @@ func (h *Handler) CreateUserHandler(responseWriter http.ResponseWriter, request
 		Data:    data,
 	}
 
-	code, err := helpers.GenerateSecureOTP(6)
-
-	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
-		return
-	}
-
-	hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), 10)
-
-	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
-		return
-	}
-
-	err = h.OTPStore.CreateOTP(body.Email, fmt.Sprint(hashedCode), OtpExpiration)
-
-	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
-		return
-	}
-
-	err = h.Queue.Enqueue(&queue.TaskPayload{
-		Type: queue.TypeEmailDelivery,
-		Payload: map[string]interface{}{
-			"email":    body.Email,
-			"template": "verification_mail",
-			"subject":  "Verify your email",
-			"data": map[string]interface{}{
-				"username":   body.Username,
-				"code":       code,
-				"expiration": 30 * time.Minute,
-			},
-		},
-	})
-
-	if err != nil {
-		log.Printf("error enqueuing email task: %s", err)
+	// the account exists at this point, `wishmatectl users resend-code` sends another code if this one is not sent
+	user := User{Email: body.Email, Username: body.Username, Locale: body.Locale}
+	if err := SendVerificationCode(request.Context(), h.OTPStore, h.Queue, user); err != nil {
+		slog.ErrorContext(request.Context(), "error sending verification code", "user_id", data.ID, "error", err)
 	}
 
 	helpers.WriteJSONResponse(responseWriter, response, http.StatusCreated)
@@ -129,27 +123,75 @@ func (h *Handler) LoginUserHandler(responseWriter http.ResponseWriter, request *
 		return
 	}
 
-	data, err := h.Store.FindUserByEmail(body.Email)
+	data, err := h.Store.FindUserByEmail(request.Context(), body.Email)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
 
+	// a locked account is refused before its password is checked, so guessing stops
+	if retryAfter := lockedFor(data); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
 	match := h.Store.ComparePasswords(data.Password, body.Password)
 	if !match {
+		if duration := h.recordFailedLogin(request.Context(), data); duration > 0 {
+			refuseLocked(responseWriter, duration)
+			return
+		}
+
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
 
-	token, err := helpers.GenerateToken(data.ID, data.Email, data.Verified)
+	if data.DisabledAt != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusForbidden, "account is disabled", nil))
+		return
+	}
+
+	h.completeLogin(responseWriter, request, data)
+}
+
+// completeLogin logs in a user who proved who they are, or, when they turned 2FA on,
+// returns the challenge to exchange along with their second factor.
+func (h *Handler) completeLogin(responseWriter http.ResponseWriter, request *http.Request, user User) {
+	// the second step, VerifyTwoFactorHandler, issues the access token
+	if user.TwoFactorEnabled {
+		challenge, err := helpers.GenerateChallengeToken(h.SecretKey, user.ID)
+		if err != nil {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+			return
+		}
+
+		response := Response{
+			Status:  "Success",
+			Message: "Two-factor authentication required",
+			Data:    LoginChallengeResponse{TwoFactorRequired: true, ChallengeToken: challenge, Expiration: helpers.ChallengeExpiration},
+		}
+
+		helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+		return
+	}
+
+	h.logIn(responseWriter, request, user)
+}
+
+// logIn starts a session for a user who passed every check.
+func (h *Handler) logIn(responseWriter http.ResponseWriter, request *http.Request, user User) {
+	data, err := h.startSession(request, user)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
 		return
 	}
+
+	h.recordLogin(request, user)
+
 	response := Response{
 		Status:  "Success",
 		Message: "User logged in",
-		Data:    map[string]interface{}{"token": token, "expiration": helpers.TokenExpiration},
+		Data:    data,
 	}
 
 	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
@@ -171,13 +213,13 @@ func (h *Handler) VerifyUserHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	user, err := h.Store.FindUserByEmail(body.Email)
+	user, err := h.Store.FindUserByEmail(request.Context(), body.Email)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrBadRequest)
 		return
 	}
 
-	isValid, err := h.OTPStore.ValidateOTP(body.Email, body.Code)
+	isValid, err := h.OTPStore.ValidateOTP(request.Context(), body.Email, body.Code)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
@@ -192,7 +234,7 @@ func (h *Handler) VerifyUserHandler(responseWriter http.ResponseWriter, request
 		Verified: true,
 	}
 
-	_, err = h.Store.UpdateUser(user.ID, updateBody)
+	_, err = h.Store.UpdateUser(request.Context(), user.ID, updateBody)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
 		return
@@ -208,8 +250,6 @@ func (h *Handler) VerifyUserHandler(responseWriter http.ResponseWriter, request
 
 func (h *Handler) LogoutUserHandler(responseWriter http.ResponseWriter, request *http.Request) {}
 
-func (h *Handler) RefreshTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {}
-
 func (h *Handler) RequestCodeHandler(responseWriter http.ResponseWriter, request *http.Request) {
 	body, problems, err := helpers.DecodeAndValidate[*RequestOTPBody](request)
 
@@ -226,60 +266,77 @@ func (h *Handler) RequestCodeHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	user, err := h.Store.FindUserByEmail(body.Email)
+	user, err := h.Store.FindUserByEmail(request.Context(), body.Email)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrBadRequest)
 		return
 	}
 
-	code, err := helpers.GenerateSecureOTP(6)
-
+	err = SendVerificationCode(request.Context(), h.OTPStore, h.Queue, user)
 	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "error sending code", nil))
 		return
 	}
 
-	hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), 10)
+	response := Response{
+		Status:  "Success",
+		Message: "Code has been sent successfully",
+	}
 
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// SendVerificationCode issues a new one-time code to the user, storing only its hash,
+// and enqueues the verification email carrying it.
+func SendVerificationCode(ctx context.Context, otpStore OTPStore, q queue.Queue, user User) error {
+	code, err := helpers.GenerateSecureOTP(6)
 	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
-		return
+		return fmt.Errorf("error generating code: %w", err)
 	}
 
-	err = h.OTPStore.CreateOTP(user.Email, fmt.Sprint(hashedCode), OtpExpiration)
+	hashedCode, err := bcrypt.GenerateFromPassword([]byte(code), 10)
+	if err != nil {
+		return fmt.Errorf("error hashing code: %w", err)
+	}
 
+	err = otpStore.CreateOTP(ctx, user.Email, string(hashedCode), OtpExpiration)
 	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
-		return
+		return fmt.Errorf("error storing code: %w", err)
 	}
 
-	err = h.Queue.Enqueue(&queue.TaskPayload{
-		Type: queue.TypeEmailDelivery,
+	err = q.Enqueue(&queue.TaskPayload{
+		Type:         queue.TypeEmailDelivery,
+		RequestID:    logging.RequestID(ctx),
+		TraceContext: tracing.Inject(ctx),
 		Payload: map[string]interface{}{
-			"email":    body.Email,
+			"email":    user.Email,
 			"template": "verification_mail",
-			"subject":  "Verify your email",
+			"subject":  i18n.T(user.Locale, i18n.SubjectVerification),
+			"locale":   user.Locale,
 			"data": map[string]interface{}{
 				"username":   user.Username,
 				"code":       code,
-				"expiration": 30 * time.Minute,
+				"expiration": OtpExpiration,
 			},
 		},
 	})
-
 	if err != nil {
-		log.Printf("error enqueuing email task: %s", err)
-	}
-
-	response := Response{
-		Status:  "Success",
-		Message: "Code has been sent successfully",
+		return fmt.Errorf("error enqueuing email task: %w", err)
 	}
 
-	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+	return nil
 }
 
 func (h *Handler) ResetPasswordRequestHandler(responseWriter http.ResponseWriter, request *http.Request) {
 }
 
 func (h *Handler) ResetPasswordHandler(responseWriter http.ResponseWriter, request *http.Request) {}
+
+// JWKSHandler publishes the public keys of the access tokens, for other services to
+// verify them with. A key is published as soon as it is deployed, ahead of the day it
+// starts signing, so verifiers may cache the set for a while.
+func (h *Handler) JWKSHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Cache-Control", "public, max-age=300")
+
+	helpers.WriteJSONResponse(responseWriter, h.Tokens.JWKS(), http.StatusOK)
+}
@@ -2,14 +2,30 @@ package auth_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
+	"github.com/Adedunmol/wish-mate/internal/oidc/oidctest"
 	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/totp"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,6 +35,9 @@ var (
 	ErrNoEntry = errors.New("no entry found")
 )
 
+// tokens sign the access tokens of the handlers under test.
+var tokens = helpers.NewSecretKeys("http://localhost:5000", "wishmate", []byte("0123456789abcdef0123456789abcdef"))
+
 type StubQueue struct {
 	Tasks []queue.TaskPayload
 }
@@ -32,7 +51,7 @@ type StubOtpStore struct {
 	otps []auth.OTP
 }
 
-func (s *StubOtpStore) CreateOTP(email, otp string, expiration int) error {
+func (s *StubOtpStore) CreateOTP(ctx context.Context, email, otp string, expiration int) error {
 	currentTime := time.Now()
 	futureTime := time.Now().Add(10 * time.Minute)
 
@@ -49,7 +68,7 @@ func (s *StubOtpStore) CreateOTP(email, otp string, expiration int) error {
 	return nil
 }
 
-func (s *StubOtpStore) ValidateOTP(email string, otp string) (bool, error) {
+func (s *StubOtpStore) ValidateOTP(ctx context.Context, email string, otp string) (bool, error) {
 
 	for _, otpData := range s.otps {
 		if otpData.Email == email {
@@ -60,21 +79,37 @@ func (s *StubOtpStore) ValidateOTP(email string, otp string) (bool, error) {
 			if otpData.ExpiresAt.Before(time.Now()) {
 				return false, helpers.ErrBadRequest
 			}
+
+			return true, nil
 		}
 	}
 
 	return false, helpers.ErrNotFound
 }
 
-func (s *StubOtpStore) DeleteOTP(email string) error {
+func (s *StubOtpStore) DeleteOTP(ctx context.Context, email string) error {
 	return nil
 }
 
+type FailingStubOtpStore struct {
+	StubOtpStore
+}
+
+func (s *FailingStubOtpStore) CreateOTP(ctx context.Context, email, otp string, expiration int) error {
+	return ErrNoEntry
+}
+
 type StubUserStore struct {
 	users []auth.User
+	// lockouts, unlockTokens and logins hold the columns auth.User leaves out
+	lockouts     map[int]int
+	unlockTokens map[string]int
+	logins       map[int][]string
+	// sessions, when set, are revoked along with a password change
+	sessions *StubSessionStore
 }
 
-func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
+func (s *StubUserStore) CreateUser(ctx context.Context, body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
 
 	for _, u := range s.users {
 		if u.Email == body.Email {
@@ -89,296 +124,2037 @@ func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserRe
 	return auth.CreateUserResponse{ID: userData.ID, FirstName: userData.FirstName, LastName: userData.LastName, Username: userData.Username}, nil
 }
 
-func (s *StubUserStore) FindUserByEmail(email string) (auth.User, error) {
+func (s *StubUserStore) FindUserByEmail(ctx context.Context, email string) (auth.User, error) {
+
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) FindUserByID(ctx context.Context, id int) (auth.User, error) {
+
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) UpdateUser(ctx context.Context, id int, data auth.UpdateUserBody) (auth.User, error) {
+	if data.Username != nil {
+		for _, u := range s.users {
+			if u.ID != id && u.Username == *data.Username {
+				return auth.User{}, helpers.ErrConflict
+			}
+		}
+	}
+
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+
+	for i, u := range s.users {
+		if u.ID == id {
+			set(&s.users[i].FirstName, data.FirstName)
+			set(&s.users[i].LastName, data.LastName)
+			set(&s.users[i].Username, data.Username)
+			set(&s.users[i].DateOfBirth, data.DateOfBirth)
+			set(&s.users[i].Bio, data.Bio)
+			set(&s.users[i].Timezone, data.Timezone)
+			set(&s.users[i].Locale, data.Locale)
+			s.users[i].Verified = u.Verified || data.Verified
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DisableUser(ctx context.Context, id int) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			disabledAt := time.Now()
+			s.users[i].DisabledAt = &disabledAt
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DeleteUser(ctx context.Context, id int) error {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubUserStore) ComparePasswords(storedPassword, candidatePassword string) bool {
+	return storedPassword == candidatePassword
+}
+
+func (s *StubUserStore) ChangePassword(ctx context.Context, id int, password string) error {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].Password = password
+
+			if s.sessions != nil {
+				s.sessions.revokeAll(id)
+			}
+
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubUserStore) SetPendingEmail(ctx context.Context, id int, email string) error {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].PendingEmail = email
+
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubUserStore) ConfirmEmail(ctx context.Context, id int) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id && u.PendingEmail != "" {
+			for _, other := range s.users {
+				if other.Email == u.PendingEmail {
+					return auth.User{}, helpers.ErrConflict
+				}
+			}
+
+			s.users[i].Email, s.users[i].PendingEmail = u.PendingEmail, ""
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) SetAvatar(ctx context.Context, id int, key string) (string, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].AvatarKey = key
+
+			return u.AvatarKey, nil
+		}
+	}
+
+	return "", helpers.ErrNotFound
+}
+
+func (s *StubUserStore) RecordFailedLogin(ctx context.Context, id int) (int, int, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].FailedLogins++
+
+			return s.users[i].FailedLogins, s.lockouts[id], nil
+		}
+	}
+
+	return 0, 0, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error) {
+	if s.lockouts == nil {
+		s.lockouts, s.unlockTokens = map[int]int{}, map[string]int{}
+	}
+
+	for i, u := range s.users {
+		if u.ID == id {
+			if u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+				return false, nil
+			}
+
+			s.users[i].LockedUntil = &until
+			s.users[i].FailedLogins = 0
+			s.lockouts[id]++
+			s.unlockTokens[unlockToken] = id
+
+			return true, nil
+		}
+	}
+
+	return false, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) UnlockUser(ctx context.Context, unlockToken string) (auth.User, error) {
+	id, ok := s.unlockTokens[unlockToken]
+	if !ok {
+		return auth.User{}, helpers.ErrNotFound
+	}
+	delete(s.unlockTokens, unlockToken)
+
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].LockedUntil = nil
+			s.users[i].FailedLogins = 0
+			s.lockouts[id] = 0
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) RecordLogin(ctx context.Context, id int, device, ip string) (auth.LoginSighting, error) {
+	if s.logins == nil {
+		s.logins = map[int][]string{}
+	}
+
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].FailedLogins = 0
+		}
+	}
+
+	previous := s.logins[id]
+	s.logins[id] = append(previous, device, ip)
+
+	if len(previous) == 0 {
+		return auth.LoginSighting{First: true}, nil
+	}
+
+	sighting := auth.LoginSighting{NewDevice: true, NewIP: true}
+	for i := 0; i < len(previous); i += 2 {
+		if previous[i] == device {
+			sighting.NewDevice = false
+		}
+		if previous[i+1] == ip {
+			sighting.NewIP = false
+		}
+	}
+
+	return sighting, nil
+}
+
+// StubTwoFactorStore turns 2FA on and off on the users of its user store.
+type StubTwoFactorStore struct {
+	users         *StubUserStore
+	secrets       map[int]string
+	lastSteps     map[int]int64
+	recoveryCodes map[int]map[string]bool
+}
+
+func NewStubTwoFactorStore(users *StubUserStore) *StubTwoFactorStore {
+	return &StubTwoFactorStore{users: users, secrets: map[int]string{}, lastSteps: map[int]int64{}, recoveryCodes: map[int]map[string]bool{}}
+}
+
+func (s *StubTwoFactorStore) setEnabled(userID int, enabled bool) {
+	for i, u := range s.users.users {
+		if u.ID == userID {
+			s.users.users[i].TwoFactorEnabled = enabled
+		}
+	}
+}
+
+func (s *StubTwoFactorStore) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	user, _ := s.users.FindUserByID(ctx, userID)
+	if user.TwoFactorEnabled {
+		return helpers.ErrConflict
+	}
+
+	s.secrets[userID] = secret
+	delete(s.lastSteps, userID)
+	return nil
+}
+
+func (s *StubTwoFactorStore) GetTOTPSecret(ctx context.Context, userID int) (string, bool, error) {
+	secret, ok := s.secrets[userID]
+	if !ok {
+		return "", false, helpers.ErrNotFound
+	}
+
+	user, _ := s.users.FindUserByID(ctx, userID)
+	return secret, user.TwoFactorEnabled, nil
+}
+
+func (s *StubTwoFactorStore) EnableTwoFactor(ctx context.Context, userID int, recoveryCodes []string) error {
+	s.setEnabled(userID, true)
+	return s.ReplaceRecoveryCodes(ctx, userID, recoveryCodes)
+}
+
+func (s *StubTwoFactorStore) DisableTwoFactor(ctx context.Context, userID int) error {
+	s.setEnabled(userID, false)
+	delete(s.secrets, userID)
+	delete(s.recoveryCodes, userID)
+	return nil
+}
+
+func (s *StubTwoFactorStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	if last, ok := s.lastSteps[userID]; ok && last >= step {
+		return false, nil
+	}
+
+	s.lastSteps[userID] = step
+	return true, nil
+}
+
+func (s *StubTwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, recoveryCode string) (bool, error) {
+	if !s.recoveryCodes[userID][recoveryCode] {
+		return false, nil
+	}
+
+	delete(s.recoveryCodes[userID], recoveryCode)
+	return true, nil
+}
+
+func (s *StubTwoFactorStore) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes []string) error {
+	s.recoveryCodes[userID] = map[string]bool{}
+	for _, code := range recoveryCodes {
+		s.recoveryCodes[userID][code] = true
+	}
+	return nil
+}
+
+// StubIdentityStore links the users of its user store to provider accounts.
+type StubIdentityStore struct {
+	users      *StubUserStore
+	identities map[string]int
+}
+
+func NewStubIdentityStore(users *StubUserStore) *StubIdentityStore {
+	return &StubIdentityStore{users: users, identities: map[string]int{}}
+}
+
+func (s *StubIdentityStore) FindUserByIdentity(ctx context.Context, provider, subject string) (auth.User, error) {
+	userID, ok := s.identities[provider+"/"+subject]
+	if !ok {
+		return auth.User{}, helpers.ErrNotFound
+	}
+
+	return s.users.FindUserByID(ctx, userID)
+}
+
+func (s *StubIdentityStore) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	if _, ok := s.identities[provider+"/"+subject]; ok {
+		return helpers.ErrConflict
+	}
+
+	s.identities[provider+"/"+subject] = userID
+	return nil
+}
+
+func (s *StubIdentityStore) CreateUserWithIdentity(ctx context.Context, body *auth.CreateUserBody, provider, subject string) (auth.User, error) {
+	for _, u := range s.users.users {
+		if u.Email == body.Email || u.Username == body.Username {
+			return auth.User{}, helpers.ErrConflict
+		}
+	}
+
+	user := auth.User{ID: len(s.users.users) + 1, FirstName: body.FirstName, LastName: body.LastName, Username: body.Username, Email: body.Email, Password: body.Password, Locale: body.Locale, Verified: true}
+	s.users.users = append(s.users.users, user)
+	s.identities[provider+"/"+subject] = user.ID
+
+	return user, nil
+}
+
+type StubMagicLinkStore struct {
+	links map[string]stubMagicLink
+}
+
+type stubMagicLink struct {
+	userID    int
+	expiresAt time.Time
+	used      bool
+}
+
+func (s *StubMagicLinkStore) CreateMagicLink(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	if s.links == nil {
+		s.links = map[string]stubMagicLink{}
+	}
+
+	for hash, link := range s.links {
+		if link.userID == userID && !link.used {
+			delete(s.links, hash)
+		}
+	}
+
+	s.links[tokenHash] = stubMagicLink{userID: userID, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *StubMagicLinkStore) UseMagicLink(ctx context.Context, tokenHash string) (int, error) {
+	link, ok := s.links[tokenHash]
+	if !ok || link.used || link.expiresAt.Before(time.Now()) {
+		return 0, helpers.ErrNotFound
+	}
+
+	link.used = true
+	s.links[tokenHash] = link
+
+	return link.userID, nil
+}
+
+type StubPersonalTokenStore struct {
+	tokens map[string]stubPersonalToken
+}
+
+type stubPersonalToken struct {
+	userID int
+	token  auth.PersonalToken
+}
+
+func (s *StubPersonalTokenStore) CreatePersonalToken(ctx context.Context, userID int, name, tokenHash, hint string, scopes []string, expiresAt time.Time) (auth.PersonalToken, error) {
+	if s.tokens == nil {
+		s.tokens = map[string]stubPersonalToken{}
+	}
+
+	token := auth.PersonalToken{ID: len(s.tokens) + 1, Name: name, Hint: hint, Scopes: scopes, ExpiresAt: expiresAt, CreatedAt: time.Now()}
+	s.tokens[tokenHash] = stubPersonalToken{userID: userID, token: token}
+
+	return token, nil
+}
+
+func (s *StubPersonalTokenStore) ListPersonalTokens(ctx context.Context, userID int) ([]auth.PersonalToken, error) {
+	tokens := make([]auth.PersonalToken, 0)
+	for _, t := range s.tokens {
+		if t.userID == userID {
+			tokens = append(tokens, t.token)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (s *StubPersonalTokenStore) RevokePersonalToken(ctx context.Context, userID, tokenID int) error {
+	for hash, t := range s.tokens {
+		if t.userID == userID && t.token.ID == tokenID {
+			delete(s.tokens, hash)
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubPersonalTokenStore) UsePersonalToken(ctx context.Context, tokenHash string) (helpers.Principal, error) {
+	t, ok := s.tokens[tokenHash]
+	if !ok || t.token.ExpiresAt.Before(time.Now()) {
+		return helpers.Principal{}, helpers.ErrNotFound
+	}
+
+	now := time.Now()
+	t.token.LastUsedAt = &now
+	s.tokens[tokenHash] = t
+
+	return helpers.Principal{UserID: t.userID, Verified: true, Scopes: t.token.Scopes}, nil
+}
+
+// ScopelessPersonalTokenStore finds every token, with its scopes read as NULL.
+type ScopelessPersonalTokenStore struct {
+	StubPersonalTokenStore
+}
+
+func (s *ScopelessPersonalTokenStore) UsePersonalToken(ctx context.Context, tokenHash string) (helpers.Principal, error) {
+	return helpers.Principal{UserID: 1, Verified: true}, nil
+}
+
+type StubSessionStore struct {
+	sessions []stubSession
+}
+
+type stubSession struct {
+	session          auth.Session
+	refreshTokenHash string
+	revoked          bool
+}
+
+func (s *StubSessionStore) CreateSession(ctx context.Context, userID int, refreshTokenHash, userAgent, ip string, expiresAt time.Time) (auth.Session, error) {
+	now := time.Now()
+	session := auth.Session{ID: len(s.sessions) + 1, UserID: userID, UserAgent: userAgent, IP: ip, CreatedAt: now, LastSeenAt: now, ExpiresAt: expiresAt}
+
+	s.sessions = append(s.sessions, stubSession{session: session, refreshTokenHash: refreshTokenHash})
+
+	return session, nil
+}
+
+func (s *StubSessionStore) RefreshSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash, ip string, expiresAt time.Time) (auth.Session, error) {
+	for i, session := range s.sessions {
+		if session.refreshTokenHash == refreshTokenHash && !session.revoked {
+			s.sessions[i].refreshTokenHash = newRefreshTokenHash
+			s.sessions[i].session.IP = ip
+			s.sessions[i].session.ExpiresAt = expiresAt
+
+			return s.sessions[i].session, nil
+		}
+	}
+
+	return auth.Session{}, helpers.ErrNotFound
+}
+
+func (s *StubSessionStore) TouchSession(ctx context.Context, sessionID, userID int) error {
+	for _, session := range s.sessions {
+		if session.session.ID == sessionID && session.session.UserID == userID && !session.revoked {
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubSessionStore) ListSessions(ctx context.Context, userID int) ([]auth.Session, error) {
+	sessions := make([]auth.Session, 0)
+	for _, session := range s.sessions {
+		if session.session.UserID == userID && !session.revoked {
+			sessions = append(sessions, session.session)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *StubSessionStore) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	for i, session := range s.sessions {
+		if session.session.ID == sessionID && session.session.UserID == userID && !session.revoked {
+			s.sessions[i].revoked = true
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
+func (s *StubSessionStore) RevokeOtherSessions(ctx context.Context, userID, keepSessionID int) (int, error) {
+	revoked := 0
+	for i, session := range s.sessions {
+		if session.session.UserID == userID && session.session.ID != keepSessionID && !session.revoked {
+			s.sessions[i].revoked = true
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+func (s *StubSessionStore) revokeAll(userID int) {
+	for i, session := range s.sessions {
+		if session.session.UserID == userID {
+			s.sessions[i].revoked = true
+		}
+	}
+}
+
+type FailingStubUserStore struct {
+	users []auth.User
+}
+
+func (s *FailingStubUserStore) CreateUser(ctx context.Context, _ *auth.CreateUserBody) (auth.CreateUserResponse, error) {
+
+	return auth.CreateUserResponse{}, ErrCreate
+}
+
+func (s *FailingStubUserStore) FindUserByEmail(ctx context.Context, _ string) (auth.User, error) {
+	return auth.User{}, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) FindUserByID(ctx context.Context, id int) (auth.User, error) {
+
+	for _, u := range s.users {
+		if u.ID == id {
+			return u, nil
+		}
+	}
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *FailingStubUserStore) UpdateUser(ctx context.Context, id int, data auth.UpdateUserBody) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].Verified = data.Verified
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *FailingStubUserStore) DisableUser(ctx context.Context, id int) (auth.User, error) {
+	return auth.User{}, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) DeleteUser(ctx context.Context, id int) error {
+	return ErrNoEntry
+}
+
+func (s *FailingStubUserStore) ComparePasswords(_, _ string) bool {
+	return false
+}
+
+func (s *FailingStubUserStore) ChangePassword(ctx context.Context, id int, password string) error {
+	return ErrNoEntry
+}
+
+func (s *FailingStubUserStore) SetPendingEmail(ctx context.Context, id int, email string) error {
+	return ErrNoEntry
+}
+
+func (s *FailingStubUserStore) ConfirmEmail(ctx context.Context, id int) (auth.User, error) {
+	return auth.User{}, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) SetAvatar(ctx context.Context, id int, key string) (string, error) {
+	return "", ErrNoEntry
+}
+
+func (s *FailingStubUserStore) RecordFailedLogin(ctx context.Context, id int) (int, int, error) {
+	return 0, 0, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error) {
+	return false, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) UnlockUser(ctx context.Context, unlockToken string) (auth.User, error) {
+	return auth.User{}, ErrNoEntry
+}
+
+func (s *FailingStubUserStore) RecordLogin(ctx context.Context, id int, device, ip string) (auth.LoginSighting, error) {
+	return auth.LoginSighting{}, ErrNoEntry
+}
+
+func TestPOSTUser(t *testing.T) {
+
+	t.Run("create and send a auth back", func(t *testing.T) {
+		store := StubUserStore{users: make([]auth.User, 0)}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &StubOtpStore{}}
+
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"status":  "Success",
+			"message": "User created successfully",
+			"data": map[string]interface{}{
+				"id":         float64(1),
+				"first_name": "Adedunmola",
+				"last_name":  "Oyewale",
+				"username":   "Adedunmola",
+			},
+		}
+
+		assertResponseCode(t, response.Code, http.StatusCreated)
+		assertResponseBody(t, got, want)
+
+		if len(store.users) != 1 {
+			t.Errorf("got %d users, want 1", len(store.users))
+		}
+
+		if len(mockQueue.Tasks) != 1 {
+			t.Errorf("got %d tasks, want 1", len(mockQueue.Tasks))
+		}
+	})
+
+	t.Run("carries the request id into the email task", func(t *testing.T) {
+		store := StubUserStore{users: make([]auth.User, 0)}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &StubOtpStore{}}
+
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+
+		request := createUserRequest(data)
+		request = request.WithContext(logging.WithRequestID(request.Context(), "abc123"))
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusCreated)
+
+		if len(mockQueue.Tasks) != 1 || mockQueue.Tasks[0].RequestID != "abc123" {
+			t.Errorf("got tasks %+v, want one carrying request id %q", mockQueue.Tasks, "abc123")
+		}
+	})
+
+	t.Run("fails in creating auth", func(t *testing.T) {
+		store := FailingStubUserStore{users: make([]auth.User, 0)}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &StubOtpStore{}}
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		//want := map[string]interface{}{}
+
+		assertResponseCode(t, response.Code, http.StatusInternalServerError)
+
+		//assertResponseBody(t, got, want)
+	})
+
+	t.Run("creates the user when the verification code cannot be stored", func(t *testing.T) {
+		store := StubUserStore{users: make([]auth.User, 0)}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &FailingStubOtpStore{}}
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		// a retry would conflict with the account already created
+		assertResponseCode(t, response.Code, http.StatusCreated)
+
+		if len(store.users) != 1 {
+			t.Errorf("got %d users, want the one created", len(store.users))
+		}
+
+		if len(mockQueue.Tasks) != 0 {
+			t.Errorf("got %d tasks, want none", len(mockQueue.Tasks))
+		}
+	})
+
+	t.Run("returns error for invalid request body", func(t *testing.T) {
+		store := FailingStubUserStore{users: make([]auth.User, 0)}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &StubOtpStore{}}
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		wantBody := map[string]interface{}{
+			"message": "invalid request body",
+			"problems": map[string][]string{
+				"Email":    []string{"Email required"},
+				"Password": []string{"Password required"},
+			},
+		}
+
+		wantJSON, _ := json.Marshal(wantBody)
+
+		var want map[string]interface{}
+		_ = json.Unmarshal(wantJSON, &want)
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+		assertResponseBody(t, got, want)
+
+		if len(mockQueue.Tasks) == 1 {
+			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+		}
+	})
+
+	t.Run("email conflict", func(t *testing.T) {
+		store := StubUserStore{users: []auth.User{
+			{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
+		}}
+		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+
+		server := &auth.Handler{Store: &store, Queue: &mockQueue, OTPStore: &StubOtpStore{}}
+
+		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.CreateUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "resource already exists",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusConflict)
+		assertResponseBody(t, got, want)
+
+		if len(mockQueue.Tasks) == 1 {
+			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+		}
+	})
+}
+
+func TestPOSTLogin(t *testing.T) {
+	disabledAt := time.Now()
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
+		{ID: 2, FirstName: "Tobi", LastName: "Adeyemi", Password: "password", Email: "tobi@gmail.com", Username: "Tobi", DisabledAt: &disabledAt},
+	}}
+	server := &auth.Handler{Store: &store, SessionStore: &StubSessionStore{}, Tokens: tokens}
+
+	t.Run("find and log in a auth", func(t *testing.T) {
+
+		data := []byte(`{ "email": "adedunmola@gmail.com", "password": "password" }`)
+
+		request := loginUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+	})
+
+	t.Run("returns error for invalid request body", func(t *testing.T) {
+		store := FailingStubUserStore{users: make([]auth.User, 0)}
+		server := &auth.Handler{Store: &store, SessionStore: &StubSessionStore{}, Tokens: tokens}
+		data := []byte(`{ "password": "password" }`)
+
+		request := createUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		wantBody := map[string]interface{}{
+			"message": "invalid request body",
+			"problems": map[string][]string{
+				"Email": []string{"Email required"},
+			},
+		}
+
+		wantJSON, _ := json.Marshal(wantBody)
+
+		var want map[string]interface{}
+		_ = json.Unmarshal(wantJSON, &want)
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+		assertResponseBody(t, got, want)
+
+	})
+
+	t.Run("does not find a auth", func(t *testing.T) {
+		data := []byte(`{ "email": "adedunmola1@gmail.com", "password": "password123" }`)
+
+		request := loginUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "invalid credentials",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusUnauthorized)
+		assertResponseBody(t, got, want)
+	})
+
+	t.Run("incorrect password", func(t *testing.T) {
+
+		data := []byte(`{ "email": "adedunmola@gmail.com", "password": "password123" }`)
+
+		request := loginUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "invalid credentials",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusUnauthorized)
+		assertResponseBody(t, got, want)
+	})
+
+	t.Run("refuses a disabled account", func(t *testing.T) {
+
+		data := []byte(`{ "email": "tobi@gmail.com", "password": "password" }`)
+
+		request := loginUserRequest(data)
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "account is disabled",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusForbidden)
+		assertResponseBody(t, got, want)
+	})
+}
+
+func TestLockout(t *testing.T) {
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
+	}}
+	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+	server := &auth.Handler{
+		Store:        &store,
+		Queue:        &mockQueue,
+		SessionStore: &StubSessionStore{},
+		Tokens:       tokens,
+		Lockout:      auth.LockoutPolicy{MaxFailures: 3, Duration: time.Minute, MaxDuration: time.Hour},
+		AppURL:       "https://wishmate.app/",
+	}
+
+	login := func(password string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.LoginUserHandler(response, loginUserRequest([]byte(`{ "email": "adedunmola@gmail.com", "password": "`+password+`" }`)))
+		return response
+	}
+
+	var unlockURL string
+
+	t.Run("locks the account after too many failures", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			assertResponseCode(t, login("password123").Code, http.StatusUnauthorized)
+		}
+
+		response := login("password123")
+
+		assertResponseCode(t, response.Code, http.StatusLocked)
+		if got := response.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("Retry-After = %q, want 60", got)
+		}
+
+		if len(mockQueue.Tasks) != 1 || mockQueue.Tasks[0].Payload["template"] != "lockout_mail" {
+			t.Fatalf("got tasks %+v, want the lockout alert", mockQueue.Tasks)
+		}
+
+		data := mockQueue.Tasks[0].Payload["data"].(map[string]interface{})
+		unlockURL = data["unlock_url"].(string)
+		if !strings.HasPrefix(unlockURL, "https://wishmate.app/unlock?token=") {
+			t.Errorf("unlock url = %q, want a link to the app", unlockURL)
+		}
+	})
+
+	t.Run("refuses the right password while locked", func(t *testing.T) {
+		assertResponseCode(t, login("password").Code, http.StatusLocked)
+	})
+
+	t.Run("refuses an unknown unlock token", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.UnlockUserHandler(response, unlockUserRequest("not-the-token"))
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("unlocks with the emailed token", func(t *testing.T) {
+		link, err := url.Parse(unlockURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		response := httptest.NewRecorder()
+		server.UnlockUserHandler(response, unlockUserRequest(link.Query().Get("token")))
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+		assertResponseCode(t, login("password").Code, http.StatusOK)
+	})
+
+	t.Run("the token is single use", func(t *testing.T) {
+		link, _ := url.Parse(unlockURL)
+
+		response := httptest.NewRecorder()
+		server.UnlockUserHandler(response, unlockUserRequest(link.Query().Get("token")))
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+	})
+}
+
+func TestLockDuration(t *testing.T) {
+	policy := auth.LockoutPolicy{MaxFailures: 5, Duration: 15 * time.Minute, MaxDuration: 2 * time.Hour}
+
+	cases := map[int]time.Duration{
+		0:   15 * time.Minute,
+		1:   30 * time.Minute,
+		2:   time.Hour,
+		3:   2 * time.Hour,
+		100: 2 * time.Hour,
+	}
+
+	for lockouts, want := range cases {
+		if got := policy.LockDuration(lockouts); got != want {
+			t.Errorf("LockDuration(%d) = %s, want %s", lockouts, got, want)
+		}
+	}
+}
+
+func TestNewLoginAlert(t *testing.T) {
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
+	}}
+	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+	server := &auth.Handler{Store: &store, Queue: &mockQueue, SessionStore: &StubSessionStore{}, Tokens: tokens}
+
+	login := func(userAgent, remoteAddr string) {
+		t.Helper()
+
+		request := loginUserRequest([]byte(`{ "email": "adedunmola@gmail.com", "password": "password" }`))
+		request.Header.Set("User-Agent", userAgent)
+		request.RemoteAddr = remoteAddr
+		response := httptest.NewRecorder()
+
+		server.LoginUserHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+	}
+
+	t.Run("does not alert on the first login", func(t *testing.T) {
+		login("Firefox", "102.89.34.12:5000")
+
+		if len(mockQueue.Tasks) != 0 {
+			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+		}
+	})
+
+	t.Run("does not alert on a known device and address", func(t *testing.T) {
+		login("Firefox", "102.89.34.12:6000")
+
+		if len(mockQueue.Tasks) != 0 {
+			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+		}
+	})
+
+	t.Run("alerts on a new address", func(t *testing.T) {
+		login("Firefox", "41.58.1.1:5000")
+
+		if len(mockQueue.Tasks) != 1 || mockQueue.Tasks[0].Payload["template"] != "new_login_mail" {
+			t.Fatalf("got tasks %+v, want the new login alert", mockQueue.Tasks)
+		}
+
+		data := mockQueue.Tasks[0].Payload["data"].(map[string]interface{})
+		if data["ip"] != "41.58.1.1" || data["device"] != "Firefox" || data["username"] != "Adedunmola" {
+			t.Errorf("alert data = %v", data)
+		}
+	})
+}
+
+func TestTwoFactor(t *testing.T) {
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", Verified: true},
+	}}
+	twoFactorStore := NewStubTwoFactorStore(&store)
+	server := &auth.Handler{
+		Store:          &store,
+		Queue:          &StubQueue{},
+		TwoFactorStore: twoFactorStore,
+		SessionStore:   &StubSessionStore{},
+		Tokens:         tokens,
+		SecretKey:      []byte("0123456789abcdef0123456789abcdef"),
+		EncryptionKey:  []byte("fedcba9876543210fedcba9876543210"),
+	}
+
+	// authenticated sends a request as the user AuthMiddleware let through
+	authenticated := func(handler http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(http.MethodPost, "/auth/2fa", strings.NewReader(body))
+		request = request.WithContext(helpers.WithPrincipal(request.Context(), helpers.Principal{UserID: 1, Email: "adedunmola@gmail.com", Verified: true}))
+		response := httptest.NewRecorder()
+
+		handler(response, request)
+
+		return response
+	}
+
+	decode := func(t *testing.T, response *httptest.ResponseRecorder, data interface{}) {
+		t.Helper()
+
+		if err := json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: data}); err != nil {
+			t.Fatalf("error decoding %s: %v", response.Body.String(), err)
+		}
+	}
+
+	login := func() *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.LoginUserHandler(response, loginUserRequest([]byte(`{ "email": "adedunmola@gmail.com", "password": "password" }`)))
+		return response
+	}
+
+	verify := func(challenge, code string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		body := `{ "challenge_token": "` + challenge + `", "code": "` + code + `" }`
+		server.VerifyTwoFactorHandler(response, loginUserRequest([]byte(body)))
+		return response
+	}
+
+	var enrollment auth.TwoFactorEnrollmentResponse
+	var recovery auth.RecoveryCodesResponse
+
+	t.Run("enrolls and returns the secret", func(t *testing.T) {
+		response := authenticated(server.EnrollTwoFactorHandler, "")
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+		decode(t, response, &enrollment)
+
+		if enrollment.Secret == "" || !strings.HasPrefix(enrollment.URI, "otpauth://totp/Wishmate:") {
+			t.Errorf("enrollment = %+v, want a secret and an otpauth uri", enrollment)
+		}
+
+		if stored := twoFactorStore.secrets[1]; stored == "" || stored == enrollment.Secret {
+			t.Errorf("stored secret = %q, want it encrypted", stored)
+		}
+	})
+
+	t.Run("refuses a wrong confirmation code", func(t *testing.T) {
+		response := authenticated(server.ConfirmTwoFactorHandler, `{ "code": "000000" }`)
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+	})
+
+	t.Run("confirms with a first code and returns the recovery codes", func(t *testing.T) {
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+		response := authenticated(server.ConfirmTwoFactorHandler, `{ "code": "`+code+`" }`)
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+		decode(t, response, &recovery)
+
+		if len(recovery.RecoveryCodes) != auth.RecoveryCodeCount {
+			t.Errorf("got %d recovery codes, want %d", len(recovery.RecoveryCodes), auth.RecoveryCodeCount)
+		}
+	})
+
+	var challenge auth.LoginChallengeResponse
+
+	t.Run("login asks for the second factor", func(t *testing.T) {
+		response := login()
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+		decode(t, response, &challenge)
+
+		if !challenge.TwoFactorRequired || challenge.ChallengeToken == "" {
+			t.Errorf("login data = %+v, want a challenge", challenge)
+		}
+
+		if strings.Contains(response.Body.String(), `"token"`) {
+			t.Errorf("login issued an access token before the second factor: %s", response.Body.String())
+		}
+	})
+
+	t.Run("refuses the challenge as an access token", func(t *testing.T) {
+		if _, err := helpers.DecodeToken(tokens, challenge.ChallengeToken); err == nil {
+			t.Error("the challenge token decoded as an access token")
+		}
+	})
+
+	t.Run("refuses the code used to confirm", func(t *testing.T) {
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+
+		assertResponseCode(t, verify(challenge.ChallengeToken, code).Code, http.StatusUnauthorized)
+	})
+
+	t.Run("accepts a recovery code once", func(t *testing.T) {
+		code := strings.ToUpper(recovery.RecoveryCodes[0])
+
+		response := verify(challenge.ChallengeToken, code)
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var data map[string]interface{}
+		decode(t, response, &data)
+		if _, err := helpers.DecodeToken(tokens, data["token"].(string)); err != nil {
+			t.Errorf("the access token does not decode: %v", err)
+		}
+
+		assertResponseCode(t, verify(challenge.ChallengeToken, code).Code, http.StatusUnauthorized)
+	})
+
+	t.Run("regenerates the recovery codes after reauthenticating", func(t *testing.T) {
+		code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now())+1)
+
+		response := authenticated(server.RegenerateRecoveryCodesHandler, `{ "password": "wrong", "code": "`+code+`" }`)
+		assertResponseCode(t, response.Code, http.StatusUnauthorized)
+
+		response = authenticated(server.RegenerateRecoveryCodesHandler, `{ "password": "password", "code": "`+code+`" }`)
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		previous := recovery.RecoveryCodes[1]
+		decode(t, response, &recovery)
+
+		assertResponseCode(t, verify(challenge.ChallengeToken, previous).Code, http.StatusUnauthorized)
+	})
+
+	t.Run("disables after reauthenticating", func(t *testing.T) {
+		response := authenticated(server.DisableTwoFactorHandler, `{ "password": "password", "code": "`+recovery.RecoveryCodes[0]+`" }`)
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var data map[string]interface{}
+		response = login()
+		decode(t, response, &data)
+
+		if _, ok := data["token"]; !ok {
+			t.Errorf("login data = %v, want the access token", data)
+		}
+	})
+}
+
+func TestOIDC(t *testing.T) {
+	provider, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+
+	lockedUntil := time.Now().Add(time.Minute)
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", Verified: true},
+		{ID: 2, FirstName: "Unverified", LastName: "User", Password: "password", Email: "unverified@gmail.com", Username: "unverified"},
+		{ID: 3, FirstName: "Second", LastName: "Factor", Password: "password", Email: "2fa@gmail.com", Username: "2fa", Verified: true, TwoFactorEnabled: true},
+		{ID: 4, FirstName: "Locked", LastName: "Out", Password: "password", Email: "locked@gmail.com", Username: "locked", Verified: true, LockedUntil: &lockedUntil},
+	}}
+	identityStore := NewStubIdentityStore(&store)
+	server := &auth.Handler{
+		Store:         &store,
+		Queue:         &StubQueue{},
+		IdentityStore: identityStore,
+		SessionStore:  &StubSessionStore{},
+		Providers: map[string]*oidc.Provider{
+			"test": oidc.NewProvider(provider.Config("test", "http://localhost:5000/auth/oidc/test/callback"), nil),
+		},
+		Tokens:        tokens,
+		SecretKey:     []byte("0123456789abcdef0123456789abcdef"),
+		EncryptionKey: []byte("fedcba9876543210fedcba9876543210"),
+	}
+
+	router := chi.NewRouter()
+	router.Get("/auth/oidc/{provider}/login", server.OIDCLoginHandler)
+	router.Get("/auth/oidc/{provider}/callback", server.OIDCCallbackHandler)
+
+	// start sends the user to the provider, returning where to and the flow cookie
+	start := func(t *testing.T, name string) (string, *http.Cookie) {
+		t.Helper()
+
+		request, _ := http.NewRequest(http.MethodGet, "/auth/oidc/"+name+"/login", nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusFound)
+
+		cookies := response.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly {
+			t.Fatalf("cookies = %v, want the http-only flow cookie", cookies)
+		}
+
+		return response.Header().Get("Location"), cookies[0]
+	}
+
+	callback := func(code, state string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		query := url.Values{"code": {code}, "state": {state}}
+		request, _ := http.NewRequest(http.MethodGet, "/auth/oidc/test/callback?"+query.Encode(), nil)
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+		return response
+	}
+
+	signIn := func(t *testing.T, identity oidctest.Identity) *httptest.ResponseRecorder {
+		t.Helper()
+
+		location, cookie := start(t, "test")
+
+		code, state, err := provider.Authorize(location, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return callback(code, state, cookie)
+	}
+
+	// loggedIn returns the user of the access token in the response
+	loggedIn := func(t *testing.T, response *httptest.ResponseRecorder) int {
+		t.Helper()
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var data struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &data}); err != nil {
+			t.Fatalf("error decoding %s: %v", response.Body.String(), err)
+		}
+
+		claims, err := helpers.DecodeToken(tokens, data.Token)
+		if err != nil {
+			t.Fatalf("error decoding token: %v", err)
+		}
+
+		return claims["user_id"].(int)
+	}
+
+	t.Run("creates a verified user for a new email", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "new", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"})
+
+		userID := loggedIn(t, response)
+
+		user, _ := store.FindUserByID(context.Background(), userID)
+		if user.Email != "ada@example.com" || !user.Verified || user.FirstName != "Ada" || !strings.HasPrefix(user.Username, "ada-") {
+			t.Errorf("user = %+v, want a verified user named after the provider's account", user)
+		}
+
+		if again := loggedIn(t, signIn(t, oidctest.Identity{Subject: "new", Email: "ada@example.com", EmailVerified: true})); again != userID {
+			t.Errorf("signed in again as user %d, want %d", again, userID)
+		}
+	})
+
+	t.Run("links an existing user by verified email", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "existing", Email: "adedunmola@gmail.com", EmailVerified: true})
+
+		if userID := loggedIn(t, response); userID != 1 {
+			t.Errorf("signed in as user %d, want 1", userID)
+		}
+
+		if identityStore.identities["test/existing"] != 1 {
+			t.Errorf("identities = %v, want the account linked to user 1", identityStore.identities)
+		}
+	})
+
+	t.Run("refuses an email the provider has not verified", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "unverified-email", Email: "adedunmola@gmail.com"})
+
+		assertResponseCode(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("refuses to link an unverified account", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "squatted", Email: "unverified@gmail.com", EmailVerified: true})
+
+		assertResponseCode(t, response.Code, http.StatusConflict)
+	})
+
+	t.Run("asks for the second factor", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "2fa", Email: "2fa@gmail.com", EmailVerified: true})
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var challenge auth.LoginChallengeResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &challenge}); err != nil || !challenge.TwoFactorRequired {
+			t.Errorf("got %s, want a two-factor challenge", response.Body.String())
+		}
+	})
+
+	t.Run("refuses a locked account", func(t *testing.T) {
+		response := signIn(t, oidctest.Identity{Subject: "locked", Email: "locked@gmail.com", EmailVerified: true})
+
+		assertResponseCode(t, response.Code, http.StatusLocked)
+		if got := response.Header().Get("Retry-After"); got != "60" {
+			t.Errorf("Retry-After = %q, want 60", got)
+		}
+	})
+
+	t.Run("refuses a wrong state", func(t *testing.T) {
+		location, cookie := start(t, "test")
+		code, _, _ := provider.Authorize(location, oidctest.Identity{Subject: "new", Email: "ada@example.com", EmailVerified: true})
+
+		assertResponseCode(t, callback(code, "forged", cookie).Code, http.StatusBadRequest)
+	})
+
+	t.Run("refuses a callback without the flow cookie", func(t *testing.T) {
+		location, _ := start(t, "test")
+		code, state, _ := provider.Authorize(location, oidctest.Identity{Subject: "new", Email: "ada@example.com", EmailVerified: true})
+
+		assertResponseCode(t, callback(code, state, nil).Code, http.StatusBadRequest)
+	})
+
+	t.Run("refuses a token the provider did not sign for this flow", func(t *testing.T) {
+		provider.Claims = func(claims jwt.MapClaims) { claims["nonce"] = "replayed" }
+		defer func() { provider.Claims = nil }()
+
+		response := signIn(t, oidctest.Identity{Subject: "new", Email: "ada@example.com", EmailVerified: true})
+
+		assertResponseCode(t, response.Code, http.StatusUnauthorized)
+	})
+
+	t.Run("refuses an unknown provider", func(t *testing.T) {
+		request, _ := http.NewRequest(http.MethodGet, "/auth/oidc/unknown/login", nil)
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusNotFound)
+	})
+}
+
+func TestMagicLink(t *testing.T) {
+	newServer := func(policy auth.MagicLinkPolicy) (*auth.Handler, *StubUserStore, *StubQueue) {
+		store := &StubUserStore{users: []auth.User{
+			{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", Verified: true},
+			{ID: 2, FirstName: "Unverified", LastName: "User", Password: "password", Email: "unverified@gmail.com", Username: "unverified"},
+		}}
+		q := &StubQueue{}
+
+		policy.TTL = 15 * time.Minute
+
+		return &auth.Handler{
+			Store:          store,
+			Queue:          q,
+			MagicLinkStore: &StubMagicLinkStore{},
+			SessionStore:   &StubSessionStore{},
+			Tokens:         tokens,
+			SecretKey:      []byte("0123456789abcdef0123456789abcdef"),
+			AppURL:         "https://wishmate.app",
+			MagicLink:      policy,
+		}, store, q
+	}
+
+	request := func(server *auth.Handler, email string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.RequestMagicLinkHandler(response, magicLinkRequest([]byte(`{ "email": "`+email+`" }`)))
+		return response
+	}
+
+	verify := func(server *auth.Handler, token, userAgent string) *httptest.ResponseRecorder {
+		r, _ := http.NewRequest(http.MethodPost, "/auth/magic-link/verify", strings.NewReader(`{ "token": "`+token+`" }`))
+		r.Header.Set("User-Agent", userAgent)
+		r.RemoteAddr = "102.89.34.12:4000"
+		response := httptest.NewRecorder()
+		server.VerifyMagicLinkHandler(response, r)
+		return response
+	}
+
+	// emailedToken is the token of the link in the last email
+	emailedToken := func(t *testing.T, q *StubQueue) string {
+		t.Helper()
+
+		if len(q.Tasks) == 0 {
+			t.Fatal("no email was enqueued")
+		}
+
+		payload := q.Tasks[len(q.Tasks)-1].Payload
+		if payload["template"] != "magic_link_mail" || payload["subject"] != "Your Wishmate sign in link" {
+			t.Fatalf("payload = %v, want the magic link email", payload)
+		}
+
+		link, err := url.Parse(payload["data"].(map[string]interface{})["link"].(string))
+		if err != nil || link.Host != "wishmate.app" || link.Path != "/magic-link" {
+			t.Fatalf("link = %v, want one to the app", link)
+		}
+
+		return link.Query().Get("token")
+	}
+
+	t.Run("emails a link that logs in once", func(t *testing.T) {
+		server, _, q := newServer(auth.MagicLinkPolicy{})
+
+		assertResponseCode(t, request(server, "adedunmola@gmail.com").Code, http.StatusOK)
+
+		token := emailedToken(t, q)
+
+		response := verify(server, token, "Firefox")
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var data struct {
+			Token string `json:"token"`
+		}
+		_ = json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &data})
+		if claims, err := helpers.DecodeToken(tokens, data.Token); err != nil || claims["user_id"] != 1 {
+			t.Errorf("got %s, want an access token for user 1", response.Body.String())
+		}
+
+		assertResponseCode(t, verify(server, token, "Firefox").Code, http.StatusBadRequest)
+	})
+
+	t.Run("answers the same for an unknown email", func(t *testing.T) {
+		server, _, q := newServer(auth.MagicLinkPolicy{})
+
+		assertResponseCode(t, request(server, "nobody@gmail.com").Code, http.StatusOK)
+
+		if len(q.Tasks) != 0 {
+			t.Errorf("tasks = %v, want no email", q.Tasks)
+		}
+	})
+
+	t.Run("replaces the links not used yet", func(t *testing.T) {
+		server, _, q := newServer(auth.MagicLinkPolicy{})
+
+		request(server, "adedunmola@gmail.com")
+		first := emailedToken(t, q)
+		request(server, "adedunmola@gmail.com")
+
+		assertResponseCode(t, verify(server, first, "Firefox").Code, http.StatusBadRequest)
+		assertResponseCode(t, verify(server, emailedToken(t, q), "Firefox").Code, http.StatusOK)
+	})
+
+	t.Run("verifies the email", func(t *testing.T) {
+		server, store, q := newServer(auth.MagicLinkPolicy{})
+
+		request(server, "unverified@gmail.com")
+		assertResponseCode(t, verify(server, emailedToken(t, q), "Firefox").Code, http.StatusOK)
+
+		if user, _ := store.FindUserByID(context.Background(), 2); !user.Verified {
+			t.Error("the user is not verified")
+		}
+	})
+
+	t.Run("refuses a forged token", func(t *testing.T) {
+		server, _, _ := newServer(auth.MagicLinkPolicy{})
+
+		forged, _ := helpers.GenerateMagicLinkToken([]byte("another key"), helpers.MagicLinkClaims{UserID: 1, ID: "forged"}, time.Minute)
+
+		assertResponseCode(t, verify(server, forged, "Firefox").Code, http.StatusBadRequest)
+	})
+
+	t.Run("binds the link to the device", func(t *testing.T) {
+		server, _, q := newServer(auth.MagicLinkPolicy{BindDevice: true, BindIP: true})
+
+		r := magicLinkRequest([]byte(`{ "email": "adedunmola@gmail.com" }`))
+		r.Header.Set("User-Agent", "Firefox")
+		r.RemoteAddr = "102.89.34.12:3000"
+		server.RequestMagicLinkHandler(httptest.NewRecorder(), r)
+
+		token := emailedToken(t, q)
+
+		assertResponseCode(t, verify(server, token, "Chrome").Code, http.StatusForbidden)
+		assertResponseCode(t, verify(server, token, "Firefox").Code, http.StatusOK)
+	})
+}
+
+func TestPersonalTokens(t *testing.T) {
+	tokenStore := &StubPersonalTokenStore{}
+	server := &auth.Handler{
+		Store:              &StubUserStore{},
+		PersonalTokenStore: tokenStore,
+		Tokens:             tokens,
+	}
+
+	// as sends a request as the user AuthMiddleware let through
+	as := func(userID int, handler http.HandlerFunc, method, body, tokenID string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/auth/tokens", strings.NewReader(body))
+
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("id", tokenID)
+		ctx := context.WithValue(request.Context(), chi.RouteCtxKey, routeCtx)
+		request = request.WithContext(helpers.WithPrincipal(ctx, helpers.Principal{UserID: userID, Verified: true}))
+
+		response := httptest.NewRecorder()
+		handler(response, request)
+
+		return response
+	}
+
+	var created auth.CreatedPersonalTokenResponse
+
+	t.Run("creates a token shown once and stored hashed", func(t *testing.T) {
+		response := as(1, server.CreatePersonalTokenHandler, http.MethodPost, `{ "name": "backup script", "scopes": ["read:wishlists"] }`, "")
+
+		assertResponseCode(t, response.Code, http.StatusCreated)
+		_ = json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &created})
+
+		if !strings.HasPrefix(created.Token, helpers.PersonalTokenPrefix) || !strings.HasPrefix(created.Token, created.PersonalToken.Hint) {
+			t.Errorf("got %+v, want a wmp_ token and its hint", created)
+		}
+
+		if _, ok := tokenStore.tokens[created.Token]; ok || len(tokenStore.tokens) != 1 {
+			t.Errorf("stored tokens = %v, want the token hashed", tokenStore.tokens)
+		}
+
+		days := time.Until(created.PersonalToken.ExpiresAt).Hours() / 24
+		if days < auth.DefaultPersonalTokenDays-1 || days > auth.DefaultPersonalTokenDays {
+			t.Errorf("expires in %.1f days, want %d", days, auth.DefaultPersonalTokenDays)
+		}
+	})
+
+	t.Run("refuses an unknown scope or expiry", func(t *testing.T) {
+		for _, body := range []string{
+			`{ "name": "admin", "scopes": ["admin"] }`,
+			`{ "name": "no scopes", "scopes": [] }`,
+			`{ "name": "forever", "scopes": ["read:friends"], "expires_in_days": 1000 }`,
+		} {
+			response := as(1, server.CreatePersonalTokenHandler, http.MethodPost, body, "")
+			assertResponseCode(t, response.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("authenticates the bearer with the scopes of the token", func(t *testing.T) {
+		principal, err := auth.PersonalTokens{Store: tokenStore}.Authenticate(context.Background(), created.Token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if principal.UserID != 1 || !principal.HasScope(helpers.ScopeReadWishlists) || principal.HasScope(helpers.ScopeWriteWishlists) {
+			t.Errorf("principal = %+v, want user 1 with read:wishlists only", principal)
+		}
+
+		if _, err := (auth.PersonalTokens{Store: tokenStore}).Authenticate(context.Background(), helpers.PersonalTokenPrefix+"unknown"); err != helpers.ErrNotFound {
+			t.Errorf("got %v, want not found", err)
+		}
+	})
+
+	t.Run("gives a token without scopes none", func(t *testing.T) {
+		principal, err := auth.PersonalTokens{Store: &ScopelessPersonalTokenStore{}}.Authenticate(context.Background(), created.Token)
+		if err != nil || principal.HasScope(helpers.ScopeReadFriends) {
+			t.Errorf("principal = %+v, want no scope", principal)
+		}
+	})
+
+	t.Run("lists the tokens of the user", func(t *testing.T) {
+		var listed []auth.PersonalToken
+
+		response := as(1, server.ListPersonalTokensHandler, http.MethodGet, "", "")
+		assertResponseCode(t, response.Code, http.StatusOK)
+		_ = json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &listed})
+
+		if len(listed) != 1 || listed[0].Name != "backup script" || listed[0].LastUsedAt == nil {
+			t.Errorf("got %+v, want the used backup script token", listed)
+		}
+
+		if strings.Contains(response.Body.String(), created.Token) {
+			t.Error("the list shows the token")
+		}
+	})
+
+	t.Run("revokes only the tokens of the user", func(t *testing.T) {
+		id := strconv.Itoa(created.PersonalToken.ID)
+
+		assertResponseCode(t, as(2, server.RevokePersonalTokenHandler, http.MethodDelete, "", id).Code, http.StatusNotFound)
+		assertResponseCode(t, as(1, server.RevokePersonalTokenHandler, http.MethodDelete, "", "abc").Code, http.StatusBadRequest)
+		assertResponseCode(t, as(1, server.RevokePersonalTokenHandler, http.MethodDelete, "", id).Code, http.StatusOK)
+
+		if _, err := (auth.PersonalTokens{Store: tokenStore}).Authenticate(context.Background(), created.Token); err != helpers.ErrNotFound {
+			t.Errorf("got %v, want the revoked token refused", err)
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	sessionStore := &StubSessionStore{}
+	store := StubUserStore{sessions: sessionStore, users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", Verified: true},
+	}}
+	server := &auth.Handler{Store: &store, Queue: &StubQueue{}, SessionStore: sessionStore, Tokens: tokens, Lockout: auth.LockoutPolicy{MaxFailures: 5, Duration: time.Minute}}
+
+	type tokenResponse struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	decode := func(t *testing.T, response *httptest.ResponseRecorder, data interface{}) {
+		t.Helper()
 
-	for _, u := range s.users {
-		if u.Email == email {
-			return u, nil
+		if err := json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: data}); err != nil {
+			t.Fatalf("error decoding %s: %v", response.Body.String(), err)
 		}
 	}
-	return auth.User{}, helpers.ErrNotFound
-}
 
-func (s *StubUserStore) FindUserByID(id int) (auth.User, error) {
+	login := func(t *testing.T, userAgent string) tokenResponse {
+		t.Helper()
 
-	for _, u := range s.users {
-		if u.ID == id {
-			return u, nil
-		}
+		request := loginUserRequest([]byte(`{ "email": "adedunmola@gmail.com", "password": "password" }`))
+		request.Header.Set("User-Agent", userAgent)
+		response := httptest.NewRecorder()
+		server.LoginUserHandler(response, request)
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var got tokenResponse
+		decode(t, response, &got)
+		return got
 	}
-	return auth.User{}, helpers.ErrNotFound
-}
 
-func (s *StubUserStore) UpdateUser(id int, data auth.UpdateUserBody) (auth.User, error) {
-	for i, u := range s.users {
-		if u.ID == id {
-			s.users[i].Verified = data.Verified
+	refresh := func(refreshToken string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		server.RefreshTokenHandler(response, loginUserRequest([]byte(`{ "refresh_token": "`+refreshToken+`" }`)))
+		return response
+	}
 
-			return s.users[i], nil
+	// as sends a request with the access token, as AuthMiddleware would let it through
+	as := func(t *testing.T, token string, handler http.HandlerFunc, body, sessionID string) *httptest.ResponseRecorder {
+		t.Helper()
+
+		claims, err := helpers.DecodeToken(tokens, token)
+		if err != nil {
+			t.Fatalf("error decoding the access token: %v", err)
 		}
-	}
+		principal := helpers.Principal{UserID: claims["user_id"].(int), Verified: true, SessionID: claims["session_id"].(int)}
 
-	return auth.User{}, helpers.ErrNotFound
-}
+		request, _ := http.NewRequest(http.MethodPost, "/auth/sessions", strings.NewReader(body))
+		routeCtx := chi.NewRouteContext()
+		routeCtx.URLParams.Add("id", sessionID)
+		ctx := context.WithValue(request.Context(), chi.RouteCtxKey, routeCtx)
+		request = request.WithContext(helpers.WithPrincipal(ctx, principal))
 
-func (s *StubUserStore) ComparePasswords(storedPassword, candidatePassword string) bool {
-	return storedPassword == candidatePassword
-}
+		response := httptest.NewRecorder()
+		handler(response, request)
 
-type FailingStubUserStore struct {
-	users []auth.User
-}
+		return response
+	}
 
-func (s *FailingStubUserStore) CreateUser(_ *auth.CreateUserBody) (auth.CreateUserResponse, error) {
+	active := func(t *testing.T, token string) bool {
+		t.Helper()
 
-	return auth.CreateUserResponse{}, ErrCreate
-}
+		claims, _ := helpers.DecodeToken(tokens, token)
+		return sessionStore.TouchSession(context.Background(), claims["session_id"].(int), claims["user_id"].(int)) == nil
+	}
 
-func (s *FailingStubUserStore) FindUserByEmail(_ string) (auth.User, error) {
-	return auth.User{}, ErrNoEntry
-}
+	t.Run("starts a session on login", func(t *testing.T) {
+		got := login(t, "Firefox")
 
-func (s *FailingStubUserStore) FindUserByID(id int) (auth.User, error) {
+		if got.RefreshToken == "" || !active(t, got.Token) {
+			t.Errorf("got %+v, want an access token of an active session and a refresh token", got)
+		}
 
-	for _, u := range s.users {
-		if u.ID == id {
-			return u, nil
+		if session := sessionStore.sessions[len(sessionStore.sessions)-1]; session.refreshTokenHash == got.RefreshToken || session.session.UserAgent != "Firefox" {
+			t.Errorf("session = %+v, want the refresh token hashed and the device recorded", session)
 		}
-	}
-	return auth.User{}, helpers.ErrNotFound
-}
+	})
 
-func (s *FailingStubUserStore) UpdateUser(id int, data auth.UpdateUserBody) (auth.User, error) {
-	for i, u := range s.users {
-		if u.ID == id {
-			s.users[i].Verified = data.Verified
+	t.Run("rotates the refresh token", func(t *testing.T) {
+		first := login(t, "Firefox")
 
-			return s.users[i], nil
+		response := refresh(first.RefreshToken)
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		var second tokenResponse
+		decode(t, response, &second)
+
+		if second.RefreshToken == first.RefreshToken || !active(t, second.Token) {
+			t.Errorf("got %+v, want a new refresh token and an access token of the session", second)
 		}
-	}
 
-	return auth.User{}, helpers.ErrNotFound
-}
+		assertResponseCode(t, refresh(first.RefreshToken).Code, http.StatusUnauthorized)
+		assertResponseCode(t, refresh("unknown").Code, http.StatusUnauthorized)
+	})
 
-func (s *FailingStubUserStore) ComparePasswords(_, _ string) bool {
-	return false
-}
+	t.Run("lists the sessions marking the current one", func(t *testing.T) {
+		current := login(t, "Chrome")
 
-func TestPOSTUser(t *testing.T) {
+		response := as(t, current.Token, server.ListSessionsHandler, "", "")
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-	t.Run("create and send a auth back", func(t *testing.T) {
-		store := StubUserStore{users: make([]auth.User, 0)}
-		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
-		server := &auth.Handler{Store: &store, Queue: &mockQueue}
+		var sessions []auth.Session
+		decode(t, response, &sessions)
 
-		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+		currents := 0
+		for _, session := range sessions {
+			if session.Current {
+				currents++
+				if session.UserAgent != "Chrome" {
+					t.Errorf("current session = %+v, want the Chrome one", session)
+				}
+			}
+		}
 
-		request := createUserRequest(data)
-		response := httptest.NewRecorder()
+		if len(sessions) < 2 || currents != 1 {
+			t.Errorf("got %+v, want the sessions with one current", sessions)
+		}
+	})
 
-		server.CreateUserHandler(response, request)
+	t.Run("revokes one session", func(t *testing.T) {
+		current := login(t, "Firefox")
+		other := login(t, "Safari")
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		claims, _ := helpers.DecodeToken(tokens, other.Token)
+		id := strconv.Itoa(claims["session_id"].(int))
 
-		want := map[string]interface{}{
-			"status":  "Success",
-			"message": "User created successfully",
-			"data": map[string]interface{}{
-				"id":         float64(1),
-				"first_name": "Adedunmola",
-				"last_name":  "Oyewale",
-				"username":   "Adedunmola",
-			},
+		assertResponseCode(t, as(t, current.Token, server.RevokeSessionHandler, "", "abc").Code, http.StatusBadRequest)
+		assertResponseCode(t, as(t, current.Token, server.RevokeSessionHandler, "", id).Code, http.StatusOK)
+		assertResponseCode(t, as(t, current.Token, server.RevokeSessionHandler, "", id).Code, http.StatusNotFound)
+
+		if active(t, other.Token) || !active(t, current.Token) {
+			t.Error("want only the Safari session revoked")
 		}
 
-		assertResponseCode(t, response.Code, http.StatusCreated)
-		assertResponseBody(t, got, want)
+		assertResponseCode(t, refresh(other.RefreshToken).Code, http.StatusUnauthorized)
+	})
 
-		if len(store.users) != 1 {
-			t.Errorf("got %d users, want 1", len(store.users))
+	t.Run("revokes every other session", func(t *testing.T) {
+		other := login(t, "Safari")
+		current := login(t, "Firefox")
+
+		response := as(t, current.Token, server.RevokeOtherSessionsHandler, "", "")
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if active(t, other.Token) || !active(t, current.Token) {
+			t.Error("want every session but the current one revoked")
 		}
 
-		if len(mockQueue.Tasks) != 1 {
-			t.Errorf("got %d tasks, want 1", len(mockQueue.Tasks))
+		if sessions, _ := sessionStore.ListSessions(context.Background(), 1); len(sessions) != 1 {
+			t.Errorf("got %d sessions, want 1", len(sessions))
 		}
 	})
 
-	t.Run("fails in creating auth", func(t *testing.T) {
-		store := FailingStubUserStore{users: make([]auth.User, 0)}
-		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
-		server := &auth.Handler{Store: &store, Queue: &mockQueue}
-		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password" }`)
+	t.Run("refuses a wrong current password", func(t *testing.T) {
+		current := login(t, "Firefox")
 
-		request := createUserRequest(data)
-		response := httptest.NewRecorder()
+		response := as(t, current.Token, server.ChangePasswordHandler, `{ "current_password": "wrong", "new_password": "new password" }`, "")
+		assertResponseCode(t, response.Code, http.StatusUnauthorized)
 
-		server.CreateUserHandler(response, request)
+		if !active(t, current.Token) {
+			t.Error("the session was revoked")
+		}
+	})
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+	t.Run("revokes every session when the password changes", func(t *testing.T) {
+		other := login(t, "Safari")
+		current := login(t, "Firefox")
 
-		//want := map[string]interface{}{}
+		response := as(t, current.Token, server.ChangePasswordHandler, `{ "current_password": "password", "new_password": "new password" }`, "")
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		assertResponseCode(t, response.Code, http.StatusInternalServerError)
+		var got tokenResponse
+		decode(t, response, &got)
 
-		//assertResponseBody(t, got, want)
-	})
+		if active(t, other.Token) || active(t, current.Token) || !active(t, got.Token) {
+			t.Error("want every session revoked and a new one started")
+		}
 
-	t.Run("returns error for invalid request body", func(t *testing.T) {
-		store := FailingStubUserStore{users: make([]auth.User, 0)}
-		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
-		server := &auth.Handler{Store: &store, Queue: &mockQueue}
-		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola" }`)
+		if user, _ := store.FindUserByID(context.Background(), 1); user.Password == "password" || user.Password == "new password" {
+			t.Errorf("password = %q, want the new one hashed", user.Password)
+		}
+	})
+}
 
-		request := createUserRequest(data)
+func TestProfile(t *testing.T) {
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", DateOfBirth: "1990-03-06", Locale: "en", Timezone: "UTC", Verified: true},
+		{ID: 2, FirstName: "Tobi", LastName: "Ade", Password: "password", Email: "tobi@gmail.com", Username: "tobi", Verified: true},
+	}}
+	otpStore := &StubOtpStore{}
+	q := &StubQueue{}
+	server := &auth.Handler{Store: &store, OTPStore: otpStore, Queue: q, Lockout: auth.LockoutPolicy{MaxFailures: 5, Duration: time.Minute}}
+
+	// as sends a request as user 1, as AuthMiddleware would let it through
+	as := func(handler http.HandlerFunc, method, body string) *httptest.ResponseRecorder {
+		request, _ := http.NewRequest(method, "/auth/profile", strings.NewReader(body))
+		request = request.WithContext(helpers.WithPrincipal(request.Context(), helpers.Principal{UserID: 1, Verified: true}))
 		response := httptest.NewRecorder()
 
-		server.CreateUserHandler(response, request)
+		handler(response, request)
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		return response
+	}
 
-		wantBody := map[string]interface{}{
-			"message": "invalid request body",
-			"problems": map[string][]string{
-				"Email":    []string{"Email required"},
-				"Password": []string{"Password required"},
-			},
+	profile := func(t *testing.T, response *httptest.ResponseRecorder) auth.Profile {
+		t.Helper()
+
+		var got auth.Profile
+		if err := json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &got}); err != nil {
+			t.Fatalf("error decoding %s: %v", response.Body.String(), err)
 		}
+		return got
+	}
 
-		wantJSON, _ := json.Marshal(wantBody)
+	t.Run("returns the profile without the password", func(t *testing.T) {
+		response := as(server.GetProfileHandler, http.MethodGet, "")
 
-		var want map[string]interface{}
-		_ = json.Unmarshal(wantJSON, &want)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		assertResponseCode(t, response.Code, http.StatusBadRequest)
-		assertResponseBody(t, got, want)
+		if got := profile(t, response); got.Username != "Adedunmola" || got.DateOfBirth != "1990-03-06" || got.Timezone != "UTC" {
+			t.Errorf("got %+v", got)
+		}
 
-		if len(mockQueue.Tasks) == 1 {
-			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+		if strings.Contains(response.Body.String(), "password") {
+			t.Errorf("got %s, want no password", response.Body.String())
 		}
 	})
 
-	t.Run("email conflict", func(t *testing.T) {
-		store := StubUserStore{users: []auth.User{
-			{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
-		}}
-		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
+	t.Run("updates only the fields sent", func(t *testing.T) {
+		response := as(server.UpdateProfileHandler, http.MethodPatch, `{ "bio": "Loves books", "timezone": "Africa/Lagos", "date_of_birth": "1991-04-07" }`)
 
-		server := &auth.Handler{Store: &store, Queue: &mockQueue}
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		data := []byte(`{ "first_name": "Adedunmola", "last_name": "Oyewale", "username": "Adedunmola", "password": "password", "email": "adedunmola@gmail.com" }`)
+		got := profile(t, response)
+		want := auth.Profile{ID: 1, Username: "Adedunmola", Email: "adedunmola@gmail.com", FirstName: "Adedunmola", LastName: "Oyewale", DateOfBirth: "1991-04-07", Bio: "Loves books", Timezone: "Africa/Lagos", Locale: "en"}
+		if got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
 
-		request := createUserRequest(data)
-		response := httptest.NewRecorder()
+	t.Run("clears the date of birth", func(t *testing.T) {
+		response := as(server.UpdateProfileHandler, http.MethodPatch, `{ "date_of_birth": "" }`)
 
-		server.CreateUserHandler(response, request)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		if got := profile(t, response); got.DateOfBirth != "" {
+			t.Errorf("date of birth = %q, want none", got.DateOfBirth)
+		}
+	})
 
-		want := map[string]interface{}{
-			"message": "resource already exists",
+	t.Run("refuses invalid fields", func(t *testing.T) {
+		for _, body := range []string{
+			`{ "first_name": "" }`,
+			`{ "username": "a b" }`,
+			`{ "date_of_birth": "1990-02-30" }`,
+			`{ "timezone": "Mars/Olympus" }`,
+			`{ "locale": "de" }`,
+		} {
+			if response := as(server.UpdateProfileHandler, http.MethodPatch, body); response.Code != http.StatusBadRequest {
+				t.Errorf("%s: got %d, want 400", body, response.Code)
+			}
 		}
+	})
+
+	t.Run("refuses a taken username", func(t *testing.T) {
+		response := as(server.UpdateProfileHandler, http.MethodPatch, `{ "username": "tobi" }`)
 
 		assertResponseCode(t, response.Code, http.StatusConflict)
-		assertResponseBody(t, got, want)
+	})
 
-		if len(mockQueue.Tasks) == 1 {
-			t.Errorf("got %d tasks, want 0", len(mockQueue.Tasks))
+	t.Run("cannot verify the user", func(t *testing.T) {
+		store.users[0].Verified = false
+		as(server.UpdateProfileHandler, http.MethodPatch, `{ "verified": true }`)
+
+		if user, _ := store.FindUserByID(context.Background(), 1); user.Verified {
+			t.Error("the user is verified")
 		}
+		store.users[0].Verified = true
 	})
-}
 
-func TestPOSTLogin(t *testing.T) {
-	store := StubUserStore{users: []auth.User{
-		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
-	}}
-	server := &auth.Handler{Store: &store}
+	t.Run("refuses an email change without the password or to a taken email", func(t *testing.T) {
+		assertResponseCode(t, as(server.ChangeEmailHandler, http.MethodPost, `{ "email": "ade@yahoo.com", "password": "wrong" }`).Code, http.StatusUnauthorized)
+		assertResponseCode(t, as(server.ChangeEmailHandler, http.MethodPost, `{ "email": "tobi@gmail.com", "password": "password" }`).Code, http.StatusConflict)
+		assertResponseCode(t, as(server.ChangeEmailHandler, http.MethodPost, `{ "email": "ADEDUNMOLA@gmail.com", "password": "password" }`).Code, http.StatusBadRequest)
+		assertResponseCode(t, as(server.ConfirmEmailHandler, http.MethodPost, `{ "code": "123456" }`).Code, http.StatusBadRequest)
 
-	t.Run("find and log in a auth", func(t *testing.T) {
+		if len(q.Tasks) != 0 {
+			t.Errorf("tasks = %v, want no email", q.Tasks)
+		}
+	})
 
-		data := []byte(`{ "email": "adedunmola@gmail.com", "password": "password" }`)
+	t.Run("changes the email once the new address is verified", func(t *testing.T) {
+		response := as(server.ChangeEmailHandler, http.MethodPost, `{ "email": "ade@yahoo.com", "password": "password" }`)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		request := loginUserRequest(data)
-		response := httptest.NewRecorder()
+		if len(q.Tasks) != 1 || q.Tasks[0].Payload["email"] != "ade@yahoo.com" || q.Tasks[0].Payload["template"] != "verification_mail" {
+			t.Fatalf("tasks = %v, want a code sent to the new email", q.Tasks)
+		}
 
-		server.LoginUserHandler(response, request)
+		if got := profile(t, as(server.GetProfileHandler, http.MethodGet, "")); got.Email != "adedunmola@gmail.com" || got.PendingEmail != "ade@yahoo.com" {
+			t.Errorf("got %+v, want the email unchanged until verified", got)
+		}
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		// the stub keeps codes as they are, the handler stored a hash
+		future := time.Now().Add(time.Minute)
+		otpStore.otps = []auth.OTP{{Email: "ade@yahoo.com", OTP: "123456", ExpiresAt: &future}}
 
+		assertResponseCode(t, as(server.ConfirmEmailHandler, http.MethodPost, `{ "code": "654321" }`).Code, http.StatusBadRequest)
+
+		response = as(server.ConfirmEmailHandler, http.MethodPost, `{ "code": "123456" }`)
 		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if got := profile(t, response); got.Email != "ade@yahoo.com" || got.PendingEmail != "" {
+			t.Errorf("got %+v, want the new email", got)
+		}
 	})
+}
 
-	t.Run("returns error for invalid request body", func(t *testing.T) {
-		store := FailingStubUserStore{users: make([]auth.User, 0)}
-		server := &auth.Handler{Store: &store}
-		data := []byte(`{ "password": "password" }`)
+func TestAvatar(t *testing.T) {
+	store := StubUserStore{users: []auth.User{
+		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", Verified: true},
+	}}
+	dir := t.TempDir()
+	images := &media.Images{Store: media.NewLocalStore(dir, "http://localhost:5000/blobs", []byte("secret")), MaxBytes: 1 << 20, LinkTTL: time.Minute}
+	server := &auth.Handler{Store: &store, Images: images}
+
+	// send uploads an image as the avatar of user 1, or sends no body
+	send := func(handler http.HandlerFunc, method string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		if data != nil {
+			part, _ := writer.CreateFormFile(media.FormField, "avatar.png")
+			part.Write(data)
+		}
+		writer.Close()
 
-		request := createUserRequest(data)
+		request, _ := http.NewRequest(method, "/auth/profile/avatar", &body)
+		request.Header.Set("Content-Type", writer.FormDataContentType())
+		request = request.WithContext(helpers.WithPrincipal(request.Context(), helpers.Principal{UserID: 1, Verified: true}))
 		response := httptest.NewRecorder()
 
-		server.LoginUserHandler(response, request)
+		handler(response, request)
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		return response
+	}
 
-		wantBody := map[string]interface{}{
-			"message": "invalid request body",
-			"problems": map[string][]string{
-				"Email": []string{"Email required"},
-			},
-		}
+	var avatar bytes.Buffer
+	if err := png.Encode(&avatar, image.NewNRGBA(image.Rect(0, 0, 600, 600))); err != nil {
+		t.Fatal(err)
+	}
 
-		wantJSON, _ := json.Marshal(wantBody)
+	var key string
 
-		var want map[string]interface{}
-		_ = json.Unmarshal(wantJSON, &want)
+	t.Run("stores the avatar and links to it", func(t *testing.T) {
+		response := send(server.UploadAvatarHandler, http.MethodPut, avatar.Bytes())
 
-		assertResponseCode(t, response.Code, http.StatusBadRequest)
-		assertResponseBody(t, got, want)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-	})
+		var got auth.Profile
+		_ = json.Unmarshal(response.Body.Bytes(), &auth.Response{Data: &got})
 
-	t.Run("does not find a auth", func(t *testing.T) {
-		data := []byte(`{ "email": "adedunmola1@gmail.com", "password": "password123" }`)
+		if !strings.HasPrefix(got.AvatarURL, "http://localhost:5000/blobs/avatars/1/") || !strings.Contains(got.AvatarThumbnailURL, "_thumb.png?") {
+			t.Errorf("got %+v, want links to the avatar", got)
+		}
 
-		request := loginUserRequest(data)
-		response := httptest.NewRecorder()
+		key = store.users[0].AvatarKey
+		if _, err := os.Stat(filepath.Join(dir, media.ThumbnailKey(key))); err != nil {
+			t.Error(err)
+		}
+	})
 
-		server.LoginUserHandler(response, request)
+	t.Run("keeps the avatar when the upload is not an image", func(t *testing.T) {
+		response := send(server.UploadAvatarHandler, http.MethodPut, []byte("<svg></svg>"))
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		assertResponseCode(t, response.Code, http.StatusUnsupportedMediaType)
 
-		want := map[string]interface{}{
-			"message": "invalid credentials",
+		if store.users[0].AvatarKey != key {
+			t.Errorf("avatar = %q, want %q", store.users[0].AvatarKey, key)
 		}
-
-		assertResponseCode(t, response.Code, http.StatusUnauthorized)
-		assertResponseBody(t, got, want)
 	})
 
-	t.Run("incorrect password", func(t *testing.T) {
+	t.Run("deletes the avatar it replaces", func(t *testing.T) {
+		response := send(server.UploadAvatarHandler, http.MethodPut, avatar.Bytes())
 
-		data := []byte(`{ "email": "adedunmola@gmail.com", "password": "password123" }`)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		request := loginUserRequest(data)
-		response := httptest.NewRecorder()
+		if _, err := os.Stat(filepath.Join(dir, key)); !os.IsNotExist(err) {
+			t.Errorf("the previous avatar is still stored: %v", err)
+		}
+	})
 
-		server.LoginUserHandler(response, request)
+	t.Run("removes the avatar", func(t *testing.T) {
+		response := send(server.DeleteAvatarHandler, http.MethodDelete, nil)
 
-		var got map[string]interface{}
-		_ = json.Unmarshal(response.Body.Bytes(), &got)
+		assertResponseCode(t, response.Code, http.StatusOK)
 
-		want := map[string]interface{}{
-			"message": "invalid credentials",
+		if strings.Contains(response.Body.String(), "avatar_url") {
+			t.Errorf("got %s, want no avatar", response.Body.String())
 		}
 
-		assertResponseCode(t, response.Code, http.StatusUnauthorized)
-		assertResponseBody(t, got, want)
+		if entries, _ := os.ReadDir(filepath.Join(dir, "avatars", "1")); len(entries) != 0 {
+			t.Errorf("left %v", entries)
+		}
 	})
 }
 
@@ -520,6 +2296,18 @@ func loginUserRequest(data []byte) *http.Request {
 	return request
 }
 
+func unlockUserRequest(token string) *http.Request {
+	request, _ := http.NewRequest("POST", "/auth/unlock", bytes.NewReader([]byte(`{ "token": "`+token+`" }`)))
+
+	return request
+}
+
+func magicLinkRequest(data []byte) *http.Request {
+	request, _ := http.NewRequest("POST", "/auth/magic-link", bytes.NewReader(data))
+
+	return request
+}
+
 func verifyOTPRequest(data []byte) *http.Request {
 	request, _ := http.NewRequest("POST", "/auth/verify", bytes.NewReader(data))
 
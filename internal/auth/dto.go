@@ -13,7 +13,19 @@ type User struct {
 	Email       string
 	Password    string
 	DateOfBirth string
-	Verified    bool
+	Locale      string
+	Bio         string
+	Timezone    string
+	// PendingEmail is the address an email change waits to verify, empty when none.
+	PendingEmail string
+	// AvatarKey is where the avatar is in the blob store, empty when there is none.
+	AvatarKey  string
+	Verified   bool
+	DisabledAt *time.Time
+	// FailedLogins counts the failed logins since the last successful one or lockout.
+	FailedLogins     int
+	LockedUntil      *time.Time
+	TwoFactorEnabled bool
 }
 
 type CreateUserBody struct {
@@ -23,6 +35,7 @@ type CreateUserBody struct {
 	Password  string `json:"password" validate:"required"`
 	Username  string `json:"username" validate:"required"`
 	Email     string `json:"email" validate:"required,email"`
+	Locale    string `json:"locale" validate:"omitempty,oneof=en fr yo"`
 }
 
 type LoginUserBody struct {
@@ -46,8 +59,48 @@ type OTP struct {
 	CreatedAt *time.Time `json:"created_at"`
 }
 
+// UpdateUserBody changes the fields that are set and keeps the others, an empty date of
+// birth or bio clears it. Verified only ever marks the user verified, users cannot set it.
 type UpdateUserBody struct {
-	Verified bool `json:"verified"`
+	helpers.Validation
+	FirstName   *string `json:"first_name,omitempty" validate:"omitnil,min=1,max=100"`
+	LastName    *string `json:"last_name,omitempty" validate:"omitnil,min=1,max=100"`
+	Username    *string `json:"username,omitempty" validate:"omitnil,min=3,max=30,alphanum"`
+	DateOfBirth *string `json:"date_of_birth,omitempty" validate:"omitnil,len=0|datetime=2006-01-02"`
+	Bio         *string `json:"bio,omitempty" validate:"omitnil,max=500"`
+	Timezone    *string `json:"timezone,omitempty" validate:"omitnil,timezone"`
+	Locale      *string `json:"locale,omitempty" validate:"omitnil,oneof=en fr yo"`
+	Verified    bool    `json:"-"`
+}
+
+// Profile is what users see and edit of their own account.
+type Profile struct {
+	ID           int    `json:"id"`
+	Username     string `json:"username"`
+	Email        string `json:"email"`
+	PendingEmail string `json:"pending_email,omitempty"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	DateOfBirth  string `json:"date_of_birth,omitempty"`
+	Bio          string `json:"bio"`
+	Timezone     string `json:"timezone"`
+	Locale       string `json:"locale"`
+	// AvatarURL and AvatarThumbnailURL are signed links, which stop working after a while.
+	AvatarURL          string `json:"avatar_url,omitempty"`
+	AvatarThumbnailURL string `json:"avatar_thumbnail_url,omitempty"`
+}
+
+// ChangeEmailBody starts an email change, which the code sent to the new address
+// completes.
+type ChangeEmailBody struct {
+	helpers.Validation
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+type ConfirmEmailBody struct {
+	helpers.Validation
+	Code string `json:"code" validate:"required"`
 }
 
 type VerifyOTPBody struct {
@@ -60,3 +113,103 @@ type RequestOTPBody struct {
 	helpers.Validation
 	Email string `json:"email" validate:"required,email"`
 }
+
+type UnlockUserBody struct {
+	helpers.Validation
+	Token string `json:"token" validate:"required"`
+}
+
+type RequestMagicLinkBody struct {
+	helpers.Validation
+	Email string `json:"email" validate:"required,email"`
+}
+
+type VerifyMagicLinkBody struct {
+	helpers.Validation
+	Token string `json:"token" validate:"required"`
+}
+
+type ConfirmTwoFactorBody struct {
+	helpers.Validation
+	Code string `json:"code" validate:"required"`
+}
+
+// ReauthenticateBody proves the user is at the keyboard before 2FA is changed, the code
+// is one from the authenticator app or a recovery code.
+type ReauthenticateBody struct {
+	helpers.Validation
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+type VerifyTwoFactorBody struct {
+	helpers.Validation
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+type TwoFactorEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type LoginChallengeResponse struct {
+	TwoFactorRequired bool          `json:"two_factor_required"`
+	ChallengeToken    string        `json:"challenge_token"`
+	Expiration        time.Duration `json:"expiration"`
+}
+
+// CreatePersonalTokenBody names a new personal access token and what it may do. It
+// lasts DefaultPersonalTokenDays unless told otherwise.
+type CreatePersonalTokenBody struct {
+	helpers.Validation
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=read:wishlists write:wishlists read:friends"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"`
+}
+
+// PersonalToken describes a personal access token, never showing the token itself.
+// The hint is its first characters, to tell the tokens apart.
+type PersonalToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Hint       string     `json:"hint"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreatedPersonalTokenResponse is the only time the token is shown.
+type CreatedPersonalTokenResponse struct {
+	Token         string        `json:"token"`
+	PersonalToken PersonalToken `json:"personal_token"`
+}
+
+type RefreshTokenBody struct {
+	helpers.Validation
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type ChangePasswordBody struct {
+	helpers.Validation
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
+}
+
+// Session is a sign in of the user on one device, lasting as long as it is refreshed.
+// Current marks the session the request was made with.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"-"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// MagicLinkPolicy is how long the sign in links last, and whether they only work from
+// the device or the address they were requested from.
+type MagicLinkPolicy struct {
+	TTL        time.Duration
+	BindDevice bool
+	BindIP     bool
+}
+
+var (
+	ErrInvalidMagicLink   = helpers.NewHTTPError(nil, http.StatusBadRequest, "invalid or expired sign in link", nil)
+	ErrMagicLinkElsewhere = helpers.NewHTTPError(nil, http.StatusForbidden, "this sign in link only works on the device and network it was requested from", nil)
+)
+
+// RequestMagicLinkHandler emails a sign in link to the owner of the account. It answers
+// the same whether an account uses the email or not, so it tells nobody which do.
+func (h *Handler) RequestMagicLinkHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*RequestMagicLinkBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	user, err := h.Store.FindUserByEmail(request.Context(), body.Email)
+	if err != nil && !errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if err == nil && user.DisabledAt == nil {
+		if err := h.sendMagicLink(request, user); err != nil {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "error sending link", nil))
+			return
+		}
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "If an account uses this email, a sign in link has been sent to it",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// sendMagicLink issues a new sign in link to the user, which replaces the ones they did
+// not use, and enqueues the email carrying it.
+func (h *Handler) sendMagicLink(request *http.Request, user User) error {
+	ctx := request.Context()
+
+	id, hashedID, err := newRandomToken()
+	if err != nil {
+		return fmt.Errorf("error generating link id: %w", err)
+	}
+
+	link := helpers.MagicLinkClaims{UserID: user.ID, ID: id}
+	if h.MagicLink.BindDevice {
+		link.Device = hashToken(clientDevice(request))
+	}
+	if h.MagicLink.BindIP {
+		link.IP = hashToken(clientIP(request))
+	}
+
+	token, err := helpers.GenerateMagicLinkToken(h.SecretKey, link, h.MagicLink.TTL)
+	if err != nil {
+		return err
+	}
+
+	err = h.MagicLinkStore.CreateMagicLink(ctx, user.ID, hashedID, time.Now().Add(h.MagicLink.TTL))
+	if err != nil {
+		return fmt.Errorf("error storing link: %w", err)
+	}
+
+	return SendSecurityAlert(ctx, h.Queue, user, "magic_link_mail", i18n.SubjectMagicLink, map[string]interface{}{
+		"link":       strings.TrimSuffix(h.AppURL, "/") + "/magic-link?token=" + url.QueryEscape(token),
+		"expiration": int(h.MagicLink.TTL.Minutes()),
+	})
+}
+
+// VerifyMagicLinkHandler exchanges the token of a sign in link for an access token, as
+// a login would. The link reached the user's inbox, so it verifies their email too.
+func (h *Handler) VerifyMagicLinkHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*VerifyMagicLinkBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	link, err := helpers.DecodeMagicLinkToken(h.SecretKey, body.Token)
+	if err != nil {
+		helpers.HandleError(responseWriter, ErrInvalidMagicLink)
+		return
+	}
+
+	// checked before the link is used up, so it still works from the right device
+	if (link.Device != "" && link.Device != hashToken(clientDevice(request))) || (link.IP != "" && link.IP != hashToken(clientIP(request))) {
+		helpers.HandleError(responseWriter, ErrMagicLinkElsewhere)
+		return
+	}
+
+	userID, err := h.MagicLinkStore.UseMagicLink(request.Context(), hashToken(link.ID))
+	if err != nil {
+		if errors.Is(err, helpers.ErrNotFound) {
+			helpers.HandleError(responseWriter, ErrInvalidMagicLink)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if userID != link.UserID {
+		helpers.HandleError(responseWriter, ErrInvalidMagicLink)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, ErrInvalidMagicLink)
+		return
+	}
+
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
+	if user.DisabledAt != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusForbidden, "account is disabled", nil))
+		return
+	}
+
+	if !user.Verified {
+		user, err = h.Store.UpdateUser(request.Context(), user.ID, UpdateUserBody{Verified: true})
+		if err != nil {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+			return
+		}
+	}
+
+	slog.InfoContext(request.Context(), "magic link used", "user_id", user.ID)
+
+	h.completeLogin(responseWriter, request, user)
+}
@@ -0,0 +1,312 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// oidcFlowCookie carries the state of a sign in from the redirect to the provider to
+// the callback, encrypted with the EncryptionKey.
+const oidcFlowCookie = "wishmate_oidc"
+
+// OIDCFlowExpiration is how long the user has to sign in at the provider.
+const OIDCFlowExpiration = 10 * time.Minute
+
+// maxUsernameAttempts bounds the usernames tried for an account created at sign in.
+const maxUsernameAttempts = 3
+
+var (
+	ErrUnknownProvider   = helpers.NewHTTPError(nil, http.StatusNotFound, "unknown sign in provider", nil)
+	ErrInvalidOIDCState  = helpers.NewHTTPError(nil, http.StatusBadRequest, "the sign in expired or was started in another browser, start again", nil)
+	ErrProviderRejected  = helpers.NewHTTPError(nil, http.StatusUnauthorized, "the provider did not sign you in", nil)
+	ErrProviderFailed    = helpers.NewHTTPError(nil, http.StatusBadGateway, "the provider could not be reached, try again later", nil)
+	ErrUnverifiedEmail   = helpers.NewHTTPError(nil, http.StatusForbidden, "the provider has not verified your email address", nil)
+	ErrUnverifiedAccount = helpers.NewHTTPError(nil, http.StatusConflict, "an account with this email is not verified yet, verify it before signing in with a provider", nil)
+)
+
+type oidcFlow struct {
+	Provider string    `json:"provider"`
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Expires  time.Time `json:"expires"`
+}
+
+// OIDCLoginHandler sends the user to sign in at the provider, which redirects them back
+// to OIDCCallbackHandler.
+func (h *Handler) OIDCLoginHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	provider, ok := h.Providers[chi.URLParam(request, "provider")]
+	if !ok {
+		helpers.HandleError(responseWriter, ErrUnknownProvider)
+		return
+	}
+
+	flow := oidcFlow{Provider: provider.Name(), Expires: time.Now().Add(OIDCFlowExpiration)}
+
+	for _, value := range []*string{&flow.State, &flow.Nonce, &flow.Verifier} {
+		random, err := oidc.RandomString()
+		if err != nil {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+			return
+		}
+		*value = random
+	}
+
+	authURL, err := provider.AuthCodeURL(request.Context(), flow.State, flow.Nonce, flow.Verifier)
+	if err != nil {
+		slog.ErrorContext(request.Context(), "error starting oidc sign in", "provider", provider.Name(), "error", err)
+		helpers.HandleError(responseWriter, ErrProviderFailed)
+		return
+	}
+
+	encoded, err := json.Marshal(flow)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	sealed, err := helpers.Encrypt(h.EncryptionKey, string(encoded))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	http.SetCookie(responseWriter, h.oidcFlowCookie(provider, sealed, int(OIDCFlowExpiration.Seconds())))
+	http.Redirect(responseWriter, request, authURL, http.StatusFound)
+}
+
+// OIDCCallbackHandler finishes the sign in at the provider, logging in the user linked
+// to the account there. An account is linked to the user with its verified email the
+// first time, or to a new user when there is none.
+func (h *Handler) OIDCCallbackHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	provider, ok := h.Providers[chi.URLParam(request, "provider")]
+	if !ok {
+		helpers.HandleError(responseWriter, ErrUnknownProvider)
+		return
+	}
+
+	flow, ok := h.readOIDCFlow(request, provider)
+
+	// the state works once, whatever the outcome
+	http.SetCookie(responseWriter, h.oidcFlowCookie(provider, "", -1))
+
+	query := request.URL.Query()
+
+	if !ok || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(flow.State)) != 1 {
+		helpers.HandleError(responseWriter, ErrInvalidOIDCState)
+		return
+	}
+
+	// the user cancelled, or the provider refused them
+	if query.Get("error") != "" || query.Get("code") == "" {
+		slog.InfoContext(request.Context(), "oidc sign in refused", "provider", provider.Name(), "error", query.Get("error"))
+		helpers.HandleError(responseWriter, ErrProviderRejected)
+		return
+	}
+
+	claims, err := provider.Exchange(request.Context(), query.Get("code"), flow.Verifier, flow.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrRejected) {
+			slog.WarnContext(request.Context(), "oidc sign in rejected", "provider", provider.Name(), "error", err)
+			helpers.HandleError(responseWriter, ErrProviderRejected)
+			return
+		}
+
+		slog.ErrorContext(request.Context(), "error finishing oidc sign in", "provider", provider.Name(), "error", err)
+		helpers.HandleError(responseWriter, ErrProviderFailed)
+		return
+	}
+
+	user, err := h.oidcUser(request.Context(), provider.Name(), claims)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if user.DisabledAt != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusForbidden, "account is disabled", nil))
+		return
+	}
+
+	// the provider vouches for the user, but a locked account stays locked however it signs in
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
+	h.completeLogin(responseWriter, request, user)
+}
+
+// oidcUser finds the user linked to the account at the provider, linking or creating
+// one by its email when the provider verified it.
+func (h *Handler) oidcUser(ctx context.Context, provider string, claims oidc.Claims) (User, error) {
+	user, err := h.IdentityStore.FindUserByIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+
+	if !errors.Is(err, helpers.ErrNotFound) {
+		return User{}, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return User{}, ErrUnverifiedEmail
+	}
+
+	user, err = h.Store.FindUserByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		// whoever registered an unverified account may not own the email, linking it
+		// would let them in to the provider's user's account
+		if !user.Verified {
+			return User{}, ErrUnverifiedAccount
+		}
+
+		if err := h.IdentityStore.LinkIdentity(ctx, user.ID, provider, claims.Subject, claims.Email); err != nil {
+			if errors.Is(err, helpers.ErrConflict) {
+				return User{}, helpers.NewHTTPError(err, http.StatusConflict, "this account is linked to another account at the provider", nil)
+			}
+			return User{}, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil)
+		}
+
+		slog.InfoContext(ctx, "oidc identity linked", "user_id", user.ID, "provider", provider)
+		return user, nil
+	case !errors.Is(err, helpers.ErrNotFound):
+		return User{}, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil)
+	}
+
+	user, err = h.createOIDCUser(ctx, provider, claims)
+	if err != nil {
+		if errors.Is(err, helpers.ErrConflict) {
+			return User{}, helpers.ErrConflict
+		}
+		return User{}, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil)
+	}
+
+	slog.InfoContext(ctx, "user created at oidc sign in", "user_id", user.ID, "provider", provider)
+	return user, nil
+}
+
+// createOIDCUser creates a verified user for the account at the provider, named after
+// it. The user gets a random password, they sign in through the provider.
+func (h *Handler) createOIDCUser(ctx context.Context, provider string, claims oidc.Claims) (User, error) {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return User{}, fmt.Errorf("error generating password: %w", err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(base64.RawURLEncoding.EncodeToString(password)), 10)
+	if err != nil {
+		return User{}, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	localPart, _, _ := strings.Cut(claims.Email, "@")
+
+	firstName := claims.GivenName
+	if firstName == "" {
+		firstName = claims.Name
+	}
+	if firstName == "" {
+		firstName = localPart
+	}
+
+	body := &CreateUserBody{
+		FirstName: firstName,
+		LastName:  claims.FamilyName,
+		Password:  string(hashedPassword),
+		Email:     claims.Email,
+		Locale:    i18n.Normalize(claims.Locale),
+	}
+
+	// the username is derived from the email, a taken one is tried again with another suffix
+	for attempt := 1; ; attempt++ {
+		body.Username, err = usernameFor(localPart)
+		if err != nil {
+			return User{}, err
+		}
+
+		user, err := h.IdentityStore.CreateUserWithIdentity(ctx, body, provider, claims.Subject)
+		if err == nil || !errors.Is(err, helpers.ErrConflict) || attempt == maxUsernameAttempts {
+			return user, err
+		}
+	}
+}
+
+// usernameFor derives a username from the local part of an email, with a random suffix.
+func usernameFor(localPart string) (string, error) {
+	base := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return -1
+	}, localPart)
+
+	if len(base) > 20 {
+		base = base[:20]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("error generating username: %w", err)
+	}
+
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+func (h *Handler) readOIDCFlow(request *http.Request, provider *oidc.Provider) (oidcFlow, bool) {
+	cookie, err := request.Cookie(oidcFlowCookie)
+	if err != nil {
+		return oidcFlow{}, false
+	}
+
+	decrypted, err := helpers.Decrypt(h.EncryptionKey, cookie.Value)
+	if err != nil {
+		return oidcFlow{}, false
+	}
+
+	var flow oidcFlow
+	if err := json.Unmarshal([]byte(decrypted), &flow); err != nil {
+		return oidcFlow{}, false
+	}
+
+	if flow.Provider != provider.Name() || flow.State == "" || time.Now().After(flow.Expires) {
+		return oidcFlow{}, false
+	}
+
+	return flow, true
+}
+
+// oidcFlowCookie is scoped to the callback of the provider. It goes along the redirect
+// back from the provider, a top-level navigation, which SameSite=Lax allows.
+func (h *Handler) oidcFlowCookie(provider *oidc.Provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcFlowCookie,
+		Value:    value,
+		Path:     "/auth/oidc/" + provider.Name(),
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(provider.RedirectURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// How long a personal access token lasts when its creator does not say, and at most.
+const (
+	DefaultPersonalTokenDays = 90
+	MaxPersonalTokenDays     = 365
+)
+
+// personalTokenHintLength is how much of a token its hint shows, the prefix and four
+// random characters.
+const personalTokenHintLength = len(helpers.PersonalTokenPrefix) + 4
+
+// PersonalTokens authenticates the bearers of personal access tokens for
+// middlewares.AuthMiddleware.
+type PersonalTokens struct {
+	Store PersonalTokenStore
+}
+
+func (p PersonalTokens) Authenticate(ctx context.Context, token string) (helpers.Principal, error) {
+	principal, err := p.Store.UsePersonalToken(ctx, hashToken(token))
+	if err != nil {
+		return helpers.Principal{}, err
+	}
+
+	// a token without scopes must not pass for a signed in user, who has them all
+	if principal.Scopes == nil {
+		principal.Scopes = []string{}
+	}
+
+	return principal, nil
+}
+
+// CreatePersonalTokenHandler creates a personal access token for the signed in user. The
+// token is in the response and never shown again.
+func (h *Handler) CreatePersonalTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*CreatePersonalTokenBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	days := body.ExpiresInDays
+	if days == 0 {
+		days = DefaultPersonalTokenDays
+	}
+
+	secret, _, err := newRandomToken()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+	token := helpers.PersonalTokenPrefix + secret
+
+	expiresAt := time.Now().AddDate(0, 0, days)
+
+	personalToken, err := h.PersonalTokenStore.CreatePersonalToken(request.Context(), userID, body.Name, hashToken(token), token[:personalTokenHintLength], body.Scopes, expiresAt)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	slog.InfoContext(request.Context(), "personal access token created", "user_id", userID, "token_id", personalToken.ID, "scopes", body.Scopes)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Personal access token created successfully, copy it now as it will not be shown again",
+		Data:    CreatedPersonalTokenResponse{Token: token, PersonalToken: personalToken},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusCreated)
+}
+
+// ListPersonalTokensHandler lists the personal access tokens of the signed in user.
+func (h *Handler) ListPersonalTokensHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	tokens, err := h.PersonalTokenStore.ListPersonalTokens(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Personal access tokens retrieved successfully",
+		Data:    tokens,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// RevokePersonalTokenHandler revokes a personal access token of the signed in user, it
+// stops working at once.
+func (h *Handler) RevokePersonalTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	tokenID, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "id is required", nil))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	err = h.PersonalTokenStore.RevokePersonalToken(request.Context(), userID, tokenID)
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	slog.InfoContext(request.Context(), "personal access token revoked", "user_id", userID, "token_id", tokenID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Personal access token revoked successfully",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
@@ -0,0 +1,327 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrUsernameTaken  = helpers.NewHTTPError(nil, http.StatusConflict, "username is already taken", nil)
+	ErrEmailTaken     = helpers.NewHTTPError(nil, http.StatusConflict, "email is already taken", nil)
+	ErrSameEmail      = helpers.NewHTTPError(nil, http.StatusBadRequest, "this is already your email", nil)
+	ErrNoPendingEmail = helpers.NewHTTPError(nil, http.StatusBadRequest, "no email change is pending", nil)
+)
+
+func (h *Handler) newProfile(user User) Profile {
+	profile := Profile{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail,
+		FirstName:    user.FirstName,
+		LastName:     user.LastName,
+		DateOfBirth:  user.DateOfBirth,
+		Bio:          user.Bio,
+		Timezone:     user.Timezone,
+		Locale:       user.Locale,
+	}
+
+	if h.Images != nil {
+		profile.AvatarURL = h.Images.URL(user.AvatarKey)
+		profile.AvatarThumbnailURL = h.Images.ThumbnailURL(user.AvatarKey)
+	}
+
+	return profile
+}
+
+// GetProfileHandler returns the profile of the signed in user.
+func (h *Handler) GetProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Profile retrieved successfully",
+		Data:    h.newProfile(user),
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// UpdateProfileHandler changes the fields of the profile that are in the body. The date
+// of birth decides when friends hear of the user's birthday.
+func (h *Handler) UpdateProfileHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*UpdateUserBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.UpdateUser(request.Context(), userID, *body)
+	if errors.Is(err, helpers.ErrConflict) {
+		helpers.HandleError(responseWriter, ErrUsernameTaken)
+		return
+	}
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Profile updated successfully",
+		Data:    h.newProfile(user),
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// ChangeEmailHandler starts an email change once the user gave their password, sending
+// a code to the new address. The email stays the same until ConfirmEmailHandler gets
+// the code.
+func (h *Handler) ChangeEmailHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*ChangeEmailBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
+	if !h.Store.ComparePasswords(user.Password, body.Password) {
+		// a stolen session should not be a way around the lockout
+		if duration := h.recordFailedLogin(request.Context(), user); duration > 0 {
+			refuseLocked(responseWriter, duration)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if strings.EqualFold(body.Email, user.Email) {
+		helpers.HandleError(responseWriter, ErrSameEmail)
+		return
+	}
+
+	if _, err := h.Store.FindUserByEmail(request.Context(), body.Email); err == nil {
+		helpers.HandleError(responseWriter, ErrEmailTaken)
+		return
+	}
+
+	err = h.Store.SetPendingEmail(request.Context(), user.ID, body.Email)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	// the code goes to the new address, proving the user reads it
+	pending := user
+	pending.Email = body.Email
+	if err := SendVerificationCode(request.Context(), h.OTPStore, h.Queue, pending); err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "error sending code", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Code has been sent to the new email",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// ConfirmEmailHandler completes an email change with the code sent to the new address.
+func (h *Handler) ConfirmEmailHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*ConfirmEmailBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if user.PendingEmail == "" {
+		helpers.HandleError(responseWriter, ErrNoPendingEmail)
+		return
+	}
+
+	isValid, err := h.OTPStore.ValidateOTP(request.Context(), user.PendingEmail, body.Code)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if !isValid {
+		helpers.HandleError(responseWriter, ErrInvalidCode)
+		return
+	}
+
+	user, err = h.Store.ConfirmEmail(request.Context(), user.ID)
+	if errors.Is(err, helpers.ErrConflict) {
+		helpers.HandleError(responseWriter, ErrEmailTaken)
+		return
+	}
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, ErrNoPendingEmail)
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	slog.InfoContext(request.Context(), "email changed", "user_id", user.ID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Email changed successfully",
+		Data:    h.newProfile(user),
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// UploadAvatarHandler stores the image of a multipart request as the avatar of the user,
+// replacing the one they had.
+func (h *Handler) UploadAvatarHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	key, err := h.Images.Upload(responseWriter, request, fmt.Sprintf("avatars/%d", userID))
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	h.setAvatar(responseWriter, request, userID, key, "Avatar uploaded successfully")
+}
+
+// DeleteAvatarHandler removes the avatar of the user.
+func (h *Handler) DeleteAvatarHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	h.setAvatar(responseWriter, request, userID, "", "Avatar removed successfully")
+}
+
+// setAvatar stores key as the avatar of the user and deletes the image it replaced,
+// responding with the profile.
+func (h *Handler) setAvatar(responseWriter http.ResponseWriter, request *http.Request, userID int, key, message string) {
+	previous, err := h.Store.SetAvatar(request.Context(), userID, key)
+	if err != nil {
+		if key != "" {
+			_ = h.Images.Remove(request.Context(), key)
+		}
+
+		if errors.Is(err, helpers.ErrNotFound) {
+			helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if previous != "" {
+		// the new avatar is in place, a leftover file is only wasted space
+		if err := h.Images.Remove(request.Context(), previous); err != nil {
+			slog.ErrorContext(request.Context(), "error deleting the previous avatar", "user_id", userID, "key", previous, "error", err)
+		}
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: message,
+		Data:    h.newProfile(user),
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 )
@@ -12,10 +14,93 @@ func AuthRoutes(config config.Config) {
 
 	store := NewUserStore(config.DB)
 
-	handler := Handler{Store: store, Queue: config.Queue}
+	otpStore := NewOTPStore(config.DB)
 
-	authRouter.Post("/register", http.HandlerFunc(handler.CreateUserHandler))
-	authRouter.Post("/login", http.HandlerFunc(handler.LoginUserHandler))
+	twoFactorStore := NewTwoFactorStore(config.DB)
+
+	identityStore := NewIdentityStore(config.DB)
+
+	magicLinkStore := NewMagicLinkStore(config.DB)
+
+	personalTokenStore := NewPersonalTokenStore(config.DB)
+
+	sessionStore := NewSessionStore(config.DB)
+
+	providers := make(map[string]*oidc.Provider)
+	for _, provider := range config.Settings.OIDC.Providers() {
+		providers[provider.Name] = oidc.NewProvider(provider, nil)
+	}
+
+	handler := Handler{
+		Store:              store,
+		Queue:              config.Queue,
+		OTPStore:           otpStore,
+		TwoFactorStore:     twoFactorStore,
+		IdentityStore:      identityStore,
+		MagicLinkStore:     magicLinkStore,
+		PersonalTokenStore: personalTokenStore,
+		SessionStore:       sessionStore,
+		Providers:          providers,
+		Tokens:             config.Tokens,
+		SecretKey:          []byte(config.Settings.SecretKey.Reveal()),
+		EncryptionKey:      []byte(config.Settings.EncryptionKey.Reveal()),
+		Lockout:            LockoutPolicy(config.Settings.Lockout),
+		AppURL:             config.Settings.AppURL,
+		Images:             config.Images,
+		MagicLink: MagicLinkPolicy{
+			TTL:        config.Settings.MagicLink.TTL,
+			BindDevice: config.Settings.MagicLink.BindsDevice(),
+			BindIP:     config.Settings.MagicLink.BindsIP(),
+		},
+	}
+
+	limits := config.Settings.RateLimits
+	rateLimit := func(policy middlewares.Policy, key middlewares.KeyFunc) func(http.Handler) http.Handler {
+		return middlewares.RateLimit(config.RateLimiter, policy, key)
+	}
+
+	authRouter.With(rateLimit(limits.Register, middlewares.KeyByIP)).Post("/register", http.HandlerFunc(handler.CreateUserHandler))
+	// by address first, so the requests it refuses do not use up the quota of the email
+	authRouter.With(rateLimit(limits.LoginIP, middlewares.KeyByIP), rateLimit(limits.Login, middlewares.KeyByEmail)).Post("/login", http.HandlerFunc(handler.LoginUserHandler))
+	// a sign in link is a code sent by email, it counts against the OTP limit
+	authRouter.With(rateLimit(limits.OTP, middlewares.KeyByEmail)).Post("/magic-link", http.HandlerFunc(handler.RequestMagicLinkHandler))
+	authRouter.With(rateLimit(limits.Verify, middlewares.KeyByIP)).Post("/magic-link/verify", http.HandlerFunc(handler.VerifyMagicLinkHandler))
+	authRouter.With(rateLimit(limits.Verify, middlewares.KeyByIP)).Post("/unlock", http.HandlerFunc(handler.UnlockUserHandler))
+	authRouter.With(rateLimit(limits.Verify, middlewares.KeyByIP)).Post("/2fa/verify", http.HandlerFunc(handler.VerifyTwoFactorHandler))
+	authRouter.With(rateLimit(limits.Verify, middlewares.KeyByIP)).Post("/refresh", http.HandlerFunc(handler.RefreshTokenHandler))
+
+	authRouter.With(rateLimit(limits.Login, middlewares.KeyByIP)).Get("/oidc/{provider}/login", http.HandlerFunc(handler.OIDCLoginHandler))
+	authRouter.With(rateLimit(limits.Login, middlewares.KeyByIP)).Get("/oidc/{provider}/callback", http.HandlerFunc(handler.OIDCCallbackHandler))
+
+	authRouter.Group(func(r chi.Router) {
+		// no personal access token authenticator: the scopes only open the resource routers,
+		// a token cannot change how its user signs in, nor make more tokens
+		r.Use(middlewares.AuthMiddleware(handler.Tokens, sessionStore, nil))
+
+		r.Post("/2fa/enroll", http.HandlerFunc(handler.EnrollTwoFactorHandler))
+		r.With(rateLimit(limits.Verify, middlewares.KeyByUser)).Post("/2fa/confirm", http.HandlerFunc(handler.ConfirmTwoFactorHandler))
+		r.With(rateLimit(limits.Verify, middlewares.KeyByUser)).Post("/2fa/disable", http.HandlerFunc(handler.DisableTwoFactorHandler))
+		r.With(rateLimit(limits.Verify, middlewares.KeyByUser)).Post("/2fa/recovery-codes", http.HandlerFunc(handler.RegenerateRecoveryCodesHandler))
+
+		r.Post("/tokens", http.HandlerFunc(handler.CreatePersonalTokenHandler))
+		r.Get("/tokens", http.HandlerFunc(handler.ListPersonalTokensHandler))
+		r.Delete("/tokens/{id}", http.HandlerFunc(handler.RevokePersonalTokenHandler))
+
+		r.Get("/sessions", http.HandlerFunc(handler.ListSessionsHandler))
+		r.Delete("/sessions", http.HandlerFunc(handler.RevokeOtherSessionsHandler))
+		r.Delete("/sessions/{id}", http.HandlerFunc(handler.RevokeSessionHandler))
+
+		r.With(rateLimit(limits.Verify, middlewares.KeyByUser)).Post("/password", http.HandlerFunc(handler.ChangePasswordHandler))
+
+		r.Get("/profile", http.HandlerFunc(handler.GetProfileHandler))
+		r.Patch("/profile", http.HandlerFunc(handler.UpdateProfileHandler))
+		r.With(rateLimit(limits.OTP, middlewares.KeyByUser)).Post("/profile/email", http.HandlerFunc(handler.ChangeEmailHandler))
+		r.With(rateLimit(limits.Verify, middlewares.KeyByUser)).Post("/profile/email/verify", http.HandlerFunc(handler.ConfirmEmailHandler))
+		r.Put("/profile/avatar", http.HandlerFunc(handler.UploadAvatarHandler))
+		r.Delete("/profile/avatar", http.HandlerFunc(handler.DeleteAvatarHandler))
+	})
 
 	config.Router.Mount("/auth", authRouter)
+
+	config.Router.Get("/.well-known/jwks.json", http.HandlerFunc(handler.JWKSHandler))
 }
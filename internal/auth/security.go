@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alertTimeLayout is how the security alerts show times, the same in every locale.
+const alertTimeLayout = "2006-01-02 15:04 MST"
+
+// maxDeviceLength bounds the user agent kept for each login.
+const maxDeviceLength = 256
+
+// LockoutPolicy locks an account for Duration after MaxFailures failed logins in a row.
+// The duration doubles with each lockout since the last successful login, up to
+// MaxDuration. A zero MaxFailures turns lockouts off.
+type LockoutPolicy struct {
+	MaxFailures int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// LockDuration is how long the next lockout lasts, after the given number of lockouts.
+func (p LockoutPolicy) LockDuration(lockouts int) time.Duration {
+	duration := p.Duration
+	for i := 0; i < lockouts && duration < p.MaxDuration; i++ {
+		duration *= 2
+	}
+
+	if p.MaxDuration > 0 && duration > p.MaxDuration {
+		return p.MaxDuration
+	}
+
+	return duration
+}
+
+// lockedFor returns how long the account stays locked, zero when it is not.
+func lockedFor(user User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+
+	return time.Until(*user.LockedUntil)
+}
+
+func refuseLocked(responseWriter http.ResponseWriter, retryAfter time.Duration) {
+	responseWriter.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	helpers.HandleError(responseWriter, helpers.ErrAccountLocked)
+}
+
+// recordFailedLogin counts a failed login for the user, locking the account and
+// alerting its owner once the policy allows no more. It returns how long the account
+// is locked for, zero when it is not. Failures to record are logged, the login is
+// refused either way.
+func (h *Handler) recordFailedLogin(ctx context.Context, user User) time.Duration {
+	if h.Lockout.MaxFailures <= 0 {
+		return 0
+	}
+
+	failures, lockouts, err := h.Store.RecordFailedLogin(ctx, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording failed login", "user_id", user.ID, "error", err)
+		return 0
+	}
+
+	if failures < h.Lockout.MaxFailures {
+		return 0
+	}
+
+	token, hashedToken, err := newRandomToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "error generating unlock token", "user_id", user.ID, "error", err)
+		return 0
+	}
+
+	duration := h.Lockout.LockDuration(lockouts)
+	until := time.Now().Add(duration)
+
+	locked, err := h.Store.LockUser(ctx, user.ID, until, hashedToken)
+	if err != nil {
+		slog.ErrorContext(ctx, "error locking user", "user_id", user.ID, "error", err)
+		return 0
+	}
+
+	if !locked {
+		return 0
+	}
+
+	slog.WarnContext(ctx, "account locked", "user_id", user.ID, "failures", failures, "duration", duration)
+
+	err = SendSecurityAlert(ctx, h.Queue, user, "lockout_mail", i18n.SubjectAccountLocked, map[string]interface{}{
+		"attempts":   failures,
+		"until":      until.UTC().Format(alertTimeLayout),
+		"unlock_url": h.unlockURL(token),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending lockout alert", "user_id", user.ID, "error", err)
+	}
+
+	return duration
+}
+
+// recordLogin remembers where the user logged in from, alerting them of a login from a
+// device or address not seen before. The very first login raises no alert.
+func (h *Handler) recordLogin(request *http.Request, user User) {
+	ctx := request.Context()
+	device, ip := clientDevice(request), clientIP(request)
+
+	sighting, err := h.Store.RecordLogin(ctx, user.ID, device, ip)
+	if err != nil {
+		slog.ErrorContext(ctx, "error recording login", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if sighting.First || !(sighting.NewDevice || sighting.NewIP) {
+		return
+	}
+
+	err = SendSecurityAlert(ctx, h.Queue, user, "new_login_mail", i18n.SubjectNewLogin, map[string]interface{}{
+		"device": device,
+		"ip":     ip,
+		"time":   time.Now().UTC().Format(alertTimeLayout),
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "error sending new login alert", "user_id", user.ID, "error", err)
+	}
+}
+
+func (h *Handler) unlockURL(token string) string {
+	return strings.TrimSuffix(h.AppURL, "/") + "/unlock?token=" + url.QueryEscape(token)
+}
+
+// UnlockUserHandler lifts a lockout with the token emailed to the owner of the account.
+func (h *Handler) UnlockUserHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*UnlockUserBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	user, err := h.Store.UnlockUser(request.Context(), hashToken(body.Token))
+	if err != nil {
+		if errors.Is(err, helpers.ErrNotFound) {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid or expired unlock token", nil))
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	slog.InfoContext(request.Context(), "account unlocked", "user_id", user.ID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Account unlocked successfully",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// SendSecurityAlert enqueues a security email to the owner of the account.
+func SendSecurityAlert(ctx context.Context, q queue.Queue, user User, template, subject string, data map[string]interface{}) error {
+	data["username"] = user.Username
+
+	err := q.Enqueue(&queue.TaskPayload{
+		Type:         queue.TypeEmailDelivery,
+		RequestID:    logging.RequestID(ctx),
+		TraceContext: tracing.Inject(ctx),
+		Payload: map[string]interface{}{
+			"email":    user.Email,
+			"template": template,
+			"subject":  i18n.T(user.Locale, subject),
+			"locale":   user.Locale,
+			"data":     data,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error enqueuing email task: %w", err)
+	}
+
+	return nil
+}
+
+// newRandomToken returns a random token for an email and the hash the store keeps.
+func newRandomToken() (string, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	return token, hashToken(token), nil
+}
+
+// hashToken is how the random tokens and codes are stored, they are long enough not to
+// need a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientDevice identifies the device by its user agent.
+func clientDevice(request *http.Request) string {
+	device := strings.TrimSpace(request.UserAgent())
+	if device == "" {
+		return "unknown"
+	}
+
+	if len(device) > maxDeviceLength {
+		return device[:maxDeviceLength]
+	}
+
+	return device
+}
+
+// clientIP is the address of the client, which the router reads from the forwarded
+// headers when it trusts the proxy.
+func clientIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+
+	return host
+}
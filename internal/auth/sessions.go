@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SessionExpiration is how long a session lasts without being refreshed.
+const SessionExpiration = 30 * 24 * time.Hour
+
+// startSession opens a session for the user on the device of the request, returning the
+// access and refresh tokens to respond with.
+func (h *Handler) startSession(request *http.Request, user User) (map[string]interface{}, error) {
+	refreshToken, refreshTokenHash, err := newRandomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := h.SessionStore.CreateSession(request.Context(), user.ID, refreshTokenHash, clientDevice(request), clientIP(request), time.Now().Add(SessionExpiration))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := helpers.GenerateToken(h.Tokens, user.ID, user.Email, user.Verified, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"token": token, "refresh_token": refreshToken, "expiration": helpers.TokenExpiration}, nil
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a new refresh
+// token, the one sent stops working. The session lasts SessionExpiration from then.
+func (h *Handler) RefreshTokenHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*RefreshTokenBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	refreshToken, refreshTokenHash, err := newRandomToken()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	session, err := h.SessionStore.RefreshSession(request.Context(), hashToken(body.RefreshToken), refreshTokenHash, clientIP(request), time.Now().Add(SessionExpiration))
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), session.UserID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	token, err := helpers.GenerateToken(h.Tokens, user.ID, user.Email, user.Verified, session.ID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Token refreshed",
+		Data:    map[string]interface{}{"token": token, "refresh_token": refreshToken, "expiration": helpers.TokenExpiration},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// ListSessionsHandler lists the active sessions of the signed in user, marking the one
+// the request was made with.
+func (h *Handler) ListSessionsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	sessions, err := h.SessionStore.ListSessions(request.Context(), principal.UserID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == principal.SessionID
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Sessions retrieved successfully",
+		Data:    sessions,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// RevokeSessionHandler signs the user out of one of their sessions, the current one
+// included. Its access token stops working at once.
+func (h *Handler) RevokeSessionHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	sessionID, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "id is required", nil))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	err = h.SessionStore.RevokeSession(request.Context(), userID, sessionID)
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	slog.InfoContext(request.Context(), "session revoked", "user_id", userID, "session_id", sessionID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Session revoked successfully",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// RevokeOtherSessionsHandler signs the user out everywhere but the current session.
+func (h *Handler) RevokeOtherSessionsHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	revoked, err := h.SessionStore.RevokeOtherSessions(request.Context(), principal.UserID, principal.SessionID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	slog.InfoContext(request.Context(), "other sessions revoked", "user_id", principal.UserID, "session_id", principal.SessionID, "revoked", revoked)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Other sessions revoked successfully",
+		Data:    map[string]interface{}{"revoked": revoked},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// ChangePasswordHandler changes the password of the signed in user once they gave the
+// current one. Every session is revoked, and a new one starts for the device of the
+// request.
+func (h *Handler) ChangePasswordHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*ChangePasswordBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
+	if !h.Store.ComparePasswords(user.Password, body.CurrentPassword) {
+		// a stolen session should not be a way around the lockout
+		if duration := h.recordFailedLogin(request.Context(), user); duration > 0 {
+			refuseLocked(responseWriter, duration)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(body.NewPassword), 10)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	err = h.Store.ChangePassword(request.Context(), user.ID, string(hashedPassword))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	slog.InfoContext(request.Context(), "password changed, sessions revoked", "user_id", user.ID)
+
+	data, err := h.startSession(request, user)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Password changed, every session was signed out",
+		Data:    data,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
@@ -2,37 +2,153 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
 
 type OTPStore interface {
-	CreateOTP(email string, code string, expiration int) error
-	ValidateOTP(email string, otp string) (bool, error)
-	DeleteOTP(email string) error
+	CreateOTP(ctx context.Context, email string, code string, expiration int) error
+	ValidateOTP(ctx context.Context, email string, otp string) (bool, error)
+	DeleteOTP(ctx context.Context, email string) error
+}
+
+// TwoFactorStore keeps the TOTP secrets, encrypted by the caller, and the hashes of
+// the recovery codes.
+type TwoFactorStore interface {
+	// SetTOTPSecret keeps the secret of an enrollment until it is confirmed, replacing
+	// any unconfirmed one. It fails with helpers.ErrConflict when 2FA is already on.
+	SetTOTPSecret(ctx context.Context, userID int, secret string) error
+	// GetTOTPSecret returns the secret of the user and whether 2FA is on.
+	GetTOTPSecret(ctx context.Context, userID int) (secret string, enabled bool, err error)
+	// EnableTwoFactor turns 2FA on with a new set of recovery codes.
+	EnableTwoFactor(ctx context.Context, userID int, recoveryCodes []string) error
+	DisableTwoFactor(ctx context.Context, userID int) error
+	// UseTOTPStep records the time step of an accepted code. It reports false when
+	// that step or a later one was used already, so each code works once.
+	UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error)
+	// UseRecoveryCode uses up a recovery code, reporting false when the user has no
+	// unused one matching.
+	UseRecoveryCode(ctx context.Context, userID int, recoveryCode string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes []string) error
+}
+
+// MagicLinkStore keeps the sign in links by the hash of their id, so each works once.
+type MagicLinkStore interface {
+	// CreateMagicLink keeps a new link of the user, which replaces their unused ones.
+	CreateMagicLink(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error
+	// UseMagicLink uses up the link, returning its user. It fails with
+	// helpers.ErrNotFound when the link is unknown, used or expired.
+	UseMagicLink(ctx context.Context, tokenHash string) (int, error)
+}
+
+// PersonalTokenStore keeps the personal access tokens by the hash of the token.
+type PersonalTokenStore interface {
+	CreatePersonalToken(ctx context.Context, userID int, name, tokenHash, hint string, scopes []string, expiresAt time.Time) (PersonalToken, error)
+	// ListPersonalTokens returns the unrevoked tokens of the user, expired ones included.
+	ListPersonalTokens(ctx context.Context, userID int) ([]PersonalToken, error)
+	// RevokePersonalToken fails with helpers.ErrNotFound when the user has no such token.
+	RevokePersonalToken(ctx context.Context, userID, tokenID int) error
+	// UsePersonalToken records a use of the token, returning the principal it stands
+	// for. It fails with helpers.ErrNotFound when the token is unknown, revoked or
+	// expired, or its user disabled.
+	UsePersonalToken(ctx context.Context, tokenHash string) (helpers.Principal, error)
+}
+
+// SessionStore keeps the sessions by the hash of their refresh token, which changes on
+// every refresh.
+type SessionStore interface {
+	CreateSession(ctx context.Context, userID int, refreshTokenHash, userAgent, ip string, expiresAt time.Time) (Session, error)
+	// RefreshSession replaces the refresh token of the session and pushes back its
+	// expiry. It fails with helpers.ErrNotFound when the token is unknown, replaced,
+	// revoked or expired, or its user disabled.
+	RefreshSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash, ip string, expiresAt time.Time) (Session, error)
+	// TouchSession records that the session was seen. It fails with helpers.ErrNotFound
+	// when the session is revoked or expired, not the user's, or the user disabled.
+	TouchSession(ctx context.Context, sessionID, userID int) error
+	// ListSessions returns the active sessions of the user, the last seen first.
+	ListSessions(ctx context.Context, userID int) ([]Session, error)
+	// RevokeSession fails with helpers.ErrNotFound when the user has no such session.
+	RevokeSession(ctx context.Context, userID, sessionID int) error
+	// RevokeOtherSessions revokes every session of the user but the one kept, returning
+	// how many it revoked.
+	RevokeOtherSessions(ctx context.Context, userID, keepSessionID int) (int, error)
+}
+
+// IdentityStore links the users to their accounts at OpenID Connect providers, each
+// account known by its provider and the subject the provider gave it.
+type IdentityStore interface {
+	// FindUserByIdentity returns the user linked to the account, or helpers.ErrNotFound.
+	FindUserByIdentity(ctx context.Context, provider, subject string) (User, error)
+	// LinkIdentity links the account to an existing user. It fails with
+	// helpers.ErrConflict when the user is linked to another account at the provider.
+	LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error
+	// CreateUserWithIdentity creates a verified user linked to the account. It fails
+	// with helpers.ErrConflict when the username or the email is taken.
+	CreateUserWithIdentity(ctx context.Context, body *CreateUserBody, provider, subject string) (User, error)
 }
 
 type Store interface {
-	CreateUser(body *CreateUserBody) (CreateUserResponse, error)
-	FindUserByEmail(email string) (User, error)
-	FindUserByID(id int) (User, error)
-	UpdateUser(id int, data UpdateUserBody) (User, error)
+	CreateUser(ctx context.Context, body *CreateUserBody) (CreateUserResponse, error)
+	FindUserByEmail(ctx context.Context, email string) (User, error)
+	FindUserByID(ctx context.Context, id int) (User, error)
+	// UpdateUser fails with helpers.ErrConflict when the new username is taken.
+	UpdateUser(ctx context.Context, id int, data UpdateUserBody) (User, error)
+	DisableUser(ctx context.Context, id int) (User, error)
+	DeleteUser(ctx context.Context, id int) error
 	ComparePasswords(storedPassword, candidatePassword string) bool
+	// ChangePassword sets the hashed password of the user and revokes all their sessions.
+	ChangePassword(ctx context.Context, id int, password string) error
+	// SetPendingEmail keeps the address an email change waits to verify, replacing any
+	// earlier one.
+	SetPendingEmail(ctx context.Context, id int, email string) error
+	// ConfirmEmail makes the pending email the email of the user. It fails with
+	// helpers.ErrNotFound when no change is pending, and helpers.ErrConflict when
+	// another user took the address meanwhile.
+	ConfirmEmail(ctx context.Context, id int) (User, error)
+	// SetAvatar stores the key of the avatar of the user, an empty one removing it, and
+	// returns the key it replaced.
+	SetAvatar(ctx context.Context, id int, key string) (string, error)
+	// RecordFailedLogin counts a failed login, returning the failures in a row and the
+	// lockouts since the last successful login.
+	RecordFailedLogin(ctx context.Context, id int) (failures int, lockouts int, err error)
+	// LockUser locks the account until the given time, keeping the hash of the token
+	// that unlocks it. It reports false when the account was already locked.
+	LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error)
+	// UnlockUser lifts the lock of the account holding the hashed unlock token.
+	UnlockUser(ctx context.Context, unlockToken string) (User, error)
+	// RecordLogin clears the failed logins and remembers the device and address the
+	// user logged in from, reporting whether they were seen before.
+	RecordLogin(ctx context.Context, id int, device, ip string) (LoginSighting, error)
+}
+
+// LoginSighting tells apart a login from a new device or address.
+type LoginSighting struct {
+	// First is set on the first login recorded for the user, nothing is new then.
+	First     bool
+	NewDevice bool
+	NewIP     bool
 }
 
+// userColumns is selected, in this order, by every query scanned with scanUser.
+const userColumns = "id, username, email, first_name, last_name, password, COALESCE(to_char(date_of_birth, 'YYYY-MM-DD'), ''), locale, bio, timezone, COALESCE(pending_email, ''), COALESCE(avatar_key, ''), verified, disabled_at, failed_logins, locked_until, two_factor_enabled"
+
 type UserStore struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewUserStore(db *pgx.Conn) *UserStore {
+func NewUserStore(db *pgxpool.Pool) *UserStore {
 
 	return &UserStore{db: db}
 }
 
-func (s *UserStore) CreateUser(body *CreateUserBody) (CreateUserResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *UserStore) CreateUser(ctx context.Context, body *CreateUserBody) (CreateUserResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
@@ -45,16 +161,16 @@ func (s *UserStore) CreateUser(body *CreateUserBody) (CreateUserResponse, error)
 
 	row := tx.QueryRow(
 		ctx,
-		"INSERT INTO users (username, first_name, last_name, password) VALUES ($1, $2, $3, $4) RETURNING username, first_name, last_name;",
-		body.Username, body.FirstName, body.LastName, body.Password)
+		"INSERT INTO users (username, email, first_name, last_name, password, locale) VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'en')) RETURNING id, username, first_name, last_name;",
+		body.Username, body.Email, body.FirstName, body.LastName, body.Password, body.Locale)
 
-	err = row.Scan(&user.Username, &user.FirstName, &user.LastName, &user.LastName)
+	err = row.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName)
 
 	if err != nil {
 		return CreateUserResponse{}, fmt.Errorf("error scanning row (insert friendship): %w", err)
 	}
 
-	err = tx.Commit(context.Background())
+	err = tx.Commit(ctx)
 	if err != nil {
 		return CreateUserResponse{}, fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -62,8 +178,8 @@ func (s *UserStore) CreateUser(body *CreateUserBody) (CreateUserResponse, error)
 	return user, nil
 }
 
-func (s *UserStore) FindUserByEmail(email string) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *UserStore) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
@@ -72,17 +188,16 @@ func (s *UserStore) FindUserByEmail(email string) (User, error) {
 	}
 	defer tx.Rollback(ctx)
 
-	var user User
-
-	row := tx.QueryRow(ctx, "SELECT id, username, email, first_name, last_name, password, date_of_birth FROM users WHERE email = $1;", email)
-
-	err = row.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Password, &user.DateOfBirth)
+	user, err := scanUser(tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1;", email))
 
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
 		return User{}, fmt.Errorf("error scanning row (find auth by email): %w", err)
 	}
 
-	err = tx.Commit(context.Background())
+	err = tx.Commit(ctx)
 	if err != nil {
 		return User{}, fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -90,8 +205,8 @@ func (s *UserStore) FindUserByEmail(email string) (User, error) {
 	return user, nil
 }
 
-func (s *UserStore) FindUserByID(id int) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *UserStore) FindUserByID(ctx context.Context, id int) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
@@ -100,21 +215,56 @@ func (s *UserStore) FindUserByID(id int) (User, error) {
 	}
 	defer tx.Rollback(ctx)
 
-	var user User
+	user, err := scanUser(tx.QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1;", id))
 
-	row := tx.QueryRow(
-		ctx,
-		"SELECT id, username, email, first_name, last_name, password, date_of_birth FROM users WHERE id = $1;",
-		id,
-	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
+		return User{}, fmt.Errorf("error scanning row (find auth by id): %w", err)
+	}
 
-	err = row.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Password, &user.DateOfBirth)
+	err = tx.Commit(ctx)
+	if err != nil {
+		return User{}, fmt.Errorf("error committing transaction: %w", err)
+	}
 
+	return user, nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, id int, data UpdateUserBody) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
-		return User{}, fmt.Errorf("error scanning row (find auth by email): %w", err)
+		return User{}, fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `UPDATE users SET
+			first_name = COALESCE($2, first_name),
+			last_name = COALESCE($3, last_name),
+			username = COALESCE($4, username),
+			date_of_birth = CASE WHEN $5::text IS NULL THEN date_of_birth ELSE NULLIF($5, '')::date END,
+			bio = COALESCE($6, bio),
+			timezone = COALESCE($7, timezone),
+			locale = COALESCE($8, locale),
+			verified = verified OR $9,
+			updated_at = NOW()
+		WHERE id = $1 RETURNING ` + userColumns + ";"
+
+	user, err := scanUser(tx.QueryRow(ctx, query, id, data.FirstName, data.LastName, data.Username, data.DateOfBirth, data.Bio, data.Timezone, data.Locale, data.Verified))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return User{}, helpers.ErrConflict
+		}
+		return User{}, fmt.Errorf("error updating user: %w", err)
 	}
 
-	err = tx.Commit(context.Background())
+	err = tx.Commit(ctx)
 	if err != nil {
 		return User{}, fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -122,16 +272,134 @@ func (s *UserStore) FindUserByID(id int) (User, error) {
 	return user, nil
 }
 
-func (s *UserStore) UpdateUser(id int, data UpdateUserBody) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (s *UserStore) DisableUser(ctx context.Context, id int) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
+
 	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return User{}, fmt.Errorf("error creating transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	return User{}, err
+	user, err := scanUser(tx.QueryRow(ctx, "UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1 RETURNING "+userColumns+";", id))
+	if err != nil {
+		return User{}, fmt.Errorf("error disabling user: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return User{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) ChangePassword(ctx context.Context, id int, password string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, "UPDATE users SET password = $1, updated_at = NOW() WHERE id = $2;", password, id)
+	if err != nil {
+		return fmt.Errorf("error changing password: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx, "UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;", id)
+	if err != nil {
+		return fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *UserStore) SetPendingEmail(ctx context.Context, id int, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, "UPDATE users SET pending_email = $1, updated_at = NOW() WHERE id = $2;", email, id)
+	if err != nil {
+		return fmt.Errorf("error setting pending email: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *UserStore) ConfirmEmail(ctx context.Context, id int) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	user, err := scanUser(s.db.QueryRow(
+		ctx,
+		"UPDATE users SET email = pending_email, pending_email = NULL, updated_at = NOW() WHERE id = $1 AND pending_email IS NOT NULL RETURNING "+userColumns+";",
+		id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
+		if isUniqueViolation(err) {
+			return User{}, helpers.ErrConflict
+		}
+		return User{}, fmt.Errorf("error confirming email: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) SetAvatar(ctx context.Context, id int, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE users u SET avatar_key = NULLIF($2, ''), updated_at = NOW()
+		FROM (SELECT id, avatar_key FROM users WHERE id = $1 FOR UPDATE) previous
+		WHERE u.id = previous.id RETURNING COALESCE(previous.avatar_key, '');`
+
+	var previous string
+
+	err := s.db.QueryRow(ctx, query, id, key).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", helpers.ErrNotFound
+		}
+		return "", fmt.Errorf("error setting avatar: %w", err)
+	}
+
+	return previous, nil
+}
+
+// DeleteUser removes the user along with everything they own, the foreign keys cascade.
+func (s *UserStore) DeleteUser(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, "DELETE FROM users WHERE id = $1;", id)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	return nil
 }
 
 func (s *UserStore) ComparePasswords(storedPassword, candidatePassword string) bool {
@@ -143,3 +411,738 @@ func (s *UserStore) ComparePasswords(storedPassword, candidatePassword string) b
 	}
 	return true
 }
+
+func (s *UserStore) RecordFailedLogin(ctx context.Context, id int) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var failures, lockouts int
+
+	err := s.db.QueryRow(ctx, "UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 RETURNING failed_logins, lockouts;", id).Scan(&failures, &lockouts)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, 0, helpers.ErrNotFound
+		}
+		return 0, 0, fmt.Errorf("error recording failed login: %w", err)
+	}
+
+	return failures, lockouts, nil
+}
+
+func (s *UserStore) LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// concurrent failures on another instance may have locked the account already
+	result, err := s.db.Exec(
+		ctx,
+		"UPDATE users SET locked_until = $2, lockouts = lockouts + 1, failed_logins = 0, unlock_token = $3, updated_at = NOW() WHERE id = $1 AND (locked_until IS NULL OR locked_until <= NOW());",
+		id, until, unlockToken)
+	if err != nil {
+		return false, fmt.Errorf("error locking user: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (s *UserStore) UnlockUser(ctx context.Context, unlockToken string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	user, err := scanUser(s.db.QueryRow(
+		ctx,
+		"UPDATE users SET locked_until = NULL, lockouts = 0, failed_logins = 0, unlock_token = NULL, updated_at = NOW() WHERE unlock_token = $1 AND locked_until > NOW() RETURNING "+userColumns+";",
+		unlockToken))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
+		return User{}, fmt.Errorf("error unlocking user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) RecordLogin(ctx context.Context, id int, device, ip string) (LoginSighting, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return LoginSighting{}, fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE users SET failed_logins = 0, lockouts = 0 WHERE id = $1 AND (failed_logins > 0 OR lockouts > 0);", id)
+	if err != nil {
+		return LoginSighting{}, fmt.Errorf("error resetting failed logins: %w", err)
+	}
+
+	var logins, fromDevice, fromIP int
+
+	err = tx.QueryRow(
+		ctx,
+		"SELECT COUNT(*), COUNT(*) FILTER (WHERE device = $2), COUNT(*) FILTER (WHERE ip = $3) FROM login_devices WHERE user_id = $1;",
+		id, device, ip).Scan(&logins, &fromDevice, &fromIP)
+	if err != nil {
+		return LoginSighting{}, fmt.Errorf("error scanning row (login devices): %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		"INSERT INTO login_devices (user_id, device, ip) VALUES ($1, $2, $3) ON CONFLICT (user_id, device, ip) DO UPDATE SET last_seen_at = NOW();",
+		id, device, ip)
+	if err != nil {
+		return LoginSighting{}, fmt.Errorf("error inserting login device: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return LoginSighting{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	if logins == 0 {
+		return LoginSighting{First: true}, nil
+	}
+
+	return LoginSighting{NewDevice: fromDevice == 0, NewIP: fromIP == 0}, nil
+}
+
+// isUniqueViolation reports whether the statement broke a unique constraint, such as
+// the one on usernames.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func scanUser(row pgx.Row) (User, error) {
+	var user User
+
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Password, &user.DateOfBirth, &user.Locale, &user.Bio, &user.Timezone, &user.PendingEmail, &user.AvatarKey, &user.Verified, &user.DisabledAt, &user.FailedLogins, &user.LockedUntil, &user.TwoFactorEnabled)
+
+	return user, err
+}
+
+type PgOTPStore struct {
+	db *pgxpool.Pool
+}
+
+func NewOTPStore(db *pgxpool.Pool) *PgOTPStore {
+
+	return &PgOTPStore{db: db}
+}
+
+// CreateOTP stores the hashed code, replacing any code previously issued to the email.
+// The code expires after expiration minutes.
+func (s *PgOTPStore) CreateOTP(ctx context.Context, email string, code string, expiration int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM otps WHERE email = $1;", email)
+	if err != nil {
+		return fmt.Errorf("error deleting previous otps: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO otps (email, otp, expires_at) VALUES ($1, $2, NOW() + make_interval(mins => $3));", email, code, expiration)
+	if err != nil {
+		return fmt.Errorf("error inserting otp: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateOTP checks code against the hashed code issued to the email, which is
+// used up by a successful check.
+func (s *PgOTPStore) ValidateOTP(ctx context.Context, email string, code string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var hashedCode string
+	var expiresAt time.Time
+
+	err := s.db.QueryRow(ctx, "SELECT otp, expires_at FROM otps WHERE email = $1 ORDER BY created_at DESC LIMIT 1;", email).Scan(&hashedCode, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, helpers.ErrNotFound
+		}
+		return false, fmt.Errorf("error fetching otp: %w", err)
+	}
+
+	if expiresAt.Before(time.Now()) {
+		return false, helpers.ErrBadRequest
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hashedCode), []byte(code)) != nil {
+		return false, helpers.ErrBadRequest
+	}
+
+	if err := s.DeleteOTP(ctx, email); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (s *PgOTPStore) DeleteOTP(ctx context.Context, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	_, err := s.db.Exec(ctx, "DELETE FROM otps WHERE email = $1;", email)
+	if err != nil {
+		return fmt.Errorf("error deleting otp: %w", err)
+	}
+
+	return nil
+}
+
+type PgTwoFactorStore struct {
+	db *pgxpool.Pool
+}
+
+func NewTwoFactorStore(db *pgxpool.Pool) *PgTwoFactorStore {
+
+	return &PgTwoFactorStore{db: db}
+}
+
+func (s *PgTwoFactorStore) SetTOTPSecret(ctx context.Context, userID int, secret string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, "UPDATE users SET two_factor_secret = $2, two_factor_last_step = NULL, updated_at = NOW() WHERE id = $1 AND NOT two_factor_enabled;", userID, secret)
+	if err != nil {
+		return fmt.Errorf("error setting totp secret: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrConflict
+	}
+
+	return nil
+}
+
+func (s *PgTwoFactorStore) GetTOTPSecret(ctx context.Context, userID int) (string, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var secret *string
+	var enabled bool
+
+	err := s.db.QueryRow(ctx, "SELECT two_factor_secret, two_factor_enabled FROM users WHERE id = $1;", userID).Scan(&secret, &enabled)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", false, helpers.ErrNotFound
+		}
+		return "", false, fmt.Errorf("error fetching totp secret: %w", err)
+	}
+
+	if secret == nil {
+		return "", false, helpers.ErrNotFound
+	}
+
+	return *secret, enabled, nil
+}
+
+func (s *PgTwoFactorStore) EnableTwoFactor(ctx context.Context, userID int, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE users SET two_factor_enabled = TRUE, updated_at = NOW() WHERE id = $1;", userID)
+	if err != nil {
+		return fmt.Errorf("error enabling two factor: %w", err)
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PgTwoFactorStore) DisableTwoFactor(ctx context.Context, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "UPDATE users SET two_factor_enabled = FALSE, two_factor_secret = NULL, two_factor_last_step = NULL, updated_at = NOW() WHERE id = $1;", userID)
+	if err != nil {
+		return fmt.Errorf("error disabling two factor: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1;", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PgTwoFactorStore) UseTOTPStep(ctx context.Context, userID int, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, "UPDATE users SET two_factor_last_step = $2 WHERE id = $1 AND (two_factor_last_step IS NULL OR two_factor_last_step < $2);", userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error recording totp step: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (s *PgTwoFactorStore) UseRecoveryCode(ctx context.Context, userID int, recoveryCode string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(ctx, "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL;", userID, recoveryCode)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	return result.RowsAffected() == 1, nil
+}
+
+func (s *PgTwoFactorStore) ReplaceRecoveryCodes(ctx context.Context, userID int, recoveryCodes []string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodes); err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, recoveryCodes []string) error {
+	_, err := tx.Exec(ctx, "DELETE FROM recovery_codes WHERE user_id = $1;", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[]);", userID, recoveryCodes)
+	if err != nil {
+		return fmt.Errorf("error inserting recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+type PgIdentityStore struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityStore(db *pgxpool.Pool) *PgIdentityStore {
+
+	return &PgIdentityStore{db: db}
+}
+
+func (s *PgIdentityStore) FindUserByIdentity(ctx context.Context, provider, subject string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	user, err := scanUser(s.db.QueryRow(
+		ctx,
+		"SELECT "+userColumns+" FROM users WHERE id = (SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2);",
+		provider, subject))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrNotFound
+		}
+		return User{}, fmt.Errorf("error scanning row (find user by identity): %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *PgIdentityStore) LinkIdentity(ctx context.Context, userID int, provider, subject, email string) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(
+		ctx,
+		"INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING;",
+		userID, provider, subject, email)
+	if err != nil {
+		return fmt.Errorf("error linking identity: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrConflict
+	}
+
+	return nil
+}
+
+func (s *PgIdentityStore) CreateUserWithIdentity(ctx context.Context, body *CreateUserBody, provider, subject string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return User{}, fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// the provider verified the email, so the account skips the one-time code
+	user, err := scanUser(tx.QueryRow(
+		ctx,
+		"INSERT INTO users (username, email, first_name, last_name, password, locale, verified) VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'en'), TRUE) ON CONFLICT DO NOTHING RETURNING "+userColumns+";",
+		body.Username, body.Email, body.FirstName, body.LastName, body.Password, body.Locale))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, helpers.ErrConflict
+		}
+		return User{}, fmt.Errorf("error inserting user: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO user_identities (user_id, provider, subject, email) VALUES ($1, $2, $3, $4);", user.ID, provider, subject, body.Email)
+	if err != nil {
+		return User{}, fmt.Errorf("error inserting identity: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return User{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return user, nil
+}
+
+type PgMagicLinkStore struct {
+	db *pgxpool.Pool
+}
+
+func NewMagicLinkStore(db *pgxpool.Pool) *PgMagicLinkStore {
+
+	return &PgMagicLinkStore{db: db}
+}
+
+func (s *PgMagicLinkStore) CreateMagicLink(ctx context.Context, userID int, tokenHash string, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "DELETE FROM magic_links WHERE user_id = $1 AND (used_at IS NULL OR expires_at <= NOW());", userID)
+	if err != nil {
+		return fmt.Errorf("error deleting magic links: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO magic_links (user_id, token_hash, expires_at) VALUES ($1, $2, $3);", userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error inserting magic link: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PgMagicLinkStore) UseMagicLink(ctx context.Context, tokenHash string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var userID int
+
+	err := s.db.QueryRow(
+		ctx,
+		"UPDATE magic_links SET used_at = NOW() WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW() RETURNING user_id;",
+		tokenHash).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, helpers.ErrNotFound
+		}
+		return 0, fmt.Errorf("error using magic link: %w", err)
+	}
+
+	return userID, nil
+}
+
+type PgPersonalTokenStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPersonalTokenStore(db *pgxpool.Pool) *PgPersonalTokenStore {
+
+	return &PgPersonalTokenStore{db: db}
+}
+
+func (s *PgPersonalTokenStore) CreatePersonalToken(ctx context.Context, userID int, name, tokenHash, hint string, scopes []string, expiresAt time.Time) (PersonalToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var token PersonalToken
+
+	query := `INSERT INTO personal_access_tokens (user_id, name, token_hash, hint, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, name, hint, scopes, expires_at, created_at;`
+
+	err := s.db.QueryRow(ctx, query, userID, name, tokenHash, hint, scopes, expiresAt).
+		Scan(&token.ID, &token.Name, &token.Hint, &token.Scopes, &token.ExpiresAt, &token.CreatedAt)
+	if err != nil {
+		return PersonalToken{}, fmt.Errorf("error inserting personal access token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *PgPersonalTokenStore) ListPersonalTokens(ctx context.Context, userID int) ([]PersonalToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT id, name, hint, scopes, expires_at, last_used_at, created_at FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL ORDER BY created_at DESC;`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	tokens := make([]PersonalToken, 0)
+	for rows.Next() {
+		var token PersonalToken
+
+		err = rows.Scan(&token.ID, &token.Name, &token.Hint, &token.Scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning personal access token: %w", err)
+		}
+
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching personal access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *PgPersonalTokenStore) RevokePersonalToken(ctx context.Context, userID, tokenID int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(
+		ctx,
+		"UPDATE personal_access_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;",
+		tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking personal access token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PgPersonalTokenStore) UsePersonalToken(ctx context.Context, tokenHash string) (helpers.Principal, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	principal := helpers.Principal{Scopes: []string{}}
+
+	query := `UPDATE personal_access_tokens t SET last_used_at = NOW()
+		FROM users u
+		WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND t.expires_at > NOW()
+			AND u.id = t.user_id AND u.disabled_at IS NULL
+		RETURNING u.id, u.email, u.verified, t.scopes;`
+
+	err := s.db.QueryRow(ctx, query, tokenHash).Scan(&principal.UserID, &principal.Email, &principal.Verified, &principal.Scopes)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return helpers.Principal{}, helpers.ErrNotFound
+		}
+		return helpers.Principal{}, fmt.Errorf("error using personal access token: %w", err)
+	}
+
+	return principal, nil
+}
+
+type PgSessionStore struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionStore(db *pgxpool.Pool) *PgSessionStore {
+
+	return &PgSessionStore{db: db}
+}
+
+const sessionColumns = "id, user_id, user_agent, ip, created_at, last_seen_at, expires_at"
+
+func scanSession(row pgx.Row) (Session, error) {
+	var session Session
+
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt)
+
+	return session, err
+}
+
+func (s *PgSessionStore) CreateSession(ctx context.Context, userID int, refreshTokenHash, userAgent, ip string, expiresAt time.Time) (Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO sessions (user_id, refresh_token_hash, user_agent, ip, expires_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING ` + sessionColumns + ";"
+
+	session, err := scanSession(s.db.QueryRow(ctx, query, userID, refreshTokenHash, userAgent, ip, expiresAt))
+	if err != nil {
+		return Session{}, fmt.Errorf("error inserting session: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *PgSessionStore) RefreshSession(ctx context.Context, refreshTokenHash, newRefreshTokenHash, ip string, expiresAt time.Time) (Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE sessions s SET refresh_token_hash = $2, ip = $3, expires_at = $4, last_seen_at = NOW()
+		FROM users u
+		WHERE s.refresh_token_hash = $1 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+			AND u.id = s.user_id AND u.disabled_at IS NULL
+		RETURNING s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_seen_at, s.expires_at;`
+
+	session, err := scanSession(s.db.QueryRow(ctx, query, refreshTokenHash, newRefreshTokenHash, ip, expiresAt))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, helpers.ErrNotFound
+		}
+		return Session{}, fmt.Errorf("error refreshing session: %w", err)
+	}
+
+	return session, nil
+}
+
+func (s *PgSessionStore) TouchSession(ctx context.Context, sessionID, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `UPDATE sessions s SET last_seen_at = NOW()
+		FROM users u
+		WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND s.expires_at > NOW()
+			AND u.id = s.user_id AND u.disabled_at IS NULL;`
+
+	result, err := s.db.Exec(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("error touching session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PgSessionStore) ListSessions(ctx context.Context, userID int) ([]Session, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := "SELECT " + sessionColumns + ` FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW() ORDER BY last_seen_at DESC;`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := make([]Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+func (s *PgSessionStore) RevokeSession(ctx context.Context, userID, sessionID int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(
+		ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW();",
+		sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *PgSessionStore) RevokeOtherSessions(ctx context.Context, userID, keepSessionID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.Exec(
+		ctx,
+		"UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL AND expires_at > NOW();",
+		userID, keepSessionID)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+
+	return int(result.RowsAffected()), nil
+}
@@ -0,0 +1,418 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/totp"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TOTPIssuer names the account in authenticator apps.
+const TOTPIssuer = "Wishmate"
+
+// RecoveryCodeCount is how many recovery codes a user gets at a time, each works once.
+const RecoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled  = helpers.NewHTTPError(nil, http.StatusConflict, "two-factor authentication is already on", nil)
+	ErrTwoFactorDisabled = helpers.NewHTTPError(nil, http.StatusBadRequest, "two-factor authentication is off", nil)
+	ErrInvalidCode       = helpers.NewHTTPError(nil, http.StatusBadRequest, "invalid code", nil)
+)
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// currentUserID is the user AuthMiddleware authenticated.
+func currentUserID(request *http.Request) (int, bool) {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	return principal.UserID, ok
+}
+
+// EnrollTwoFactorHandler starts an enrollment, returning the secret to add to an
+// authenticator app. Two-factor authentication is on once ConfirmTwoFactorHandler
+// gets a first code.
+func (h *Handler) EnrollTwoFactorHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		helpers.HandleError(responseWriter, ErrTwoFactorEnabled)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	encrypted, err := helpers.Encrypt(h.EncryptionKey, secret)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	err = h.TwoFactorStore.SetTOTPSecret(request.Context(), user.ID, encrypted)
+	if err != nil {
+		if errors.Is(err, helpers.ErrConflict) {
+			helpers.HandleError(responseWriter, ErrTwoFactorEnabled)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Add the secret to an authenticator app and confirm with a code",
+		Data:    TwoFactorEnrollmentResponse{Secret: secret, URI: totp.URI(TOTPIssuer, user.Email, secret)},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// ConfirmTwoFactorHandler turns two-factor authentication on with a first code from the
+// enrolled app, returning the recovery codes. They are shown this once.
+func (h *Handler) ConfirmTwoFactorHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*ConfirmTwoFactorBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	secret, enabled, err := h.TwoFactorStore.GetTOTPSecret(request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrNotFound) {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "no two-factor enrollment to confirm", nil))
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if enabled {
+		helpers.HandleError(responseWriter, ErrTwoFactorEnabled)
+		return
+	}
+
+	valid, err := h.checkTOTP(request.Context(), userID, secret, body.Code)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if !valid {
+		helpers.HandleError(responseWriter, ErrInvalidCode)
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	err = h.TwoFactorStore.EnableTwoFactor(request.Context(), userID, hashes)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	slog.InfoContext(request.Context(), "two-factor authentication enabled", "user_id", userID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Two-factor authentication enabled, keep the recovery codes somewhere safe",
+		Data:    RecoveryCodesResponse{RecoveryCodes: codes},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off, once the user gave their
+// password and a code again.
+func (h *Handler) DisableTwoFactorHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	user, ok := h.reauthenticate(responseWriter, request)
+	if !ok {
+		return
+	}
+
+	err := h.TwoFactorStore.DisableTwoFactor(request.Context(), user.ID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	slog.InfoContext(request.Context(), "two-factor authentication disabled", "user_id", user.ID)
+
+	response := Response{
+		Status:  "Success",
+		Message: "Two-factor authentication disabled",
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// RegenerateRecoveryCodesHandler replaces every recovery code, used or not, once the
+// user gave their password and a code again.
+func (h *Handler) RegenerateRecoveryCodesHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	user, ok := h.reauthenticate(responseWriter, request)
+	if !ok {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	err = h.TwoFactorStore.ReplaceRecoveryCodes(request.Context(), user.ID, hashes)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	response := Response{
+		Status:  "Success",
+		Message: "Recovery codes regenerated, the previous ones no longer work",
+		Data:    RecoveryCodesResponse{RecoveryCodes: codes},
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
+
+// VerifyTwoFactorHandler is the second step of a login with two-factor authentication,
+// exchanging the challenge token and a code for the access token.
+func (h *Handler) VerifyTwoFactorHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	body, problems, err := helpers.DecodeAndValidate[*VerifyTwoFactorBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return
+	}
+
+	userID, err := helpers.DecodeChallengeToken(h.SecretKey, body.ChallengeToken)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return
+	}
+
+	valid, err := h.checkSecondFactor(request.Context(), user.ID, body.Code)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
+
+	if !valid {
+		if duration := h.recordFailedLogin(request.Context(), user); duration > 0 {
+			refuseLocked(responseWriter, duration)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if user.DisabledAt != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusForbidden, "account is disabled", nil))
+		return
+	}
+
+	h.logIn(responseWriter, request, user)
+}
+
+// reauthenticate checks the password and second factor of the authenticated user in
+// the ReauthenticateBody, writing the error response when they do not match.
+func (h *Handler) reauthenticate(responseWriter http.ResponseWriter, request *http.Request) (User, bool) {
+	body, problems, err := helpers.DecodeAndValidate[*ReauthenticateBody](request)
+
+	var clientError helpers.ClientError
+	ok := errors.As(err, &clientError)
+
+	if err != nil && problems == nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", nil))
+		return User{}, false
+	}
+
+	if err != nil && ok {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "invalid request body", problems))
+		return User{}, false
+	}
+
+	userID, ok := currentUserID(request)
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return User{}, false
+	}
+
+	user, err := h.Store.FindUserByID(request.Context(), userID)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return User{}, false
+	}
+
+	if !user.TwoFactorEnabled {
+		helpers.HandleError(responseWriter, ErrTwoFactorDisabled)
+		return User{}, false
+	}
+
+	if retryAfter := lockedFor(user); retryAfter > 0 {
+		refuseLocked(responseWriter, retryAfter)
+		return User{}, false
+	}
+
+	valid := h.Store.ComparePasswords(user.Password, body.Password)
+	if valid {
+		valid, err = h.checkSecondFactor(request.Context(), user.ID, body.Code)
+		if err != nil {
+			helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+			return User{}, false
+		}
+	}
+
+	if !valid {
+		// a stolen session should not be a way around the lockout
+		if duration := h.recordFailedLogin(request.Context(), user); duration > 0 {
+			refuseLocked(responseWriter, duration)
+			return User{}, false
+		}
+
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return User{}, false
+	}
+
+	return user, true
+}
+
+// checkSecondFactor accepts a code from the authenticator app or an unused recovery
+// code, using either up.
+func (h *Handler) checkSecondFactor(ctx context.Context, userID int, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	if !isTOTPCode(code) {
+		return h.TwoFactorStore.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	secret, enabled, err := h.TwoFactorStore.GetTOTPSecret(ctx, userID)
+	if err != nil {
+		if errors.Is(err, helpers.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if !enabled {
+		return false, nil
+	}
+
+	return h.checkTOTP(ctx, userID, secret, code)
+}
+
+// checkTOTP checks code against the encrypted secret, refusing a code already used.
+func (h *Handler) checkTOTP(ctx context.Context, userID int, encryptedSecret, code string) (bool, error) {
+	secret, err := helpers.Decrypt(h.EncryptionKey, encryptedSecret)
+	if err != nil {
+		return false, fmt.Errorf("error decrypting totp secret: %w", err)
+	}
+
+	step, valid := totp.Validate(secret, code, time.Now())
+	if !valid {
+		return false, nil
+	}
+
+	return h.TwoFactorStore.UseTOTPStep(ctx, userID, step)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// newRecoveryCodes returns the recovery codes to show the user, written xxxxx-xxxxx,
+// and the hashes the store keeps.
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(raw))[:10]
+
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashToken(code)
+	}
+
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode accepts a recovery code however the user typed it.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -1,13 +1,28 @@
 package config
 
 import (
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/health"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
 	"github.com/Adedunmol/wish-mate/internal/queue"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Config struct {
-	DB     *pgx.Conn
-	Router *chi.Mux
-	Queue  queue.Queue
+	DB        *pgxpool.Pool
+	Router    *chi.Mux
+	Queue     queue.Queue
+	Mailer    email.Mailer
+	Templates *email.Templates
+	Health    *health.Handler
+	Settings  Settings
+	// Tokens sign and verify the access tokens, see Settings.TokenKeys.
+	Tokens *helpers.Keys
+	// RateLimiter counts the requests of the throttled routes, none are throttled when nil.
+	RateLimiter middlewares.Limiter
+	// Images stores the uploaded images, see Settings.Images.
+	Images *media.Images
 }
@@ -4,26 +4,63 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"github.com/jackc/pgx/v5"
-	"os"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func ConnectDB() (*pgx.Conn, error) {
-	connectionStr, exists := os.LookupEnv("DATABASE_URL")
+// ConnectDB opens a connection pool to DATABASE_URL, sized by the DB_* settings.
+// Anything left unset keeps the pgxpool default (or the pool_* parameters of the
+// connection string).
+func ConnectDB(ctx context.Context, settings Settings) (*pgxpool.Pool, error) {
+	poolConfig, err := pgxpool.ParseConfig(settings.DatabaseURL.Reveal())
+	if err != nil {
+		return nil, errors.New("error parsing database url")
+	}
 
-	if !exists {
-		return nil, errors.New("DATABASE_URL environment variable not set")
+	if err := applyPoolSettings(poolConfig, settings.Pool); err != nil {
+		return nil, err
 	}
 
-	conn, err := pgx.Connect(context.Background(), connectionStr)
+	poolConfig.ConnConfig.Tracer = tracing.QueryTracer{}
 
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to database: %v", err)
 	}
 
-	if err := conn.Ping(context.Background()); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("error pinging database: %v", err)
 	}
 
-	return conn, nil
+	return pool, nil
+}
+
+func applyPoolSettings(poolConfig *pgxpool.Config, pool PoolSettings) error {
+	if pool.MaxConns != 0 {
+		poolConfig.MaxConns = pool.MaxConns
+	}
+	if pool.MinConns != 0 {
+		poolConfig.MinConns = pool.MinConns
+	}
+	if pool.MaxConnLifetime != 0 {
+		poolConfig.MaxConnLifetime = pool.MaxConnLifetime
+	}
+	if pool.MaxConnIdleTime != 0 {
+		poolConfig.MaxConnIdleTime = pool.MaxConnIdleTime
+	}
+	if pool.HealthCheckPeriod != 0 {
+		poolConfig.HealthCheckPeriod = pool.HealthCheckPeriod
+	}
+
+	// the defaults may come from the connection string, so the bounds are checked here
+	if poolConfig.MaxConns < 1 {
+		return errors.New("DB_MAX_CONNS must be at least 1")
+	}
+
+	if poolConfig.MinConns > poolConfig.MaxConns {
+		return fmt.Errorf("DB_MIN_CONNS (%d) is greater than DB_MAX_CONNS (%d)", poolConfig.MinConns, poolConfig.MaxConns)
+	}
+
+	return nil
 }
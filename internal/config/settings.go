@@ -0,0 +1,767 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/joho/godotenv"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPort               = 5000
+	DefaultShutdownDrainDelay = 5 * time.Second
+	DefaultAppURL             = "http://localhost:3000"
+	DefaultAPIURL             = "http://localhost:5000"
+	DefaultJWTAudience        = "wishmate"
+	MinSecretKeyLength        = 32
+)
+
+// Secret is a setting that is never printed or logged, Reveal returns its value.
+type Secret string
+
+func (s Secret) Reveal() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+
+	return logging.Redacted
+}
+
+func (s Secret) GoString() string {
+	return strconv.Quote(s.String())
+}
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// PoolSettings size the pgx pool, zero values keep the pgxpool defaults.
+type PoolSettings struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+}
+
+// RateLimitSettings are the policies of the throttled routes, each written as
+// limit/window such as 10/15m, or off.
+type RateLimitSettings struct {
+	Login middlewares.Policy
+	// LoginIP bounds the logins from one address whatever the email, Login alone lets
+	// an address try every account.
+	LoginIP       middlewares.Policy
+	Register      middlewares.Policy
+	OTP           middlewares.Policy
+	Verify        middlewares.Policy
+	FriendRequest middlewares.Policy
+}
+
+// LockoutSettings lock an account after MaxFailures failed logins in a row, for
+// Duration doubled by each lockout since the last successful login, up to MaxDuration.
+type LockoutSettings struct {
+	MaxFailures int
+	Duration    time.Duration
+	MaxDuration time.Duration
+}
+
+// The MAGIC_LINK_BINDING values, which tie a sign in link to where it was requested from.
+const (
+	MagicLinkBindNone   = "none"
+	MagicLinkBindDevice = "device"
+	MagicLinkBindIP     = "ip"
+	MagicLinkBindBoth   = "both"
+)
+
+// MagicLinkSettings are how long the sign in links last and what they are bound to.
+type MagicLinkSettings struct {
+	TTL     time.Duration
+	Binding string
+}
+
+func (s MagicLinkSettings) BindsDevice() bool {
+	return s.Binding == MagicLinkBindDevice || s.Binding == MagicLinkBindBoth
+}
+
+func (s MagicLinkSettings) BindsIP() bool {
+	return s.Binding == MagicLinkBindIP || s.Binding == MagicLinkBindBoth
+}
+
+// JWTSettings are the keys and the claims of the access tokens. Without KeysDir the
+// tokens are signed with SECRET_KEY, which only this API can verify.
+type JWTSettings struct {
+	// KeysDir holds the PEM private keys, see helpers.LoadKeys.
+	KeysDir  string
+	Issuer   string
+	Audience string
+}
+
+// OIDCSettings are the OpenID Connect providers users may sign in with, Google and
+// one more of any kind. Each is on when its client id is set.
+type OIDCSettings struct {
+	Google  oidc.Config
+	Generic oidc.Config
+}
+
+// Providers lists the providers that are on.
+func (s OIDCSettings) Providers() []oidc.Config {
+	var providers []oidc.Config
+
+	for _, provider := range []oidc.Config{s.Google, s.Generic} {
+		if provider.ClientID != "" {
+			providers = append(providers, provider)
+		}
+	}
+
+	return providers
+}
+
+// UploadSettings are where the uploaded images are kept and how large they may be.
+type UploadSettings struct {
+	// Store is media.StoreLocal, keeping the images in Dir, or media.StoreS3.
+	Store    string
+	Dir      string
+	S3       media.S3Config
+	MaxBytes int64
+	// LinkTTL is how long the links to the images work.
+	LinkTTL time.Duration
+}
+
+// Settings is the configuration of every process, read once at startup by Load.
+type Settings struct {
+	Port        int
+	DatabaseURL Secret
+	Pool        PoolSettings
+	// CheckMigrations makes the web server refuse to start against an outdated schema.
+	CheckMigrations bool
+	RedisURL        Secret
+
+	SecretKey   Secret
+	AdminAPIKey Secret
+	// EncryptionKey holds the helpers.EncryptionKeySize bytes that seal the values
+	// stored at rest, such as the two-factor secrets.
+	EncryptionKey Secret
+	// AppURL is the address of the client app, which the links in emails point to.
+	AppURL string
+	// APIURL is the public address of this API, which the OpenID Connect providers
+	// redirect back to.
+	APIURL    string
+	Lockout   LockoutSettings
+	MagicLink MagicLinkSettings
+	OIDC      OIDCSettings
+	JWT       JWTSettings
+	Uploads   UploadSettings
+
+	Mail email.TransportConfig
+
+	LogLevel       slog.Level
+	MetricsAddr    string
+	TracesExporter string
+	OTLPEndpoint   string
+
+	// TrustProxy takes the client address from X-Forwarded-For and X-Real-IP, only
+	// safe behind a proxy that sets them.
+	TrustProxy     bool
+	RateLimitStore string
+	RateLimits     RateLimitSettings
+
+	// ShutdownDrainDelay is how long the web server keeps serving once readiness fails,
+	// which should cover the probe period of the load balancer.
+	ShutdownDrainDelay time.Duration
+}
+
+// ValidationError lists every setting that is missing or invalid, so all of them can
+// be fixed at once.
+type ValidationError struct {
+	Problems map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	keys := make([]string, 0, len(e.Problems))
+	for key := range e.Problems {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	report := make([]string, 0, len(keys))
+	for _, key := range keys {
+		report = append(report, fmt.Sprintf("%s %s", key, e.Problems[key]))
+	}
+
+	return "invalid configuration: " + strings.Join(report, "; ")
+}
+
+// Load reads the settings from the environment, falling back to the file named by
+// CONFIG_FILE and then to a .env file in the working directory. Both files hold
+// KEY=value lines and are optional, although CONFIG_FILE must exist when it is set.
+func Load() (Settings, error) {
+	values := map[string]string{}
+
+	if dotenv, err := godotenv.Read(); err == nil {
+		values = dotenv
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Settings{}, fmt.Errorf("error reading .env: %w", err)
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		file, err := godotenv.Read(path)
+		if err != nil {
+			return Settings{}, fmt.Errorf("error reading CONFIG_FILE: %w", err)
+		}
+
+		for key, value := range file {
+			values[key] = value
+		}
+	}
+
+	return Parse(func(key string) string {
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+
+		return values[key]
+	})
+}
+
+// Parse builds the settings from lookup, which returns "" for a setting that is not
+// set, applying the defaults and validating every value.
+func Parse(lookup func(key string) string) (Settings, error) {
+	p := parser{lookup: lookup, problems: map[string]string{}}
+
+	secretKey := p.lookup("SECRET_KEY")
+
+	settings := Settings{
+		Port:            p.integer("PORT", DefaultPort),
+		DatabaseURL:     Secret(p.url("DATABASE_URL", "postgres", "postgresql")),
+		CheckMigrations: p.boolean("DB_CHECK_MIGRATIONS"),
+		RedisURL:        Secret(p.url("REDIS_URL", "redis", "rediss")),
+		Pool: PoolSettings{
+			MaxConns:          int32(p.integer("DB_MAX_CONNS", 0)),
+			MinConns:          int32(p.integer("DB_MIN_CONNS", 0)),
+			MaxConnLifetime:   p.duration("DB_MAX_CONN_LIFETIME", 0),
+			MaxConnIdleTime:   p.duration("DB_MAX_CONN_IDLE_TIME", 0),
+			HealthCheckPeriod: p.duration("DB_HEALTH_CHECK_PERIOD", 0),
+		},
+		SecretKey:     Secret(secretKey),
+		AdminAPIKey:   Secret(p.lookup("ADMIN_API_KEY")),
+		EncryptionKey: p.encryptionKey("ENCRYPTION_KEY", secretKey),
+		AppURL:        p.link("APP_URL", DefaultAppURL),
+		APIURL:        p.link("API_URL", DefaultAPIURL),
+		Lockout: LockoutSettings{
+			MaxFailures: p.integer("LOGIN_MAX_FAILURES", 5),
+			Duration:    p.duration("LOGIN_LOCKOUT", 15*time.Minute),
+			MaxDuration: p.duration("LOGIN_LOCKOUT_MAX", 24*time.Hour),
+		},
+		MagicLink: MagicLinkSettings{
+			TTL:     p.duration("MAGIC_LINK_TTL", 15*time.Minute),
+			Binding: p.oneOf("MAGIC_LINK_BINDING", MagicLinkBindNone, MagicLinkBindNone, MagicLinkBindDevice, MagicLinkBindIP, MagicLinkBindBoth),
+		},
+		Mail: email.TransportConfig{
+			Transport:    p.oneOf("MAIL_TRANSPORT", email.TransportSMTP, email.TransportSMTP, email.TransportMaildir, email.TransportEML, email.TransportLog),
+			From:         p.lookup("FROM_EMAIL"),
+			SMTPAddr:     p.lookup("SMTP_ADDR"),
+			SMTPUsername: p.lookup("FROM_EMAIL"),
+			SMTPPassword: p.lookup("FROM_EMAIL_PASSWORD"),
+			SMTPTLS:      p.oneOf("SMTP_TLS", email.TLSStartTLS, email.TLSStartTLS, email.TLSImplicit, email.TLSNone),
+			SMTPTimeout:  p.duration("SMTP_TIMEOUT", email.DefaultSMTPTimeout),
+			Dir:          p.string("MAIL_DIR", "tmp/mail"),
+		},
+		Uploads: UploadSettings{
+			Store:    p.oneOf("BLOB_STORE", media.StoreLocal, media.StoreLocal, media.StoreS3),
+			Dir:      p.string("BLOB_DIR", "tmp/blobs"),
+			MaxBytes: int64(p.integer("UPLOAD_MAX_BYTES", media.DefaultMaxBytes)),
+			LinkTTL:  p.duration("BLOB_LINK_TTL", media.DefaultLinkTTL),
+			S3: media.S3Config{
+				Endpoint:        p.link("S3_ENDPOINT", ""),
+				Region:          p.string("S3_REGION", media.DefaultS3Region),
+				Bucket:          p.lookup("S3_BUCKET"),
+				AccessKeyID:     p.lookup("S3_ACCESS_KEY_ID"),
+				SecretAccessKey: p.lookup("S3_SECRET_ACCESS_KEY"),
+				PathStyle:       p.boolean("S3_PATH_STYLE"),
+			},
+		},
+		LogLevel:       p.level("LOG_LEVEL"),
+		MetricsAddr:    p.lookup("METRICS_ADDR"),
+		TracesExporter: p.oneOf("OTEL_TRACES_EXPORTER", tracing.ExporterNone, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout),
+		OTLPEndpoint:   p.lookup("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		TrustProxy:     p.boolean("TRUST_PROXY"),
+		RateLimitStore: p.oneOf("RATE_LIMIT_STORE", middlewares.RateLimitStoreRedis, middlewares.RateLimitStoreRedis, middlewares.RateLimitStoreMemory),
+		RateLimits: RateLimitSettings{
+			Login:         p.policy("RATE_LIMIT_LOGIN", "login", 10, 15*time.Minute),
+			LoginIP:       p.policy("RATE_LIMIT_LOGIN_IP", "login_ip", 50, 15*time.Minute),
+			Register:      p.policy("RATE_LIMIT_REGISTER", "register", 5, time.Hour),
+			OTP:           p.policy("RATE_LIMIT_OTP", "otp", 5, time.Hour),
+			Verify:        p.policy("RATE_LIMIT_VERIFY", "verify", 10, 15*time.Minute),
+			FriendRequest: p.policy("RATE_LIMIT_FRIEND_REQUEST", "friend_request", 30, time.Hour),
+		},
+		ShutdownDrainDelay: p.duration("SHUTDOWN_DRAIN_DELAY", DefaultShutdownDrainDelay),
+	}
+
+	settings.OIDC = p.oidc(settings.APIURL)
+
+	settings.JWT = JWTSettings{
+		KeysDir:  p.lookup("JWT_KEYS_DIR"),
+		Issuer:   p.string("JWT_ISSUER", settings.APIURL),
+		Audience: p.string("JWT_AUDIENCE", DefaultJWTAudience),
+	}
+
+	if settings.Port < 1 || settings.Port > 65535 {
+		p.problem("PORT", "must be between 1 and 65535")
+	}
+
+	if len(settings.SecretKey) < MinSecretKeyLength {
+		p.problem("SECRET_KEY", fmt.Sprintf("must be at least %d characters", MinSecretKeyLength))
+	}
+
+	if settings.JWT.KeysDir != "" {
+		if _, err := settings.TokenKeys(); err != nil {
+			p.problem("JWT_KEYS_DIR", err.Error())
+		}
+	}
+
+	if settings.Lockout.MaxFailures > 0 && settings.Lockout.Duration == 0 {
+		p.problem("LOGIN_LOCKOUT", "must be longer than 0s, set LOGIN_MAX_FAILURES=0 to turn lockouts off")
+	}
+
+	if settings.Lockout.MaxDuration < settings.Lockout.Duration {
+		p.problem("LOGIN_LOCKOUT_MAX", "must be at least LOGIN_LOCKOUT")
+	}
+
+	if settings.MagicLink.TTL < time.Minute || settings.MagicLink.TTL > time.Hour {
+		p.problem("MAGIC_LINK_TTL", "must be between 1m and 1h")
+	}
+
+	// a timeout of 0 would fail every delivery before it starts
+	if settings.Mail.SMTPTimeout <= 0 {
+		p.problem("SMTP_TIMEOUT", "must be longer than 0s")
+	}
+
+	if settings.Uploads.MaxBytes <= 0 {
+		p.problem("UPLOAD_MAX_BYTES", "must be at least 1")
+	}
+
+	// S3 refuses presigned links that work for longer
+	if settings.Uploads.LinkTTL < time.Minute || settings.Uploads.LinkTTL > 7*24*time.Hour {
+		p.problem("BLOB_LINK_TTL", "must be between 1m and 168h")
+	}
+
+	if settings.Uploads.Store == media.StoreS3 {
+		for key, value := range map[string]string{
+			"S3_BUCKET":            settings.Uploads.S3.Bucket,
+			"S3_ACCESS_KEY_ID":     settings.Uploads.S3.AccessKeyID,
+			"S3_SECRET_ACCESS_KEY": settings.Uploads.S3.SecretAccessKey,
+		} {
+			if value == "" {
+				p.problem(key, "is required by the s3 blob store")
+			}
+		}
+	}
+
+	if settings.Pool.MaxConns != 0 && settings.Pool.MinConns > settings.Pool.MaxConns {
+		p.problem("DB_MIN_CONNS", "is greater than DB_MAX_CONNS")
+	}
+
+	if settings.Mail.Transport == email.TransportSMTP && settings.Mail.SMTPAddr == "" {
+		p.problem("SMTP_ADDR", "is required by the smtp transport")
+	}
+
+	if len(p.problems) > 0 {
+		return settings, &ValidationError{Problems: p.problems}
+	}
+
+	return settings, nil
+}
+
+// TokenKeys are the keys that sign and verify the access tokens, those in
+// JWT_KEYS_DIR or else SECRET_KEY.
+func (s Settings) TokenKeys() (*helpers.Keys, error) {
+	if s.JWT.KeysDir == "" {
+		return helpers.NewSecretKeys(s.JWT.Issuer, s.JWT.Audience, []byte(s.SecretKey.Reveal())), nil
+	}
+
+	return helpers.LoadKeys(s.JWT.KeysDir, s.JWT.Issuer, s.JWT.Audience)
+}
+
+// Images stores the uploads in the blob store of the settings. The links to a local
+// store point to /blobs on APIURL, signed with a key derived from SECRET_KEY.
+func (s Settings) Images() *media.Images {
+	var store media.BlobStore
+
+	switch s.Uploads.Store {
+	case media.StoreS3:
+		store = media.NewS3Store(s.Uploads.S3, &http.Client{Timeout: 30 * time.Second})
+	default:
+		signingKey := sha256.Sum256([]byte("wishmate blob links:" + s.SecretKey.Reveal()))
+		store = media.NewLocalStore(s.Uploads.Dir, strings.TrimSuffix(s.APIURL, "/")+"/blobs", signingKey[:])
+	}
+
+	return &media.Images{Store: store, MaxBytes: s.Uploads.MaxBytes, LinkTTL: s.Uploads.LinkTTL}
+}
+
+// Redacted lists every setting by its variable name, with the secrets and the
+// passwords in URLs masked. It is what String and LogValue print.
+func (s Settings) Redacted() map[string]string {
+	return map[string]string{
+		"PORT":                        strconv.Itoa(s.Port),
+		"DATABASE_URL":                redactURL(s.DatabaseURL),
+		"DB_CHECK_MIGRATIONS":         strconv.FormatBool(s.CheckMigrations),
+		"DB_MAX_CONNS":                strconv.Itoa(int(s.Pool.MaxConns)),
+		"DB_MIN_CONNS":                strconv.Itoa(int(s.Pool.MinConns)),
+		"DB_MAX_CONN_LIFETIME":        s.Pool.MaxConnLifetime.String(),
+		"DB_MAX_CONN_IDLE_TIME":       s.Pool.MaxConnIdleTime.String(),
+		"DB_HEALTH_CHECK_PERIOD":      s.Pool.HealthCheckPeriod.String(),
+		"REDIS_URL":                   redactURL(s.RedisURL),
+		"SECRET_KEY":                  s.SecretKey.String(),
+		"ADMIN_API_KEY":               s.AdminAPIKey.String(),
+		"ENCRYPTION_KEY":              s.EncryptionKey.String(),
+		"APP_URL":                     s.AppURL,
+		"API_URL":                     s.APIURL,
+		"GOOGLE_CLIENT_ID":            s.OIDC.Google.ClientID,
+		"GOOGLE_CLIENT_SECRET":        Secret(s.OIDC.Google.ClientSecret).String(),
+		"OIDC_NAME":                   s.OIDC.Generic.Name,
+		"OIDC_ISSUER":                 s.OIDC.Generic.Issuer,
+		"OIDC_CLIENT_ID":              s.OIDC.Generic.ClientID,
+		"OIDC_CLIENT_SECRET":          Secret(s.OIDC.Generic.ClientSecret).String(),
+		"OIDC_SCOPES":                 strings.Join(s.OIDC.Generic.Scopes, " "),
+		"JWT_KEYS_DIR":                s.JWT.KeysDir,
+		"JWT_ISSUER":                  s.JWT.Issuer,
+		"JWT_AUDIENCE":                s.JWT.Audience,
+		"LOGIN_MAX_FAILURES":          strconv.Itoa(s.Lockout.MaxFailures),
+		"LOGIN_LOCKOUT":               s.Lockout.Duration.String(),
+		"LOGIN_LOCKOUT_MAX":           s.Lockout.MaxDuration.String(),
+		"MAGIC_LINK_TTL":              s.MagicLink.TTL.String(),
+		"MAGIC_LINK_BINDING":          s.MagicLink.Binding,
+		"BLOB_STORE":                  s.Uploads.Store,
+		"BLOB_DIR":                    s.Uploads.Dir,
+		"BLOB_LINK_TTL":               s.Uploads.LinkTTL.String(),
+		"UPLOAD_MAX_BYTES":            strconv.FormatInt(s.Uploads.MaxBytes, 10),
+		"S3_ENDPOINT":                 s.Uploads.S3.Endpoint,
+		"S3_REGION":                   s.Uploads.S3.Region,
+		"S3_BUCKET":                   s.Uploads.S3.Bucket,
+		"S3_ACCESS_KEY_ID":            s.Uploads.S3.AccessKeyID,
+		"S3_SECRET_ACCESS_KEY":        Secret(s.Uploads.S3.SecretAccessKey).String(),
+		"S3_PATH_STYLE":               strconv.FormatBool(s.Uploads.S3.PathStyle),
+		"MAIL_TRANSPORT":              s.Mail.Transport,
+		"FROM_EMAIL":                  s.Mail.From,
+		"FROM_EMAIL_PASSWORD":         Secret(s.Mail.SMTPPassword).String(),
+		"SMTP_ADDR":                   s.Mail.SMTPAddr,
+		"SMTP_TLS":                    s.Mail.SMTPTLS,
+		"SMTP_TIMEOUT":                s.Mail.SMTPTimeout.String(),
+		"MAIL_DIR":                    s.Mail.Dir,
+		"LOG_LEVEL":                   s.LogLevel.String(),
+		"METRICS_ADDR":                s.MetricsAddr,
+		"OTEL_TRACES_EXPORTER":        s.TracesExporter,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": s.OTLPEndpoint,
+		"TRUST_PROXY":                 strconv.FormatBool(s.TrustProxy),
+		"RATE_LIMIT_STORE":            s.RateLimitStore,
+		"RATE_LIMIT_LOGIN":            formatPolicy(s.RateLimits.Login),
+		"RATE_LIMIT_LOGIN_IP":         formatPolicy(s.RateLimits.LoginIP),
+		"RATE_LIMIT_REGISTER":         formatPolicy(s.RateLimits.Register),
+		"RATE_LIMIT_OTP":              formatPolicy(s.RateLimits.OTP),
+		"RATE_LIMIT_VERIFY":           formatPolicy(s.RateLimits.Verify),
+		"RATE_LIMIT_FRIEND_REQUEST":   formatPolicy(s.RateLimits.FriendRequest),
+		"SHUTDOWN_DRAIN_DELAY":        s.ShutdownDrainDelay.String(),
+	}
+}
+
+func (s Settings) String() string {
+	redacted := s.Redacted()
+
+	keys := make([]string, 0, len(redacted))
+	for key := range redacted {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+"="+redacted[key])
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (s Settings) GoString() string {
+	return s.String()
+}
+
+func (s Settings) LogValue() slog.Value {
+	redacted := s.Redacted()
+
+	attrs := make([]slog.Attr, 0, len(redacted))
+	for key, value := range redacted {
+		attrs = append(attrs, slog.String(key, value))
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+
+	return slog.GroupValue(attrs...)
+}
+
+func formatPolicy(policy middlewares.Policy) string {
+	if policy.Limit == 0 {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%s", policy.Limit, policy.Window)
+}
+
+// redactURL masks the password of a connection URL, keeping the rest readable.
+func redactURL(value Secret) string {
+	u, err := url.Parse(value.Reveal())
+	if err != nil {
+		return value.String()
+	}
+
+	return u.Redacted()
+}
+
+type parser struct {
+	lookup   func(key string) string
+	problems map[string]string
+}
+
+func (p *parser) problem(key, message string) {
+	if _, ok := p.problems[key]; !ok {
+		p.problems[key] = message
+	}
+}
+
+func (p *parser) string(key, fallback string) string {
+	if value := p.lookup(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+func (p *parser) integer(key string, fallback int) int {
+	value := p.lookup(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		p.problem(key, fmt.Sprintf("must be a positive integer, got %q", value))
+		return fallback
+	}
+
+	return n
+}
+
+func (p *parser) duration(key string, fallback time.Duration) time.Duration {
+	value := p.lookup(key)
+	if value == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		p.problem(key, fmt.Sprintf("must be a duration such as 30s or 5m, got %q", value))
+		return fallback
+	}
+
+	return d
+}
+
+func (p *parser) boolean(key string) bool {
+	value := p.lookup(key)
+	if value == "" {
+		return false
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.problem(key, fmt.Sprintf("must be true or false, got %q", value))
+	}
+
+	return b
+}
+
+// oneOf returns the value of key, which must be one of allowed, or the fallback.
+func (p *parser) oneOf(key, fallback string, allowed ...string) string {
+	value := p.lookup(key)
+	if value == "" {
+		return fallback
+	}
+
+	for _, option := range allowed {
+		if value == option {
+			return value
+		}
+	}
+
+	p.problem(key, fmt.Sprintf("must be one of %s, got %q", strings.Join(allowed, ", "), value))
+	return fallback
+}
+
+// url returns a required URL, which must use one of the schemes.
+func (p *parser) url(key string, schemes ...string) string {
+	value := p.lookup(key)
+	if value == "" {
+		p.problem(key, "is required")
+		return ""
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		// the error would repeat the value, with its password
+		p.problem(key, "must be a valid URL")
+		return value
+	}
+
+	for _, scheme := range schemes {
+		if u.Scheme == scheme {
+			return value
+		}
+	}
+
+	p.problem(key, fmt.Sprintf("must be a %s:// URL", schemes[0]))
+	return value
+}
+
+// link returns an http or https URL, or the fallback when key is not set.
+func (p *parser) link(key, fallback string) string {
+	value := p.lookup(key)
+	if value == "" {
+		return fallback
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		p.problem(key, fmt.Sprintf("must be an http:// or https:// URL, got %q", value))
+		return fallback
+	}
+
+	return value
+}
+
+// encryptionKey reads a key written as hex, or else derives one from the secret key,
+// in which case changing SECRET_KEY makes the values encrypted before unreadable.
+func (p *parser) encryptionKey(key, secretKey string) Secret {
+	value := p.lookup(key)
+	if value == "" {
+		derived := sha256.Sum256([]byte("wishmate encryption key:" + secretKey))
+		return Secret(derived[:])
+	}
+
+	decoded, err := hex.DecodeString(value)
+	if err != nil || len(decoded) != helpers.EncryptionKeySize {
+		// the error would repeat the key
+		p.problem(key, fmt.Sprintf("must be %d hex characters", 2*helpers.EncryptionKeySize))
+		return ""
+	}
+
+	return Secret(decoded)
+}
+
+// providerName is what a provider may be called, it is part of the routes.
+var providerName = regexp.MustCompile(`^[a-z0-9-]{1,32}$`)
+
+// oidc reads the OpenID Connect providers, whose callbacks are routes of the API at apiURL.
+func (p *parser) oidc(apiURL string) OIDCSettings {
+	callback := func(name string) string {
+		return strings.TrimSuffix(apiURL, "/") + "/auth/oidc/" + name + "/callback"
+	}
+
+	google := oidc.Config{
+		Name:         "google",
+		Issuer:       oidc.GoogleIssuer,
+		ClientID:     p.lookup("GOOGLE_CLIENT_ID"),
+		ClientSecret: p.lookup("GOOGLE_CLIENT_SECRET"),
+		RedirectURL:  callback("google"),
+	}
+
+	if google.ClientID != "" && google.ClientSecret == "" {
+		p.problem("GOOGLE_CLIENT_SECRET", "is required with GOOGLE_CLIENT_ID")
+	}
+
+	generic := oidc.Config{
+		Name:         p.string("OIDC_NAME", "oidc"),
+		ClientID:     p.lookup("OIDC_CLIENT_ID"),
+		ClientSecret: p.lookup("OIDC_CLIENT_SECRET"),
+		Scopes:       strings.Fields(p.lookup("OIDC_SCOPES")),
+	}
+
+	if generic.ClientID == "" {
+		return OIDCSettings{Google: google}
+	}
+
+	generic.Issuer = p.url("OIDC_ISSUER", "https", "http")
+	generic.RedirectURL = callback(generic.Name)
+
+	if !providerName.MatchString(generic.Name) || generic.Name == google.Name {
+		p.problem("OIDC_NAME", fmt.Sprintf("must be lowercase letters, digits and dashes other than google, got %q", generic.Name))
+	}
+
+	if generic.ClientSecret == "" {
+		p.problem("OIDC_CLIENT_SECRET", "is required with OIDC_CLIENT_ID")
+	}
+
+	return OIDCSettings{Google: google, Generic: generic}
+}
+
+// policy reads a rate limit written as limit/window, or off.
+func (p *parser) policy(key, name string, limit int, window time.Duration) middlewares.Policy {
+	policy := middlewares.Policy{Name: name, Limit: limit, Window: window}
+
+	value := p.lookup(key)
+	switch value {
+	case "":
+		return policy
+	case "off":
+		policy.Limit = 0
+		return policy
+	}
+
+	limitValue, windowValue, found := strings.Cut(value, "/")
+	n, err := strconv.Atoi(limitValue)
+	d, durationErr := time.ParseDuration(windowValue)
+	if !found || err != nil || n < 1 || durationErr != nil || d < time.Second {
+		p.problem(key, fmt.Sprintf("must be limit/window such as 10/15m, or off, got %q", value))
+		return policy
+	}
+
+	policy.Limit, policy.Window = n, d
+	return policy
+}
+
+func (p *parser) level(key string) slog.Level {
+	var level slog.Level
+
+	value := p.lookup(key)
+	if value == "" {
+		return level
+	}
+
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		p.problem(key, fmt.Sprintf("must be debug, info, warn or error, got %q", value))
+	}
+
+	return level
+}
@@ -0,0 +1,26 @@
+// Package docs serves the OpenAPI description of the API and a page to browse it.
+// openapi.json is written by hand, the tests keep it in line with the router and the DTOs.
+package docs
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed index.html
+var page []byte
+
+func SpecHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusOK)
+	responseWriter.Write(Spec)
+}
+
+func PageHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	responseWriter.Header().Set("Content-Type", "text/html; charset=utf-8")
+	responseWriter.WriteHeader(http.StatusOK)
+	responseWriter.Write(page)
+}
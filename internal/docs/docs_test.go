@@ -0,0 +1,307 @@
+package docs_test
+
+import (
+	"encoding/json"
+	"github.com/Adedunmol/wish-mate/internal/admin"
+	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/docs"
+	"github.com/Adedunmol/wish-mate/internal/friendship"
+	"github.com/Adedunmol/wish-mate/internal/health"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/routes"
+	"github.com/Adedunmol/wish-mate/internal/wishlist"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+type spec struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Required   []string                   `json:"required"`
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+
+	var s spec
+	if err := json.Unmarshal(docs.Spec, &s); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	return s
+}
+
+func TestSpecCoversRoutes(t *testing.T) {
+	s := loadSpec(t)
+
+	router := chi.NewRouter()
+	routes.SetupRoutes(config.Config{Router: router})
+
+	mounted := map[string]bool{}
+
+	err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		// a subrouter's "/" is reached without the trailing slash
+		if len(route) > 1 {
+			route = strings.TrimSuffix(route, "/")
+		}
+
+		operation := strings.ToLower(method) + " " + route
+		mounted[operation] = true
+
+		if _, ok := s.Paths[route][strings.ToLower(method)]; !ok {
+			t.Errorf("route %s %s is missing from openapi.json", method, route)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error walking the routes: %v", err)
+	}
+
+	for path, item := range s.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+
+			if !mounted[method+" "+path] {
+				t.Errorf("openapi.json documents %s %s, which is not mounted", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestSpecSchemasMatchDTOs(t *testing.T) {
+	s := loadSpec(t)
+
+	dtos := map[string]interface{}{
+		"HTTPError":                    helpers.HTTPError{},
+		"Response":                     auth.Response{},
+		"CreateUserBody":               auth.CreateUserBody{},
+		"CreateUserResponse":           auth.CreateUserResponse{},
+		"LoginUserBody":                auth.LoginUserBody{},
+		"UnlockUserBody":               auth.UnlockUserBody{},
+		"RequestMagicLinkBody":         auth.RequestMagicLinkBody{},
+		"VerifyMagicLinkBody":          auth.VerifyMagicLinkBody{},
+		"VerifyTwoFactorBody":          auth.VerifyTwoFactorBody{},
+		"ConfirmTwoFactorBody":         auth.ConfirmTwoFactorBody{},
+		"ReauthenticateBody":           auth.ReauthenticateBody{},
+		"TwoFactorEnrollmentResponse":  auth.TwoFactorEnrollmentResponse{},
+		"RecoveryCodesResponse":        auth.RecoveryCodesResponse{},
+		"LoginChallengeResponse":       auth.LoginChallengeResponse{},
+		"CreatePersonalTokenBody":      auth.CreatePersonalTokenBody{},
+		"PersonalToken":                auth.PersonalToken{},
+		"CreatedPersonalTokenResponse": auth.CreatedPersonalTokenResponse{},
+		"RefreshTokenBody":             auth.RefreshTokenBody{},
+		"ChangePasswordBody":           auth.ChangePasswordBody{},
+		"Session":                      auth.Session{},
+		"UpdateUserBody":               auth.UpdateUserBody{},
+		"Profile":                      auth.Profile{},
+		"ChangeEmailBody":              auth.ChangeEmailBody{},
+		"ConfirmEmailBody":             auth.ConfirmEmailBody{},
+		"JSONWebKeySet":                helpers.JSONWebKeySet{},
+		"JSONWebKey":                   helpers.JSONWebKey{},
+		"FriendRequestBody":            friendship.FriendRequestBody{},
+		"UpdateFriendRequestBody":      friendship.UpdateFriendRequestBody{},
+		"FriendshipResponse":           friendship.FriendshipResponse{},
+		"Item":                         wishlist.Item{},
+		"Wishlist":                     wishlist.Wishlist{},
+		"UpdateWishlist":               wishlist.UpdateWishlist{},
+		"UpdateItem":                   wishlist.UpdateItem{},
+		"ItemResponse":                 wishlist.ItemResponse{},
+		"PickerResponse":               wishlist.PickerResponse{},
+		"WishlistResponse":             wishlist.WishlistResponse{},
+		"PreviewEmailBody":             admin.PreviewEmailBody{},
+		"TestEmailBody":                admin.TestEmailBody{},
+		"TemplateResponse":             admin.TemplateResponse{},
+		"PreviewResponse":              admin.PreviewResponse{},
+		"PoolStatsResponse":            admin.PoolStatsResponse{},
+		"HealthReport":                 health.Report{},
+		"HealthCheckResult":            health.CheckResult{},
+	}
+
+	// the envelopes, probes and key set are not validated, their required fields are the ones always written
+	unvalidated := map[string]bool{"Response": true, "HTTPError": true, "HealthReport": true, "HealthCheckResult": true, "JSONWebKeySet": true, "JSONWebKey": true}
+
+	for name, dto := range dtos {
+		t.Run(name, func(t *testing.T) {
+			schema, ok := s.Components.Schemas[name]
+			if !ok {
+				t.Fatalf("schema %s is missing from openapi.json", name)
+			}
+
+			fields, required, always := jsonFields(reflect.TypeOf(dto))
+			if unvalidated[name] {
+				required = always
+			}
+
+			var properties []string
+			for property := range schema.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(properties)
+
+			if !reflect.DeepEqual(properties, fields) {
+				t.Errorf("schema properties = %v, want %v", properties, fields)
+			}
+
+			sort.Strings(schema.Required)
+			if len(schema.Required) != 0 || len(required) != 0 {
+				if !reflect.DeepEqual(schema.Required, required) {
+					t.Errorf("schema required = %v, want %v", schema.Required, required)
+				}
+			}
+		})
+	}
+}
+
+// jsonFields lists the JSON names of a struct's fields, the ones validated as required
+// and the ones always present in the output.
+func jsonFields(typ reflect.Type) (fields, required, always []string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous || !field.IsExported() {
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, name)
+
+		if rules := strings.Split(field.Tag.Get("validate"), ","); rules[0] == "required" {
+			required = append(required, name)
+		}
+
+		if !strings.Contains(options, "omitempty") {
+			always = append(always, name)
+		}
+	}
+
+	sort.Strings(fields)
+	sort.Strings(required)
+	sort.Strings(always)
+
+	return fields, required, always
+}
+
+func TestAccountRoutesRefusePersonalTokens(t *testing.T) {
+	s := loadSpec(t)
+
+	router := chi.NewRouter()
+	routes.SetupRoutes(config.Config{Router: router})
+
+	// a personal access token is refused before it is looked up, so none needs to exist
+	token := helpers.PersonalTokenPrefix + "0123456789abcdef"
+
+	for path, item := range s.Paths {
+		if !strings.HasPrefix(path, "/auth/") {
+			continue
+		}
+
+		for method, raw := range item {
+			var operation struct {
+				Description string                `json:"description"`
+				Security    []map[string][]string `json:"security"`
+			}
+			if err := json.Unmarshal(raw, &operation); err != nil || len(operation.Security) == 0 {
+				continue
+			}
+
+			t.Run(strings.ToUpper(method)+" "+path, func(t *testing.T) {
+				if !strings.Contains(operation.Description, "Personal access tokens cannot use it") {
+					t.Errorf("description = %q, want it to say personal access tokens cannot use it", operation.Description)
+				}
+
+				target := strings.NewReplacer("{id}", "1", "{provider}", "test").Replace(path)
+				request := httptest.NewRequest(strings.ToUpper(method), target, nil)
+				request.Header.Set("Authorization", "Bearer "+token)
+				response := httptest.NewRecorder()
+				router.ServeHTTP(response, request)
+
+				if response.Code != http.StatusUnauthorized {
+					t.Errorf("response code = %d, want %d", response.Code, http.StatusUnauthorized)
+				}
+			})
+		}
+	}
+}
+
+func TestSpecReferences(t *testing.T) {
+	var document map[string]interface{}
+	if err := json.Unmarshal(docs.Spec, &document); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	for _, match := range regexp.MustCompile(`"\$ref":\s*"#/([^"]+)"`).FindAllSubmatch(docs.Spec, -1) {
+		var node interface{} = document
+		for _, key := range strings.Split(string(match[1]), "/") {
+			object, ok := node.(map[string]interface{})
+			if !ok {
+				node = nil
+				break
+			}
+			node = object[key]
+		}
+
+		if node == nil {
+			t.Errorf("reference #/%s does not resolve", match[1])
+		}
+	}
+}
+
+func TestDocsRoutes(t *testing.T) {
+	router := chi.NewRouter()
+	docs.DocsRoutes(config.Config{Router: router})
+
+	t.Run("serves the spec", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("response code = %d, want %d", response.Code, http.StatusOK)
+		}
+
+		if got := response.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/json") {
+			t.Errorf("content type = %q, want application/json", got)
+		}
+
+		var got map[string]interface{}
+		if err := json.Unmarshal(response.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid json: %v", err)
+		}
+
+		if got["openapi"] != "3.0.3" {
+			t.Errorf("openapi = %v, want 3.0.3", got["openapi"])
+		}
+	})
+
+	t.Run("serves the docs page", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+		if response.Code != http.StatusOK {
+			t.Fatalf("response code = %d, want %d", response.Code, http.StatusOK)
+		}
+
+		if !strings.Contains(response.Body.String(), `"/openapi.json"`) {
+			t.Error("docs page does not load /openapi.json")
+		}
+	})
+}
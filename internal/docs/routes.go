@@ -0,0 +1,12 @@
+package docs
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/config"
+	"net/http"
+)
+
+func DocsRoutes(config config.Config) {
+
+	config.Router.Get("/openapi.json", http.HandlerFunc(SpecHandler))
+	config.Router.Get("/docs", http.HandlerFunc(PageHandler))
+}
@@ -2,67 +2,132 @@ package email
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"html/template"
-	"net/smtp"
-	"os"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
 	"strings"
+	"time"
 )
 
-// go to google app passwords and create an app and use the details given
-
 type Email struct {
-	ToAddr   string            `json:"to_addr"`
-	Subject  string            `json:"subject"`
-	Template string            `json:"template"`
-	Vars     map[string]string `json:"vars"`
+	ToAddr   string                 `json:"to_addr"`
+	Subject  string                 `json:"subject"`
+	Template string                 `json:"template"`
+	Locale   string                 `json:"locale"`
+	Vars     map[string]interface{} `json:"vars"`
+}
+
+// Message is a rendered email ready to be handed to a Mailer.
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+	Text    string
 }
 
-func SendHTMLEmail(to []string, subject, htmlBody string) error {
+// Mailer delivers rendered messages. The transport (smtp, file, log) is chosen by configuration.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Bytes returns the message in RFC 5322 format as a multipart/alternative
+// with the plain text part first and the HTML part last (the preferred one).
+func (m *Message) Bytes() ([]byte, error) {
+	messageID, err := newMessageID(m.From)
+	if err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", m.Text},
+		{"text/html; charset=UTF-8", m.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error creating message part: %v", err)
+		}
+
+		qp := quotedprintable.NewWriter(partWriter)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("error encoding message part: %v", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("error encoding message part: %v", err)
+		}
+	}
 
-	auth := smtp.PlainAuth(
-		"",
-		os.Getenv("FROM_EMAIL"),
-		os.Getenv("FROM_EMAIL_PASSWORD"),
-		os.Getenv("FROM_EMAIL_SMTP"),
-	)
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error closing message: %v", err)
+	}
 
-	headers := "MIME-version: 1.0;\nContent-Type: text/html; charset: UTF-8"
+	var buf bytes.Buffer
 
-	message := "Subject: " + subject + "\n" + headers + "\n\n" + htmlBody
+	buf.WriteString("From: " + m.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(m.To, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", m.Subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("Message-ID: " + messageID + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q\r\n", writer.Boundary()))
+	buf.WriteString("\r\n")
+	buf.Write(body.Bytes())
 
-	return smtp.SendMail(
-		os.Getenv("SMTP_ADDR"),
-		auth,
-		os.Getenv("FROM_EMAIL"),
-		to,
-		[]byte(message),
-	)
+	return buf.Bytes(), nil
 }
 
-func parseTemplate(data Email) (bytes.Buffer, error) {
+// newMessageID builds a globally unique Message-ID on the sender's domain.
+func newMessageID(from string) (string, error) {
+	domain := "wishmate.local"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at != -1 {
+			domain = addr.Address[at+1:]
+		}
+	}
 
-	tmpl, err := template.ParseFiles("../templates/" + data.Template + ".html")
-	if err != nil {
-		return bytes.Buffer{}, fmt.Errorf("error parsing template: %v", err)
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating message id: %v", err)
 	}
 
-	var rendered bytes.Buffer
-	if err := tmpl.Execute(&rendered, data); err != nil {
-		return bytes.Buffer{}, fmt.Errorf("error executing template: %v", err)
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(buf), domain), nil
+}
+
+// withSender returns a copy of msg using from when the message has no sender of its own.
+func withSender(msg *Message, from string) *Message {
+	if msg.From != "" {
+		return msg
 	}
 
-	return rendered, nil
+	withFrom := *msg
+	withFrom.From = from
+	return &withFrom
 }
 
-func (e Email) SendTemplateEmail() error {
+func (e Email) SendTemplateEmail(ctx context.Context, templates *Templates, mailer Mailer) error {
 
 	to := strings.Split(e.ToAddr, ",")
 
-	rendered, err := parseTemplate(e)
+	html, text, err := templates.Render(e.Template, e.Locale, e.Vars)
 	if err != nil {
 		return err
 	}
 
-	return SendHTMLEmail(to, e.Subject, rendered.String())
+	// the sender is filled in by the transport
+	return mailer.Send(ctx, &Message{To: to, Subject: e.Subject, HTML: html, Text: text})
 }
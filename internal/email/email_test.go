@@ -0,0 +1,300 @@
+package email_test
+
+import (
+	"context"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/templates"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	t.Run("load and render the embedded templates", func(t *testing.T) {
+		tmpls, err := email.LoadTemplates(templates.FS)
+		if err != nil {
+			t.Fatalf("error loading templates: %v", err)
+		}
+
+		html, text, err := tmpls.Render("verification_mail", "en", map[string]interface{}{"username": "adedunmola", "code": "123456", "expiration": 30})
+		if err != nil {
+			t.Fatalf("error rendering template: %v", err)
+		}
+
+		for _, body := range []string{html, text} {
+			if !strings.Contains(body, "adedunmola") || !strings.Contains(body, "123456") {
+				t.Errorf("rendered template is missing data: %s", body)
+			}
+		}
+	})
+
+	t.Run("render the translation for the locale and fall back to english", func(t *testing.T) {
+		tmpls, err := email.LoadTemplates(templates.FS)
+		if err != nil {
+			t.Fatalf("error loading templates: %v", err)
+		}
+
+		data := map[string]interface{}{"username": "adedunmola", "friend_username": "tobi", "date": "2025-03-06"}
+
+		_, text, err := tmpls.Render("reminder_mail", "fr", data)
+		if err != nil {
+			t.Fatalf("error rendering template: %v", err)
+		}
+
+		if !strings.Contains(text, "Rappel prévu pour le : 6 mars 2025") {
+			t.Errorf("french template not rendered with a localized date: %s", text)
+		}
+
+		_, text, err = tmpls.Render("reminder_mail", "de", data)
+		if err != nil {
+			t.Fatalf("error rendering template: %v", err)
+		}
+
+		if !strings.Contains(text, "Reminder set for: March 6, 2025") {
+			t.Errorf("english fallback not rendered: %s", text)
+		}
+	})
+
+	t.Run("render amounts in the locale of the template", func(t *testing.T) {
+		tmpls, err := email.LoadTemplates(templates.FS)
+		if err != nil {
+			t.Fatalf("error loading templates: %v", err)
+		}
+
+		data := map[string]interface{}{
+			"username":        "adedunmola",
+			"friend_username": "tobi",
+			"date":            "2025-03-06",
+			"items": []interface{}{
+				map[string]interface{}{"name": "Wireless headphones", "price": 45000.0, "currency": "NGN"},
+				map[string]interface{}{"name": "A good book"},
+			},
+		}
+
+		for locale, price := range map[string]string{
+			"en": "₦45,000.00",
+			"fr": "45\u202f000,00\u00a0₦",
+		} {
+			html, text, err := tmpls.Render("reminder_mail", locale, data)
+			if err != nil {
+				t.Fatalf("error rendering template: %v", err)
+			}
+
+			if want := "- Wireless headphones: " + price + "\n- A good book\n"; !strings.Contains(text, want) {
+				t.Errorf("%s plain text does not list %q: %s", locale, want, text)
+			}
+
+			if want := "Wireless headphones · " + price; !strings.Contains(html, want) {
+				t.Errorf("%s html does not list %q: %s", locale, want, html)
+			}
+		}
+	})
+
+	t.Run("return error for a missing required template", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome_mail.html": {Data: []byte("<p>{{ .username }}</p>")},
+			"welcome_mail.txt":  {Data: []byte("{{ .username }}")},
+		}
+
+		if _, err := email.LoadTemplates(fsys); err == nil {
+			t.Error("expected error for missing templates")
+		}
+	})
+
+	t.Run("return error for a missing plain text variant", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"welcome_mail.html": {Data: []byte("<p>{{ .username }}</p>")},
+		}
+
+		if _, err := email.LoadTemplates(fsys); err == nil {
+			t.Error("expected error for missing plain text variant")
+		}
+	})
+}
+
+func TestMessageBytes(t *testing.T) {
+	msg := &email.Message{
+		From:    "noreply@wishmate.app",
+		To:      []string{"user@example.com"},
+		Subject: "Joyeux anniversaire 🎂",
+		HTML:    "<p>hello</p>",
+		Text:    "hello",
+	}
+
+	raw, err := msg.Bytes()
+	if err != nil {
+		t.Fatalf("error building message: %v", err)
+	}
+
+	content := string(raw)
+
+	for _, want := range []string{
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=UTF-8",
+		"Content-Type: text/html; charset=UTF-8",
+		"Subject: =?UTF-8?q?",
+		"@wishmate.app>",
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("message does not contain %q", want)
+		}
+	}
+
+	if strings.Index(content, "text/plain") > strings.Index(content, "text/html") {
+		t.Error("plain text part should come before the html part")
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	msg := &email.Message{To: []string{"user@example.com"}, Subject: "Verify your email", HTML: "<p>hello</p>", Text: "hello"}
+
+	t.Run("write the message as an eml file", func(t *testing.T) {
+		dir := t.TempDir()
+		mailer := &email.FileMailer{Dir: dir, From: "noreply@wishmate.app"}
+
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("error sending mail: %v", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if len(files) != 1 {
+			t.Fatalf("got %d eml files, want 1", len(files))
+		}
+
+		assertMessage(t, files[0])
+	})
+
+	t.Run("deliver the message into the maildir new folder", func(t *testing.T) {
+		dir := t.TempDir()
+		mailer := &email.FileMailer{Dir: dir, From: "noreply@wishmate.app", Maildir: true}
+
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("error sending mail: %v", err)
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "new", "*"))
+		if len(files) != 1 {
+			t.Fatalf("got %d maildir messages, want 1", len(files))
+		}
+
+		leftovers, _ := filepath.Glob(filepath.Join(dir, "tmp", "*"))
+		if len(leftovers) != 0 {
+			t.Errorf("got %d messages left in tmp, want 0", len(leftovers))
+		}
+
+		assertMessage(t, files[0])
+	})
+}
+
+func TestNewMailer(t *testing.T) {
+	t.Run("return error for unknown transport", func(t *testing.T) {
+		_, err := email.NewMailer(email.TransportConfig{Transport: "carrier-pigeon"})
+		if err == nil {
+			t.Error("expected error for unknown transport")
+		}
+	})
+
+	t.Run("return error for unknown smtp tls mode", func(t *testing.T) {
+		_, err := email.NewMailer(email.TransportConfig{Transport: email.TransportSMTP, SMTPTLS: "sometimes"})
+		if err == nil {
+			t.Error("expected error for unknown tls mode")
+		}
+	})
+
+	t.Run("count sent and failed emails", func(t *testing.T) {
+		sent := metrics.EmailsSent.WithLabelValues(email.TransportEML, metrics.OutcomeSuccess)
+		failed := metrics.EmailsSent.WithLabelValues(email.TransportEML, metrics.OutcomeError)
+		sentBefore, failedBefore := testutil.ToFloat64(sent), testutil.ToFloat64(failed)
+
+		dir := t.TempDir()
+		mailer, err := email.NewMailer(email.TransportConfig{Transport: email.TransportEML, Dir: dir, From: "noreply@wishmate.app"})
+		if err != nil {
+			t.Fatalf("error creating mailer: %v", err)
+		}
+
+		msg := &email.Message{To: []string{"user@example.com"}, Subject: "Verify your email", HTML: "<p>hello</p>"}
+		if err := mailer.Send(context.Background(), msg); err != nil {
+			t.Fatalf("error sending: %v", err)
+		}
+
+		// a file where the directory should be makes the transport fail
+		blocked := filepath.Join(dir, "blocked")
+		if err := os.WriteFile(blocked, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		mailer, _ = email.NewMailer(email.TransportConfig{Transport: email.TransportEML, Dir: blocked})
+		if err := mailer.Send(context.Background(), msg); err == nil {
+			t.Fatal("expected an error writing into a file")
+		}
+
+		if got := testutil.ToFloat64(sent) - sentBefore; got != 1 {
+			t.Errorf("got %v sent emails, want 1", got)
+		}
+		if got := testutil.ToFloat64(failed) - failedBefore; got != 1 {
+			t.Errorf("got %v failed emails, want 1", got)
+		}
+	})
+}
+
+func assertMessage(t *testing.T, path string) {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+
+	for _, want := range []string{"From: noreply@wishmate.app", "To: user@example.com", "Subject: Verify your email", "<p>hello</p>"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("message does not contain %q", want)
+		}
+	}
+}
+
+func TestTemplateFields(t *testing.T) {
+	tmpls, err := email.LoadTemplates(templates.FS)
+	if err != nil {
+		t.Fatalf("error loading templates: %v", err)
+	}
+
+	t.Run("return the fields the template reads", func(t *testing.T) {
+		got, err := tmpls.Fields("verification_mail")
+		if err != nil {
+			t.Fatalf("error getting fields: %v", err)
+		}
+
+		want := []string{"code", "expiration", "username"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("return the fields missing from the data", func(t *testing.T) {
+		got, err := tmpls.MissingFields("verification_mail", map[string]interface{}{"username": "adedunmola"})
+		if err != nil {
+			t.Fatalf("error getting missing fields: %v", err)
+		}
+
+		want := []string{"code", "expiration"}
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("sample data covers every template", func(t *testing.T) {
+		for _, name := range tmpls.Names() {
+			missing, err := tmpls.MissingFields(name, email.SampleData[name])
+			if err != nil {
+				t.Fatalf("error getting missing fields: %v", err)
+			}
+
+			if len(missing) != 0 {
+				t.Errorf("sample data for %s is missing %v", name, missing)
+			}
+		}
+	})
+}
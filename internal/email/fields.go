@@ -0,0 +1,140 @@
+package email
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template/parse"
+)
+
+// SampleData is realistic data for previewing each template without triggering the real flow.
+var SampleData = map[string]map[string]interface{}{
+	"welcome_mail": {
+		"username": "adedunmola",
+	},
+	"verification_mail": {
+		"username":   "adedunmola",
+		"code":       "482913",
+		"expiration": 30,
+	},
+	"reminder_mail": {
+		"username":        "adedunmola",
+		"friend_username": "tobi",
+		"date":            "2025-03-06",
+		"title":           "Wishlist Reminder",
+		"body":            "tobi created a wishlist for a special date. Kindly check it out.",
+		// the amounts are float64, as they are once a task payload goes through json
+		"items": []interface{}{
+			map[string]interface{}{"name": "Wireless headphones", "price": 45000.0, "currency": "NGN"},
+			map[string]interface{}{"name": "A good book"},
+		},
+	},
+	"birthday_mail": {
+		"title": "Happy Birthday!",
+		"body":  "Wishing you a wonderful day filled with joy!",
+	},
+	"lockout_mail": {
+		"username":   "adedunmola",
+		"attempts":   5,
+		"until":      "2025-03-06 14:30 UTC",
+		"unlock_url": "https://wishmate.app/unlock?token=sample",
+	},
+	"new_login_mail": {
+		"username": "adedunmola",
+		"device":   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X)",
+		"ip":       "102.89.34.12",
+		"time":     "2025-03-06 14:30 UTC",
+	},
+	"magic_link_mail": {
+		"username":   "adedunmola",
+		"link":       "https://wishmate.app/magic-link?token=sample",
+		"expiration": 15,
+	},
+}
+
+// Fields returns the top level data fields the named template reads, across both
+// variants and every translation, in alphabetical order.
+func (t *Templates) Fields(name string) ([]string, error) {
+	if _, ok := t.html[name]; !ok {
+		return nil, fmt.Errorf("unknown email template: %s", name)
+	}
+
+	seen := make(map[string]bool)
+
+	for key, tmpl := range t.html {
+		if key != name && !strings.HasPrefix(key, name+".") {
+			continue
+		}
+
+		collectFields(tmpl.Tree.Root, seen)
+		collectFields(t.text[key].Tree.Root, seen)
+	}
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// MissingFields returns the fields the named template reads that data does not provide.
+func (t *Templates) MissingFields(name string, data map[string]interface{}) ([]string, error) {
+	fields, err := t.Fields(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, field := range fields {
+		if _, ok := data[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+
+	return missing, nil
+}
+
+func collectFields(node parse.Node, seen map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, seen)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, seen)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, seen)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, seen)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, seen)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, seen)
+		}
+	case *parse.ChainNode:
+		collectFields(n.Node, seen)
+	case *parse.FieldNode:
+		seen[n.Ident[0]] = true
+	}
+}
+
+func collectBranch(n *parse.BranchNode, seen map[string]bool) {
+	collectFields(n.Pipe, seen)
+	collectFields(n.List, seen)
+	collectFields(n.ElseList, seen)
+}
@@ -0,0 +1,78 @@
+package email
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every message to disk instead of sending it, so it can be
+// inspected locally. With Maildir set, Dir is laid out as a Maildir (tmp, new, cur)
+// that mail clients can open; otherwise each message is written as a .eml file.
+type FileMailer struct {
+	Dir     string
+	From    string
+	Maildir bool
+}
+
+func (m *FileMailer) Send(_ context.Context, msg *Message) error {
+	msg = withSender(msg, m.From)
+
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	name, err := uniqueName()
+	if err != nil {
+		return err
+	}
+
+	if !m.Maildir {
+		if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+			return fmt.Errorf("error creating mail directory: %v", err)
+		}
+
+		path := filepath.Join(m.Dir, name+".eml")
+		if err := os.WriteFile(path, raw, 0o644); err != nil {
+			return fmt.Errorf("error writing mail file: %v", err)
+		}
+		return nil
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("error creating maildir: %v", err)
+		}
+	}
+
+	// maildir delivery: write to tmp, then atomically move into new
+	tmpPath := filepath.Join(m.Dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, raw, 0o644); err != nil {
+		return fmt.Errorf("error writing maildir message: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, filepath.Join(m.Dir, "new", name)); err != nil {
+		return fmt.Errorf("error delivering maildir message: %v", err)
+	}
+
+	return nil
+}
+
+func uniqueName() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating mail file name: %v", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), hex.EncodeToString(buf), hostname), nil
+}
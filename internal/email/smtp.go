@@ -0,0 +1,115 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+const (
+	TLSNone     = "none"
+	TLSStartTLS = "starttls"
+	TLSImplicit = "implicit"
+)
+
+// SMTPMailer sends messages through an SMTP relay.
+// go to google app passwords and create an app and use the details given
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	TLS      string
+	Timeout  time.Duration
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	host, _, err := net.SplitHostPort(m.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %v", m.Addr, err)
+	}
+
+	msg = withSender(msg, m.From)
+
+	raw, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeout)
+	defer cancel()
+
+	conn, err := m.dial(ctx, host)
+	if err != nil {
+		return fmt.Errorf("error connecting to smtp server: %v", err)
+	}
+
+	// bound the whole conversation, not just the dial
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return fmt.Errorf("error setting smtp deadline: %v", err)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("error creating smtp client: %v", err)
+	}
+	defer client.Close()
+
+	if m.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("error starting tls: %v", err)
+		}
+	}
+
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return fmt.Errorf("error authenticating with smtp server: %v", err)
+		}
+	}
+
+	if err := client.Mail(msg.From); err != nil {
+		return fmt.Errorf("error setting sender: %v", err)
+	}
+
+	for _, to := range msg.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("error adding recipient %s: %v", to, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("error starting message data: %v", err)
+	}
+
+	if _, err := writer.Write(raw); err != nil {
+		return fmt.Errorf("error writing message: %v", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("error sending message: %v", err)
+	}
+
+	return client.Quit()
+}
+
+func (m *SMTPMailer) dial(ctx context.Context, host string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: m.Timeout}
+
+	if m.TLS == TLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		return tlsDialer.DialContext(ctx, "tcp", m.Addr)
+	}
+
+	return dialer.DialContext(ctx, "tcp", m.Addr)
+}
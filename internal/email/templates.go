@@ -0,0 +1,145 @@
+package email
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// RequiredTemplates are the templates the application enqueues; loading fails when one is missing.
+var RequiredTemplates = []string{"welcome_mail", "verification_mail", "reminder_mail", "birthday_mail", "lockout_mail", "new_login_mail", "magic_link_mail"}
+
+// Templates holds the pre-parsed HTML and plain text variant of every email template.
+// Templates are keyed by name and locale; the English one carries no locale in its file name.
+type Templates struct {
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+// LoadTemplates parses every <name>.html and <name>.txt pair in fsys, along with their
+// translations named <name>.<locale>.html and <name>.<locale>.txt.
+// It is meant to run at startup so a missing or broken template stops the process
+// instead of failing each email delivery.
+func LoadTemplates(fsys fs.FS) (*Templates, error) {
+	t := &Templates{
+		html: make(map[string]*htmltemplate.Template),
+		text: make(map[string]*texttemplate.Template),
+	}
+
+	htmlFiles, err := fs.Glob(fsys, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("error listing templates: %v", err)
+	}
+
+	for _, file := range htmlFiles {
+		key := strings.TrimSuffix(file, path.Ext(file))
+
+		locale := i18n.DefaultLocale
+		if _, suffix, ok := strings.Cut(key, "."); ok {
+			locale = suffix
+		}
+
+		funcs := templateFuncs(locale)
+
+		htmlTmpl, err := htmltemplate.New(file).Funcs(funcs).ParseFS(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template %s: %v", file, err)
+		}
+
+		textTmpl, err := texttemplate.New(key+".txt").Funcs(funcs).ParseFS(fsys, key+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("error parsing plain text variant of %s: %v", key, err)
+		}
+
+		t.html[key] = htmlTmpl
+		t.text[key] = textTmpl
+	}
+
+	for _, name := range RequiredTemplates {
+		if _, ok := t.html[name]; !ok {
+			return nil, fmt.Errorf("missing email template: %s", name)
+		}
+	}
+
+	return t, nil
+}
+
+// Names returns the loaded template names (without locale) in alphabetical order.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.html))
+	for key := range t.html {
+		if !strings.Contains(key, ".") {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Render executes both variants of the named template with data, using the translation
+// for locale when there is one and the English template otherwise.
+func (t *Templates) Render(name, locale string, data interface{}) (html string, text string, err error) {
+	key := name
+	if locale = i18n.Normalize(locale); locale != i18n.DefaultLocale {
+		if _, ok := t.html[name+"."+locale]; ok {
+			key = name + "." + locale
+		}
+	}
+
+	htmlTmpl, ok := t.html[key]
+	if !ok {
+		return "", "", fmt.Errorf("unknown email template: %s", name)
+	}
+
+	var htmlBuf bytes.Buffer
+	if err := htmlTmpl.Execute(&htmlBuf, data); err != nil {
+		return "", "", fmt.Errorf("error executing template %s: %v", key, err)
+	}
+
+	var textBuf bytes.Buffer
+	if err := t.text[key].Execute(&textBuf, data); err != nil {
+		return "", "", fmt.Errorf("error executing plain text template %s: %v", key, err)
+	}
+
+	return htmlBuf.String(), textBuf.String(), nil
+}
+
+// templateFuncs formats dates and amounts in the locale of the template they are attached to.
+func templateFuncs(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"formatDate": func(value interface{}) string {
+			switch v := value.(type) {
+			case nil:
+				return ""
+			case time.Time:
+				return i18n.FormatDate(locale, v)
+			case *time.Time:
+				if v == nil {
+					return ""
+				}
+				return i18n.FormatDate(locale, *v)
+			case string:
+				// task payloads carry dates as strings once they go through json
+				for _, layout := range []string{"2006-01-02", time.RFC3339} {
+					if date, err := time.Parse(layout, v); err == nil {
+						return i18n.FormatDate(locale, date)
+					}
+				}
+				return v
+			default:
+				return fmt.Sprint(value)
+			}
+		},
+		"formatCurrency": func(amount float64, currency string) string {
+			return i18n.FormatCurrency(locale, amount, currency)
+		},
+	}
+}
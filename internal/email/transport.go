@@ -0,0 +1,87 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+const (
+	TransportSMTP    = "smtp"
+	TransportMaildir = "maildir"
+	TransportEML     = "eml"
+	TransportLog     = "log"
+)
+
+const DefaultSMTPTimeout = 10 * time.Second
+
+type TransportConfig struct {
+	Transport    string
+	From         string
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string
+	SMTPTimeout  time.Duration
+	Dir          string
+}
+
+// NewMailer builds the configured transport, counting and tracing the emails it sends and fails to send.
+func NewMailer(cfg TransportConfig) (Mailer, error) {
+	mailer, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &instrumentedMailer{Mailer: mailer, transport: cfg.Transport}, nil
+}
+
+func newTransport(cfg TransportConfig) (Mailer, error) {
+	switch cfg.Transport {
+	case TransportSMTP:
+		switch cfg.SMTPTLS {
+		case TLSNone, TLSStartTLS, TLSImplicit:
+		default:
+			return nil, fmt.Errorf("unknown smtp tls mode: %s", cfg.SMTPTLS)
+		}
+
+		return &SMTPMailer{
+			Addr:     cfg.SMTPAddr,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+			TLS:      cfg.SMTPTLS,
+			Timeout:  cfg.SMTPTimeout,
+		}, nil
+	case TransportMaildir:
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From, Maildir: true}, nil
+	case TransportEML:
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From}, nil
+	case TransportLog:
+		return &LogMailer{From: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", cfg.Transport)
+	}
+}
+
+type instrumentedMailer struct {
+	Mailer
+	transport string
+}
+
+func (m *instrumentedMailer) Send(ctx context.Context, msg *Message) error {
+	ctx, span := tracing.Tracer().Start(ctx, "email send "+m.transport,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("email.transport", m.transport)),
+	)
+
+	err := m.Mailer.Send(ctx, msg)
+	metrics.EmailsSent.WithLabelValues(m.transport, metrics.Outcome(err)).Inc()
+
+	tracing.End(span, err)
+	return err
+}
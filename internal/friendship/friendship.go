@@ -4,6 +4,7 @@ import (
 	"errors"
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/Adedunmol/wish-mate/internal/queue"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -20,6 +21,7 @@ type Handler struct {
 	AuthStore   auth.Store
 	FriendStore FriendStore
 	Queue       queue.Queue
+	Policy      *policy.Policy
 }
 
 func (h *Handler) SendRequestHandler(responseWriter http.ResponseWriter, request *http.Request) {
@@ -52,7 +54,23 @@ func (h *Handler) SendRequestHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	data, err := h.FriendStore.CreateFriendship(newUserID, body.RecipientID)
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Policy.CanActAs(principal, newUserID); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if err := h.Policy.CanSendFriendRequest(request.Context(), principal, body.RecipientID); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	data, err := h.FriendStore.CreateFriendship(request.Context(), newUserID, body.RecipientID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
@@ -96,6 +114,23 @@ func (h *Handler) UpdateRequestHandler(responseWriter http.ResponseWriter, reque
 		return
 	}
 
+	newUserID, err := strconv.Atoi(chi.URLParam(request, "user_id"))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "id is required", nil))
+		return
+	}
+
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	if err := h.Policy.CanActAs(principal, newUserID); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
 	var status string
 
 	switch body.Type {
@@ -110,7 +145,19 @@ func (h *Handler) UpdateRequestHandler(responseWriter http.ResponseWriter, reque
 		return
 	}
 
-	data, err := h.FriendStore.UpdateFriendship(newRequestID, status)
+	friendship, err := h.FriendStore.GetFriendship(request.Context(), newRequestID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	friendRequest := policy.FriendRequest{SenderID: friendship.UserID, RecipientID: friendship.FriendID}
+	if err := h.Policy.CanAnswerFriendRequest(principal, friendRequest, status == "blocked"); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	data, err := h.FriendStore.UpdateFriendship(request.Context(), newRequestID, status)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
@@ -140,10 +187,14 @@ func (h *Handler) GetAllRequestsHandler(responseWriter http.ResponseWriter, requ
 		return
 	}
 
-	currentUserID := request.Context().Value("user_id").(int)
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
 
-	if currentUserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanActAs(principal, newUserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
@@ -153,11 +204,11 @@ func (h *Handler) GetAllRequestsHandler(responseWriter http.ResponseWriter, requ
 
 	switch status {
 	case "accepted", "blocked", "pending":
-		data, err = h.FriendStore.GetAllFriendships(newUserID, status)
+		data, err = h.FriendStore.GetAllFriendships(request.Context(), newUserID, status)
 		break
 	case "":
 		status = "all"
-		data, err = h.FriendStore.GetAllFriendships(newUserID, status)
+		data, err = h.FriendStore.GetAllFriendships(request.Context(), newUserID, status)
 		break
 	default:
 		helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusBadRequest, "invalid status", nil))
@@ -205,20 +256,29 @@ func (h *Handler) GetRequestHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	currentUserID := request.Context().Value("user_id").(int)
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
 
-	if currentUserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanActAs(principal, newUserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	data, err := h.FriendStore.GetFriendship(newRequestID)
+	data, err := h.FriendStore.GetFriendship(request.Context(), newRequestID)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
+	if err := h.Policy.CanViewFriendRequest(principal, policy.FriendRequest{SenderID: data.UserID, RecipientID: data.FriendID}); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
 	response := Response{
 		Status:  "Success",
 		Message: "Friendship retrieved successfully",
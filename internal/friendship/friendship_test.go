@@ -8,6 +8,7 @@ import (
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/friendship"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/Adedunmol/wish-mate/internal/queue"
 	"github.com/go-chi/chi/v5"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type StubQueue struct {
@@ -30,7 +32,7 @@ type StubUserStore struct {
 	users []auth.User
 }
 
-func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
+func (s *StubUserStore) CreateUser(ctx context.Context, body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
 
 	for _, u := range s.users {
 		if u.Email == body.Email {
@@ -45,7 +47,7 @@ func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserRe
 	return auth.CreateUserResponse{ID: userData.ID, FirstName: userData.FirstName, LastName: userData.LastName, Username: userData.Username}, nil
 }
 
-func (s *StubUserStore) FindUserByEmail(email string) (auth.User, error) {
+func (s *StubUserStore) FindUserByEmail(ctx context.Context, email string) (auth.User, error) {
 
 	for _, u := range s.users {
 		if u.Email == email {
@@ -55,7 +57,7 @@ func (s *StubUserStore) FindUserByEmail(email string) (auth.User, error) {
 	return auth.User{}, helpers.ErrNotFound
 }
 
-func (s *StubUserStore) FindUserByID(id int) (auth.User, error) {
+func (s *StubUserStore) FindUserByID(ctx context.Context, id int) (auth.User, error) {
 
 	for _, u := range s.users {
 		if u.ID == id {
@@ -65,15 +67,93 @@ func (s *StubUserStore) FindUserByID(id int) (auth.User, error) {
 	return auth.User{}, helpers.ErrNotFound
 }
 
+func (s *StubUserStore) UpdateUser(ctx context.Context, id int, data auth.UpdateUserBody) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].Verified = u.Verified || data.Verified
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DisableUser(ctx context.Context, id int) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			disabledAt := time.Now()
+			s.users[i].DisabledAt = &disabledAt
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DeleteUser(ctx context.Context, id int) error {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
 func (s *StubUserStore) ComparePasswords(storedPassword, candidatePassword string) bool {
 	return storedPassword == candidatePassword
 }
 
+func (s *StubUserStore) ChangePassword(ctx context.Context, id int, password string) error {
+	return nil
+}
+
+func (s *StubUserStore) SetPendingEmail(ctx context.Context, id int, email string) error {
+	return nil
+}
+
+func (s *StubUserStore) ConfirmEmail(ctx context.Context, id int) (auth.User, error) {
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) SetAvatar(ctx context.Context, id int, key string) (string, error) {
+	return "", nil
+}
+
+func (s *StubUserStore) RecordFailedLogin(ctx context.Context, id int) (int, int, error) {
+	return 1, 0, nil
+}
+
+func (s *StubUserStore) LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error) {
+	return true, nil
+}
+
+func (s *StubUserStore) UnlockUser(ctx context.Context, unlockToken string) (auth.User, error) {
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) RecordLogin(ctx context.Context, id int, device, ip string) (auth.LoginSighting, error) {
+	return auth.LoginSighting{First: true}, nil
+}
+
+// StubRelationStore makes every two users strangers.
+type StubRelationStore struct{}
+
+func (s *StubRelationStore) Relation(ctx context.Context, userID, otherID int) (policy.Relation, error) {
+	return policy.RelationNone, nil
+}
+
+var rules = policy.New(&StubRelationStore{})
+
 type StubFriendStore struct {
 	friends []friendship.FriendshipResponse
 }
 
-func (s *StubFriendStore) CreateFriendship(userID, recipientID int) (friendship.FriendshipResponse, error) {
+func (s *StubFriendStore) CreateFriendship(ctx context.Context, userID, recipientID int) (friendship.FriendshipResponse, error) {
 
 	data := friendship.FriendshipResponse{
 		ID:       1,
@@ -87,7 +167,7 @@ func (s *StubFriendStore) CreateFriendship(userID, recipientID int) (friendship.
 	return data, nil
 }
 
-func (s *StubFriendStore) UpdateFriendship(friendshipID int, status string) (friendship.FriendshipResponse, error) {
+func (s *StubFriendStore) UpdateFriendship(ctx context.Context, friendshipID int, status string) (friendship.FriendshipResponse, error) {
 
 	for i, u := range s.friends {
 		if u.ID == friendshipID {
@@ -98,20 +178,20 @@ func (s *StubFriendStore) UpdateFriendship(friendshipID int, status string) (fri
 	return friendship.FriendshipResponse{}, helpers.ErrNotFound
 }
 
-func (s *StubFriendStore) GetAllFriendships(userID int, status string) ([]friendship.FriendshipResponse, error) {
+func (s *StubFriendStore) GetAllFriendships(ctx context.Context, userID int, status string) ([]friendship.FriendshipResponse, error) {
 	result := make([]friendship.FriendshipResponse, 0)
 
 	log.Printf("status: %s", status)
 
 	for _, u := range s.friends {
-		if u.UserID == userID && (u.Status == status || u.Status == "all") {
+		if u.UserID == userID && (u.Status == status || status == "all") {
 			result = append(result, u)
 		}
 	}
 	return result, nil
 }
 
-func (s *StubFriendStore) GetFriendship(requestID int) (friendship.FriendshipResponse, error) {
+func (s *StubFriendStore) GetFriendship(ctx context.Context, requestID int) (friendship.FriendshipResponse, error) {
 
 	for _, u := range s.friends {
 		if u.ID == requestID {
@@ -126,20 +206,20 @@ type NotFoundFriendStore struct {
 	friends []friendship.FriendshipResponse
 }
 
-func (s *NotFoundFriendStore) CreateFriendship(_, _ int) (friendship.FriendshipResponse, error) {
+func (s *NotFoundFriendStore) CreateFriendship(ctx context.Context, _, _ int) (friendship.FriendshipResponse, error) {
 
 	return friendship.FriendshipResponse{}, helpers.ErrNotFound
 }
 
-func (s *NotFoundFriendStore) UpdateFriendship(_ int, _ string) (friendship.FriendshipResponse, error) {
+func (s *NotFoundFriendStore) UpdateFriendship(ctx context.Context, _ int, _ string) (friendship.FriendshipResponse, error) {
 	return friendship.FriendshipResponse{}, helpers.ErrNotFound
 }
 
-func (s *NotFoundFriendStore) GetAllFriendships(_ int, _ string) ([]friendship.FriendshipResponse, error) {
+func (s *NotFoundFriendStore) GetAllFriendships(ctx context.Context, _ int, _ string) ([]friendship.FriendshipResponse, error) {
 	return nil, nil
 }
 
-func (s *NotFoundFriendStore) GetFriendship(requestID int) (friendship.FriendshipResponse, error) {
+func (s *NotFoundFriendStore) GetFriendship(ctx context.Context, requestID int) (friendship.FriendshipResponse, error) {
 	return friendship.FriendshipResponse{}, nil
 }
 
@@ -147,20 +227,20 @@ type ConflictFriendStore struct {
 	friends []friendship.FriendshipResponse
 }
 
-func (s *ConflictFriendStore) CreateFriendship(_, _ int) (friendship.FriendshipResponse, error) {
+func (s *ConflictFriendStore) CreateFriendship(ctx context.Context, _, _ int) (friendship.FriendshipResponse, error) {
 
 	return friendship.FriendshipResponse{}, helpers.ErrConflict
 }
 
-func (s *ConflictFriendStore) UpdateFriendship(_ int, _ string) (friendship.FriendshipResponse, error) {
+func (s *ConflictFriendStore) UpdateFriendship(ctx context.Context, _ int, _ string) (friendship.FriendshipResponse, error) {
 	return friendship.FriendshipResponse{}, helpers.ErrConflict
 }
 
-func (s *ConflictFriendStore) GetAllFriendships(_ int, _ string) ([]friendship.FriendshipResponse, error) {
+func (s *ConflictFriendStore) GetAllFriendships(ctx context.Context, _ int, _ string) ([]friendship.FriendshipResponse, error) {
 	return nil, nil
 }
 
-func (s *ConflictFriendStore) GetFriendship(requestID int) (friendship.FriendshipResponse, error) {
+func (s *ConflictFriendStore) GetFriendship(ctx context.Context, requestID int) (friendship.FriendshipResponse, error) {
 	return friendship.FriendshipResponse{}, nil
 }
 
@@ -172,7 +252,7 @@ func TestSendRequest(t *testing.T) {
 	friendStore := StubFriendStore{friends: make([]friendship.FriendshipResponse, 0)}
 	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 	t.Run("send a request and return the entry", func(t *testing.T) {
 
@@ -201,6 +281,33 @@ func TestSendRequest(t *testing.T) {
 		assertResponseBody(t, got, want)
 	})
 
+	t.Run("return 400 for a request to oneself", func(t *testing.T) {
+		request := createSendRequest(2, []byte(`{ "recipient_id": 2 }`))
+		response := httptest.NewRecorder()
+
+		server.SendRequestHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "cannot send a friend request to yourself",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
+		assertResponseBody(t, got, want)
+	})
+
+	t.Run("return 403 for sending as another user", func(t *testing.T) {
+		request := createSendRequest(2, []byte(`{ "recipient_id": 1 }`))
+		request = request.WithContext(helpers.WithPrincipal(request.Context(), helpers.Principal{UserID: 1, Verified: true}))
+		response := httptest.NewRecorder()
+
+		server.SendRequestHandler(response, request)
+
+		assertResponseCode(t, response.Code, http.StatusForbidden)
+	})
+
 	t.Run("return 404 for no friendship with the id", func(t *testing.T) {
 		authStore := StubUserStore{users: []auth.User{
 			{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
@@ -209,7 +316,7 @@ func TestSendRequest(t *testing.T) {
 		friendStore := NotFoundFriendStore{friends: make([]friendship.FriendshipResponse, 0)}
 		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 		data := []byte(fmt.Sprintf(`{ "recipient_id": %d }`, 3))
 
 		request := createSendRequest(1, data)
@@ -237,7 +344,7 @@ func TestSendRequest(t *testing.T) {
 		friendStore := ConflictFriendStore{friends: make([]friendship.FriendshipResponse, 0)}
 		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 		data := []byte(fmt.Sprintf(`{ "recipient_id": %d }`, 3))
 
@@ -295,12 +402,12 @@ func TestUpdateRequest(t *testing.T) {
 	}}
 	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 	t.Run("accept a request and return the entry", func(t *testing.T) {
 		data := []byte(`{ "type": "accept" }`)
 
-		request := createUpdateRequest(1, 1, data)
+		request := createUpdateRequest(2, 1, data)
 		response := httptest.NewRecorder()
 
 		server.UpdateRequestHandler(response, request)
@@ -323,6 +430,28 @@ func TestUpdateRequest(t *testing.T) {
 		assertResponseBody(t, got, want)
 	})
 
+	t.Run("return 403 for the sender accepting their own request", func(t *testing.T) {
+		friendStore := StubFriendStore{friends: []friendship.FriendshipResponse{
+			{ID: 1, UserID: 1, FriendID: 2, Status: "pending"},
+		}}
+		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
+
+		request := createUpdateRequest(1, 1, []byte(`{ "type": "accept" }`))
+		response := httptest.NewRecorder()
+
+		server.UpdateRequestHandler(response, request)
+
+		var got map[string]interface{}
+		_ = json.Unmarshal(response.Body.Bytes(), &got)
+
+		want := map[string]interface{}{
+			"message": "only the recipient can accept a friend request",
+		}
+
+		assertResponseCode(t, response.Code, http.StatusForbidden)
+		assertResponseBody(t, got, want)
+	})
+
 	t.Run("block a friendship and return the entry", func(t *testing.T) {
 		authStore := StubUserStore{users: []auth.User{
 			{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"},
@@ -334,7 +463,7 @@ func TestUpdateRequest(t *testing.T) {
 		}}
 		mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+		server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 		data := []byte(`{ "type": "block" }`)
 
@@ -428,7 +557,7 @@ func TestUpdateRequest(t *testing.T) {
 
 	t.Run("return 400 for empty request id", func(t *testing.T) {
 
-		ctx := context.WithValue(context.Background(), "user_id", 1)
+		ctx := authenticated(1)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/users/%d/friend_requests/", 1), bytes.NewReader([]byte(`{ "type": "accept" }`)))
 
 		rctx := chi.NewRouteContext()
@@ -484,7 +613,7 @@ func TestGetAllFriendships(t *testing.T) {
 	}}
 	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 	t.Run("return all friendships", func(t *testing.T) {
 
@@ -614,7 +743,7 @@ func TestGetAllFriendships(t *testing.T) {
 
 	t.Run("return 403 for accessing another friendship's requests", func(t *testing.T) {
 
-		ctx := context.WithValue(context.Background(), "user_id", 1)
+		ctx := authenticated(1)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d/friend_requests?status=%s", 2, "accepted"), nil)
 
 		rctx := chi.NewRouteContext()
@@ -656,7 +785,7 @@ func TestGetFriendship(t *testing.T) {
 	}}
 	mockQueue := StubQueue{Tasks: make([]queue.TaskPayload, 0)}
 
-	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue}
+	server := &friendship.Handler{AuthStore: &authStore, FriendStore: &friendStore, Queue: &mockQueue, Policy: rules}
 
 	t.Run("return a friendship", func(t *testing.T) {
 
@@ -707,7 +836,7 @@ func TestGetFriendship(t *testing.T) {
 	})
 
 	t.Run("return 403 for accessing another friendship's friendship", func(t *testing.T) {
-		ctx := context.WithValue(context.Background(), "user_id", 1)
+		ctx := authenticated(1)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d/friend_requests/%d", 2, 1), nil)
 
 		rctx := chi.NewRouteContext()
@@ -736,7 +865,7 @@ func TestGetFriendship(t *testing.T) {
 	})
 
 	t.Run("return 400 for no request id", func(t *testing.T) {
-		ctx := context.WithValue(context.Background(), "user_id", 1)
+		ctx := authenticated(1)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d/friend_requests/%d", 2, 1), nil)
 
 		rctx := chi.NewRouteContext()
@@ -764,9 +893,14 @@ func TestGetFriendship(t *testing.T) {
 	})
 }
 
+// authenticated is the context AuthMiddleware gives the requests of the user.
+func authenticated(userID int) context.Context {
+	return helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: userID, Verified: true})
+}
+
 func createSendRequest(userID int, data []byte) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/api/v1/users/1/friend_requests", bytes.NewReader(data))
 
 	rctx := chi.NewRouteContext()
@@ -779,7 +913,7 @@ func createSendRequest(userID int, data []byte) *http.Request {
 
 func createUpdateRequest(userID, requestID int, data []byte) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/api/v1/users/%d/friend_requests/%d", userID, requestID), bytes.NewReader(data))
 
 	rctx := chi.NewRouteContext()
@@ -793,7 +927,7 @@ func createUpdateRequest(userID, requestID int, data []byte) *http.Request {
 
 func getAllRequests(userID, requestID int, status string) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d/friend_requests?status=%s", userID, status), nil)
 
 	rctx := chi.NewRouteContext()
@@ -807,7 +941,7 @@ func getAllRequests(userID, requestID int, status string) *http.Request {
 
 func getARequest(userID, requestID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/api/v1/users/%d/friend_requests/%d", userID, requestID), nil)
 
 	rctx := chi.NewRouteContext()
@@ -3,6 +3,9 @@ package friendship
 import (
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 )
@@ -14,10 +17,26 @@ func UserRoutes(config config.Config) {
 	authStore := auth.NewUserStore(config.DB)
 	friendshipStore := NewFriendshipStore(config.DB)
 
-	handler := Handler{AuthStore: authStore, FriendStore: friendshipStore, Queue: config.Queue}
+	sessionStore := auth.NewSessionStore(config.DB)
 
-	userRouter.Post("/{user_id}/friend_requests", http.HandlerFunc(handler.SendRequestHandler))
-	userRouter.Patch("/{user_id}/friend_requests/{request_id}", http.HandlerFunc(handler.UpdateRequestHandler))
+	handler := Handler{AuthStore: authStore, FriendStore: friendshipStore, Queue: config.Queue, Policy: policy.New(policy.NewRelationStore(config.DB))}
+
+	userRouter.Group(func(r chi.Router) {
+		// no scope lets a personal access token make or answer friend requests
+		r.Use(middlewares.AuthMiddleware(config.Tokens, sessionStore, nil))
+
+		r.With(middlewares.RateLimit(config.RateLimiter, config.Settings.RateLimits.FriendRequest, middlewares.KeyByUser)).
+			Post("/{user_id}/friend_requests", http.HandlerFunc(handler.SendRequestHandler))
+		r.Patch("/{user_id}/friend_requests/{request_id}", http.HandlerFunc(handler.UpdateRequestHandler))
+	})
+
+	userRouter.Group(func(r chi.Router) {
+		r.Use(middlewares.AuthMiddleware(config.Tokens, sessionStore, auth.PersonalTokens{Store: auth.NewPersonalTokenStore(config.DB)}))
+		r.Use(middlewares.RequireScope(helpers.ScopeReadFriends))
+
+		r.Get("/{user_id}/friend_requests", http.HandlerFunc(handler.GetAllRequestsHandler))
+		r.Get("/{user_id}/friend_requests/{request_id}", http.HandlerFunc(handler.GetRequestHandler))
+	})
 
 	config.Router.Mount("/users", userRouter)
 }
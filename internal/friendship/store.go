@@ -2,37 +2,34 @@ package friendship
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 )
 
 type FriendStore interface {
-	CreateFriendship(userID, recipientID int) (FriendshipResponse, error)
-	UpdateFriendship(friendshipID int, status string) (FriendshipResponse, error)
-	GetAllFriendships(userID int, status string) ([]FriendshipResponse, error)
-	GetFriendship(requestID int) (FriendshipResponse, error)
+	CreateFriendship(ctx context.Context, userID, recipientID int) (FriendshipResponse, error)
+	UpdateFriendship(ctx context.Context, friendshipID int, status string) (FriendshipResponse, error)
+	GetAllFriendships(ctx context.Context, userID int, status string) ([]FriendshipResponse, error)
+	GetFriendship(ctx context.Context, requestID int) (FriendshipResponse, error)
 }
 
 type FriendshipStore struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewFriendshipStore(db *pgx.Conn) *FriendshipStore {
+func NewFriendshipStore(db *pgxpool.Pool) *FriendshipStore {
 
 	return &FriendshipStore{db: db}
 }
 
-func (f *FriendshipStore) CreateFriendship(userID, recipientID int) (FriendshipResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (f *FriendshipStore) CreateFriendship(ctx context.Context, userID, recipientID int) (FriendshipResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := f.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return FriendshipResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	query := `
 	INSERT INTO friendships (user_id, friend_id, status, friend_since)
 	VALUES ($1, $2, 'pending', NULL)
@@ -42,7 +39,7 @@ func (f *FriendshipStore) CreateFriendship(userID, recipientID int) (FriendshipR
 
 	var friendship FriendshipResponse
 
-	err = f.db.QueryRow(ctx, query, userID, recipientID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status, &friendship.FriendSince)
+	err := f.db.QueryRow(ctx, query, userID, recipientID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status, &friendship.FriendSince)
 
 	if err != nil {
 		return FriendshipResponse{}, fmt.Errorf("error inserting friendship: %w", err)
@@ -51,9 +48,9 @@ func (f *FriendshipStore) CreateFriendship(userID, recipientID int) (FriendshipR
 	return friendship, nil
 }
 
-func (f *FriendshipStore) UpdateFriendship(friendshipID int, status string) (FriendshipResponse, error) {
+func (f *FriendshipStore) UpdateFriendship(ctx context.Context, friendshipID int, status string) (FriendshipResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 
 	defer cancel()
 	tx, err := f.db.BeginTx(ctx, pgx.TxOptions{})
@@ -62,10 +59,11 @@ func (f *FriendshipStore) UpdateFriendship(friendshipID int, status string) (Fri
 	}
 	defer tx.Rollback(ctx)
 
-	query := `SELECT user_id, friend_id, status FROM friendships WHERE id = $1;`
+	// locked until the commit, so two answers to the same request do not both accept it
+	query := `SELECT user_id, friend_id, status FROM friendships WHERE id = $1 FOR UPDATE;`
 	var friendship FriendshipResponse
 
-	err = f.db.QueryRow(ctx, query, friendshipID).Scan(&friendship.UserID, &friendship.FriendID, &friendship.Status)
+	err = tx.QueryRow(ctx, query, friendshipID).Scan(&friendship.UserID, &friendship.FriendID, &friendship.Status)
 	if err != nil {
 		return FriendshipResponse{}, fmt.Errorf("error getting friendship: %w", err)
 	}
@@ -75,7 +73,7 @@ func (f *FriendshipStore) UpdateFriendship(friendshipID int, status string) (Fri
 		UPDATE friendships SET status = $1, friend_since = $2 WHERE id = $3 RETURNING id, user_id, friend_id;
 	`
 
-		err = f.db.QueryRow(ctx, updateQuery, "accepted", time.Now(), friendshipID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID)
+		err = tx.QueryRow(ctx, updateQuery, "accepted", time.Now(), friendshipID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID)
 		if err != nil {
 			return FriendshipResponse{}, fmt.Errorf("error updating friendship: %w", err)
 		}
@@ -86,7 +84,7 @@ func (f *FriendshipStore) UpdateFriendship(friendshipID int, status string) (Fri
 	ON CONFLICT (user_id, friend_id) DO NOTHING
 	`
 
-		_, err = f.db.Exec(ctx, insertQuery, &friendship.FriendID, &friendship.UserID, time.Now())
+		_, err = tx.Exec(ctx, insertQuery, &friendship.FriendID, &friendship.UserID, time.Now())
 
 		if err != nil {
 			return FriendshipResponse{}, fmt.Errorf("error inserting friendship: %w", err)
@@ -96,28 +94,27 @@ func (f *FriendshipStore) UpdateFriendship(friendshipID int, status string) (Fri
 		UPDATE friendships SET status = $1 WHERE id = $2 RETURNING id, user_id, friend_id, status;
 	`
 
-		err = f.db.QueryRow(ctx, updateQuery, status, friendshipID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status)
+		err = tx.QueryRow(ctx, updateQuery, status, friendshipID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status)
 		if err != nil {
 			return FriendshipResponse{}, fmt.Errorf("error updating friendship: %w", err)
 		}
 
 	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		return FriendshipResponse{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return friendship, nil
 }
 
-func (f *FriendshipStore) GetAllFriendships(userID int, status string) ([]FriendshipResponse, error) {
+func (f *FriendshipStore) GetAllFriendships(ctx context.Context, userID int, status string) ([]FriendshipResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 
 	defer cancel()
-	tx, err := f.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	query := `SELECT id, user_id, friend_id, friend_since FROM frienships WHERE user_id = $1 AND status = $2;`
+	query := `SELECT id, user_id, friend_id, status, friend_since FROM friendships WHERE user_id = $1 AND ($2 = 'all' OR status = $2);`
 	var friendships []FriendshipResponse
 
 	rows, err := f.db.Query(ctx, query, userID, status)
@@ -125,11 +122,12 @@ func (f *FriendshipStore) GetAllFriendships(userID int, status string) ([]Friend
 	if err != nil {
 		return nil, fmt.Errorf("error querying friendhips: %v", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var friendship FriendshipResponse
 
-		err = rows.Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.FriendSince)
+		err = rows.Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status, &friendship.FriendSince)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning rows: %w", err)
 		}
@@ -140,23 +138,20 @@ func (f *FriendshipStore) GetAllFriendships(userID int, status string) ([]Friend
 	return friendships, nil
 }
 
-func (f *FriendshipStore) GetFriendship(requestID int) (FriendshipResponse, error) {
+func (f *FriendshipStore) GetFriendship(ctx context.Context, requestID int) (FriendshipResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 
 	defer cancel()
-	tx, err := f.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return FriendshipResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	query := `SELECT id, user_id, friend_id, friend_since FROM frienships WHERE id = $1;`
+	query := `SELECT id, user_id, friend_id, status, friend_since FROM friendships WHERE id = $1;`
 
 	var friendship FriendshipResponse
 
-	err = f.db.QueryRow(ctx, query, requestID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.FriendSince)
+	err := f.db.QueryRow(ctx, query, requestID).Scan(&friendship.ID, &friendship.UserID, &friendship.FriendID, &friendship.Status, &friendship.FriendSince)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return FriendshipResponse{}, helpers.ErrNotFound
+		}
 		return FriendshipResponse{}, fmt.Errorf("error getting friendship: %w", err)
 	}
 
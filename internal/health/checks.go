@@ -0,0 +1,73 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+type ServerLister interface {
+	Servers() ([]*asynq.ServerInfo, error)
+}
+
+type Migrator interface {
+	Version(ctx context.Context) (int64, error)
+	Check(ctx context.Context) error
+}
+
+// DatabaseCheck pings Postgres through the pool.
+func DatabaseCheck(db Pinger) Check {
+	return func(ctx context.Context) (string, error) {
+		return "", db.Ping(ctx)
+	}
+}
+
+func RedisCheck(rdb redis.UniversalClient) Check {
+	return func(ctx context.Context) (string, error) {
+		return "", rdb.Ping(ctx).Err()
+	}
+}
+
+// QueueCheck looks for a queue worker whose heartbeat has not expired, otherwise the
+// emails and notifications enqueued would wait in Redis.
+func QueueCheck(inspector ServerLister) Check {
+	return func(ctx context.Context) (string, error) {
+		servers, err := inspector.Servers()
+		if err != nil {
+			return "", fmt.Errorf("error listing queue servers: %w", err)
+		}
+
+		active := 0
+		for _, server := range servers {
+			if server.Status == "active" {
+				active++
+			}
+		}
+
+		if active == 0 {
+			return "", errors.New("no queue worker is running")
+		}
+
+		return fmt.Sprintf("%d worker(s)", active), nil
+	}
+}
+
+// MigrationCheck reports the schema version and fails while a migration is pending.
+func MigrationCheck(migrator Migrator) Check {
+	return func(ctx context.Context) (string, error) {
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return "", fmt.Errorf("error reading schema version: %w", err)
+		}
+
+		detail := fmt.Sprintf("version %d", version)
+
+		return detail, migrator.Check(ctx)
+	}
+}
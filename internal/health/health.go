@@ -0,0 +1,120 @@
+// Package health serves the liveness and readiness probes of the web server.
+package health
+
+import (
+	"context"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK           = "ok"
+	StatusError        = "error"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+const DefaultTimeout = 2 * time.Second
+
+// Check reports whether a dependency can be used. The detail, such as the schema
+// version, is shown next to its status.
+type Check func(ctx context.Context) (detail string, err error)
+
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Detail    string  `json:"detail,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+type Handler struct {
+	Checks map[string]Check
+	// Timeout bounds each check, DefaultTimeout when zero.
+	Timeout time.Duration
+
+	shuttingDown atomic.Bool
+}
+
+// Shutdown makes readiness fail from now on, so the load balancer stops sending
+// requests before the server stops accepting them.
+func (h *Handler) Shutdown() {
+	h.shuttingDown.Store(true)
+}
+
+// LivenessHandler only tells that the process is serving requests, it checks no dependency.
+func (h *Handler) LivenessHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	helpers.WriteJSONResponse(responseWriter, Report{Status: StatusOK}, http.StatusOK)
+}
+
+// ReadinessHandler runs every check concurrently and fails when any of them does.
+func (h *Handler) ReadinessHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	if h.shuttingDown.Load() {
+		helpers.WriteJSONResponse(responseWriter, Report{Status: StatusShuttingDown}, http.StatusServiceUnavailable)
+		return
+	}
+
+	report := h.Run(request.Context())
+
+	status := http.StatusOK
+	if report.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	helpers.WriteJSONResponse(responseWriter, report, status)
+}
+
+// Run runs the checks and reports each of them.
+func (h *Handler) Run(ctx context.Context) Report {
+	timeout := h.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	report := Report{Status: StatusOK, Checks: make(map[string]CheckResult, len(h.Checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range h.Checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check(checkCtx)
+
+			result := CheckResult{
+				Status:    StatusOK,
+				LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+				Detail:    detail,
+			}
+			if err != nil {
+				result.Status = StatusError
+				result.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusUnavailable
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return report
+}
@@ -0,0 +1,173 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/health"
+	"github.com/Adedunmol/wish-mate/internal/migrate"
+	"github.com/hibiken/asynq"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func ok(ctx context.Context) (string, error) {
+	return "", nil
+}
+
+func serve(t *testing.T, handler http.HandlerFunc) (int, health.Report) {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	handler(response, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var report health.Report
+	if err := json.NewDecoder(response.Body).Decode(&report); err != nil {
+		t.Fatalf("invalid response body: %v", err)
+	}
+
+	return response.Code, report
+}
+
+func TestReadinessHandler(t *testing.T) {
+	t.Run("is ready when every check passes", func(t *testing.T) {
+		handler := &health.Handler{Checks: map[string]health.Check{
+			"database": ok,
+			"migrations": func(ctx context.Context) (string, error) {
+				return "version 3", nil
+			},
+		}}
+
+		status, report := serve(t, handler.ReadinessHandler)
+
+		if status != http.StatusOK {
+			t.Errorf("status = %d, want %d", status, http.StatusOK)
+		}
+		if report.Status != health.StatusOK {
+			t.Errorf("report status = %q, want %q", report.Status, health.StatusOK)
+		}
+		if got := report.Checks["migrations"]; got.Status != health.StatusOK || got.Detail != "version 3" {
+			t.Errorf("migrations = %+v, want ok with its version", got)
+		}
+	})
+
+	t.Run("is unavailable when a check fails", func(t *testing.T) {
+		handler := &health.Handler{Checks: map[string]health.Check{
+			"database": ok,
+			"redis": func(ctx context.Context) (string, error) {
+				return "", errors.New("connection refused")
+			},
+		}}
+
+		status, report := serve(t, handler.ReadinessHandler)
+
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", status, http.StatusServiceUnavailable)
+		}
+		if got := report.Checks["redis"]; got.Status != health.StatusError || got.Error != "connection refused" {
+			t.Errorf("redis = %+v, want its error", got)
+		}
+		if got := report.Checks["database"]; got.Status != health.StatusOK {
+			t.Errorf("database = %+v, want ok", got)
+		}
+	})
+
+	t.Run("bounds each check by the timeout", func(t *testing.T) {
+		handler := &health.Handler{
+			Timeout: 10 * time.Millisecond,
+			Checks: map[string]health.Check{
+				"database": func(ctx context.Context) (string, error) {
+					<-ctx.Done()
+					return "", ctx.Err()
+				},
+			},
+		}
+
+		status, report := serve(t, handler.ReadinessHandler)
+
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", status, http.StatusServiceUnavailable)
+		}
+		if got := report.Checks["database"].Error; got != context.DeadlineExceeded.Error() {
+			t.Errorf("error = %q, want %q", got, context.DeadlineExceeded.Error())
+		}
+	})
+
+	t.Run("fails once shutting down", func(t *testing.T) {
+		handler := &health.Handler{Checks: map[string]health.Check{"database": ok}}
+		handler.Shutdown()
+
+		status, report := serve(t, handler.ReadinessHandler)
+
+		if status != http.StatusServiceUnavailable {
+			t.Errorf("status = %d, want %d", status, http.StatusServiceUnavailable)
+		}
+		if report.Status != health.StatusShuttingDown {
+			t.Errorf("report status = %q, want %q", report.Status, health.StatusShuttingDown)
+		}
+
+		// the process is still alive while it drains
+		if status, _ := serve(t, handler.LivenessHandler); status != http.StatusOK {
+			t.Errorf("liveness status = %d, want %d", status, http.StatusOK)
+		}
+	})
+}
+
+type StubServerLister struct {
+	servers []*asynq.ServerInfo
+}
+
+func (s StubServerLister) Servers() ([]*asynq.ServerInfo, error) {
+	return s.servers, nil
+}
+
+func TestQueueCheck(t *testing.T) {
+	t.Run("passes with an active worker", func(t *testing.T) {
+		check := health.QueueCheck(StubServerLister{servers: []*asynq.ServerInfo{{Status: "active"}, {Status: "stopped"}}})
+
+		detail, err := check(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if detail != "1 worker(s)" {
+			t.Errorf("detail = %q, want %q", detail, "1 worker(s)")
+		}
+	})
+
+	t.Run("fails without an active worker", func(t *testing.T) {
+		check := health.QueueCheck(StubServerLister{servers: []*asynq.ServerInfo{{Status: "stopped"}}})
+
+		if _, err := check(context.Background()); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
+
+type StubMigrator struct {
+	version int64
+	err     error
+}
+
+func (m StubMigrator) Version(ctx context.Context) (int64, error) {
+	return m.version, nil
+}
+
+func (m StubMigrator) Check(ctx context.Context) error {
+	return m.err
+}
+
+func TestMigrationCheck(t *testing.T) {
+	t.Run("reports the version of an outdated schema", func(t *testing.T) {
+		check := health.MigrationCheck(StubMigrator{version: 2, err: migrate.ErrSchemaOutdated})
+
+		detail, err := check(context.Background())
+		if !errors.Is(err, migrate.ErrSchemaOutdated) {
+			t.Errorf("error = %v, want %v", err, migrate.ErrSchemaOutdated)
+		}
+		if detail != "version 2" {
+			t.Errorf("detail = %q, want %q", detail, "version 2")
+		}
+	})
+}
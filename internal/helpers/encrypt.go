@@ -0,0 +1,66 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// EncryptionKeySize is the size of the AES-256 keys Encrypt and Decrypt take.
+const EncryptionKeySize = 32
+
+var ErrDecrypt = errors.New("error decrypting value")
+
+// Encrypt seals plaintext with AES-256-GCM, for the values stored at rest. The random
+// nonce is kept in front of the ciphertext.
+func Encrypt(key []byte, plaintext string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("error generating nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed by Encrypt with the same key.
+func Decrypt(key []byte, ciphertext string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrDecrypt
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	return string(plaintext), nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+
+	return cipher.NewGCM(block)
+}
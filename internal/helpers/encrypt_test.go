@@ -0,0 +1,43 @@
+package helpers_test
+
+import (
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"strings"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	sealed, err := helpers.Encrypt(key, "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("hides the value", func(t *testing.T) {
+		if strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+			t.Errorf("sealed value %q contains the plaintext", sealed)
+		}
+	})
+
+	t.Run("opens with the same key", func(t *testing.T) {
+		got, err := helpers.Decrypt(key, sealed)
+		if err != nil || got != "JBSWY3DPEHPK3PXP" {
+			t.Errorf("got %q, %v, want the plaintext", got, err)
+		}
+	})
+
+	t.Run("fails with another key", func(t *testing.T) {
+		_, err := helpers.Decrypt([]byte("fedcba9876543210fedcba9876543210"), sealed)
+		if !errors.Is(err, helpers.ErrDecrypt) {
+			t.Errorf("got %v, want ErrDecrypt", err)
+		}
+	})
+
+	t.Run("refuses a short key", func(t *testing.T) {
+		if _, err := helpers.Encrypt([]byte("short"), "value"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
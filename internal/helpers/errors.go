@@ -17,6 +17,8 @@ var (
 	ErrValidate            = NewHTTPError(nil, http.StatusBadRequest, "error validating request body", nil)
 	ErrNotFound            = NewHTTPError(nil, http.StatusNotFound, "resource not found", nil)
 	ErrInternalServerError = NewHTTPError(nil, http.StatusInternalServerError, "internal server error", nil)
+	ErrTooManyRequests     = NewHTTPError(nil, http.StatusTooManyRequests, "too many requests, try again later", nil)
+	ErrAccountLocked       = NewHTTPError(nil, http.StatusLocked, "account is locked after too many failed logins, try again later", nil)
 )
 
 type ClientError interface {
@@ -72,6 +74,7 @@ func HandleError(responseWriter http.ResponseWriter, err error) {
 			Message: "An internal server error has occurred.",
 		}
 		WriteJSONResponse(responseWriter, body, http.StatusInternalServerError)
+		return
 	}
 	status, headers := clientError.ResponseHeaders()
 
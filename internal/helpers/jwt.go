@@ -1,52 +1,235 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"github.com/golang-jwt/jwt"
-	"os"
+	"log/slog"
+	"strconv"
 	"time"
 )
 
 const TokenExpiration = 30 * time.Minute
 
-func GenerateToken(userID int, email string, verified bool) (string, error) {
-	var signingKey = []byte(os.Getenv("SECRET_KEY"))
-	token := jwt.New(jwt.SigningMethodHS256)
+// ChallengeExpiration is how long a user has to send the second factor after the password.
+const ChallengeExpiration = 5 * time.Minute
+
+// purposeTwoFactor marks the challenge tokens, which are no access tokens.
+const purposeTwoFactor = "two_factor"
+
+// purposeMagicLink marks the tokens of the sign in links, which are no access tokens either.
+const purposeMagicLink = "magic_link"
+
+// MagicLinkClaims are what the token of a sign in link carries. ID tells the links
+// apart, so each works once. Device and IP are set, hashed, when the link only works
+// from where it was requested.
+type MagicLinkClaims struct {
+	UserID int
+	ID     string
+	Device string
+	IP     string
+}
+
+// GenerateToken signs an access token for the user with the current key, carrying the
+// standard claims other services check when they verify it with the JWKS, and the id of
+// the session it belongs to in sid.
+func GenerateToken(keys *Keys, userID int, email string, verified bool, sessionID int) (string, error) {
+	key, err := keys.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating token id: %w", err)
+	}
+
+	now := time.Now()
+
+	token := jwt.New(method(key))
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
 	claims := token.Claims.(jwt.MapClaims)
 
+	claims["iss"] = keys.Issuer
+	claims["aud"] = keys.Audience
+	claims["sub"] = strconv.Itoa(userID)
+	claims["jti"] = base64.RawURLEncoding.EncodeToString(id)
+	claims["sid"] = strconv.Itoa(sessionID)
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(TokenExpiration).Unix()
 	claims["email"] = email
 	claims["user_id"] = userID
 	claims["verified"] = verified
-	claims["exp"] = time.Now().Add(TokenExpiration).Unix()
 
-	tokenString, err := token.SignedString(signingKey)
+	tokenString, err := token.SignedString(key.Key)
 	if err != nil {
-		fmt.Printf("error generating token: %s", err.Error())
+		slog.Error("error generating token", "error", err)
 		return "", err
 	}
 
 	return tokenString, nil
 }
 
-func DecodeToken(tokenString string) (map[string]interface{}, error) {
-	var err error
+// DecodeToken returns the email, user_id (an int), verified and session_id (an int)
+// claims of an access token, once its signature, issuer, audience, subject, id and
+// times check out.
+func DecodeToken(keys *Keys, tokenString string) (map[string]interface{}, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+
+		key, ok := keys.verificationKey(id)
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", id)
+		}
+
+		if token.Method.Alg() != method(key).Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return verifyingKey(key), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error parsing token: %v", err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if _, ok := claims["purpose"]; ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// the jwt package checks exp and iat only when they are there, and no issuer or audience
+	_, expOK := claims["exp"].(float64)
+	_, iatOK := claims["iat"].(float64)
+	jti, jtiOK := claims["jti"].(string)
+	if !expOK || !iatOK || !jtiOK || jti == "" ||
+		!claims.VerifyIssuer(keys.Issuer, true) || !claims.VerifyAudience(keys.Audience, true) {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	email, emailOK := claims["email"].(string)
+	userID, userIDOK := claims["user_id"].(float64)
+	verified, verifiedOK := claims["verified"].(bool)
+	subject, subjectOK := claims["sub"].(string)
+	if !emailOK || !userIDOK || !verifiedOK || !subjectOK || subject != strconv.Itoa(int(userID)) {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	// the tokens issued before sessions name none, and could not be revoked
+	session, _ := claims["sid"].(string)
+	sessionID, err := strconv.Atoi(session)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	data := map[string]interface{}{
+		"email":      email,
+		"user_id":    int(userID),
+		"verified":   verified,
+		"session_id": sessionID,
+	}
+
+	return data, nil
+}
+
+// GenerateChallengeToken signs a short-lived token stating that the user gave the right
+// password, to exchange along with their second factor for an access token.
+func GenerateChallengeToken(secretKey []byte, userID int) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["user_id"] = userID
+	claims["purpose"] = purposeTwoFactor
+	claims["exp"] = time.Now().Add(ChallengeExpiration).Unix()
+
+	tokenString, err := token.SignedString(secretKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing challenge token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// DecodeChallengeToken returns the user a challenge token was issued to.
+func DecodeChallengeToken(secretKey []byte, tokenString string) (int, error) {
+	claims, err := parseToken(secretKey, tokenString)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || claims["purpose"] != purposeTwoFactor {
+		return 0, fmt.Errorf("invalid token")
+	}
+
+	return int(userID), nil
+}
+
+// GenerateMagicLinkToken signs the token of a sign in link, valid for expiration.
+func GenerateMagicLinkToken(secretKey []byte, link MagicLinkClaims, expiration time.Duration) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+
+	claims["user_id"] = link.UserID
+	claims["jti"] = link.ID
+	claims["purpose"] = purposeMagicLink
+	claims["exp"] = time.Now().Add(expiration).Unix()
+
+	if link.Device != "" {
+		claims["device"] = link.Device
+	}
+	if link.IP != "" {
+		claims["ip"] = link.IP
+	}
+
+	tokenString, err := token.SignedString(secretKey)
+	if err != nil {
+		return "", fmt.Errorf("error signing magic link token: %w", err)
+	}
+
+	return tokenString, nil
+}
+
+// DecodeMagicLinkToken returns the claims of the token of a sign in link.
+func DecodeMagicLinkToken(secretKey []byte, tokenString string) (MagicLinkClaims, error) {
+	claims, err := parseToken(secretKey, tokenString)
+	if err != nil {
+		return MagicLinkClaims{}, err
+	}
+
+	userID, userIDOK := claims["user_id"].(float64)
+	id, idOK := claims["jti"].(string)
+	if !userIDOK || !idOK || id == "" || claims["purpose"] != purposeMagicLink {
+		return MagicLinkClaims{}, fmt.Errorf("invalid token")
+	}
+
+	device, _ := claims["device"].(string)
+	ip, _ := claims["ip"].(string)
 
+	return MagicLinkClaims{UserID: int(userID), ID: id, Device: device, IP: ip}, nil
+}
+
+func parseToken(secretKey []byte, tokenString string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("SECRET_KEY")), nil
+		return secretKey, nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error parsing token: %v", err)
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		var data map[string]interface{}
 
-		data["email"] = claims["email"].(string)
-		data["user_id"] = claims["user_id"].(string)
-		data["verified"] = claims["verified"].(bool)
-		return data, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
-	return nil, fmt.Errorf("invalid token")
+
+	return claims, nil
 }
@@ -0,0 +1,115 @@
+package helpers_test
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/golang-jwt/jwt"
+	"testing"
+	"time"
+)
+
+func TestTokens(t *testing.T) {
+	secretKey := []byte("0123456789abcdef0123456789abcdef")
+	keys := helpers.NewSecretKeys("https://api.wishmate.app", "wishmate", secretKey)
+
+	t.Run("decodes an access token", func(t *testing.T) {
+		token, err := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 7)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := helpers.DecodeToken(keys, token)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if data["user_id"] != 42 || data["email"] != "ade@gmail.com" || data["verified"] != true || data["session_id"] != 7 {
+			t.Errorf("got %v", data)
+		}
+	})
+
+	t.Run("refuses a token signed with another key", func(t *testing.T) {
+		other := helpers.NewSecretKeys("https://api.wishmate.app", "wishmate", []byte("another key"))
+		token, _ := helpers.GenerateToken(other, 42, "ade@gmail.com", true, 7)
+
+		if _, err := helpers.DecodeToken(keys, token); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("refuses a token for another issuer or audience", func(t *testing.T) {
+		for _, other := range []*helpers.Keys{
+			helpers.NewSecretKeys("https://evil.example.com", "wishmate", secretKey),
+			helpers.NewSecretKeys("https://api.wishmate.app", "another-service", secretKey),
+		} {
+			token, _ := helpers.GenerateToken(other, 42, "ade@gmail.com", true, 7)
+
+			if _, err := helpers.DecodeToken(keys, token); err == nil {
+				t.Errorf("the token of %s for %s decoded", other.Issuer, other.Audience)
+			}
+		}
+	})
+
+	t.Run("refuses a token without the standard claims", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"email":    "ade@gmail.com",
+			"user_id":  42,
+			"verified": true,
+			"exp":      time.Now().Add(time.Minute).Unix(),
+		})
+		signed, _ := token.SignedString(secretKey)
+
+		if _, err := helpers.DecodeToken(keys, signed); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("keeps challenge and access tokens apart", func(t *testing.T) {
+		challenge, err := helpers.GenerateChallengeToken(secretKey, 42)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if userID, err := helpers.DecodeChallengeToken(secretKey, challenge); err != nil || userID != 42 {
+			t.Errorf("got %d, %v, want 42", userID, err)
+		}
+
+		if _, err := helpers.DecodeToken(keys, challenge); err == nil {
+			t.Error("the challenge token decoded as an access token")
+		}
+
+		access, _ := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 7)
+		if _, err := helpers.DecodeChallengeToken(secretKey, access); err == nil {
+			t.Error("the access token decoded as a challenge token")
+		}
+	})
+
+	t.Run("decodes a magic link token", func(t *testing.T) {
+		link := helpers.MagicLinkClaims{UserID: 42, ID: "link", Device: "device-hash"}
+
+		token, err := helpers.GenerateMagicLinkToken(secretKey, link, time.Minute)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got, err := helpers.DecodeMagicLinkToken(secretKey, token); err != nil || got != link {
+			t.Errorf("got %+v, %v, want %+v", got, err, link)
+		}
+
+		if _, err := helpers.DecodeToken(keys, token); err == nil {
+			t.Error("the magic link token decoded as an access token")
+		}
+
+		challenge, _ := helpers.GenerateChallengeToken(secretKey, 42)
+		if _, err := helpers.DecodeMagicLinkToken(secretKey, challenge); err == nil {
+			t.Error("the challenge token decoded as a magic link token")
+		}
+	})
+
+	t.Run("refuses an expired magic link token", func(t *testing.T) {
+		token, _ := helpers.GenerateMagicLinkToken(secretKey, helpers.MagicLinkClaims{UserID: 42, ID: "link"}, -time.Minute)
+
+		if _, err := helpers.DecodeMagicLinkToken(secretKey, token); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
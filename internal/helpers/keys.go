@@ -0,0 +1,284 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The algorithms access tokens are signed with. HS256 needs the secret to verify a
+// token, the others only the public key, which the JWKS publishes.
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// keyDateLayout starts the file name of a key that takes over on that day.
+const keyDateLayout = "2006-01-02"
+
+// SigningKey signs the access tokens from NotBefore on, until a later key takes over.
+type SigningKey struct {
+	// ID is the kid of the tokens it signs.
+	ID        string
+	Algorithm string
+	// Key is an *rsa.PrivateKey, an ed25519.PrivateKey or, for HS256, a []byte.
+	Key       interface{}
+	NotBefore time.Time
+}
+
+// Keys sign and verify the access tokens. The latest key whose NotBefore has come signs,
+// and the keys before it keep verifying the tokens they signed until those expire, so
+// a rotation is scheduled by adding a key that starts later.
+type Keys struct {
+	Issuer   string
+	Audience string
+	keys     []SigningKey
+}
+
+// NewKeys checks the keys and returns the set they make.
+func NewKeys(issuer, audience string, keys ...SigningKey) (*Keys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+
+	ids := map[string]bool{}
+	for _, key := range keys {
+		if ids[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		ids[key.ID] = true
+
+		if method(key) == nil {
+			return nil, fmt.Errorf("key %q is not a %s key", key.ID, key.Algorithm)
+		}
+	}
+
+	sorted := append([]SigningKey(nil), keys...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].NotBefore.Before(sorted[j].NotBefore) })
+
+	return &Keys{Issuer: issuer, Audience: audience, keys: sorted}, nil
+}
+
+// NewSecretKeys signs with HS256 and the secret key, for deployments whose tokens are
+// only verified by this API.
+func NewSecretKeys(issuer, audience string, secretKey []byte) *Keys {
+	keys, _ := NewKeys(issuer, audience, SigningKey{Algorithm: AlgorithmHS256, Key: secretKey})
+	return keys
+}
+
+// LoadKeys reads the PEM private keys in dir, RSA keys signing with RS256 and Ed25519
+// keys with EdDSA. The file name less its extension is the kid, and a name starting
+// with a date, such as 2025-06-01.pem, makes the key take over on that day (UTC).
+func LoadKeys(dir, issuer, audience string) (*Keys, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]SigningKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := loadKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no .pem keys in %s", dir)
+	}
+
+	return NewKeys(issuer, audience, keys...)
+}
+
+func loadKey(path string) (SigningKey, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return SigningKey{}, errors.New("not a PEM file")
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	id := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	key := SigningKey{ID: id, Key: private}
+
+	switch private.(type) {
+	case *rsa.PrivateKey:
+		key.Algorithm = AlgorithmRS256
+	case ed25519.PrivateKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return SigningKey{}, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", private)
+	}
+
+	if len(id) >= len(keyDateLayout) {
+		if notBefore, err := time.Parse(keyDateLayout, id[:len(keyDateLayout)]); err == nil {
+			key.NotBefore = notBefore
+		}
+	}
+
+	return key, nil
+}
+
+// Asymmetric reports whether tokens can be verified with the JWKS alone.
+func (k *Keys) Asymmetric() bool {
+	for _, key := range k.keys {
+		if key.Algorithm == AlgorithmHS256 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// signingKey is the latest key whose time has come.
+func (k *Keys) signingKey() (SigningKey, error) {
+	now := time.Now()
+
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !k.keys[i].NotBefore.After(now) {
+			return k.keys[i], nil
+		}
+	}
+
+	return SigningKey{}, errors.New("no signing key is active yet")
+}
+
+// published lists the keys that may have signed an unexpired token, or soon will. A key
+// retires once the key after it has signed for longer than a token lasts.
+func (k *Keys) published() []SigningKey {
+	now := time.Now()
+
+	keys := make([]SigningKey, 0, len(k.keys))
+	for i, key := range k.keys {
+		if i+1 < len(k.keys) && !k.keys[i+1].NotBefore.Add(TokenExpiration).After(now) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// verificationKey is the published key with the id, once its time has come.
+func (k *Keys) verificationKey(id string) (SigningKey, bool) {
+	now := time.Now()
+
+	for _, key := range k.published() {
+		if key.ID == id && !key.NotBefore.After(now) {
+			return key, true
+		}
+	}
+
+	return SigningKey{}, false
+}
+
+// JSONWebKeySet is the document of /.well-known/jwks.json, RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS publishes the public keys that verify the tokens, including those about to take
+// over so verifiers can fetch them ahead. HS256 keys are secret and left out.
+func (k *Keys) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if k == nil {
+		return set
+	}
+
+	for _, key := range k.published() {
+		switch private := key.Key.(type) {
+		case *rsa.PrivateKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: AlgorithmRS256,
+				N:   base64.RawURLEncoding.EncodeToString(private.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(private.E)).Bytes()),
+			})
+		case ed25519.PrivateKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: AlgorithmEdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(private.Public().(ed25519.PublicKey)),
+			})
+		}
+	}
+
+	return set
+}
+
+// method is the signing method of the key, nil when the key does not fit its algorithm.
+func method(key SigningKey) jwt.SigningMethod {
+	switch key.Algorithm {
+	case AlgorithmHS256:
+		if _, ok := key.Key.([]byte); ok {
+			return jwt.SigningMethodHS256
+		}
+	case AlgorithmRS256:
+		if _, ok := key.Key.(*rsa.PrivateKey); ok {
+			return jwt.SigningMethodRS256
+		}
+	case AlgorithmEdDSA:
+		if _, ok := key.Key.(ed25519.PrivateKey); ok {
+			return jwt.SigningMethodEdDSA
+		}
+	}
+
+	return nil
+}
+
+// verifyingKey is what the jwt package verifies a signature of the key with.
+func verifyingKey(key SigningKey) interface{} {
+	switch private := key.Key.(type) {
+	case *rsa.PrivateKey:
+		return &private.PublicKey
+	case ed25519.PrivateKey:
+		return private.Public()
+	}
+
+	return key.Key
+}
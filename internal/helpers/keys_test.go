@@ -0,0 +1,166 @@
+package helpers_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/golang-jwt/jwt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeys(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKeys := func(t *testing.T, keys ...helpers.SigningKey) *helpers.Keys {
+		t.Helper()
+
+		set, err := helpers.NewKeys("https://api.wishmate.app", "wishmate", keys...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return set
+	}
+
+	kid := func(t *testing.T, token string) string {
+		t.Helper()
+
+		parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := parsed.Header["kid"].(string)
+		return id
+	}
+
+	t.Run("loads the keys of a directory", func(t *testing.T) {
+		dir := t.TempDir()
+
+		edDER, _ := x509.MarshalPKCS8PrivateKey(edKey)
+		writePEM(t, filepath.Join(dir, "2024-01-01-ed.pem"), "PRIVATE KEY", edDER)
+		writePEM(t, filepath.Join(dir, "legacy.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+		keys, err := helpers.LoadKeys(dir, "https://api.wishmate.app", "wishmate")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		// legacy has no date, so it came first and the dated key took over
+		token, err := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 7)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := kid(t, token); got != "2024-01-01-ed" {
+			t.Errorf("kid = %q, want 2024-01-01-ed", got)
+		}
+
+		if _, err := helpers.DecodeToken(keys, token); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("refuses a directory without keys", func(t *testing.T) {
+		if _, err := helpers.LoadKeys(t.TempDir(), "https://api.wishmate.app", "wishmate"); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("signs with the latest key whose time has come", func(t *testing.T) {
+		keys := newKeys(t,
+			helpers.SigningKey{ID: "old", Algorithm: helpers.AlgorithmRS256, Key: rsaKey, NotBefore: time.Now().Add(-24 * time.Hour)},
+			helpers.SigningKey{ID: "current", Algorithm: helpers.AlgorithmEdDSA, Key: edKey, NotBefore: time.Now().Add(-time.Minute)},
+			helpers.SigningKey{ID: "next", Algorithm: helpers.AlgorithmHS256, Key: []byte("next"), NotBefore: time.Now().Add(time.Hour)},
+		)
+
+		token, err := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 7)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got := kid(t, token); got != "current" {
+			t.Errorf("kid = %q, want current", got)
+		}
+	})
+
+	t.Run("verifies the tokens of the previous key until they expire", func(t *testing.T) {
+		old := helpers.SigningKey{ID: "old", Algorithm: helpers.AlgorithmRS256, Key: rsaKey, NotBefore: time.Now().Add(-24 * time.Hour)}
+		token, _ := helpers.GenerateToken(newKeys(t, old), 42, "ade@gmail.com", true, 7)
+
+		recent := newKeys(t, old, helpers.SigningKey{ID: "new", Algorithm: helpers.AlgorithmEdDSA, Key: edKey, NotBefore: time.Now().Add(-time.Minute)})
+		if _, err := helpers.DecodeToken(recent, token); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		retired := newKeys(t, old, helpers.SigningKey{ID: "new", Algorithm: helpers.AlgorithmEdDSA, Key: edKey, NotBefore: time.Now().Add(-time.Hour)})
+		if _, err := helpers.DecodeToken(retired, token); err == nil {
+			t.Error("the token of a retired key decoded")
+		}
+	})
+
+	t.Run("refuses a token signed with the public key as a secret", func(t *testing.T) {
+		keys := newKeys(t, helpers.SigningKey{ID: "rsa", Algorithm: helpers.AlgorithmRS256, Key: rsaKey})
+
+		public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"iss": "https://api.wishmate.app", "aud": "wishmate", "sub": "42", "jti": "id",
+			"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+			"email": "ade@gmail.com", "user_id": 42, "verified": true,
+		})
+		token.Header["kid"] = "rsa"
+		signed, _ := token.SignedString(public)
+
+		if _, err := helpers.DecodeToken(keys, signed); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+
+	t.Run("publishes the public keys", func(t *testing.T) {
+		keys := newKeys(t,
+			helpers.SigningKey{ID: "retired", Algorithm: helpers.AlgorithmRS256, Key: rsaKey, NotBefore: time.Now().Add(-48 * time.Hour)},
+			helpers.SigningKey{ID: "current", Algorithm: helpers.AlgorithmRS256, Key: rsaKey, NotBefore: time.Now().Add(-24 * time.Hour)},
+			helpers.SigningKey{ID: "next", Algorithm: helpers.AlgorithmEdDSA, Key: edKey, NotBefore: time.Now().Add(time.Hour)},
+		)
+
+		set := keys.JWKS()
+
+		if len(set.Keys) != 2 || set.Keys[0].Kid != "current" || set.Keys[1].Kid != "next" {
+			t.Fatalf("got %+v, want current and next", set.Keys)
+		}
+
+		if set.Keys[0].Kty != "RSA" || set.Keys[0].Alg != helpers.AlgorithmRS256 || set.Keys[0].E != "AQAB" {
+			t.Errorf("got %+v, want the RSA key", set.Keys[0])
+		}
+
+		x, _ := base64.RawURLEncoding.DecodeString(set.Keys[1].X)
+		if set.Keys[1].Kty != "OKP" || set.Keys[1].Crv != "Ed25519" || !edKey.Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(x)) {
+			t.Errorf("got %+v, want the Ed25519 public key", set.Keys[1])
+		}
+	})
+
+	t.Run("keeps the shared secret out of the key set", func(t *testing.T) {
+		keys := helpers.NewSecretKeys("https://api.wishmate.app", "wishmate", []byte("0123456789abcdef0123456789abcdef"))
+
+		if len(keys.JWKS().Keys) != 0 || keys.Asymmetric() {
+			t.Errorf("got %+v, want no keys", keys.JWKS())
+		}
+	})
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
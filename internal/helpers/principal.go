@@ -0,0 +1,60 @@
+package helpers
+
+import (
+	"context"
+)
+
+// PersonalTokenPrefix starts every personal access token, telling them apart from the
+// signed access tokens.
+const PersonalTokenPrefix = "wmp_"
+
+// The scopes a personal access token may be given, each opening some routes to it.
+const (
+	ScopeReadWishlists  = "read:wishlists"
+	ScopeWriteWishlists = "write:wishlists"
+	ScopeReadFriends    = "read:friends"
+)
+
+// Scopes lists every scope.
+var Scopes = []string{ScopeReadWishlists, ScopeWriteWishlists, ScopeReadFriends}
+
+// Principal is the authenticated user a request is made by. AuthMiddleware puts it in
+// the request context from the access token or personal access token.
+type Principal struct {
+	UserID   int
+	Email    string
+	Verified bool
+	// SessionID is the session of the access token, 0 for a personal access token.
+	SessionID int
+	// Scopes are those of the personal access token, nil when the user signed in.
+	Scopes []string
+}
+
+// HasScope reports whether the principal may use the routes of the scope. A signed in
+// user may use them all.
+func (p Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the principal carried by the context, and whether there is one.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
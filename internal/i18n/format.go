@@ -0,0 +1,80 @@
+package i18n
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var months = map[string][12]string{
+	English: {"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+	French:  {"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+	Yoruba:  {"Ṣẹ́rẹ́", "Èrèlè", "Ẹrẹ̀nà", "Ìgbé", "Ẹ̀bibi", "Òkúdu", "Agẹmọ", "Ògún", "Owewe", "Ọ̀wàrà", "Bélú", "Ọ̀pẹ̀"},
+}
+
+type numberFormat struct {
+	group       string
+	decimal     string
+	symbolAfter bool
+}
+
+var numberFormats = map[string]numberFormat{
+	English: {group: ",", decimal: "."},
+	French:  {group: " ", decimal: ",", symbolAfter: true},
+	Yoruba:  {group: ",", decimal: "."},
+}
+
+var currencySymbols = map[string]string{
+	"NGN": "₦",
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+}
+
+// FormatDate formats t as a long date, e.g. "March 6, 2025", "6 mars 2025" or "6 Ẹrẹ̀nà 2025".
+func FormatDate(locale string, t time.Time) string {
+	locale = Normalize(locale)
+	month := months[locale][t.Month()-1]
+
+	if locale == English {
+		return fmt.Sprintf("%s %d, %d", month, t.Day(), t.Year())
+	}
+	return fmt.Sprintf("%d %s %d", t.Day(), month, t.Year())
+}
+
+// FormatCurrency formats amount (in major units) with the currency symbol, grouping
+// and decimal separator of the locale, e.g. "₦12,500.00" or "12 500,00 €".
+func FormatCurrency(locale string, amount float64, currency string) string {
+	locale = Normalize(locale)
+	format := numberFormats[locale]
+
+	symbol, ok := currencySymbols[strings.ToUpper(currency)]
+	if !ok {
+		symbol = strings.ToUpper(currency)
+	}
+
+	minor := int64(math.Round(math.Abs(amount) * 100))
+	whole := strconv.FormatInt(minor/100, 10)
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(format.group)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	number := fmt.Sprintf("%s%s%02d", grouped.String(), format.decimal, minor%100)
+
+	sign := ""
+	if amount < 0 && minor != 0 {
+		sign = "-"
+	}
+
+	if format.symbolAfter {
+		return sign + number + " " + symbol
+	}
+	return sign + symbol + number
+}
@@ -0,0 +1,95 @@
+// Package i18n holds the message catalog for notification copy and the
+// locale aware date and currency formatting used in emails.
+package i18n
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	English = "en"
+	French  = "fr"
+	Yoruba  = "yo"
+
+	DefaultLocale = English
+)
+
+var Supported = []string{English, French, Yoruba}
+
+const (
+	BirthdayTitle        = "birthday.title"
+	BirthdayBody         = "birthday.body"
+	SubjectVerification  = "subject.verification"
+	SubjectWelcome       = "subject.welcome"
+	SubjectBirthday      = "subject.birthday"
+	SubjectReminder      = "subject.reminder"
+	SubjectAccountLocked = "subject.account_locked"
+	SubjectNewLogin      = "subject.new_login"
+	SubjectMagicLink     = "subject.magic_link"
+)
+
+var catalog = map[string]map[string]string{
+	English: {
+		BirthdayTitle:        "Happy Birthday!",
+		BirthdayBody:         "Wishing you a wonderful day filled with joy!",
+		SubjectVerification:  "Verify your email",
+		SubjectWelcome:       "Welcome to Wishmate",
+		SubjectBirthday:      "Happy Birthday from Wishmate",
+		SubjectReminder:      "Wishlist Reminder",
+		SubjectAccountLocked: "Your Wishmate account has been locked",
+		SubjectNewLogin:      "New login to your Wishmate account",
+		SubjectMagicLink:     "Your Wishmate sign in link",
+	},
+	French: {
+		BirthdayTitle:        "Joyeux anniversaire !",
+		BirthdayBody:         "Nous vous souhaitons une merveilleuse journée remplie de joie !",
+		SubjectVerification:  "Vérifiez votre adresse e-mail",
+		SubjectWelcome:       "Bienvenue sur Wishmate",
+		SubjectBirthday:      "Joyeux anniversaire de la part de Wishmate",
+		SubjectReminder:      "Rappel de liste de souhaits",
+		SubjectAccountLocked: "Votre compte Wishmate a été verrouillé",
+		SubjectNewLogin:      "Nouvelle connexion à votre compte Wishmate",
+		SubjectMagicLink:     "Votre lien de connexion Wishmate",
+	},
+	Yoruba: {
+		BirthdayTitle:        "Ẹ kú ọjọ́ ìbí!",
+		BirthdayBody:         "A kí yín ní ọjọ́ àgbàyanu tí ó kún fún ayọ̀!",
+		SubjectVerification:  "Ṣe ìmúdájú ímeèlì rẹ",
+		SubjectWelcome:       "Ẹ kú àbọ̀ sí Wishmate",
+		SubjectBirthday:      "Ẹ kú ọjọ́ ìbí láti ọ̀dọ̀ Wishmate",
+		SubjectReminder:      "Ìrántí àkójọ ìfẹ́",
+		SubjectAccountLocked: "A ti tì àkáǹtì Wishmate rẹ",
+		SubjectNewLogin:      "Ìwọlé tuntun sí àkáǹtì Wishmate rẹ",
+		SubjectMagicLink:     "Ìjápọ̀ ìwọlé Wishmate rẹ",
+	},
+}
+
+// Normalize maps a requested locale (for example "fr-FR" or "YO") to a supported one,
+// falling back to English.
+func Normalize(locale string) string {
+	base := strings.ToLower(strings.SplitN(strings.ReplaceAll(locale, "_", "-"), "-", 2)[0])
+
+	if _, ok := catalog[base]; ok {
+		return base
+	}
+	return DefaultLocale
+}
+
+// T returns the message for key in locale, falling back to English when the
+// locale or the key is missing. Arguments are applied with fmt.Sprintf.
+func T(locale, key string, args ...interface{}) string {
+	message, ok := catalog[Normalize(locale)][key]
+	if !ok {
+		message, ok = catalog[DefaultLocale][key]
+	}
+
+	if !ok {
+		return key
+	}
+
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
@@ -0,0 +1,76 @@
+package i18n_test
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"testing"
+	"time"
+)
+
+func TestT(t *testing.T) {
+	t.Run("return the message in the requested locale", func(t *testing.T) {
+		got := i18n.T("fr", i18n.BirthdayTitle)
+		want := "Joyeux anniversaire !"
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("fall back to english for an unsupported locale", func(t *testing.T) {
+		got := i18n.T("de", i18n.BirthdayTitle)
+		want := "Happy Birthday!"
+
+		if got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("normalize region and case", func(t *testing.T) {
+		if got := i18n.Normalize("FR_ca"); got != i18n.French {
+			t.Errorf("got %q, want %q", got, i18n.French)
+		}
+
+		if got := i18n.Normalize("yo-NG"); got != i18n.Yoruba {
+			t.Errorf("got %q, want %q", got, i18n.Yoruba)
+		}
+	})
+}
+
+func TestFormatDate(t *testing.T) {
+	date := time.Date(2025, 3, 6, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]string{
+		"en": "March 6, 2025",
+		"fr": "6 mars 2025",
+		"yo": "6 Ẹrẹ̀nà 2025",
+		"":   "March 6, 2025",
+	}
+
+	for locale, want := range cases {
+		if got := i18n.FormatDate(locale, date); got != want {
+			t.Errorf("FormatDate(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestFormatCurrency(t *testing.T) {
+	cases := []struct {
+		locale   string
+		amount   float64
+		currency string
+		want     string
+	}{
+		{"en", 12500, "NGN", "₦12,500.00"},
+		{"en", 1234567.891, "USD", "$1,234,567.89"},
+		{"fr", 12500.5, "EUR", "12 500,50 €"},
+		{"yo", 999.99, "NGN", "₦999.99"},
+		{"en", -15, "GBP", "-£15.00"},
+		{"en", 10, "xof", "XOF10.00"},
+	}
+
+	for _, c := range cases {
+		if got := i18n.FormatCurrency(c.locale, c.amount, c.currency); got != c.want {
+			t.Errorf("FormatCurrency(%q, %v, %q) = %q, want %q", c.locale, c.amount, c.currency, got, c.want)
+		}
+	}
+}
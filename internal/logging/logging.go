@@ -0,0 +1,146 @@
+// Package logging sets up the JSON logger every process writes through and carries
+// the request ID from an HTTP request to the logs of the tasks it enqueues.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const Redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute and payload keys whose values never reach the logs.
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"otp":           true,
+	"code":          true,
+	"token":         true,
+	"refresh_token": true,
+	"access_token":  true,
+	"secret":        true,
+	"authorization": true,
+	"api_key":       true,
+}
+
+type requestIDKey struct{}
+
+// New returns a JSON logger writing to w that adds the request ID found in the
+// context and redacts sensitive attributes.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+
+	return slog.New(contextHandler{handler})
+}
+
+// Setup makes the JSON logger the default for slog and the log package.
+func Setup(level slog.Level) {
+	slog.SetDefault(New(os.Stderr, level))
+}
+
+// Fatal logs the message at error level and exits.
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("error generating request id: %v", err))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		return ctx
+	}
+
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the request ID carried by the context, or an empty string.
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// IsSensitive reports whether values under the key must be redacted.
+func IsSensitive(key string) bool {
+	key = strings.ToLower(key)
+	return sensitiveKeys[key] || strings.HasSuffix(key, "_password") || strings.HasSuffix(key, "_token") || strings.HasSuffix(key, "_secret")
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		record.AddAttrs(slog.String("request_id", requestID))
+	}
+
+	// lets a log line be found from its trace and the other way round
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if IsSensitive(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	if attr.Value.Kind() == slog.KindAny {
+		if payload, ok := attr.Value.Any().(map[string]interface{}); ok {
+			return slog.Any(attr.Key, RedactMap(payload))
+		}
+	}
+
+	return attr
+}
+
+// RedactMap returns a copy of the payload with the sensitive values, at any depth, redacted.
+func RedactMap(payload map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(payload))
+
+	for key, value := range payload {
+		if IsSensitive(key) {
+			redacted[key] = Redacted
+			continue
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			redacted[key] = RedactMap(nested)
+			continue
+		}
+
+		redacted[key] = value
+	}
+
+	return redacted
+}
@@ -0,0 +1,138 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"testing"
+)
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", buf.String(), err)
+	}
+
+	return entry
+}
+
+func TestLogger(t *testing.T) {
+	t.Run("adds the request id from the context", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelInfo)
+
+		ctx := logging.WithRequestID(context.Background(), "abc123")
+		logger.InfoContext(ctx, "sending mail")
+
+		entry := decode(t, &buf)
+		if entry["request_id"] != "abc123" {
+			t.Errorf("request_id = %v, want %q", entry["request_id"], "abc123")
+		}
+		if entry["msg"] != "sending mail" {
+			t.Errorf("msg = %v, want %q", entry["msg"], "sending mail")
+		}
+	})
+
+	t.Run("leaves out the request id when there is none", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelInfo)
+
+		logger.Info("scheduler started")
+
+		if _, ok := decode(t, &buf)["request_id"]; ok {
+			t.Error("request_id should not be set")
+		}
+	})
+
+	t.Run("adds the trace and span ids from the context", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelInfo)
+
+		traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+		spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+		ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID: traceID,
+			SpanID:  spanID,
+		}))
+		logger.InfoContext(ctx, "sending mail")
+
+		entry := decode(t, &buf)
+		if entry["trace_id"] != traceID.String() {
+			t.Errorf("trace_id = %v, want %q", entry["trace_id"], traceID)
+		}
+		if entry["span_id"] != spanID.String() {
+			t.Errorf("span_id = %v, want %q", entry["span_id"], spanID)
+		}
+	})
+
+	t.Run("redacts sensitive attributes", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelInfo)
+
+		logger.Info("login", "email", "adedunmola@gmail.com", "password", "hunter2", "otp", "123456", "refresh_token", "r")
+
+		entry := decode(t, &buf)
+		for _, key := range []string{"password", "otp", "refresh_token"} {
+			if entry[key] != logging.Redacted {
+				t.Errorf("%s = %v, want it redacted", key, entry[key])
+			}
+		}
+		if entry["email"] != "adedunmola@gmail.com" {
+			t.Errorf("email = %v, want it kept", entry["email"])
+		}
+	})
+
+	t.Run("redacts nested payloads", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelInfo)
+
+		payload := map[string]interface{}{
+			"template": "verification_mail",
+			"data": map[string]interface{}{
+				"username": "Adedunmola",
+				"code":     "123456",
+			},
+		}
+		logger.Info("enqueued", "payload", payload)
+
+		data := decode(t, &buf)["payload"].(map[string]interface{})["data"].(map[string]interface{})
+		if data["code"] != logging.Redacted {
+			t.Errorf("code = %v, want it redacted", data["code"])
+		}
+		if data["username"] != "Adedunmola" {
+			t.Errorf("username = %v, want it kept", data["username"])
+		}
+
+		if payload["data"].(map[string]interface{})["code"] != "123456" {
+			t.Error("the logged payload should not be modified")
+		}
+	})
+
+	t.Run("respects the level", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := logging.New(&buf, slog.LevelWarn)
+
+		logger.Info("ignored")
+
+		if buf.Len() != 0 {
+			t.Errorf("got %q, want nothing logged", buf.String())
+		}
+	})
+}
+
+func TestNewRequestID(t *testing.T) {
+	first, second := logging.NewRequestID(), logging.NewRequestID()
+
+	if len(first) != 32 {
+		t.Errorf("got request id %q, want 32 hex characters", first)
+	}
+
+	if first == second {
+		t.Error("request ids should be unique")
+	}
+}
@@ -0,0 +1,22 @@
+package media
+
+import (
+	"context"
+	"time"
+)
+
+// The BLOB_STORE values.
+const (
+	StoreLocal = "local"
+	StoreS3    = "s3"
+)
+
+// BlobStore keeps the uploaded files under keys such as avatars/1/<random>.jpg, and hands
+// out links to them that stop working after a while.
+type BlobStore interface {
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	// Delete removes the blob, a key that does not exist is not an error.
+	Delete(ctx context.Context, key string) error
+	// URL returns a signed link to the blob that works for ttl.
+	URL(key string, ttl time.Duration) string
+}
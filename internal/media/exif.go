@@ -0,0 +1,99 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// exifOrientation reads the orientation tag of a JPEG, 1 (upright) when it has none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// fill byte
+			i++
+			continue
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// markers without a segment
+			i += 2
+			continue
+		case marker == 0xDA || marker == 0xD9:
+			// the EXIF segment comes before the image data
+			return 1
+		}
+
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+// tiffOrientation finds tag 0x0112 in the first IFD of the TIFF structure EXIF is.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	if order.Uint16(tiff[2:]) != 42 {
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < count; n++ {
+		entry := offset + 2 + 12*n
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+
+		// a SHORT, held in the first two bytes of the value
+		if order.Uint16(tiff[entry+2:]) != 3 {
+			return 1
+		}
+
+		if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+			return orientation
+		}
+
+		return 1
+	}
+
+	return 1
+}
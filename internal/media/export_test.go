@@ -0,0 +1,8 @@
+package media
+
+import "time"
+
+// SetClock makes the store sign its requests as if it were now().
+func (s *S3Store) SetClock(now func() time.Time) {
+	s.now = now
+}
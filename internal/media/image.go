@@ -0,0 +1,182 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	// MaxDimension is the longest side of a stored image, larger ones are scaled down.
+	MaxDimension = 2048
+	// ThumbnailSize is the longest side of a thumbnail.
+	ThumbnailSize = 256
+	// MaxPixels bounds the images decoded, a small file can hold a huge image.
+	MaxPixels = 50_000_000
+)
+
+var (
+	ErrUnsupportedImage = helpers.NewHTTPError(nil, http.StatusUnsupportedMediaType, "image must be a JPEG or PNG", nil)
+	ErrInvalidImage     = helpers.NewHTTPError(nil, http.StatusBadRequest, "image could not be read", nil)
+	ErrTooManyPixels    = helpers.NewHTTPError(nil, http.StatusBadRequest, fmt.Sprintf("image must have at most %d pixels", MaxPixels), nil)
+)
+
+// Image is an upload ready to store, re-encoded from its pixels so none of the metadata
+// of the original, such as the EXIF location, is left.
+type Image struct {
+	ContentType string
+	// Extension is the one the keys end with, such as .jpg.
+	Extension string
+	Data      []byte
+	Thumbnail []byte
+}
+
+// Process checks that data is a JPEG or PNG from its content, whatever it was sent as,
+// and returns it scaled to MaxDimension along with a thumbnail. A JPEG is turned the
+// way its EXIF orientation says, since that tag is dropped.
+func Process(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+	if contentType != "image/jpeg" && contentType != "image/png" {
+		return Image{}, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+
+	if config.Width*config.Height > MaxPixels {
+		return Image{}, ErrTooManyPixels
+	}
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+
+	pixels := image.NewRGBA(image.Rect(0, 0, decoded.Bounds().Dx(), decoded.Bounds().Dy()))
+	draw.Draw(pixels, pixels.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	if contentType == "image/jpeg" {
+		pixels = orient(pixels, exifOrientation(data))
+	}
+
+	full := fit(pixels, MaxDimension)
+	thumbnail := fit(full, ThumbnailSize)
+
+	processed := Image{ContentType: contentType, Extension: ".png"}
+	encode := func(img image.Image) ([]byte, error) {
+		var buf bytes.Buffer
+		err := png.Encode(&buf, img)
+		return buf.Bytes(), err
+	}
+
+	if contentType == "image/jpeg" {
+		processed.Extension = ".jpg"
+		encode = func(img image.Image) ([]byte, error) {
+			var buf bytes.Buffer
+			err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+			return buf.Bytes(), err
+		}
+	}
+
+	if processed.Data, err = encode(full); err != nil {
+		return Image{}, fmt.Errorf("error encoding image: %w", err)
+	}
+
+	if processed.Thumbnail, err = encode(thumbnail); err != nil {
+		return Image{}, fmt.Errorf("error encoding thumbnail: %w", err)
+	}
+
+	return processed, nil
+}
+
+// fit scales src down so its longest side is at most size, averaging the pixels each
+// one covers. Smaller images are returned as they are.
+func fit(src *image.RGBA, size int) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if width <= size && height <= size {
+		return src
+	}
+
+	dstWidth, dstHeight := size, max(1, height*size/width)
+	if height > width {
+		dstWidth, dstHeight = max(1, width*size/height), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		y0, y1 := y*height/dstHeight, max((y+1)*height/dstHeight, y*height/dstHeight+1)
+
+		for x := 0; x < dstWidth; x++ {
+			x0, x1 := x*width/dstWidth, max((x+1)*width/dstWidth, x*width/dstWidth+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			offset := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[offset+c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	return dst
+}
+
+// orient turns and flips src as EXIF orientation 1 to 8 asks, so it displays upright.
+func orient(src *image.RGBA, orientation int) *image.RGBA {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+
+	// source returns the pixel of src shown at x, y
+	var source func(x, y int) (int, int)
+
+	switch orientation {
+	case 2:
+		source = func(x, y int) (int, int) { return width - 1 - x, y }
+	case 3:
+		source = func(x, y int) (int, int) { return width - 1 - x, height - 1 - y }
+	case 4:
+		source = func(x, y int) (int, int) { return x, height - 1 - y }
+	case 5:
+		source = func(x, y int) (int, int) { return y, x }
+	case 6:
+		source = func(x, y int) (int, int) { return y, height - 1 - x }
+	case 7:
+		source = func(x, y int) (int, int) { return width - 1 - y, height - 1 - x }
+	case 8:
+		source = func(x, y int) (int, int) { return width - 1 - y, x }
+	default:
+		return src
+	}
+
+	dstWidth, dstHeight := width, height
+	if orientation >= 5 {
+		dstWidth, dstHeight = height, width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstWidth, dstHeight))
+
+	for y := 0; y < dstHeight; y++ {
+		for x := 0; x < dstWidth; x++ {
+			sx, sy := source(x, y)
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+
+	return dst
+}
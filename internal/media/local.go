@@ -0,0 +1,153 @@
+package media
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidLink = helpers.NewHTTPError(nil, http.StatusForbidden, "link is invalid or has expired", nil)
+
+// blobKey is what the keys look like, which keeps them inside the directory.
+var blobKey = regexp.MustCompile(`^[a-z0-9_-]+(/[a-zA-Z0-9_-]+)*\.[a-z]+$`)
+
+// LocalStore keeps the blobs in a directory, serving them itself through links signed
+// with its key. It suits development and single server deployments.
+type LocalStore struct {
+	dir     string
+	baseURL string
+	key     []byte
+}
+
+// NewLocalStore stores the blobs in dir. baseURL is where the store is mounted, such as
+// https://api.example.com/blobs, and signingKey signs the links.
+func NewLocalStore(dir, baseURL string, signingKey []byte) *LocalStore {
+	return &LocalStore{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), key: signingKey}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if !blobKey.MatchString(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return fmt.Errorf("error creating blob directory: %w", err)
+	}
+
+	// written aside and renamed, so a reader never sees half a file
+	file, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error creating blob: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("error writing blob: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error writing blob: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), name); err != nil {
+		return fmt.Errorf("error storing blob: %w", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting blob: %w", err)
+	}
+
+	return nil
+}
+
+func (s *LocalStore) URL(key string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.sign(key, expires))
+
+	return s.baseURL + "/" + key + "?" + query.Encode()
+}
+
+func (s *LocalStore) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(key + "\n" + expires))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ServeHTTP serves the blob the path names, once the link checks out. The path is the
+// key, mount the store with http.StripPrefix.
+func (s *LocalStore) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	key := strings.TrimPrefix(request.URL.Path, "/")
+	expires := request.URL.Query().Get("expires")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		helpers.HandleError(responseWriter, ErrInvalidLink)
+		return
+	}
+
+	if !hmac.Equal([]byte(request.URL.Query().Get("signature")), []byte(s.sign(key, expires))) {
+		helpers.HandleError(responseWriter, ErrInvalidLink)
+		return
+	}
+
+	name, err := s.path(key)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+		return
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	// the link may be cached as long as it works, the blobs never change
+	responseWriter.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", expiresAt-time.Now().Unix()))
+	responseWriter.Header().Set("X-Content-Type-Options", "nosniff")
+
+	http.ServeContent(responseWriter, request, path.Base(key), info.ModTime(), file)
+}
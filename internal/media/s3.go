@@ -0,0 +1,216 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultS3Region is the region of the buckets when S3_REGION is not set.
+const DefaultS3Region = "us-east-1"
+
+// S3Config is an S3 compatible bucket, on AWS or elsewhere such as MinIO.
+type S3Config struct {
+	// Endpoint is the address of the service, https://s3.<region>.amazonaws.com for AWS.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle addresses the bucket as <endpoint>/<bucket> rather than
+	// <bucket>.<endpoint>, which most stand-ins for S3 need.
+	PathStyle bool
+}
+
+// S3Store keeps the blobs in a bucket, handing out presigned links to them.
+type S3Store struct {
+	config S3Config
+	client *http.Client
+	// now is when requests are signed, the tests set it
+	now func() time.Time
+}
+
+func NewS3Store(config S3Config, client *http.Client) *S3Store {
+	if config.Region == "" {
+		config.Region = DefaultS3Region
+	}
+
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	return &S3Store{config: config, client: client, now: time.Now}
+}
+
+// objectURL is where the object lives, without a query.
+func (s *S3Store) objectURL(key string) (*url.URL, error) {
+	endpoint, err := url.Parse(s.config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+
+	if s.config.PathStyle {
+		endpoint.Path += "/" + s.config.Bucket + "/" + key
+	} else {
+		endpoint.Host = s.config.Bucket + "." + endpoint.Host
+		endpoint.Path += "/" + key
+	}
+
+	return endpoint, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key, contentType string, data []byte) error {
+	request, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", contentType)
+
+	return s.do(request, http.StatusOK)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	request, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	// deleting an object that does not exist succeeds too
+	return s.do(request, http.StatusNoContent, http.StatusOK)
+}
+
+func (s *S3Store) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	target, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating S3 request: %w", err)
+	}
+
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	now := s.now().UTC()
+
+	request.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := map[string]string{
+		"host":                 target.Host,
+		"x-amz-content-sha256": payloadHash,
+		"x-amz-date":           now.Format(amzDateFormat),
+	}
+
+	signature := s.signature(now, method, target.EscapedPath(), "", headers, signedHeaders, payloadHash)
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgorithm, s.config.AccessKeyID, s.scope(now), strings.Join(signedHeaders, ";"), signature))
+
+	return request, nil
+}
+
+func (s *S3Store) do(request *http.Request, statuses ...int) error {
+	response, err := s.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("error calling S3: %w", err)
+	}
+	defer response.Body.Close()
+
+	for _, status := range statuses {
+		if response.StatusCode == status {
+			return nil
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("S3 %s %s returned %d: %s", request.Method, request.URL.Path, response.StatusCode, body)
+}
+
+// URL presigns a GET of the object, S3 refuses links that work for more than 7 days.
+func (s *S3Store) URL(key string, ttl time.Duration) string {
+	target, err := s.objectURL(key)
+	if err != nil {
+		// the endpoint is checked with the settings
+		return ""
+	}
+
+	now := s.now().UTC()
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", s.config.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(amzDateFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonicalQuery := strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	signature := s.signature(now, http.MethodGet, target.EscapedPath(), canonicalQuery, map[string]string{"host": target.Host}, []string{"host"}, unsignedPayload)
+
+	target.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+
+	return target.String()
+}
+
+const (
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+)
+
+func (s *S3Store) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a request with AWS Signature Version 4, signedHeaders being sorted
+// and lowercase.
+func (s *S3Store) signature(now time.Time, method, path, query string, headers map[string]string, signedHeaders []string, payloadHash string) string {
+	sort.Strings(signedHeaders)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		path,
+		query,
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{signingAlgorithm, now.Format(amzDateFormat), s.scope(now), hex.EncodeToString(sum[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,148 @@
+package media
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// FormField is the multipart field the image is sent in.
+	FormField = "image"
+	// DefaultMaxBytes is the largest upload when UPLOAD_MAX_BYTES is not set.
+	DefaultMaxBytes = 5 << 20
+	// DefaultLinkTTL is how long the links work when BLOB_LINK_TTL is not set.
+	DefaultLinkTTL = time.Hour
+)
+
+var ErrNoImage = helpers.NewHTTPError(nil, http.StatusBadRequest, "the image must be sent as multipart/form-data in the image field", nil)
+
+// Images takes the images users upload, storing each cleaned up by Process along with
+// its thumbnail.
+type Images struct {
+	Store BlobStore
+	// MaxBytes is the largest image accepted, as uploaded.
+	MaxBytes int64
+	// LinkTTL is how long the links to the images work.
+	LinkTTL time.Duration
+}
+
+// Upload reads the image of a multipart request and stores it under prefix, returning
+// its key.
+func (i *Images) Upload(responseWriter http.ResponseWriter, request *http.Request, prefix string) (string, error) {
+	data, err := i.read(responseWriter, request)
+	if err != nil {
+		return "", err
+	}
+
+	processed, err := Process(data)
+	if err != nil {
+		return "", err
+	}
+
+	name := make([]byte, 16)
+	if _, err := rand.Read(name); err != nil {
+		return "", err
+	}
+
+	key := prefix + "/" + hex.EncodeToString(name) + processed.Extension
+
+	if err := i.Store.Put(request.Context(), key, processed.ContentType, processed.Data); err != nil {
+		return "", err
+	}
+
+	if err := i.Store.Put(request.Context(), ThumbnailKey(key), processed.ContentType, processed.Thumbnail); err != nil {
+		_ = i.Store.Delete(request.Context(), key)
+		return "", err
+	}
+
+	return key, nil
+}
+
+// read returns the content of the image field, refusing anything over MaxBytes.
+func (i *Images) read(responseWriter http.ResponseWriter, request *http.Request) ([]byte, error) {
+	tooLarge := helpers.NewHTTPError(nil, http.StatusRequestEntityTooLarge, fmt.Sprintf("image must be at most %s", formatBytes(i.MaxBytes)), nil)
+
+	// room for the boundaries and headers of the parts
+	request.Body = http.MaxBytesReader(responseWriter, request.Body, i.MaxBytes+64<<10)
+
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return nil, ErrNoImage
+	}
+
+	for {
+		part, err := reader.NextPart()
+
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, tooLarge
+		}
+		if err != nil {
+			return nil, ErrNoImage
+		}
+
+		if part.FormName() != FormField {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, i.MaxBytes+1))
+		if errors.As(err, &maxBytesError) || int64(len(data)) > i.MaxBytes {
+			return nil, tooLarge
+		}
+		if err != nil {
+			return nil, ErrNoImage
+		}
+
+		return data, nil
+	}
+}
+
+// Remove deletes an image and its thumbnail.
+func (i *Images) Remove(ctx context.Context, key string) error {
+	return errors.Join(i.Store.Delete(ctx, key), i.Store.Delete(ctx, ThumbnailKey(key)))
+}
+
+// URL links to the image stored under key, none when key is empty.
+func (i *Images) URL(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return i.Store.URL(key, i.LinkTTL)
+}
+
+// ThumbnailURL links to the thumbnail of the image stored under key, none when key is empty.
+func (i *Images) ThumbnailURL(key string) string {
+	if key == "" {
+		return ""
+	}
+
+	return i.Store.URL(ThumbnailKey(key), i.LinkTTL)
+}
+
+// ThumbnailKey is where the thumbnail of the image stored under key is.
+func ThumbnailKey(key string) string {
+	extension := path.Ext(key)
+	return strings.TrimSuffix(key, extension) + "_thumb" + extension
+}
+
+func formatBytes(n int64) string {
+	if n >= 1<<20 && n%(1<<20) == 0 {
+		return fmt.Sprintf("%d MB", n>>20)
+	}
+
+	if n >= 1<<10 && n%(1<<10) == 0 {
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+
+	return fmt.Sprintf("%d bytes", n)
+}
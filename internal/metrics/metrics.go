@@ -0,0 +1,130 @@
+// Package metrics holds the Prometheus collectors of every process and serves them.
+// Each process exposes only what it records, the web server on its own router and
+// the worker and scheduler on METRICS_ADDR.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const namespace = "wishmate"
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeError   = "error"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Time taken to serve HTTP requests, by chi route pattern.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	TasksEnqueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "tasks_enqueued_total",
+		Help:      "Tasks handed to the queue, by type and outcome.",
+	}, []string{"type", "outcome"})
+
+	TasksProcessed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "tasks_processed_total",
+		Help:      "Tasks run by the worker, by type and outcome.",
+	}, []string{"type", "outcome"})
+
+	TaskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "queue",
+		Name:      "task_duration_seconds",
+		Help:      "Time taken by the worker to run a task, by type.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	SchedulerRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "run_duration_seconds",
+		Help:      "Time taken by a scheduler job, by job and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"job", "outcome"})
+
+	DueItems = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "scheduler",
+		Name:      "due_items_total",
+		Help:      "Due reminders and birthdays found by the scheduler, by kind.",
+	}, []string{"kind"})
+
+	EmailsSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "email",
+		Name:      "sent_total",
+		Help:      "Emails handed to the mail transport, by transport and outcome.",
+	}, []string{"transport", "outcome"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequestDuration,
+		TasksEnqueued,
+		TasksProcessed,
+		TaskDuration,
+		SchedulerRunDuration,
+		DueItems,
+		EmailsSent,
+	)
+}
+
+// Outcome is the outcome label for an operation that returned err.
+func Outcome(err error) string {
+	if err != nil {
+		return OutcomeError
+	}
+
+	return OutcomeSuccess
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Serve exposes the metrics on addr until the context is cancelled. It is meant for
+// the processes that have no HTTP server of their own.
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("serving metrics", "addr", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOutcome(t *testing.T) {
+	if got := metrics.Outcome(nil); got != metrics.OutcomeSuccess {
+		t.Errorf("got %q, want %q", got, metrics.OutcomeSuccess)
+	}
+
+	if got := metrics.Outcome(errors.New("boom")); got != metrics.OutcomeError {
+		t.Errorf("got %q, want %q", got, metrics.OutcomeError)
+	}
+}
+
+func TestPoolCollector(t *testing.T) {
+	// the pool only dials when a connection is acquired
+	pool, err := pgxpool.New(context.Background(), "postgres://wishmate@127.0.0.1:1/wishmate?pool_max_conns=7")
+	if err != nil {
+		t.Fatalf("error creating pool: %v", err)
+	}
+	defer pool.Close()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(metrics.NewPoolCollector(pool))
+
+	want := `
+# HELP wishmate_db_pool_max_conns Maximum size of the pool.
+# TYPE wishmate_db_pool_max_conns gauge
+wishmate_db_pool_max_conns 7
+# HELP wishmate_db_pool_acquired_conns Connections currently in use.
+# TYPE wishmate_db_pool_acquired_conns gauge
+wishmate_db_pool_acquired_conns 0
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want), "wishmate_db_pool_max_conns", "wishmate_db_pool_acquired_conns")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if got := testutil.CollectAndCount(metrics.NewPoolCollector(pool)); got != 12 {
+		t.Errorf("got %d pool metrics, want 12", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	metrics.TasksEnqueued.WithLabelValues("mail:deliver", metrics.OutcomeSuccess).Inc()
+
+	response := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("response code = %d, want %d", response.Code, http.StatusOK)
+	}
+
+	for _, want := range []string{
+		`wishmate_queue_tasks_enqueued_total{outcome="success",type="mail:deliver"}`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(response.Body.String(), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type PoolStater interface {
+	Stat() *pgxpool.Stat
+}
+
+// PoolCollector reports the statistics of a pgx pool each time it is scraped.
+type PoolCollector struct {
+	pool PoolStater
+
+	maxConns             *prometheus.Desc
+	totalConns           *prometheus.Desc
+	idleConns            *prometheus.Desc
+	acquiredConns        *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+	newConnsCount        *prometheus.Desc
+	maxLifetimeDestroys  *prometheus.Desc
+	maxIdleDestroys      *prometheus.Desc
+}
+
+func NewPoolCollector(pool PoolStater) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", name), help, nil, nil)
+	}
+
+	return &PoolCollector{
+		pool:                 pool,
+		maxConns:             desc("max_conns", "Maximum size of the pool."),
+		totalConns:           desc("total_conns", "Connections currently open."),
+		idleConns:            desc("idle_conns", "Open connections waiting to be used."),
+		acquiredConns:        desc("acquired_conns", "Connections currently in use."),
+		constructingConns:    desc("constructing_conns", "Connections being opened."),
+		acquireCount:         desc("acquires_total", "Connections acquired from the pool."),
+		acquireDuration:      desc("acquire_duration_seconds_total", "Time spent acquiring connections."),
+		emptyAcquireCount:    desc("empty_acquires_total", "Acquires that had to wait for a connection."),
+		canceledAcquireCount: desc("canceled_acquires_total", "Acquires cancelled by their context."),
+		newConnsCount:        desc("new_conns_total", "Connections opened."),
+		maxLifetimeDestroys:  desc("max_lifetime_destroys_total", "Connections closed for reaching DB_MAX_CONN_LIFETIME."),
+		maxIdleDestroys:      desc("max_idle_destroys_total", "Connections closed for reaching DB_MAX_CONN_IDLE_TIME."),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.pool.Stat()
+
+	gauge := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value)
+	}
+	counter := func(desc *prometheus.Desc, value float64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value)
+	}
+
+	gauge(c.maxConns, float64(stat.MaxConns()))
+	gauge(c.totalConns, float64(stat.TotalConns()))
+	gauge(c.idleConns, float64(stat.IdleConns()))
+	gauge(c.acquiredConns, float64(stat.AcquiredConns()))
+	gauge(c.constructingConns, float64(stat.ConstructingConns()))
+	counter(c.acquireCount, float64(stat.AcquireCount()))
+	counter(c.acquireDuration, stat.AcquireDuration().Seconds())
+	counter(c.emptyAcquireCount, float64(stat.EmptyAcquireCount()))
+	counter(c.canceledAcquireCount, float64(stat.CanceledAcquireCount()))
+	counter(c.newConnsCount, float64(stat.NewConnsCount()))
+	counter(c.maxLifetimeDestroys, float64(stat.MaxLifetimeDestroyCount()))
+	counter(c.maxIdleDestroys, float64(stat.MaxIdleDestroyCount()))
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"net/http"
+	"strings"
+)
+
+// AdminMiddleware guards operator endpoints with the ADMIN_API_KEY bearer token.
+// The endpoints stay closed when no key is configured.
+func AdminMiddleware(adminKey string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			if adminKey == "" {
+				helpers.HandleError(responseWriter, helpers.ErrForbidden)
+				return
+			}
+
+			token, found := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if !found || subtle.ConstantTimeCompare([]byte(token), []byte(adminKey)) != 1 {
+				helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(responseWriter, request)
+		})
+	}
+}
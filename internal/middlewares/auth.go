@@ -2,42 +2,116 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
 	"net/http"
 	"strings"
 )
 
-func AuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
-
-		authHeader := request.Header.Get("Authorization")
-		if authHeader == "" {
-			helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
-			return
-		}
-
-		tokenString := strings.Split(authHeader, " ")[1]
-		if len(tokenString) != 2 {
-			helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
-			return
-		}
-
-		data, err := helpers.DecodeToken(tokenString)
-		if err != nil {
-			helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
-			return
-		}
-
-		if !data["verified"].(bool) {
-			helpers.HandleError(responseWriter, helpers.ErrForbidden)
-			return
-		}
-
-		ctx := context.WithValue(request.Context(), "email", data["email"])
-		ctx = context.WithValue(ctx, "user_id", data["user_id"])
-		ctx = context.WithValue(ctx, "verified", data["verified"])
-
-		newRequest := request.WithContext(ctx)
-		next.ServeHTTP(responseWriter, newRequest)
-	})
+// TokenAuthenticator looks up the principal of a personal access token. It fails with
+// helpers.ErrNotFound for a token that is unknown, revoked or expired.
+type TokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (helpers.Principal, error)
+}
+
+// SessionChecker tells whether the session of an access token is still active,
+// recording that it was seen. It fails with helpers.ErrNotFound for a session that is
+// revoked or expired, or not the user's.
+type SessionChecker interface {
+	TouchSession(ctx context.Context, sessionID, userID int) error
+}
+
+// AuthMiddleware authenticates the bearer of an access token whose session is active, or
+// of a personal access token when personalTokens is not nil. Each route behind it that
+// takes personal access tokens must then require a scope with RequireScope.
+func AuthMiddleware(keys *helpers.Keys, sessions SessionChecker, personalTokens TokenAuthenticator) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+
+			authHeader := request.Header.Get("Authorization")
+			if authHeader == "" {
+				helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+				return
+			}
+
+			scheme, tokenString, found := strings.Cut(authHeader, " ")
+			if !found || !strings.EqualFold(scheme, "Bearer") || tokenString == "" {
+				helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+				return
+			}
+
+			var principal helpers.Principal
+
+			if strings.HasPrefix(tokenString, helpers.PersonalTokenPrefix) {
+				if personalTokens == nil {
+					helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+					return
+				}
+
+				var err error
+				principal, err = personalTokens.Authenticate(request.Context(), tokenString)
+				if errors.Is(err, helpers.ErrNotFound) {
+					helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+					return
+				}
+				if err != nil {
+					helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+					return
+				}
+			} else {
+				data, err := helpers.DecodeToken(keys, tokenString)
+				if err != nil {
+					helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+					return
+				}
+
+				principal = helpers.Principal{
+					UserID:    data["user_id"].(int),
+					Email:     data["email"].(string),
+					Verified:  data["verified"].(bool),
+					SessionID: data["session_id"].(int),
+				}
+
+				err = sessions.TouchSession(request.Context(), principal.SessionID, principal.UserID)
+				if errors.Is(err, helpers.ErrNotFound) {
+					helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+					return
+				}
+				if err != nil {
+					helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+					return
+				}
+			}
+
+			if !principal.Verified {
+				helpers.HandleError(responseWriter, helpers.ErrForbidden)
+				return
+			}
+
+			newRequest := request.WithContext(helpers.WithPrincipal(request.Context(), principal))
+			next.ServeHTTP(responseWriter, newRequest)
+		})
+	}
+}
+
+// RequireScope lets a personal access token use the route only when it has the scope.
+// Signed in users have every scope.
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			principal, ok := helpers.PrincipalFrom(request.Context())
+			if !ok {
+				helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				helpers.HandleError(responseWriter, helpers.NewHTTPError(nil, http.StatusForbidden, fmt.Sprintf("the token lacks the %s scope", scope), nil))
+				return
+			}
+
+			next.ServeHTTP(responseWriter, request)
+		})
+	}
 }
@@ -0,0 +1,169 @@
+package middlewares_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	_, private, _ := ed25519.GenerateKey(rand.Reader)
+
+	newKeys := func(audience string) *helpers.Keys {
+		keys, err := helpers.NewKeys("https://api.wishmate.app", audience, helpers.SigningKey{ID: "key", Algorithm: helpers.AlgorithmEdDSA, Key: private})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+	keys := newKeys("wishmate")
+
+	personalTokens := &StubTokenAuthenticator{principals: map[string]helpers.Principal{
+		"wmp_reader":     {UserID: 7, Email: "ade@gmail.com", Verified: true, Scopes: []string{helpers.ScopeReadWishlists}},
+		"wmp_unverified": {UserID: 8, Email: "oye@gmail.com", Scopes: []string{helpers.ScopeReadWishlists}},
+	}}
+
+	sessions := &StubSessionChecker{active: map[int]int{7: 42}}
+
+	var userID interface{}
+	handler := middlewares.AuthMiddleware(keys, sessions, personalTokens)(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		if principal, ok := helpers.PrincipalFrom(request.Context()); ok {
+			userID = principal.UserID
+		}
+	}))
+
+	serve := func(token string) int {
+		userID = nil
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer "+token)
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	t.Run("lets a verified user through", func(t *testing.T) {
+		token, _ := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 7)
+
+		if code := serve(token); code != http.StatusOK || userID != 42 {
+			t.Errorf("got %d for user %v, want 200 for 42", code, userID)
+		}
+	})
+
+	t.Run("refuses a token of a revoked session", func(t *testing.T) {
+		token, _ := helpers.GenerateToken(keys, 42, "ade@gmail.com", true, 8)
+
+		if code := serve(token); code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", code)
+		}
+	})
+
+	t.Run("refuses a token for another audience", func(t *testing.T) {
+		token, _ := helpers.GenerateToken(newKeys("another-service"), 42, "ade@gmail.com", true, 7)
+
+		if code := serve(token); code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", code)
+		}
+	})
+
+	t.Run("refuses an unverified user", func(t *testing.T) {
+		token, _ := helpers.GenerateToken(keys, 42, "ade@gmail.com", false, 7)
+
+		if code := serve(token); code != http.StatusForbidden {
+			t.Errorf("got %d, want 403", code)
+		}
+
+		if code := serve("wmp_unverified"); code != http.StatusForbidden {
+			t.Errorf("got %d, want 403", code)
+		}
+	})
+
+	t.Run("lets the bearer of a personal access token through", func(t *testing.T) {
+		if code := serve("wmp_reader"); code != http.StatusOK || userID != 7 {
+			t.Errorf("got %d for user %v, want 200 for 7", code, userID)
+		}
+	})
+
+	t.Run("refuses an unknown personal access token", func(t *testing.T) {
+		if code := serve("wmp_revoked"); code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", code)
+		}
+	})
+
+	t.Run("refuses personal access tokens where they are not taken", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer wmp_reader")
+		response := httptest.NewRecorder()
+
+		middlewares.AuthMiddleware(keys, sessions, nil)(http.NotFoundHandler()).ServeHTTP(response, request)
+
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("got %d, want 401", response.Code)
+		}
+	})
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := middlewares.RequireScope(helpers.ScopeWriteWishlists)(http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {}))
+
+	serve := func(principal helpers.Principal) int {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request = request.WithContext(helpers.WithPrincipal(request.Context(), principal))
+		response := httptest.NewRecorder()
+
+		handler.ServeHTTP(response, request)
+		return response.Code
+	}
+
+	t.Run("lets a signed in user through", func(t *testing.T) {
+		if code := serve(helpers.Principal{UserID: 1, Verified: true}); code != http.StatusOK {
+			t.Errorf("got %d, want 200", code)
+		}
+	})
+
+	t.Run("lets a token with the scope through", func(t *testing.T) {
+		if code := serve(helpers.Principal{UserID: 1, Verified: true, Scopes: []string{helpers.ScopeWriteWishlists}}); code != http.StatusOK {
+			t.Errorf("got %d, want 200", code)
+		}
+	})
+
+	t.Run("refuses a token without the scope", func(t *testing.T) {
+		if code := serve(helpers.Principal{UserID: 1, Verified: true, Scopes: []string{helpers.ScopeReadWishlists}}); code != http.StatusForbidden {
+			t.Errorf("got %d, want 403", code)
+		}
+
+		if code := serve(helpers.Principal{UserID: 1, Verified: true, Scopes: []string{}}); code != http.StatusForbidden {
+			t.Errorf("got %d, want 403", code)
+		}
+	})
+}
+
+type StubTokenAuthenticator struct {
+	principals map[string]helpers.Principal
+}
+
+func (s *StubTokenAuthenticator) Authenticate(ctx context.Context, token string) (helpers.Principal, error) {
+	principal, ok := s.principals[token]
+	if !ok {
+		return helpers.Principal{}, helpers.ErrNotFound
+	}
+	return principal, nil
+}
+
+// StubSessionChecker knows the user of each active session.
+type StubSessionChecker struct {
+	active map[int]int
+}
+
+func (s *StubSessionChecker) TouchSession(ctx context.Context, sessionID, userID int) error {
+	if s.active[sessionID] != userID {
+		return helpers.ErrNotFound
+	}
+	return nil
+}
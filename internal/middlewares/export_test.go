@@ -0,0 +1,9 @@
+package middlewares
+
+// Buckets is how many keys the limiter holds counters for.
+func (l *MemoryLimiter) Buckets() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.requests)
+}
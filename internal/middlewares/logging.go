@@ -0,0 +1,73 @@
+package middlewares
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// a request ID from the client is only reused when it cannot be used to inject into the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID puts the caller's X-Request-ID, or a new one, in the request context and echoes it back.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = logging.NewRequestID()
+		}
+
+		responseWriter.Header().Set(RequestIDHeader, requestID)
+
+		ctx := logging.WithRequestID(request.Context(), requestID)
+		next.ServeHTTP(responseWriter, request.WithContext(ctx))
+	})
+}
+
+// AccessLog logs every request once it has been served. It runs after RequestID so
+// the entry carries the request ID.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(responseWriter, request.ProtoMajor)
+
+		next.ServeHTTP(wrapped, request)
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// the query string is left out since it may carry tokens
+		slog.Log(request.Context(), level, "request served",
+			slog.String("method", request.Method),
+			slog.String("path", request.URL.Path),
+			slog.String("route", routePattern(request)),
+			slog.Int("status", status),
+			slog.Int("bytes", wrapped.BytesWritten()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", request.RemoteAddr),
+			slog.String("user_agent", request.UserAgent()),
+		)
+	})
+}
+
+func routePattern(request *http.Request) string {
+	routeContext := chi.RouteContext(request.Context())
+	if routeContext == nil {
+		return ""
+	}
+
+	return routeContext.RoutePattern()
+}
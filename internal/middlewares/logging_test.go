@@ -0,0 +1,117 @@
+package middlewares_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newRouter(seen *string) *chi.Mux {
+	router := chi.NewRouter()
+	router.Use(middlewares.RequestID, middlewares.AccessLog)
+
+	router.Get("/wishlists/{id}", func(responseWriter http.ResponseWriter, request *http.Request) {
+		*seen = logging.RequestID(request.Context())
+		responseWriter.WriteHeader(http.StatusTeapot)
+		responseWriter.Write([]byte("short and stout"))
+	})
+
+	return router
+}
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelInfo))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+func TestRequestID(t *testing.T) {
+	t.Run("generates a request id", func(t *testing.T) {
+		captureLogs(t)
+
+		var seen string
+		response := httptest.NewRecorder()
+		newRouter(&seen).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/wishlists/1", nil))
+
+		got := response.Header().Get(middlewares.RequestIDHeader)
+		if got == "" || got != seen {
+			t.Errorf("response request id = %q, handler saw %q, want the same non empty id", got, seen)
+		}
+	})
+
+	t.Run("reuses the caller's request id", func(t *testing.T) {
+		captureLogs(t)
+
+		request := httptest.NewRequest(http.MethodGet, "/wishlists/1", nil)
+		request.Header.Set(middlewares.RequestIDHeader, "frontend-42")
+
+		var seen string
+		response := httptest.NewRecorder()
+		newRouter(&seen).ServeHTTP(response, request)
+
+		if seen != "frontend-42" {
+			t.Errorf("request id = %q, want %q", seen, "frontend-42")
+		}
+	})
+
+	t.Run("replaces an invalid request id", func(t *testing.T) {
+		captureLogs(t)
+
+		request := httptest.NewRequest(http.MethodGet, "/wishlists/1", nil)
+		request.Header.Set(middlewares.RequestIDHeader, "bad\"id\nwith newline")
+
+		var seen string
+		response := httptest.NewRecorder()
+		newRouter(&seen).ServeHTTP(response, request)
+
+		if seen == "" || seen == request.Header.Get(middlewares.RequestIDHeader) {
+			t.Errorf("request id = %q, want a generated one", seen)
+		}
+	})
+}
+
+func TestAccessLog(t *testing.T) {
+	buf := captureLogs(t)
+
+	request := httptest.NewRequest(http.MethodGet, "/wishlists/7?token=secret", nil)
+	request.Header.Set(middlewares.RequestIDHeader, "abc")
+
+	var seen string
+	newRouter(&seen).ServeHTTP(httptest.NewRecorder(), request)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log entry %q: %v", buf.String(), err)
+	}
+
+	want := map[string]interface{}{
+		"msg":        "request served",
+		"method":     "GET",
+		"path":       "/wishlists/7",
+		"route":      "/wishlists/{id}",
+		"status":     float64(http.StatusTeapot),
+		"bytes":      float64(len("short and stout")),
+		"request_id": "abc",
+	}
+
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("%s = %v, want %v", key, entry[key], value)
+		}
+	}
+
+	if bytes.Contains(buf.Bytes(), []byte("secret")) {
+		t.Error("the query string should not be logged")
+	}
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Metrics records the duration of every request under its chi route pattern, so
+// /wishlists/1 and /wishlists/2 share a series. Requests that match no route share
+// the "unmatched" one.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		start := time.Now()
+		wrapped := middleware.NewWrapResponseWriter(responseWriter, request.ProtoMajor)
+
+		next.ServeHTTP(wrapped, request)
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := routePattern(request)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.HTTPRequestDuration.
+			WithLabelValues(request.Method, route, strconv.Itoa(status)).
+			Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,69 @@
+package middlewares_test
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// requestCount returns how many requests were observed under the route and status.
+func requestCount(t *testing.T, route, status string) uint64 {
+	t.Helper()
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("error gathering metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != "wishmate_http_request_duration_seconds" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			if labels["route"] == route && labels["status"] == status {
+				return metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	router := chi.NewRouter()
+	router.Use(middlewares.Metrics)
+
+	wishlistRouter := chi.NewRouter()
+	wishlistRouter.Get("/{id}", func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusGone)
+	})
+	router.Mount("/wishlists", wishlistRouter)
+
+	routeBefore := requestCount(t, "/wishlists/{id}", "410")
+	unmatchedBefore := requestCount(t, "unmatched", "404")
+
+	for _, path := range []string{"/wishlists/1", "/wishlists/2", "/nowhere"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	t.Run("groups requests by route pattern", func(t *testing.T) {
+		if got := requestCount(t, "/wishlists/{id}", "410") - routeBefore; got != 2 {
+			t.Errorf("got %d requests, want 2", got)
+		}
+	})
+
+	t.Run("groups unmatched requests", func(t *testing.T) {
+		if got := requestCount(t, "unmatched", "404") - unmatchedBefore; got != 1 {
+			t.Errorf("got %d requests, want 1", got)
+		}
+	})
+}
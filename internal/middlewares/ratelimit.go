@@ -0,0 +1,256 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/go-chi/chi/v5"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitStoreRedis  = "redis"
+	RateLimitStoreMemory = "memory"
+)
+
+// Policy allows Limit requests per key in any sliding Window. Routes sharing a policy
+// name share their counters, a zero Limit turns the policy off.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// Reset is the time left until the oldest request counted leaves the window.
+	Reset time.Duration
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, policy Policy, key string) (RateLimitResult, error)
+}
+
+// KeyFunc picks what a policy counts requests by.
+type KeyFunc func(request *http.Request) string
+
+// RateLimit rejects the requests over the policy with a 429 and sets the RateLimit-*
+// headers on every response. Requests go through when the limiter fails, a Redis
+// outage should not lock everyone out.
+func RateLimit(limiter Limiter, policy Policy, key KeyFunc) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil || policy.Limit <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+			result, err := limiter.Allow(request.Context(), policy, key(request))
+			if err != nil {
+				slog.ErrorContext(request.Context(), "error checking rate limit", "policy", policy.Name, "error", err)
+				next.ServeHTTP(responseWriter, request)
+				return
+			}
+
+			reset := strconv.Itoa(int(math.Ceil(result.Reset.Seconds())))
+
+			header := responseWriter.Header()
+			header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds())))
+			header.Set("RateLimit-Limit", strconv.Itoa(policy.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", reset)
+
+			if !result.Allowed {
+				header.Set("Retry-After", reset)
+				helpers.HandleError(responseWriter, helpers.ErrTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(responseWriter, request)
+		})
+	}
+}
+
+// KeyByIP counts requests by client address. Behind a proxy, the address comes from
+// the forwarded headers only when the router trusts them (see TRUST_PROXY).
+func KeyByIP(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return "ip:" + request.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// KeyByUser counts requests by the authenticated user, or else the user in the path.
+func KeyByUser(request *http.Request) string {
+	if principal, ok := helpers.PrincipalFrom(request.Context()); ok {
+		return fmt.Sprintf("user:%d", principal.UserID)
+	}
+
+	if userID := chi.URLParam(request, "user_id"); userID != "" {
+		return "user:" + userID
+	}
+
+	return KeyByIP(request)
+}
+
+// KeyByEmail counts requests by the email in the JSON body, so an account cannot be
+// targeted from many addresses. The body is left for the handler to read.
+func KeyByEmail(request *http.Request) string {
+	body, err := io.ReadAll(io.LimitReader(request.Body, 1<<20))
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return KeyByIP(request)
+	}
+
+	var payload struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Email == "" {
+		return KeyByIP(request)
+	}
+
+	return "email:" + strings.ToLower(strings.TrimSpace(payload.Email))
+}
+
+// slidingWindow keeps the timestamps of the requests in the window, in milliseconds,
+// adding the new one only when there is room. It returns whether it was added, the
+// count and the oldest timestamp.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+
+local count = redis.call("ZCARD", key)
+local allowed = 0
+if count < limit then
+	redis.call("ZADD", key, now, ARGV[4])
+	count = count + 1
+	allowed = 1
+end
+redis.call("PEXPIRE", key, window)
+
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+return {allowed, count, tonumber(oldest[2] or now)}
+`)
+
+// RedisLimiter shares the counters between every instance of the web server.
+type RedisLimiter struct {
+	Client redis.Scripter
+	// Now is replaced by the tests.
+	Now func() time.Time
+}
+
+func NewRedisLimiter(client redis.Scripter) *RedisLimiter {
+	return &RedisLimiter{Client: client, Now: time.Now}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, policy Policy, key string) (RateLimitResult, error) {
+	now := l.Now()
+	window := policy.Window.Milliseconds()
+
+	values, err := slidingWindow.Run(ctx, l.Client, []string{"ratelimit:" + policy.Name + ":" + key},
+		// the member only has to be unique, two requests may share a millisecond
+		now.UnixMilli(), window, policy.Limit, strconv.FormatInt(now.UnixNano(), 36)+":"+strconv.FormatUint(rand.Uint64(), 36),
+	).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, fmt.Errorf("error running rate limit script: %w", err)
+	}
+
+	return RateLimitResult{
+		Allowed:   values[0] == 1,
+		Remaining: policy.Limit - int(values[1]),
+		Reset:     time.Duration(values[2]+window-now.UnixMilli()) * time.Millisecond,
+	}, nil
+}
+
+// memorySweepInterval is how often MemoryLimiter drops the buckets of the keys that
+// stopped coming back.
+const memorySweepInterval = time.Minute
+
+// MemoryLimiter keeps the counters in the process, for development without Redis.
+// Each instance counts on its own.
+type MemoryLimiter struct {
+	// Now is replaced by the tests.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	requests map[string]memoryBucket
+	swept    time.Time
+}
+
+type memoryBucket struct {
+	requests []time.Time
+	// expires is when the last request leaves the window, the bucket is empty from then
+	expires time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{Now: time.Now, requests: map[string]memoryBucket{}}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, policy Policy, key string) (RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.Now()
+	bucket := policy.Name + ":" + key
+
+	l.sweep(now)
+
+	// drop the requests that left the window
+	requests := l.requests[bucket].requests
+	for len(requests) > 0 && !requests[0].After(now.Add(-policy.Window)) {
+		requests = requests[1:]
+	}
+
+	allowed := len(requests) < policy.Limit
+	if allowed {
+		requests = append(requests, now)
+	}
+
+	if len(requests) == 0 {
+		delete(l.requests, bucket)
+	} else {
+		l.requests[bucket] = memoryBucket{requests: requests, expires: requests[len(requests)-1].Add(policy.Window)}
+	}
+
+	result := RateLimitResult{Allowed: allowed, Remaining: policy.Limit - len(requests)}
+	if len(requests) > 0 {
+		result.Reset = requests[0].Add(policy.Window).Sub(now)
+	}
+
+	return result, nil
+}
+
+// sweep drops the expired buckets once every memorySweepInterval, otherwise every key
+// seen once, such as each email tried, would be kept for good.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < memorySweepInterval {
+		return
+	}
+
+	for bucket, requests := range l.requests {
+		if !requests.expires.After(now) {
+			delete(l.requests, bucket)
+		}
+	}
+
+	l.swept = now
+}
@@ -0,0 +1,232 @@
+package middlewares_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiters(t *testing.T) {
+	policy := middlewares.Policy{Name: "login", Limit: 2, Window: time.Minute}
+
+	limiters := map[string]func(t *testing.T, c *clock) middlewares.Limiter{
+		"memory": func(t *testing.T, c *clock) middlewares.Limiter {
+			limiter := middlewares.NewMemoryLimiter()
+			limiter.Now = c.Now
+			return limiter
+		},
+		"redis": func(t *testing.T, c *clock) middlewares.Limiter {
+			server := miniredis.RunT(t)
+			client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+			t.Cleanup(func() { client.Close() })
+
+			limiter := middlewares.NewRedisLimiter(client)
+			limiter.Now = c.Now
+			return limiter
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			c := &clock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+			limiter := newLimiter(t, c)
+			ctx := context.Background()
+
+			allow := func(key string) middlewares.RateLimitResult {
+				t.Helper()
+
+				result, err := limiter.Allow(ctx, policy, key)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				return result
+			}
+
+			if result := allow("email:a@example.com"); !result.Allowed || result.Remaining != 1 {
+				t.Errorf("first request = %+v, want allowed with 1 remaining", result)
+			}
+
+			c.now = c.now.Add(20 * time.Second)
+			if result := allow("email:a@example.com"); !result.Allowed || result.Remaining != 0 {
+				t.Errorf("second request = %+v, want allowed with 0 remaining", result)
+			}
+
+			c.now = c.now.Add(20 * time.Second)
+			result := allow("email:a@example.com")
+			if result.Allowed {
+				t.Errorf("third request = %+v, want refused", result)
+			}
+			if result.Reset != 20*time.Second {
+				t.Errorf("reset = %s, want 20s, when the first request leaves the window", result.Reset)
+			}
+
+			if result := allow("email:b@example.com"); !result.Allowed {
+				t.Errorf("another key = %+v, want allowed", result)
+			}
+
+			// the first request left the window, the second one is still in it
+			c.now = c.now.Add(21 * time.Second)
+			if result := allow("email:a@example.com"); !result.Allowed || result.Remaining != 0 {
+				t.Errorf("request after the window slid = %+v, want allowed with 0 remaining", result)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	c := &clock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	limiter := middlewares.NewMemoryLimiter()
+	limiter.Now = c.Now
+
+	login := middlewares.Policy{Name: "login", Limit: 10, Window: 15 * time.Minute}
+	otp := middlewares.Policy{Name: "otp", Limit: 5, Window: time.Hour}
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		_, _ = limiter.Allow(context.Background(), login, "email:"+email)
+	}
+	_, _ = limiter.Allow(context.Background(), otp, "email:a@example.com")
+
+	if buckets := limiter.Buckets(); buckets != 4 {
+		t.Fatalf("buckets = %d, want 4", buckets)
+	}
+
+	// the login requests left their window, the keys never come back
+	c.now = c.now.Add(16 * time.Minute)
+	_, _ = limiter.Allow(context.Background(), login, "email:d@example.com")
+
+	if buckets := limiter.Buckets(); buckets != 2 {
+		t.Errorf("buckets after the login window = %d, want 2, the otp one and the new one", buckets)
+	}
+
+	// the next sweep waits a while
+	c.now = c.now.Add(30 * time.Second)
+	_, _ = limiter.Allow(context.Background(), login, "email:e@example.com")
+
+	if buckets := limiter.Buckets(); buckets != 3 {
+		t.Errorf("buckets before the next sweep = %d, want 3", buckets)
+	}
+
+	c.now = c.now.Add(time.Hour)
+	_, _ = limiter.Allow(context.Background(), login, "email:f@example.com")
+
+	if buckets := limiter.Buckets(); buckets != 1 {
+		t.Errorf("buckets after every window = %d, want 1", buckets)
+	}
+}
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, policy middlewares.Policy, key string) (middlewares.RateLimitResult, error) {
+	return middlewares.RateLimitResult{}, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	policy := middlewares.Policy{Name: "otp", Limit: 1, Window: time.Hour}
+
+	var bodies []string
+	next := http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		bodies = append(bodies, string(body))
+	})
+
+	send := func(handler http.Handler, body string) *httptest.ResponseRecorder {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/auth/request-code", strings.NewReader(body)))
+		return response
+	}
+
+	t.Run("refuses the requests over the limit", func(t *testing.T) {
+		handler := middlewares.RateLimit(middlewares.NewMemoryLimiter(), policy, middlewares.KeyByEmail)(next)
+
+		response := send(handler, `{"email": "adedunmola@gmail.com"}`)
+		if response.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", response.Code, http.StatusOK)
+		}
+		if got := response.Header().Get("RateLimit-Remaining"); got != "0" {
+			t.Errorf("RateLimit-Remaining = %q, want 0", got)
+		}
+		if got := response.Header().Get("RateLimit-Policy"); got != "1;w=3600" {
+			t.Errorf("RateLimit-Policy = %q, want 1;w=3600", got)
+		}
+
+		// the same address, written differently
+		response = send(handler, `{"email": " Adedunmola@Gmail.com"}`)
+		if response.Code != http.StatusTooManyRequests {
+			t.Errorf("status = %d, want %d", response.Code, http.StatusTooManyRequests)
+		}
+		if got := response.Header().Get("Retry-After"); got != "3600" {
+			t.Errorf("Retry-After = %q, want 3600", got)
+		}
+		if !strings.Contains(response.Body.String(), "too many requests") {
+			t.Errorf("body = %s, want the 429 error", response.Body.String())
+		}
+
+		if response := send(handler, `{"email": "someone@else.com"}`); response.Code != http.StatusOK {
+			t.Errorf("another email status = %d, want %d", response.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("leaves the body for the handler", func(t *testing.T) {
+		bodies = nil
+		handler := middlewares.RateLimit(middlewares.NewMemoryLimiter(), policy, middlewares.KeyByEmail)(next)
+
+		send(handler, `{"email": "adedunmola@gmail.com"}`)
+
+		if len(bodies) != 1 || bodies[0] != `{"email": "adedunmola@gmail.com"}` {
+			t.Errorf("handler read %q, want the request body", bodies)
+		}
+	})
+
+	t.Run("refuses an address trying many emails", func(t *testing.T) {
+		limiter := middlewares.NewMemoryLimiter()
+		byIP := middlewares.RateLimit(limiter, middlewares.Policy{Name: "login_ip", Limit: 2, Window: time.Hour}, middlewares.KeyByIP)
+		byEmail := middlewares.RateLimit(limiter, middlewares.Policy{Name: "login", Limit: 1, Window: time.Hour}, middlewares.KeyByEmail)
+		handler := byIP(byEmail(next))
+
+		for _, email := range []string{"a@example.com", "b@example.com"} {
+			if response := send(handler, `{"email": "`+email+`"}`); response.Code != http.StatusOK {
+				t.Errorf("%s status = %d, want %d", email, response.Code, http.StatusOK)
+			}
+		}
+
+		if response := send(handler, `{"email": "c@example.com"}`); response.Code != http.StatusTooManyRequests {
+			t.Errorf("third email status = %d, want %d", response.Code, http.StatusTooManyRequests)
+		}
+	})
+
+	t.Run("lets requests through when the limiter fails", func(t *testing.T) {
+		handler := middlewares.RateLimit(failingLimiter{}, policy, middlewares.KeyByIP)(next)
+
+		for i := 0; i < 3; i++ {
+			if response := send(handler, ""); response.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", response.Code, http.StatusOK)
+			}
+		}
+	})
+
+	t.Run("does nothing for a policy that is off", func(t *testing.T) {
+		handler := middlewares.RateLimit(middlewares.NewMemoryLimiter(), middlewares.Policy{Name: "otp"}, middlewares.KeyByIP)(next)
+
+		response := send(handler, "")
+		if got := response.Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("RateLimit-Limit = %q, want none", got)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"strconv"
+)
+
+// Tracing runs each request in a server span, continuing the trace of a traceparent
+// header when the caller sent one. The span is named after the chi route pattern once
+// the router has matched it, like the metrics.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(responseWriter http.ResponseWriter, request *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		ctx, span := tracing.Tracer().Start(ctx, request.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.URLPath(request.URL.Path),
+				semconv.UserAgentOriginal(request.UserAgent()),
+			),
+		)
+		defer span.End()
+
+		wrapped := middleware.NewWrapResponseWriter(responseWriter, request.ProtoMajor)
+		next.ServeHTTP(wrapped, request.WithContext(ctx))
+
+		status := wrapped.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := routePattern(request)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		span.SetName(request.Method + " " + route)
+		span.SetAttributes(
+			semconv.HTTPRoute(route),
+			semconv.HTTPResponseStatusCode(status),
+			attribute.String("request_id", logging.RequestID(ctx)),
+		)
+
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, strconv.Itoa(status))
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package middlewares_test
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	router := chi.NewRouter()
+	router.Use(middlewares.Tracing)
+	router.Get("/wishlists/{id}", func(responseWriter http.ResponseWriter, request *http.Request) {
+		responseWriter.WriteHeader(http.StatusInternalServerError)
+	})
+
+	serve := func(header http.Header) sdktrace.ReadOnlySpan {
+		request := httptest.NewRequest(http.MethodGet, "/wishlists/1", nil)
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		router.ServeHTTP(httptest.NewRecorder(), request)
+
+		spans := recorder.Ended()
+		return spans[len(spans)-1]
+	}
+
+	t.Run("names the span after the route pattern", func(t *testing.T) {
+		span := serve(nil)
+
+		if span.Name() != "GET /wishlists/{id}" {
+			t.Errorf("name = %q, want %q", span.Name(), "GET /wishlists/{id}")
+		}
+		if span.Status().Description != "500" {
+			t.Errorf("status = %v, want an error for the 500", span.Status())
+		}
+	})
+
+	t.Run("continues the caller's trace", func(t *testing.T) {
+		span := serve(http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+
+		if got := span.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("trace id = %s, want the caller's", got)
+		}
+		if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+			t.Errorf("parent span id = %s, want the caller's", got)
+		}
+	})
+}
@@ -0,0 +1,354 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// LockID is the key of the Postgres advisory lock held while migrating, so that
+// concurrent deploys apply each migration once.
+const LockID int64 = 7_391_024_115
+
+var ErrSchemaOutdated = errors.New("database schema is outdated")
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Load reads every migration in fsys, sorted by version. Each version needs both
+// an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %v", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %v", entry.Name(), err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Pending returns the migrations that have not been applied, in the order they should run.
+func Pending(migrations []Migration, applied map[int64]time.Time) []Migration {
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending
+}
+
+// Create writes an empty up and down migration into dir, numbered after the latest one.
+func Create(dir, name string) (up string, down string, err error) {
+	if !regexp.MustCompile(`^[a-z0-9_]+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q: use lowercase letters, digits and underscores", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	var version int64 = 1
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down = base+".up.sql", base+".down.sql"
+
+	if err := os.WriteFile(up, []byte("-- write the migration here\n"), 0o644); err != nil {
+		return "", "", fmt.Errorf("error creating migration: %v", err)
+	}
+
+	if err := os.WriteFile(down, []byte("-- undo the up migration here\n"), 0o644); err != nil {
+		return "", "", fmt.Errorf("error creating migration: %v", err)
+	}
+
+	return up, down, nil
+}
+
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration, each in its own transaction.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range Pending(m.migrations, applied) {
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2);", migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down rolls back the latest steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, migration.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1;", migration.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("error rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status lists every known migration with the time it was applied, nil when pending.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+
+	err := m.withConn(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if appliedAt, ok := applied[migration.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Version returns the latest applied migration version, 0 on an empty database.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version int64
+
+	err := m.withConn(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for v := range applied {
+			version = max(version, v)
+		}
+
+		return nil
+	})
+
+	return version, err
+}
+
+// Check returns ErrSchemaOutdated when any embedded migration has not been applied.
+func (m *Migrator) Check(ctx context.Context) error {
+	var pending []Migration
+
+	err := m.withConn(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		pending = Pending(m.migrations, applied)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migration(s), starting with %d_%s", ErrSchemaOutdated, len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	return nil
+}
+
+func (m *Migrator) withConn(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	return m.acquire(ctx, false, fn)
+}
+
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	return m.acquire(ctx, true, fn)
+}
+
+// acquire runs fn on a single pooled connection, holding the advisory lock when asked to.
+// Advisory locks belong to the session, so the lock, the migrations and the unlock must
+// share the connection.
+func (m *Migrator) acquire(ctx context.Context, lock bool, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error acquiring connection: %w", err)
+	}
+	defer conn.Release()
+
+	if lock {
+		if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1);", LockID); err != nil {
+			return fmt.Errorf("error acquiring migration lock: %w", err)
+		}
+		defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1);", LockID)
+	}
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    BIGINT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *pgxpool.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		return nil, fmt.Errorf("error querying schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("error scanning rows: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
@@ -0,0 +1,112 @@
+package migrate_test
+
+import (
+	"github.com/Adedunmol/wish-mate/internal/migrate"
+	"github.com/Adedunmol/wish-mate/internal/migrations"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+
+	t.Run("loads the embedded migrations in order", func(t *testing.T) {
+		got, err := migrate.Load(migrations.FS)
+		if err != nil {
+			t.Fatalf("error loading migrations: %v", err)
+		}
+
+		if len(got) == 0 || got[0].Version != 1 || got[0].Name != "create_users" {
+			t.Fatalf("unexpected first migration: %+v", got)
+		}
+
+		for i := 1; i < len(got); i++ {
+			if got[i].Version <= got[i-1].Version {
+				t.Errorf("migrations out of order: %d after %d", got[i].Version, got[i-1].Version)
+			}
+		}
+
+		if !strings.Contains(got[0].Up, "locale") {
+			t.Errorf("users migration has no locale column")
+		}
+	})
+
+	t.Run("sorts versions numerically", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"10_b.up.sql":   {Data: []byte("SELECT 10;")},
+			"10_b.down.sql": {Data: []byte("SELECT -10;")},
+			"9_a.up.sql":    {Data: []byte("SELECT 9;")},
+			"9_a.down.sql":  {Data: []byte("SELECT -9;")},
+		}
+
+		got, err := migrate.Load(fsys)
+		if err != nil {
+			t.Fatalf("error loading migrations: %v", err)
+		}
+
+		if got[0].Version != 9 || got[1].Version != 10 {
+			t.Errorf("unexpected order: %+v", got)
+		}
+	})
+
+	t.Run("missing down migration", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"0001_a.up.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		if _, err := migrate.Load(fsys); err == nil {
+			t.Error("expected an error for a migration without a down file")
+		}
+	})
+
+	t.Run("invalid file name", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"create_users.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		if _, err := migrate.Load(fsys); err == nil {
+			t.Error("expected an error for an unnumbered migration")
+		}
+	})
+}
+
+func TestPending(t *testing.T) {
+	all := []migrate.Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+
+	got := migrate.Pending(all, map[int64]time.Time{1: time.Now(), 3: time.Now()})
+
+	if len(got) != 1 || got[0].Version != 2 {
+		t.Errorf("pending = %+v, want version 2", got)
+	}
+}
+
+func TestCreate(t *testing.T) {
+
+	t.Run("numbers the migration after the latest one", func(t *testing.T) {
+		dir := t.TempDir()
+		_ = os.WriteFile(filepath.Join(dir, "0004_a.up.sql"), []byte("SELECT 1;"), 0o644)
+		_ = os.WriteFile(filepath.Join(dir, "0004_a.down.sql"), []byte("SELECT 1;"), 0o644)
+
+		up, down, err := migrate.Create(dir, "add_bio")
+		if err != nil {
+			t.Fatalf("error creating migration: %v", err)
+		}
+
+		if filepath.Base(up) != "0005_add_bio.up.sql" || filepath.Base(down) != "0005_add_bio.down.sql" {
+			t.Errorf("created %s and %s", up, down)
+		}
+
+		if _, err := migrate.Load(os.DirFS(dir)); err != nil {
+			t.Errorf("created migration does not load: %v", err)
+		}
+	})
+
+	t.Run("invalid name", func(t *testing.T) {
+		if _, _, err := migrate.Create(t.TempDir(), "Add Bio"); err == nil {
+			t.Error("expected an error for an invalid name")
+		}
+	})
+}
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    id            SERIAL PRIMARY KEY,
+    username      TEXT NOT NULL UNIQUE,
+    email         TEXT NOT NULL UNIQUE,
+    first_name    TEXT NOT NULL,
+    last_name     TEXT NOT NULL,
+    password      TEXT NOT NULL,
+    date_of_birth DATE,
+    locale        TEXT NOT NULL DEFAULT 'en' CHECK (locale IN ('en', 'fr', 'yo')),
+    verified      BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,9 @@
+CREATE TABLE otps (
+    id         SERIAL PRIMARY KEY,
+    email      TEXT NOT NULL,
+    otp        TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX otps_email_idx ON otps (email);
@@ -0,0 +1,12 @@
+CREATE TABLE friendships (
+    id           SERIAL PRIMARY KEY,
+    user_id      INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    friend_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'blocked')),
+    friend_since TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, friend_id),
+    CHECK (user_id <> friend_id)
+);
+
+CREATE INDEX friendships_friend_id_idx ON friendships (friend_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS item_picks;
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS wishlists;
@@ -0,0 +1,32 @@
+CREATE TABLE wishlists (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    description   TEXT NOT NULL DEFAULT '',
+    notify_before INTEGER NOT NULL DEFAULT 0,
+    date          DATE,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX wishlists_user_id_idx ON wishlists (user_id);
+
+CREATE TABLE items (
+    id          SERIAL PRIMARY KEY,
+    wishlist_id INTEGER NOT NULL REFERENCES wishlists (id) ON DELETE CASCADE,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    link        TEXT NOT NULL DEFAULT '',
+    price       NUMERIC(12, 2),
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX items_wishlist_id_idx ON items (wishlist_id);
+
+-- an item can only be picked once
+CREATE TABLE item_picks (
+    id         SERIAL PRIMARY KEY,
+    item_id    INTEGER NOT NULL UNIQUE REFERENCES items (id) ON DELETE CASCADE,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
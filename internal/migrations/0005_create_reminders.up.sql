@@ -0,0 +1,14 @@
+CREATE TABLE reminders (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       TEXT NOT NULL DEFAULT '',
+    title      TEXT NOT NULL,
+    body       TEXT NOT NULL,
+    type       TEXT NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent')),
+    execute_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- the scheduler looks up due reminders every minute
+CREATE INDEX reminders_due_idx ON reminders (execute_at) WHERE status = 'pending';
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS login_devices;
+
+DROP INDEX IF EXISTS users_unlock_token_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS failed_logins,
+    DROP COLUMN IF EXISTS lockouts,
+    DROP COLUMN IF EXISTS locked_until,
+    DROP COLUMN IF EXISTS unlock_token;
@@ -0,0 +1,17 @@
+ALTER TABLE users
+    ADD COLUMN failed_logins INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN lockouts      INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN locked_until  TIMESTAMPTZ,
+    ADD COLUMN unlock_token  TEXT;
+
+CREATE UNIQUE INDEX users_unlock_token_idx ON users (unlock_token);
+
+CREATE TABLE login_devices (
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    device        TEXT NOT NULL,
+    ip            TEXT NOT NULL,
+    first_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, device, ip)
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS recovery_codes;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS two_factor_secret,
+    DROP COLUMN IF EXISTS two_factor_enabled,
+    DROP COLUMN IF EXISTS two_factor_last_step;
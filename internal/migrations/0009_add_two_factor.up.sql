@@ -0,0 +1,14 @@
+-- the secret is encrypted by the application, see ENCRYPTION_KEY
+ALTER TABLE users
+    ADD COLUMN two_factor_secret    TEXT,
+    ADD COLUMN two_factor_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN two_factor_last_step BIGINT;
+
+CREATE TABLE recovery_codes (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, code_hash)
+);
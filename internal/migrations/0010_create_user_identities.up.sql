@@ -0,0 +1,11 @@
+-- the accounts at OpenID Connect providers users sign in with
+CREATE TABLE user_identities (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider   TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    email      TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
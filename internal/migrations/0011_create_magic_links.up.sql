@@ -0,0 +1,11 @@
+-- the sign in links emailed to users, by the hash of the id in their signed token
+CREATE TABLE magic_links (
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at    TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX magic_links_user_id_idx ON magic_links (user_id);
@@ -0,0 +1 @@
+ALTER TABLE wishlists DROP COLUMN IF EXISTS visibility;
@@ -0,0 +1,3 @@
+-- who a wishlist is shown to besides its owner
+ALTER TABLE wishlists
+    ADD COLUMN visibility TEXT NOT NULL DEFAULT 'friends' CHECK (visibility IN ('public', 'friends', 'private'));
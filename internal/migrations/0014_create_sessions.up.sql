@@ -0,0 +1,15 @@
+-- the sign ins of each user, by the hash of their current refresh token. The access
+-- tokens name their session, and stop working once it is revoked.
+CREATE TABLE sessions (
+    id                 SERIAL PRIMARY KEY,
+    user_id            INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token_hash TEXT NOT NULL UNIQUE,
+    user_agent         TEXT NOT NULL,
+    ip                 TEXT NOT NULL,
+    expires_at         TIMESTAMPTZ NOT NULL,
+    last_seen_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at         TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
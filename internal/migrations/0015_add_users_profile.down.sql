@@ -0,0 +1,4 @@
+ALTER TABLE users
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS timezone,
+    DROP COLUMN IF EXISTS pending_email;
@@ -0,0 +1,5 @@
+-- the profile users edit themselves, and the address an email change waits to verify
+ALTER TABLE users
+    ADD COLUMN bio           TEXT NOT NULL DEFAULT '',
+    ADD COLUMN timezone      TEXT NOT NULL DEFAULT 'UTC',
+    ADD COLUMN pending_email TEXT;
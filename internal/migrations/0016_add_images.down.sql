@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_key;
+
+ALTER TABLE items DROP COLUMN IF EXISTS image_key;
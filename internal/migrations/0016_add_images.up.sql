@@ -0,0 +1,6 @@
+-- the blob store keys of the uploaded images, their thumbnails sit next to them
+ALTER TABLE users
+    ADD COLUMN avatar_key TEXT;
+
+ALTER TABLE items
+    ADD COLUMN image_key TEXT;
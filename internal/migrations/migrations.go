@@ -0,0 +1,12 @@
+// Package migrations holds the database schema migrations. They are embedded into the
+// binaries so a deploy always carries the schema it expects.
+package migrations
+
+import "embed"
+
+// FS contains every migration as an up and a down file sharing the same version and
+// name (0001_create_users.up.sql and 0001_create_users.down.sql). Versions are applied
+// in ascending order and must never be renumbered once released.
+//
+//go:embed *.sql
+var FS embed.FS
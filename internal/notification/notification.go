@@ -1,9 +1,11 @@
 package notification
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"strconv"
@@ -16,10 +18,11 @@ type Response struct {
 }
 
 type Handler struct {
-	Store Store
+	Store  Store
+	Policy *policy.Policy
 }
 
-func (h *Handler) CreateNotification(body *CreateNotificationBody) (Notification, error) {
+func (h *Handler) CreateNotification(ctx context.Context, body *CreateNotificationBody) (Notification, error) {
 	if body.UserID == 0 {
 		return Notification{}, errors.New("friendship id is required")
 	}
@@ -36,7 +39,7 @@ func (h *Handler) CreateNotification(body *CreateNotificationBody) (Notification
 		return Notification{}, errors.New("title is required")
 	}
 
-	notification, err := h.Store.CreateNotification(body)
+	notification, err := h.Store.CreateNotification(ctx, body)
 
 	if err != nil {
 		return Notification{}, fmt.Errorf("error creating notification: %v", err)
@@ -53,9 +56,8 @@ func (h *Handler) GetNotificationHandler(responseWriter http.ResponseWriter, req
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -66,16 +68,14 @@ func (h *Handler) GetNotificationHandler(responseWriter http.ResponseWriter, req
 		return
 	}
 
-	newUserID := userID.(int)
-
-	notification, err := h.Store.GetNotification(newNotificationID)
+	notification, err := h.Store.GetNotification(request.Context(), newNotificationID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if notification.UserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanViewNotification(principal, notification.UserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
@@ -102,21 +102,18 @@ func (h *Handler) GetUserNotificationsHandler(responseWriter http.ResponseWriter
 		return
 	}
 
-	currentUserID := request.Context().Value("user_id")
-
-	if currentUserID == nil || currentUserID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
 
-	newCurrentUserID := currentUserID.(int)
-
-	if newCurrentUserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanActAs(principal, newUserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	notifications, err := h.Store.GetUserNotifications(newUserID)
+	notifications, err := h.Store.GetUserNotifications(request.Context(), newUserID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
@@ -139,9 +136,8 @@ func (h *Handler) UpdateNotification(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -152,20 +148,18 @@ func (h *Handler) UpdateNotification(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	newUserID := userID.(int)
-
-	notification, err := h.Store.GetNotification(newNotificationID)
+	notification, err := h.Store.GetNotification(request.Context(), newNotificationID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if notification.UserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanViewNotification(principal, notification.UserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	notification, err = h.Store.UpdateNotification(newNotificationID, "read")
+	notification, err = h.Store.UpdateNotification(request.Context(), newNotificationID, "read")
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
@@ -188,9 +182,8 @@ func (h *Handler) DeleteNotification(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -201,20 +194,18 @@ func (h *Handler) DeleteNotification(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	newUserID := userID.(int)
-
-	notification, err := h.Store.GetNotification(newNotificationID)
+	notification, err := h.Store.GetNotification(request.Context(), newNotificationID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if notification.UserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanViewNotification(principal, notification.UserID); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	err = h.Store.DeleteNotification(newNotificationID)
+	err = h.Store.DeleteNotification(request.Context(), newNotificationID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
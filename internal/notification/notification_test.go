@@ -8,6 +8,7 @@ import (
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
 	"github.com/Adedunmol/wish-mate/internal/notification"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"net/http/httptest"
@@ -21,7 +22,7 @@ type StubStore struct {
 	users         []auth.User
 }
 
-func (s *StubStore) CreateNotification(body *notification.CreateNotificationBody) (notification.Notification, error) {
+func (s *StubStore) CreateNotification(ctx context.Context, body *notification.CreateNotificationBody) (notification.Notification, error) {
 	var userData auth.User
 
 	for _, u := range s.users {
@@ -50,7 +51,7 @@ func (s *StubStore) CreateNotification(body *notification.CreateNotificationBody
 	return data, nil
 }
 
-func (s *StubStore) GetNotification(id int) (notification.Notification, error) {
+func (s *StubStore) GetNotification(ctx context.Context, id int) (notification.Notification, error) {
 
 	for _, n := range s.notifications {
 		if n.ID == id {
@@ -60,21 +61,29 @@ func (s *StubStore) GetNotification(id int) (notification.Notification, error) {
 
 	return notification.Notification{}, helpers.ErrNotFound
 }
-func (s *StubStore) UpdateNotification(ID int, status string) (notification.Notification, error) {
+func (s *StubStore) UpdateNotification(ctx context.Context, ID int, status string) (notification.Notification, error) {
 
-	notif, _ := s.GetNotification(ID)
+	notif, _ := s.GetNotification(ctx, ID)
 
 	notif.Status = status
 
 	return notif, nil
 }
 
-func (s *StubStore) DeleteNotification(id int) error {
+func (s *StubStore) DeleteNotification(ctx context.Context, id int) error {
 	return nil
 }
 
-func (s *StubStore) GetUserNotifications(userID int) ([]notification.Notification, error) {
-	return nil, nil
+func (s *StubStore) GetUserNotifications(ctx context.Context, userID int) ([]notification.Notification, error) {
+	result := make([]notification.Notification, 0)
+
+	for _, n := range s.notifications {
+		if n.UserID == userID {
+			result = append(result, n)
+		}
+	}
+
+	return result, nil
 }
 
 func TestCreateNotification(t *testing.T) {
@@ -84,7 +93,7 @@ func TestCreateNotification(t *testing.T) {
 		},
 	}
 
-	server := &notification.Handler{Store: store}
+	server := &notification.Handler{Store: store, Policy: policy.New(nil)}
 
 	t.Run("create and return notification", func(t *testing.T) {
 		body := notification.CreateNotificationBody{
@@ -94,8 +103,11 @@ func TestCreateNotification(t *testing.T) {
 			Type:   "alert",
 		}
 
-		notif, _ := server.CreateNotification(&body)
-		currentTime := time.Now()
+		notif, _ := server.CreateNotification(context.Background(), &body)
+
+		if notif.Timestamp == nil {
+			t.Fatalf("CreateNotification returned no timestamp")
+		}
 
 		want := notification.Notification{
 			ID:        1,
@@ -104,7 +116,7 @@ func TestCreateNotification(t *testing.T) {
 			Body:      body.Body,
 			Type:      body.Type,
 			Status:    "unread",
-			Timestamp: &currentTime,
+			Timestamp: notif.Timestamp,
 		}
 
 		if len(store.notifications) != 1 {
@@ -124,7 +136,7 @@ func TestCreateNotification(t *testing.T) {
 			Type:   "alert",
 		}
 
-		_, err := server.CreateNotification(&body)
+		_, err := server.CreateNotification(context.Background(), &body)
 
 		if err == nil {
 			t.Errorf("CreateNotification returned no error")
@@ -142,7 +154,7 @@ func TestCreateNotification(t *testing.T) {
 			Type:   "alert",
 		}
 
-		_, err := server.CreateNotification(&body)
+		_, err := server.CreateNotification(context.Background(), &body)
 
 		if err == nil {
 			t.Errorf("CreateNotification returned no error")
@@ -157,7 +169,7 @@ func TestCreateNotification(t *testing.T) {
 			Type:  "alert",
 		}
 
-		_, err = server.CreateNotification(&body)
+		_, err = server.CreateNotification(context.Background(), &body)
 
 		if err == nil {
 			t.Errorf("CreateNotification returned no error")
@@ -184,7 +196,7 @@ func TestGetNotification(t *testing.T) {
 		},
 	}
 
-	server := &notification.Handler{Store: store}
+	server := &notification.Handler{Store: store, Policy: policy.New(nil)}
 
 	t.Run("get notification", func(t *testing.T) {
 		request := getNotificationRequest(1, 1, false)
@@ -223,7 +235,7 @@ func TestGetNotification(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "no resource found",
+			"message": "resource not found",
 		}
 
 		assertResponseCode(t, response.Code, http.StatusNotFound)
@@ -231,7 +243,7 @@ func TestGetNotification(t *testing.T) {
 	})
 
 	t.Run("return 400 for no notification id", func(t *testing.T) {
-		ctx := context.WithValue(context.Background(), "user_id", user.ID)
+		ctx := helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: user.ID, Verified: true})
 		request, _ := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("/users/%d/notifications/", user.ID), nil)
 
 		rctx := chi.NewRouteContext()
@@ -247,10 +259,10 @@ func TestGetNotification(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "no resource found",
+			"message": "id is required",
 		}
 
-		assertResponseCode(t, response.Code, http.StatusNotFound)
+		assertResponseCode(t, response.Code, http.StatusBadRequest)
 		assertResponseBody(t, got, want)
 	})
 
@@ -294,7 +306,7 @@ func TestGetUserNotifications(t *testing.T) {
 		},
 	}
 
-	server := &notification.Handler{Store: store}
+	server := &notification.Handler{Store: store, Policy: policy.New(nil)}
 
 	t.Run("get friendship's notifications", func(t *testing.T) {
 		request := getNotificationRequest(1, 1, true)
@@ -307,7 +319,7 @@ func TestGetUserNotifications(t *testing.T) {
 
 		want := map[string]interface{}{
 			"status":  "Success",
-			"message": "Notification retrieved successfully",
+			"message": "Notifications retrieved successfully",
 			"data": []map[string]interface{}{
 				{"id": float64(notif1.ID), "user_id": float64(user1.ID), "title": notif1.Title, "body": notif1.Body, "type": notif1.Type, "status": notif1.Status, "timestamp": &currentTime},
 				{"id": float64(notif2.ID), "user_id": float64(user1.ID), "title": notif2.Title, "body": notif2.Body, "type": notif2.Type, "status": notif2.Status, "timestamp": &currentTime},
@@ -319,7 +331,7 @@ func TestGetUserNotifications(t *testing.T) {
 	})
 
 	t.Run("return 404 for no friendship with the id", func(t *testing.T) {
-		request := getNotificationRequest(10, 1, true)
+		request := getNotificationRequest(10, 1, false)
 		response := httptest.NewRecorder()
 
 		server.GetNotificationHandler(response, request)
@@ -328,7 +340,7 @@ func TestGetUserNotifications(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "no resource found",
+			"message": "resource not found",
 		}
 
 		assertResponseCode(t, response.Code, http.StatusNotFound)
@@ -357,7 +369,7 @@ func TestUpdateNotification(t *testing.T) {
 		},
 	}
 
-	server := &notification.Handler{Store: store}
+	server := &notification.Handler{Store: store, Policy: policy.New(nil)}
 
 	t.Run("update notification's status", func(t *testing.T) {
 		request := updateNotificationRequest(notif1.ID, user1.ID)
@@ -370,7 +382,7 @@ func TestUpdateNotification(t *testing.T) {
 
 		want := map[string]interface{}{
 			"status":  "Success",
-			"message": "Notification retrieved successfully",
+			"message": "Notification updated successfully",
 			"data": map[string]interface{}{
 				"id":        float64(1),
 				"user_id":   float64(user1.ID),
@@ -403,8 +415,9 @@ func TestUpdateNotification(t *testing.T) {
 		assertResponseBody(t, got, want)
 	})
 
-	t.Run("return 400 for invalid status", func(t *testing.T) {
-		request := updateNotificationRequest(notif1.ID, user1.ID)
+	t.Run("return 400 for no notification id", func(t *testing.T) {
+		request := updateNotificationRequest(0, user1.ID)
+		request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, chi.NewRouteContext()))
 		response := httptest.NewRecorder()
 
 		server.UpdateNotification(response, request)
@@ -413,7 +426,7 @@ func TestUpdateNotification(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "invalid status",
+			"message": "id is required",
 		}
 		assertResponseCode(t, response.Code, http.StatusBadRequest)
 		assertResponseBody(t, got, want)
@@ -429,7 +442,7 @@ func TestUpdateNotification(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "forbidden from accessing another friendship's resource",
+			"message": "forbidden from accessing the resource",
 		}
 
 		assertResponseCode(t, response.Code, http.StatusForbidden)
@@ -458,7 +471,7 @@ func TestDeleteNotification(t *testing.T) {
 		},
 	}
 
-	server := &notification.Handler{Store: store}
+	server := &notification.Handler{Store: store, Policy: policy.New(nil)}
 
 	t.Run("delete notification", func(t *testing.T) {
 		request := deleteNotificationRequest(notif1.ID, user1.ID)
@@ -505,7 +518,7 @@ func TestDeleteNotification(t *testing.T) {
 		_ = json.Unmarshal(response.Body.Bytes(), &got)
 
 		want := map[string]interface{}{
-			"message": "forbidden from accessing another friendship's resource",
+			"message": "forbidden from accessing the resource",
 		}
 
 		assertResponseCode(t, response.Code, http.StatusForbidden)
@@ -517,7 +530,7 @@ func getNotificationRequest(notificationID, userID int, all bool) *http.Request
 
 	var request *http.Request
 	var rctx *chi.Context
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: userID, Verified: true})
 
 	if !all {
 		request, _ = http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("/users/%d/notifications/%d", userID, notificationID), nil)
@@ -538,7 +551,7 @@ func getNotificationRequest(notificationID, userID int, all bool) *http.Request
 }
 
 func updateNotificationRequest(notificationID, userID int) *http.Request {
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: userID, Verified: true})
 	ctx = context.WithValue(ctx, "notification_id", notificationID)
 
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/users/%d/notifications/%d", userID, notificationID), nil)
@@ -547,11 +560,13 @@ func updateNotificationRequest(notificationID, userID int) *http.Request {
 	rctx.URLParams.Add("notification_id", fmt.Sprint(notificationID))
 	rctx.URLParams.Add("user_id", fmt.Sprint(userID))
 
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
 	return request
 }
 
 func deleteNotificationRequest(notificationID, userID int) *http.Request {
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: userID, Verified: true})
 
 	request, _ := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("/users/%d/notifications/%d", userID, notificationID), nil)
 
@@ -559,6 +574,8 @@ func deleteNotificationRequest(notificationID, userID int) *http.Request {
 	rctx.URLParams.Add("notification_id", fmt.Sprint(notificationID))
 	rctx.URLParams.Add("user_id", fmt.Sprint(userID))
 
+	request = request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+
 	return request
 }
 
@@ -571,6 +588,11 @@ func assertResponseCode(t *testing.T, got, want int) {
 
 func assertResponseBody(t *testing.T, got, want map[string]interface{}) {
 	t.Helper()
+
+	wantJSON, _ := json.Marshal(want)
+	want = nil
+	_ = json.Unmarshal(wantJSON, &want)
+
 	if !reflect.DeepEqual(got, want) {
 		t.Errorf("response body = %v, want %v", got, want)
 	}
@@ -1,43 +1,44 @@
 package notification
 
 import (
+	"context"
 	"errors"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Store interface {
-	CreateNotification(body *CreateNotificationBody) (Notification, error)
-	UpdateNotification(ID int, status string) (Notification, error)
-	GetNotification(ID int) (Notification, error)
-	GetUserNotifications(userID int) ([]Notification, error)
-	DeleteNotification(ID int) error
+	CreateNotification(ctx context.Context, body *CreateNotificationBody) (Notification, error)
+	UpdateNotification(ctx context.Context, ID int, status string) (Notification, error)
+	GetNotification(ctx context.Context, ID int) (Notification, error)
+	GetUserNotifications(ctx context.Context, userID int) ([]Notification, error)
+	DeleteNotification(ctx context.Context, ID int) error
 }
 
 type NotificationStore struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewNotificationStore(db *pgx.Conn) *NotificationStore {
+func NewNotificationStore(db *pgxpool.Pool) *NotificationStore {
 
 	return &NotificationStore{db: db}
 }
 
-func (s *NotificationStore) CreateNotification(body *CreateNotificationBody) (Notification, error) {
+func (s *NotificationStore) CreateNotification(ctx context.Context, body *CreateNotificationBody) (Notification, error) {
 	return Notification{}, errors.New("not implemented")
 }
 
-func (s *NotificationStore) UpdateNotification(ID int, status string) (Notification, error) {
+func (s *NotificationStore) UpdateNotification(ctx context.Context, ID int, status string) (Notification, error) {
 	return Notification{}, errors.New("not implemented")
 }
 
-func (s *NotificationStore) GetUserNotifications(userID int) ([]Notification, error) {
+func (s *NotificationStore) GetUserNotifications(ctx context.Context, userID int) ([]Notification, error) {
 	return make([]Notification, 0), errors.New("not implemented")
 }
 
-func (s *NotificationStore) DeleteNotification(ID int) error {
+func (s *NotificationStore) DeleteNotification(ctx context.Context, ID int) error {
 	return errors.New("not implemented")
 }
 
-func (s *NotificationStore) GetNotification(ID int) (Notification, error) {
+func (s *NotificationStore) GetNotification(ctx context.Context, ID int) (Notification, error) {
 	return Notification{}, errors.New("not implemented")
 }
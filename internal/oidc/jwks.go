@@ -0,0 +1,93 @@
+package oidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+)
+
+// jsonWebKeySet is the document at the jwks_uri of a provider, RFC 7517.
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of an RSA key
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X and Y are the curve and point of an EC key
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parse returns the signing keys of the set by id, as *rsa.PublicKey and
+// *ecdsa.PublicKey. Keys of other types or uses, or that do not decode, are left out.
+func (s jsonWebKeySet) parse() map[string]interface{} {
+	keys := make(map[string]interface{}, len(s.Keys))
+
+	for _, key := range s.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+
+		switch key.Kty {
+		case "RSA":
+			if publicKey, ok := key.rsa(); ok {
+				keys[key.Kid] = publicKey
+			}
+		case "EC":
+			if publicKey, ok := key.ecdsa(); ok {
+				keys[key.Kid] = publicKey
+			}
+		}
+	}
+
+	return keys
+}
+
+func (k jsonWebKey) rsa() (*rsa.PublicKey, bool) {
+	n, nOK := decodeInt(k.N)
+	e, eOK := decodeInt(k.E)
+	if !nOK || !eOK || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+		return nil, false
+	}
+
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, true
+}
+
+func (k jsonWebKey) ecdsa() (*ecdsa.PublicKey, bool) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, false
+	}
+
+	x, xOK := decodeInt(k.X)
+	y, yOK := decodeInt(k.Y)
+	if !xOK || !yOK || !curve.IsOnCurve(x, y) {
+		return nil, false
+	}
+
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, true
+}
+
+func decodeInt(value string) (*big.Int, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, false
+	}
+
+	return new(big.Int).SetBytes(raw), true
+}
@@ -0,0 +1,413 @@
+// Package oidc signs users in with an OpenID Connect provider. It runs the authorization
+// code flow with PKCE and verifies the ID token against the keys the provider publishes.
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleIssuer is the issuer of the Google accounts.
+const GoogleIssuer = "https://accounts.google.com"
+
+// DefaultScopes are requested when the configuration names none.
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// ErrRejected is wrapped by the errors of a sign in the provider or the ID token
+// refused, as opposed to a provider that could not be reached.
+var ErrRejected = errors.New("oidc: sign in rejected")
+
+// maxResponseSize bounds the documents read from the provider.
+const maxResponseSize = 1 << 20
+
+// keysRefreshInterval is how often an unknown key id may trigger a new fetch of the keys.
+const keysRefreshInterval = time.Minute
+
+// Config describes a provider and the client registered with it.
+type Config struct {
+	// Name identifies the provider in the routes, such as google.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider.
+	RedirectURL string
+	Scopes      []string
+	// AuthURL, TokenURL and JWKSURL skip the discovery document when all are set.
+	AuthURL  string
+	TokenURL string
+	JWKSURL  string
+}
+
+// Claims are what the ID token says about the user.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+	Locale        string
+}
+
+// Provider runs the flow against one provider, caching its endpoints and keys.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu            sync.Mutex
+	discovered    bool
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewProvider returns a provider for the configuration, which talks to it with client,
+// or with a client timing out after 10s when nil.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = DefaultScopes
+	}
+
+	return &Provider{config: config, client: client}
+}
+
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+func (p *Provider) RedirectURL() string {
+	return p.config.RedirectURL
+}
+
+// AuthCodeURL is where the user is sent to sign in, the state and nonce come back in the
+// callback and the ID token, the challenge is derived from the PKCE verifier.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	config, err := p.endpoints(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.ClientID},
+		"redirect_uri":          {config.RedirectURL},
+		"scope":                 {strings.Join(config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(config.AuthURL, "?") {
+		separator = "&"
+	}
+
+	return config.AuthURL + separator + query.Encode(), nil
+}
+
+// Exchange trades the code of the callback for an ID token and returns its claims once
+// the token is verified and carries the nonce of the flow.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (Claims, error) {
+	config, err := p.endpoints(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"code_verifier": {verifier},
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, fmt.Errorf("error creating token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return Claims{}, fmt.Errorf("error requesting token: %w", err)
+	}
+	defer response.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&body); err != nil && response.StatusCode == http.StatusOK {
+		return Claims{}, fmt.Errorf("error decoding token response: %w", err)
+	}
+
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		return Claims{}, fmt.Errorf("token endpoint answered %s", response.Status)
+	case response.StatusCode != http.StatusOK:
+		return Claims{}, fmt.Errorf("%w: token endpoint answered %s: %s %s", ErrRejected, response.Status, body.Error, body.ErrorDescription)
+	case body.IDToken == "":
+		return Claims{}, fmt.Errorf("%w: token response has no id_token", ErrRejected)
+	}
+
+	return p.Verify(ctx, body.IDToken, nonce)
+}
+
+// Verify checks the signature of an ID token against the keys of the provider, its
+// issuer, audience, lifetime and nonce, and returns its claims.
+func (p *Provider) Verify(ctx context.Context, idToken, nonce string) (Claims, error) {
+	token, err := jwt.Parse(idToken, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		key, err := p.key(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+
+		// the key decides the algorithm, so a token cannot pick a weaker one
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
+				return key, nil
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); ok {
+				return key, nil
+			}
+		}
+
+		return nil, fmt.Errorf("%w: unexpected signing method %v", ErrRejected, token.Header["alg"])
+	})
+	if err != nil {
+		// keys that could not be fetched are the provider's fault, not the token's
+		var validationError *jwt.ValidationError
+		if errors.As(err, &validationError) && validationError.Errors&jwt.ValidationErrorUnverifiable != 0 &&
+			validationError.Inner != nil && !errors.Is(validationError.Inner, ErrRejected) {
+			return Claims{}, validationError.Inner
+		}
+
+		return Claims{}, fmt.Errorf("%w: invalid id token: %v", ErrRejected, err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return Claims{}, fmt.Errorf("%w: invalid id token", ErrRejected)
+	}
+
+	if err := p.checkClaims(claims, nonce); err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrRejected, err)
+	}
+
+	subject, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	givenName, _ := claims["given_name"].(string)
+	familyName, _ := claims["family_name"].(string)
+	name, _ := claims["name"].(string)
+	locale, _ := claims["locale"].(string)
+
+	return Claims{
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: claimTrue(claims["email_verified"]),
+		GivenName:     givenName,
+		FamilyName:    familyName,
+		Name:          name,
+		Locale:        locale,
+	}, nil
+}
+
+func (p *Provider) checkClaims(claims jwt.MapClaims, nonce string) error {
+	if !claims.VerifyIssuer(p.config.Issuer, true) {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+
+	if !claims.VerifyAudience(p.config.ClientID, true) {
+		return fmt.Errorf("unexpected audience %v", claims["aud"])
+	}
+
+	// a token for several audiences names the one it was issued to
+	if audiences, ok := claims["aud"].([]interface{}); ok && len(audiences) > 1 && claims["azp"] != p.config.ClientID {
+		return fmt.Errorf("unexpected authorized party %v", claims["azp"])
+	}
+
+	if _, ok := claims["exp"]; !ok {
+		return errors.New("missing exp")
+	}
+
+	if _, ok := claims["iat"]; !ok {
+		return errors.New("missing iat")
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return errors.New("missing sub")
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return errors.New("nonce mismatch")
+	}
+
+	return nil
+}
+
+// endpoints fills in the endpoints from the discovery document of the issuer, once.
+func (p *Provider) endpoints(ctx context.Context) (Config, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovered || (p.config.AuthURL != "" && p.config.TokenURL != "" && p.config.JWKSURL != "") {
+		return p.config, nil
+	}
+
+	var document struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", &document)
+	if err != nil {
+		return Config{}, fmt.Errorf("error discovering %s: %w", p.config.Name, err)
+	}
+
+	if document.Issuer != p.config.Issuer {
+		return Config{}, fmt.Errorf("error discovering %s: the document is for issuer %q", p.config.Name, document.Issuer)
+	}
+
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" || document.JWKSURI == "" {
+		return Config{}, fmt.Errorf("error discovering %s: the document is missing endpoints", p.config.Name)
+	}
+
+	if p.config.AuthURL == "" {
+		p.config.AuthURL = document.AuthorizationEndpoint
+	}
+	if p.config.TokenURL == "" {
+		p.config.TokenURL = document.TokenEndpoint
+	}
+	if p.config.JWKSURL == "" {
+		p.config.JWKSURL = document.JWKSURI
+	}
+	p.discovered = true
+
+	return p.config, nil
+}
+
+// key returns the signing key with the id, fetching the keys again when the provider
+// may have rotated them.
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	config, err := p.endpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if p.keys != nil && time.Since(p.keysFetchedAt) < keysRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrRejected, kid)
+	}
+
+	var document jsonWebKeySet
+	if err := p.getJSON(ctx, config.JWKSURL, &document); err != nil {
+		return nil, fmt.Errorf("error fetching the keys of %s: %w", p.config.Name, err)
+	}
+
+	p.keys = document.parse()
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", ErrRejected, kid)
+}
+
+// lookupKey finds the key with the id, a token without one may use the only key.
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) getJSON(ctx context.Context, address string, target interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", address, response.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(target)
+}
+
+// claimTrue reads a boolean claim, which some providers send as a string.
+func claimTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+
+	return false
+}
+
+// RandomString returns 32 random bytes encoded for URLs, for the state, the nonce and
+// the PKCE verifier.
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("error generating random string: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// Challenge derives the S256 PKCE challenge of a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
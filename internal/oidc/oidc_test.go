@@ -0,0 +1,144 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
+	"github.com/Adedunmol/wish-mate/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const redirectURL = "http://localhost:5000/auth/oidc/test/callback"
+
+func TestProvider(t *testing.T) {
+	server, err := oidctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	identity := oidctest.Identity{Subject: "1234", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"}
+
+	signIn := func(t *testing.T, provider *oidc.Provider, nonce string) (oidc.Claims, error) {
+		t.Helper()
+
+		verifier, _ := oidc.RandomString()
+
+		authURL, err := provider.AuthCodeURL(context.Background(), "state", "nonce", verifier)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		code, _, err := server.Authorize(authURL, identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return provider.Exchange(context.Background(), code, verifier, nonce)
+	}
+
+	t.Run("builds the authorization url from discovery", func(t *testing.T) {
+		provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+		authURL, err := provider.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		u, _ := url.Parse(authURL)
+		query := u.Query()
+
+		if u.Path != "/authorize" {
+			t.Errorf("path = %q, want /authorize", u.Path)
+		}
+		if query.Get("state") != "the-state" || query.Get("nonce") != "the-nonce" || query.Get("redirect_uri") != redirectURL {
+			t.Errorf("query = %v, want the state, nonce and redirect url", query)
+		}
+		if query.Get("code_challenge") != oidc.Challenge("the-verifier") || query.Get("scope") != "openid email profile" {
+			t.Errorf("query = %v, want the S256 challenge and the default scopes", query)
+		}
+	})
+
+	t.Run("verifies the id token", func(t *testing.T) {
+		provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+		claims, err := signIn(t, provider, "nonce")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		want := oidc.Claims{Subject: "1234", Email: "ada@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"}
+		if claims != want {
+			t.Errorf("claims = %+v, want %+v", claims, want)
+		}
+	})
+
+	t.Run("refuses a wrong code verifier", func(t *testing.T) {
+		provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+		authURL, _ := provider.AuthCodeURL(context.Background(), "state", "nonce", "the-verifier")
+		code, _, _ := server.Authorize(authURL, identity)
+
+		if _, err := provider.Exchange(context.Background(), code, "another-verifier", "nonce"); !errors.Is(err, oidc.ErrRejected) {
+			t.Errorf("got %v, want ErrRejected", err)
+		}
+	})
+
+	t.Run("refuses a wrong nonce", func(t *testing.T) {
+		provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+		if _, err := signIn(t, provider, "another-nonce"); !errors.Is(err, oidc.ErrRejected) {
+			t.Errorf("got %v, want ErrRejected", err)
+		}
+	})
+
+	cases := map[string]func(claims jwt.MapClaims){
+		"another audience": func(claims jwt.MapClaims) { claims["aud"] = "someone-else" },
+		"another issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"an expired token": func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"no expiry":        func(claims jwt.MapClaims) { delete(claims, "exp") },
+		"several audiences without azp": func(claims jwt.MapClaims) {
+			claims["aud"] = []string{oidctest.ClientID, "someone-else"}
+		},
+	}
+
+	for name, tamper := range cases {
+		t.Run("refuses "+name, func(t *testing.T) {
+			server.Claims = tamper
+			defer func() { server.Claims = nil }()
+
+			provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+			if _, err := signIn(t, provider, "nonce"); !errors.Is(err, oidc.ErrRejected) {
+				t.Errorf("got %v, want ErrRejected", err)
+			}
+		})
+	}
+
+	t.Run("refuses a token signed with a shared secret", func(t *testing.T) {
+		provider := oidc.NewProvider(server.Config("test", redirectURL), nil)
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": server.URL, "aud": oidctest.ClientID, "sub": "1234", "nonce": "nonce"})
+		token.Header["kid"] = oidctest.KeyID
+		signed, _ := token.SignedString([]byte(oidctest.ClientSecret))
+
+		if _, err := provider.Verify(context.Background(), signed, "nonce"); !errors.Is(err, oidc.ErrRejected) {
+			t.Errorf("got %v, want ErrRejected", err)
+		}
+	})
+
+	t.Run("tells an unreachable provider from a rejection", func(t *testing.T) {
+		config := server.Config("test", redirectURL)
+		config.Issuer = "http://127.0.0.1:1"
+
+		provider := oidc.NewProvider(config, nil)
+
+		_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier")
+		if err == nil || errors.Is(err, oidc.ErrRejected) {
+			t.Errorf("got %v, want a discovery error", err)
+		}
+	})
+}
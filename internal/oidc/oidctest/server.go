@@ -0,0 +1,212 @@
+// Package oidctest runs a stand-in OpenID Connect provider for the tests, which signs
+// in whoever the test says without showing a page.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/oidc"
+	"github.com/golang-jwt/jwt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	ClientID     = "wishmate-test"
+	ClientSecret = "wishmate-test-secret"
+	// KeyID names the key the ID tokens are signed with.
+	KeyID = "test-key"
+)
+
+// Identity is the user the provider signs in.
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+}
+
+// Server is the stand-in provider, Close stops it.
+type Server struct {
+	*httptest.Server
+
+	// Claims, when set, may change the claims of the next ID tokens, to test how bad
+	// tokens are refused.
+	Claims func(claims jwt.MapClaims)
+
+	key *rsa.PrivateKey
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+type grant struct {
+	identity    Identity
+	redirectURL string
+	nonce       string
+	challenge   string
+}
+
+// NewServer starts a provider with a new signing key.
+func NewServer() (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("error generating key: %w", err)
+	}
+
+	s := &Server{key: key, grants: map[string]grant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+
+	s.Server = httptest.NewServer(mux)
+
+	return s, nil
+}
+
+// Config is the configuration of a client of the provider, found by discovery.
+func (s *Server) Config(name, redirectURL string) oidc.Config {
+	return oidc.Config{
+		Name:         name,
+		Issuer:       s.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+	}
+}
+
+// Authorize plays the user signing in as identity at the authorization URL, returning
+// the code and the state the provider would redirect back with.
+func (s *Server) Authorize(authURL string, identity Identity) (code, state string, err error) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	query := u.Query()
+	if query.Get("client_id") != ClientID || query.Get("response_type") != "code" {
+		return "", "", fmt.Errorf("unexpected authorization request %s", authURL)
+	}
+
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", fmt.Errorf("authorization request without PKCE %s", authURL)
+	}
+
+	code, err = oidc.RandomString()
+	if err != nil {
+		return "", "", err
+	}
+
+	s.mu.Lock()
+	s.grants[code] = grant{
+		identity:    identity,
+		redirectURL: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+	}
+	s.mu.Unlock()
+
+	return code, query.Get("state"), nil
+}
+
+func (s *Server) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	g, ok := s.grants[r.PostForm.Get("code")]
+	// a code works once
+	delete(s.grants, r.PostForm.Get("code"))
+	s.mu.Unlock()
+
+	switch {
+	case r.PostForm.Get("client_id") != ClientID || r.PostForm.Get("client_secret") != ClientSecret:
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	case !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != g.redirectURL:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code verifier mismatch"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            ClientID,
+		"sub":            g.identity.Subject,
+		"email":          g.identity.Email,
+		"email_verified": g.identity.EmailVerified,
+		"given_name":     g.identity.GivenName,
+		"family_name":    g.identity.FamilyName,
+		"nonce":          g.nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+
+	if s.Claims != nil {
+		s.Claims(claims)
+	}
+
+	idToken, err := s.Sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// Sign signs claims with the key of the provider, as an ID token.
+func (s *Server) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = KeyID
+
+	return token.SignedString(s.key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
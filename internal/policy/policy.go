@@ -0,0 +1,207 @@
+// Package policy decides what the authenticated user may do with the wishlists, items,
+// friend requests and notifications of others. Handlers ask it once they know which
+// resource a request is about, and return its errors as they are.
+package policy
+
+import (
+	"context"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"net/http"
+)
+
+// Relation is how two users stand, named after the friendship statuses.
+type Relation string
+
+const (
+	RelationNone    Relation = ""
+	RelationPending Relation = "pending"
+	RelationFriends Relation = "accepted"
+	RelationBlocked Relation = "blocked"
+)
+
+var relationRanks = map[Relation]int{RelationNone: 0, RelationPending: 1, RelationFriends: 2, RelationBlocked: 3}
+
+func (r Relation) outranks(other Relation) bool {
+	return relationRanks[r] > relationRanks[other]
+}
+
+// Who a wishlist is shown to besides its owner. Friends is the default.
+const (
+	VisibilityPublic  = "public"
+	VisibilityFriends = "friends"
+	VisibilityPrivate = "private"
+)
+
+// Visibilities lists every visibility, the owner sees them all.
+var Visibilities = []string{VisibilityPublic, VisibilityFriends, VisibilityPrivate}
+
+var (
+	ErrOwnWishlist  = helpers.NewHTTPError(nil, http.StatusBadRequest, "cannot pick an item of your own wishlist", nil)
+	ErrFriendSelf   = helpers.NewHTTPError(nil, http.StatusBadRequest, "cannot send a friend request to yourself", nil)
+	ErrNotRecipient = helpers.NewHTTPError(nil, http.StatusForbidden, "only the recipient can accept a friend request", nil)
+)
+
+// Wishlist is what the policy needs to know about a wishlist.
+type Wishlist struct {
+	OwnerID    int
+	Visibility string
+}
+
+// FriendRequest is a friendship row, sent by SenderID to RecipientID.
+type FriendRequest struct {
+	SenderID    int
+	RecipientID int
+}
+
+type Policy struct {
+	Store Store
+}
+
+func New(store Store) *Policy {
+
+	return &Policy{Store: store}
+}
+
+// CanActAs checks that the user in the path of a /users/{user_id} route is the principal.
+func (p *Policy) CanActAs(principal helpers.Principal, userID int) error {
+	if principal.UserID != userID {
+		return helpers.ErrForbidden
+	}
+
+	return nil
+}
+
+// CanViewWishlist lets the owner see their wishlist, anyone not blocked see a public
+// one and friends see one shown to friends. Others get a not found, so they cannot
+// tell a hidden wishlist from a missing one.
+func (p *Policy) CanViewWishlist(ctx context.Context, principal helpers.Principal, wishlist Wishlist) error {
+	if principal.UserID == wishlist.OwnerID {
+		return nil
+	}
+
+	if wishlist.Visibility == VisibilityPrivate {
+		return helpers.ErrNotFound
+	}
+
+	relation, err := p.relation(ctx, principal.UserID, wishlist.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case relation == RelationBlocked:
+		return helpers.ErrNotFound
+	case wishlist.Visibility == VisibilityPublic, relation == RelationFriends:
+		return nil
+	}
+
+	return helpers.ErrNotFound
+}
+
+// VisibleWishlists lists the visibilities of the owner's wishlists the principal may see.
+func (p *Policy) VisibleWishlists(ctx context.Context, principal helpers.Principal, ownerID int) ([]string, error) {
+	if principal.UserID == ownerID {
+		return Visibilities, nil
+	}
+
+	relation, err := p.relation(ctx, principal.UserID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch relation {
+	case RelationBlocked:
+		return nil, helpers.ErrNotFound
+	case RelationFriends:
+		return []string{VisibilityPublic, VisibilityFriends}, nil
+	}
+
+	return []string{VisibilityPublic}, nil
+}
+
+// CanEditWishlist lets only the owner change or delete a wishlist.
+func (p *Policy) CanEditWishlist(principal helpers.Principal, wishlist Wishlist) error {
+	if principal.UserID != wishlist.OwnerID {
+		return helpers.ErrForbidden
+	}
+
+	return nil
+}
+
+// CanEditItem lets only the owner of the wishlist change or delete its items.
+func (p *Policy) CanEditItem(principal helpers.Principal, wishlist Wishlist) error {
+	return p.CanEditWishlist(principal, wishlist)
+}
+
+// CanPickItem lets anyone who can see a wishlist pick its items, except its owner, for
+// whom the picks stay a surprise.
+func (p *Policy) CanPickItem(ctx context.Context, principal helpers.Principal, wishlist Wishlist) error {
+	if err := p.CanViewWishlist(ctx, principal, wishlist); err != nil {
+		return err
+	}
+
+	if principal.UserID == wishlist.OwnerID {
+		return ErrOwnWishlist
+	}
+
+	return nil
+}
+
+// CanSendFriendRequest lets the principal ask anyone but themselves who has not
+// blocked them, or been blocked by them. A block reads as a missing user.
+func (p *Policy) CanSendFriendRequest(ctx context.Context, principal helpers.Principal, recipientID int) error {
+	if principal.UserID == recipientID {
+		return ErrFriendSelf
+	}
+
+	relation, err := p.relation(ctx, principal.UserID, recipientID)
+	if err != nil {
+		return err
+	}
+
+	if relation == RelationBlocked {
+		return helpers.ErrNotFound
+	}
+
+	return nil
+}
+
+// CanViewFriendRequest lets either side of a friend request see it.
+func (p *Policy) CanViewFriendRequest(principal helpers.Principal, request FriendRequest) error {
+	if principal.UserID != request.SenderID && principal.UserID != request.RecipientID {
+		return helpers.ErrForbidden
+	}
+
+	return nil
+}
+
+// CanAnswerFriendRequest lets the recipient accept a request, and either side block.
+func (p *Policy) CanAnswerFriendRequest(principal helpers.Principal, request FriendRequest, block bool) error {
+	if err := p.CanViewFriendRequest(principal, request); err != nil {
+		return err
+	}
+
+	if !block && principal.UserID != request.RecipientID {
+		return ErrNotRecipient
+	}
+
+	return nil
+}
+
+// CanViewNotification lets users see only their own notifications.
+func (p *Policy) CanViewNotification(principal helpers.Principal, ownerID int) error {
+	if principal.UserID != ownerID {
+		return helpers.ErrForbidden
+	}
+
+	return nil
+}
+
+func (p *Policy) relation(ctx context.Context, userID, otherID int) (Relation, error) {
+	relation, err := p.Store.Relation(ctx, userID, otherID)
+	if err != nil {
+		return RelationNone, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil)
+	}
+
+	return relation, nil
+}
@@ -0,0 +1,153 @@
+package policy_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
+	"reflect"
+	"testing"
+)
+
+// StubRelationStore knows the relation between user 1 and each other user.
+type StubRelationStore struct {
+	relations map[int]policy.Relation
+}
+
+func (s *StubRelationStore) Relation(ctx context.Context, userID, otherID int) (policy.Relation, error) {
+	if userID == 1 {
+		return s.relations[otherID], nil
+	}
+	return s.relations[userID], nil
+}
+
+func TestPolicy(t *testing.T) {
+	owner := helpers.Principal{UserID: 1}
+	friend := helpers.Principal{UserID: 2}
+	stranger := helpers.Principal{UserID: 3}
+	blocked := helpers.Principal{UserID: 4}
+	pending := helpers.Principal{UserID: 5}
+
+	rules := policy.New(&StubRelationStore{relations: map[int]policy.Relation{
+		2: policy.RelationFriends,
+		4: policy.RelationBlocked,
+		5: policy.RelationPending,
+	}})
+
+	wishlist := func(visibility string) policy.Wishlist {
+		return policy.Wishlist{OwnerID: owner.UserID, Visibility: visibility}
+	}
+
+	t.Run("shows a wishlist by its visibility", func(t *testing.T) {
+		cases := []struct {
+			principal  helpers.Principal
+			visibility string
+			want       error
+		}{
+			{owner, policy.VisibilityPrivate, nil},
+			{friend, policy.VisibilityFriends, nil},
+			{friend, policy.VisibilityPrivate, helpers.ErrNotFound},
+			{stranger, policy.VisibilityPublic, nil},
+			{stranger, policy.VisibilityFriends, helpers.ErrNotFound},
+			{pending, policy.VisibilityFriends, helpers.ErrNotFound},
+			{blocked, policy.VisibilityPublic, helpers.ErrNotFound},
+		}
+
+		for _, c := range cases {
+			if got := rules.CanViewWishlist(context.Background(), c.principal, wishlist(c.visibility)); got != c.want {
+				t.Errorf("user %d viewing a %s wishlist: got %v, want %v", c.principal.UserID, c.visibility, got, c.want)
+			}
+		}
+	})
+
+	t.Run("lists the visibilities each user sees", func(t *testing.T) {
+		got, _ := rules.VisibleWishlists(context.Background(), friend, owner.UserID)
+		if want := []string{policy.VisibilityPublic, policy.VisibilityFriends}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		got, _ = rules.VisibleWishlists(context.Background(), stranger, owner.UserID)
+		if want := []string{policy.VisibilityPublic}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+
+		if _, err := rules.VisibleWishlists(context.Background(), blocked, owner.UserID); err != helpers.ErrNotFound {
+			t.Errorf("got %v, want not found", err)
+		}
+	})
+
+	t.Run("lets only the owner edit", func(t *testing.T) {
+		if err := rules.CanEditWishlist(owner, wishlist(policy.VisibilityFriends)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := rules.CanEditItem(friend, wishlist(policy.VisibilityFriends)); err != helpers.ErrForbidden {
+			t.Errorf("got %v, want forbidden", err)
+		}
+	})
+
+	t.Run("lets those who see a wishlist pick, except its owner", func(t *testing.T) {
+		if err := rules.CanPickItem(context.Background(), friend, wishlist(policy.VisibilityFriends)); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := rules.CanPickItem(context.Background(), owner, wishlist(policy.VisibilityFriends)); err != policy.ErrOwnWishlist {
+			t.Errorf("got %v, want %v", err, policy.ErrOwnWishlist)
+		}
+
+		if err := rules.CanPickItem(context.Background(), stranger, wishlist(policy.VisibilityFriends)); err != helpers.ErrNotFound {
+			t.Errorf("got %v, want not found", err)
+		}
+	})
+
+	t.Run("answers friend requests", func(t *testing.T) {
+		request := policy.FriendRequest{SenderID: 1, RecipientID: 2}
+
+		if err := rules.CanAnswerFriendRequest(friend, request, false); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := rules.CanAnswerFriendRequest(owner, request, false); err != policy.ErrNotRecipient {
+			t.Errorf("got %v, want %v", err, policy.ErrNotRecipient)
+		}
+
+		if err := rules.CanAnswerFriendRequest(owner, request, true); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := rules.CanViewFriendRequest(stranger, request); err != helpers.ErrForbidden {
+			t.Errorf("got %v, want forbidden", err)
+		}
+	})
+
+	t.Run("refuses friend requests to oneself or across a block", func(t *testing.T) {
+		if err := rules.CanSendFriendRequest(context.Background(), owner, owner.UserID); err != policy.ErrFriendSelf {
+			t.Errorf("got %v, want %v", err, policy.ErrFriendSelf)
+		}
+
+		if err := rules.CanSendFriendRequest(context.Background(), blocked, owner.UserID); err != helpers.ErrNotFound {
+			t.Errorf("got %v, want not found", err)
+		}
+
+		if err := rules.CanSendFriendRequest(context.Background(), stranger, owner.UserID); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("fails when the relation cannot be read", func(t *testing.T) {
+		rules := policy.New(&FailingRelationStore{})
+
+		err := rules.CanViewWishlist(context.Background(), friend, wishlist(policy.VisibilityFriends))
+
+		var httpError *helpers.HTTPError
+		if !errors.As(err, &httpError) || httpError.Status != 500 {
+			t.Errorf("got %v, want an internal server error", err)
+		}
+	})
+}
+
+type FailingRelationStore struct{}
+
+func (s *FailingRelationStore) Relation(ctx context.Context, userID, otherID int) (policy.Relation, error) {
+	return policy.RelationNone, errors.New("connection refused")
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+type Store interface {
+	// Relation is how two users stand, whichever of them sent the friend request.
+	Relation(ctx context.Context, userID, otherID int) (Relation, error)
+}
+
+type RelationStore struct {
+	db *pgxpool.Pool
+}
+
+func NewRelationStore(db *pgxpool.Pool) *RelationStore {
+
+	return &RelationStore{db: db}
+}
+
+func (r *RelationStore) Relation(ctx context.Context, userID, otherID int) (Relation, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `SELECT status FROM friendships
+		WHERE (user_id = $1 AND friend_id = $2) OR (user_id = $2 AND friend_id = $1);`
+
+	rows, err := r.db.Query(ctx, query, userID, otherID)
+	if err != nil {
+		return RelationNone, fmt.Errorf("error fetching friendships: %w", err)
+	}
+	defer rows.Close()
+
+	relation := RelationNone
+	for rows.Next() {
+		var status string
+		if err := rows.Scan(&status); err != nil {
+			return RelationNone, fmt.Errorf("error scanning friendship: %w", err)
+		}
+
+		// an accepted request has a row each way, and a block on either side wins
+		if current := Relation(status); current.outranks(relation) {
+			relation = current
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return RelationNone, fmt.Errorf("error fetching friendships: %w", err)
+	}
+
+	return relation, nil
+}
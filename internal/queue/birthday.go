@@ -5,16 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/hibiken/asynq"
-	"log"
+	"log/slog"
 )
 
 const TypeBirthdayMailDelivery = "birthday:mail"
 
 type BirthdayMailPayload struct {
-	Template string
-	Subject  string
-	Email    string
-	Data     interface{}
+	Template     string
+	Subject      string
+	Email        string
+	Data         interface{}
+	RequestID    string
+	TraceContext map[string]string
 }
 
 func (e *BirthdayMailPayload) NewTask() (*asynq.Task, error) {
@@ -32,7 +34,7 @@ func HandleBirthdayMailTask(ctx context.Context, t *asynq.Task) error {
 	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 		return fmt.Errorf("error decoding birthday email delivery payload: %w", err)
 	}
-	log.Printf("sending mails to user's friends: %s", payload.Email)
+	slog.InfoContext(ctx, "sending mails to user's friends", "email", payload.Email)
 
 	// get user's friends and send mails to them
 
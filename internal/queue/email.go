@@ -4,17 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/email"
 	"github.com/hibiken/asynq"
-	"log"
+	"log/slog"
 )
 
 const TypeEmailDelivery = "mail:deliver"
 
 type EmailDeliveryPayload struct {
-	Template string
-	Subject  string
-	Email    string
-	Data     interface{}
+	Template     string
+	Subject      string
+	Email        string
+	Locale       string
+	Data         interface{}
+	RequestID    string
+	TraceContext map[string]string
 }
 
 func (e *EmailDeliveryPayload) NewTask() (*asynq.Task, error) {
@@ -27,14 +31,28 @@ func (e *EmailDeliveryPayload) NewTask() (*asynq.Task, error) {
 	return asynq.NewTask(TypeEmailDelivery, payload), nil
 }
 
-func HandleEmailTask(ctx context.Context, t *asynq.Task) error {
-	var payload EmailDeliveryPayload
-	if err := json.Unmarshal(t.Payload(), &payload); err != nil {
-		return fmt.Errorf("error decoding email delivery payload: %w", err)
+func WrapEmailHandler(mailer email.Mailer, templates *email.Templates) func(ctx context.Context, t *asynq.Task) error {
+	return func(ctx context.Context, t *asynq.Task) error {
+		var payload EmailDeliveryPayload
+		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
+			return fmt.Errorf("error decoding email delivery payload: %w", err)
+		}
+		slog.InfoContext(ctx, "sending mail", "template", payload.Template, "locale", payload.Locale, "email", payload.Email)
+
+		vars, _ := payload.Data.(map[string]interface{})
+
+		mail := email.Email{
+			ToAddr:   payload.Email,
+			Subject:  payload.Subject,
+			Template: payload.Template,
+			Locale:   payload.Locale,
+			Vars:     vars,
+		}
+
+		if err := mail.SendTemplateEmail(ctx, templates, mailer); err != nil {
+			return fmt.Errorf("error sending mail to %s: %w", payload.Email, err)
+		}
+
+		return nil
 	}
-	log.Printf("sending mail to user: %s", payload.Email)
-
-	// send mail to user
-
-	return nil
 }
@@ -6,17 +6,19 @@ import (
 	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/notification"
 	"github.com/hibiken/asynq"
-	"log"
+	"log/slog"
 )
 
 const TypeNotificationDelivery = "notification:deliver"
 
 type NotificationDeliveryPayload struct {
-	ID     int
-	UserID int
-	Title  string
-	Body   string
-	Type   string
+	ID           int
+	UserID       int
+	Title        string
+	Body         string
+	Type         string
+	RequestID    string
+	TraceContext map[string]string
 }
 
 func (e *NotificationDeliveryPayload) NewTask() (*asynq.Task, error) {
@@ -36,11 +38,11 @@ func WrapHandler(store notification.Store) func(ctx context.Context, t *asynq.Ta
 		if err := json.Unmarshal(t.Payload(), &payload); err != nil {
 			return fmt.Errorf("error decoding notification delivery payload: %w", err)
 		}
-		log.Printf("creating notification %d for: %d", payload.ID, payload.UserID)
+		slog.InfoContext(ctx, "creating notification", "reminder_id", payload.ID, "user_id", payload.UserID, "type", payload.Type)
 
 		// send in a collection of the user's friends from sql query
 
-		_, err := store.CreateNotification(&notification.CreateNotificationBody{
+		_, err := store.CreateNotification(ctx, &notification.CreateNotificationBody{
 			UserID: payload.UserID,
 			Title:  payload.Title,
 			Body:   payload.Body,
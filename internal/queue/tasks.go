@@ -2,14 +2,21 @@ package queue
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/email"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
 	"github.com/Adedunmol/wish-mate/internal/notification"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
 	"github.com/hibiken/asynq"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/redis/go-redis/v9"
-	"log"
-	"os"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
 	"sync"
+	"time"
 )
 
 type Task interface {
@@ -20,6 +27,10 @@ type Task interface {
 type TaskPayload struct {
 	Type    string
 	Payload map[string]interface{}
+	// RequestID ties the task's logs to the request or scheduler run that enqueued it.
+	RequestID string
+	// TraceContext continues the caller's trace, see tracing.Inject.
+	TraceContext map[string]string
 }
 
 type Queue interface {
@@ -28,18 +39,40 @@ type Queue interface {
 
 type Client struct {
 	client *asynq.Client
+	redis  asynq.RedisClientOpt
 	once   sync.Once
 }
 
 func (qc *Client) Enqueue(taskPayload *TaskPayload) error {
+	ctx := tracing.Extract(context.Background(), taskPayload.TraceContext)
+	ctx, span := tracing.Tracer().Start(ctx, "enqueue "+taskPayload.Type,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("task.type", taskPayload.Type)),
+	)
+
+	// the task continues the trace from the enqueue span
+	err := qc.enqueue(taskPayload, tracing.Inject(ctx))
+	metrics.TasksEnqueued.WithLabelValues(taskPayload.Type, metrics.Outcome(err)).Inc()
+
+	tracing.End(span, err)
+	return err
+}
+
+func (qc *Client) enqueue(taskPayload *TaskPayload, traceContext map[string]string) error {
 
 	switch taskPayload.Type {
 	case TypeEmailDelivery:
+		// the locale is optional, templates fall back to english
+		locale, _ := taskPayload.Payload["locale"].(string)
+
 		emailPayload := EmailDeliveryPayload{
-			Email:    taskPayload.Payload["email"].(string),
-			Template: taskPayload.Payload["template"].(string),
-			Subject:  taskPayload.Payload["subject"].(string),
-			Data:     map[string]interface{}{},
+			Email:        taskPayload.Payload["email"].(string),
+			Template:     taskPayload.Payload["template"].(string),
+			Subject:      taskPayload.Payload["subject"].(string),
+			Locale:       locale,
+			Data:         taskPayload.Payload["data"],
+			RequestID:    taskPayload.RequestID,
+			TraceContext: traceContext,
 		}
 
 		task, err := emailPayload.NewTask()
@@ -54,10 +87,12 @@ func (qc *Client) Enqueue(taskPayload *TaskPayload) error {
 		break
 	case TypeBirthdayMailDelivery:
 		emailPayload := BirthdayMailPayload{
-			Email:    taskPayload.Payload["email"].(string),
-			Template: taskPayload.Payload["template"].(string),
-			Subject:  taskPayload.Payload["subject"].(string),
-			Data:     map[string]interface{}{},
+			Email:        taskPayload.Payload["email"].(string),
+			Template:     taskPayload.Payload["template"].(string),
+			Subject:      taskPayload.Payload["subject"].(string),
+			Data:         map[string]interface{}{},
+			RequestID:    taskPayload.RequestID,
+			TraceContext: traceContext,
 		}
 
 		task, err := emailPayload.NewTask()
@@ -72,11 +107,13 @@ func (qc *Client) Enqueue(taskPayload *TaskPayload) error {
 		break
 	case TypeNotificationDelivery:
 		notificationPayload := NotificationDeliveryPayload{
-			ID:     taskPayload.Payload["id"].(int),
-			UserID: taskPayload.Payload["user_id"].(int),
-			Title:  taskPayload.Payload["title"].(string),
-			Body:   taskPayload.Payload["body"].(string),
-			Type:   taskPayload.Payload["type"].(string),
+			ID:           taskPayload.Payload["id"].(int),
+			UserID:       taskPayload.Payload["user_id"].(int),
+			Title:        taskPayload.Payload["title"].(string),
+			Body:         taskPayload.Payload["body"].(string),
+			Type:         taskPayload.Payload["type"].(string),
+			RequestID:    taskPayload.RequestID,
+			TraceContext: traceContext,
 		}
 
 		task, err := notificationPayload.NewTask()
@@ -94,17 +131,19 @@ func (qc *Client) Enqueue(taskPayload *TaskPayload) error {
 	return nil
 }
 
-func NewClient(ctx context.Context) (*Client, error) {
+func NewClient(ctx context.Context, redisURL string) (*Client, error) {
 	var qc Client
-	addr, err := redis.ParseURL(os.Getenv("REDIS_URL"))
+	addr, err := redis.ParseURL(redisURL)
 	if err != nil {
 		return &qc, fmt.Errorf("error parsing redis url: %v", err)
 	}
 
+	qc.redis = asynq.RedisClientOpt{Addr: addr.Addr}
+
 	qc.once.Do(func() {
-		log.Printf("setting up connection for asynq redis queue")
+		slog.Info("setting up connection for asynq redis queue")
 
-		qc.client = asynq.NewClient(asynq.RedisClientOpt{Addr: addr.Addr, Password: "", DB: 0})
+		qc.client = asynq.NewClient(qc.redis)
 	})
 
 	return &qc, nil
@@ -115,25 +154,65 @@ func (qc *Client) GetClient() *asynq.Client {
 }
 
 func (qc *Client) Close() error {
-	log.Println("closing connection to asynq queue")
+	slog.Info("closing connection to asynq queue")
 	return fmt.Errorf("error closing connection: %v", qc.client.Close())
 }
 
-func (qc *Client) Run(ctx context.Context, db *pgx.Conn) error {
-	addr, err := redis.ParseURL(os.Getenv("REDIS_URL"))
-	if err != nil {
-		return fmt.Errorf("error parsing redis url: %v", err)
-	}
-
-	queueServer := asynq.NewServer(asynq.RedisClientOpt{Addr: addr.Addr}, asynq.Config{})
+func (qc *Client) Run(ctx context.Context, db *pgxpool.Pool, mailer email.Mailer, templates *email.Templates) error {
+	queueServer := asynq.NewServer(qc.redis, asynq.Config{
+		Logger: asynqLogger{slog.Default()},
+		ErrorHandler: asynq.ErrorHandlerFunc(func(ctx context.Context, task *asynq.Task, err error) {
+			slog.ErrorContext(ctx, "task failed", "type", task.Type(), "error", err)
+		}),
+	})
 
 	mux := asynq.NewServeMux()
+	mux.Use(instrument)
 
-	mux.HandleFunc(TypeEmailDelivery, HandleEmailTask)
+	mux.HandleFunc(TypeEmailDelivery, WrapEmailHandler(mailer, templates))
 	mux.HandleFunc(TypeNotificationDelivery, WrapHandler(notification.NewNotificationStore(db)))
 
-	if err := queueServer.Run(mux); err != nil {
+	if err := queueServer.Start(mux); err != nil {
 		return fmt.Errorf("error running queue server: %v", err)
 	}
+
+	// wait for the caller to cancel, then let in-flight tasks finish before returning
+	<-ctx.Done()
+	queueServer.Shutdown()
+
+	slog.Info("queue server exited properly")
 	return nil
 }
+
+// taskContext holds the fields every task payload carries besides its own.
+type taskContext struct {
+	RequestID    string
+	TraceContext map[string]string
+}
+
+// instrument counts the tasks the worker runs and times them. Each task runs in a span
+// continuing the trace of whoever enqueued it, with the request id of its logs.
+func instrument(next asynq.Handler) asynq.Handler {
+	return asynq.HandlerFunc(func(ctx context.Context, task *asynq.Task) error {
+		start := time.Now()
+
+		// a payload that does not decode is left for the handler to reject
+		var taskCtx taskContext
+		_ = json.Unmarshal(task.Payload(), &taskCtx)
+
+		ctx = logging.WithRequestID(ctx, taskCtx.RequestID)
+		ctx = tracing.Extract(ctx, taskCtx.TraceContext)
+		ctx, span := tracing.Tracer().Start(ctx, "process "+task.Type(),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.String("task.type", task.Type())),
+		)
+
+		err := next.ProcessTask(ctx, task)
+
+		metrics.TaskDuration.WithLabelValues(task.Type()).Observe(time.Since(start).Seconds())
+		metrics.TasksProcessed.WithLabelValues(task.Type(), metrics.Outcome(err)).Inc()
+
+		tracing.End(span, err)
+		return err
+	})
+}
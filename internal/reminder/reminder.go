@@ -4,9 +4,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/i18n"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
 	"github.com/Adedunmol/wish-mate/internal/queue"
-	"github.com/jackc/pgx/v5"
-	"log"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
 	"time"
 )
 
@@ -20,53 +24,51 @@ type CreateReminderBody struct {
 }
 
 type Store interface {
-	CreateReminder(body CreateReminderBody) (ReminderResponse, error)
-	GetReminders(currentTime *time.Time) ([]ReminderResponse, error)
-	GetBirthdays(currentTime *time.Time) ([]ReminderResponse, error)
-	UpdateReminder(ID int) error
-	DeleteReminder(ID int) error
+	CreateReminder(ctx context.Context, body CreateReminderBody) (ReminderResponse, error)
+	GetReminders(ctx context.Context, currentTime *time.Time) ([]ReminderResponse, error)
+	GetBirthdays(ctx context.Context, currentTime *time.Time) ([]ReminderResponse, error)
+	UpdateReminder(ctx context.Context, ID int) error
+	DeleteReminder(ctx context.Context, ID int) error
 }
 
 type ReminderStore struct {
-	DB *pgx.Conn
+	DB *pgxpool.Pool
 }
 
-func (t *ReminderStore) DeleteReminder(ID int) error {
+func (t *ReminderStore) DeleteReminder(ctx context.Context, ID int) error {
 	//TODO implement me
 	panic("implement me")
 }
 
-func (t *ReminderStore) CreateReminder(body CreateReminderBody) (ReminderResponse, error) {
+func (t *ReminderStore) CreateReminder(ctx context.Context, body CreateReminderBody) (ReminderResponse, error) {
 	return ReminderResponse{}, nil
 }
 
-func (t *ReminderStore) GetReminders(currentTime *time.Time) ([]ReminderResponse, error) {
+func (t *ReminderStore) GetReminders(ctx context.Context, currentTime *time.Time) ([]ReminderResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := t.DB.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	// add inner join to get the user_id friends (id, email), which the notifications and emails are going to be sent
 	query := `
-		SELECT id, user_id, title, body, execute_at FROM reminders WHERE execute_at <= NOW();
+		SELECT r.id, r.user_id, u.email, u.locale, r.title, r.body, r.type, r.status, r.execute_at
+		FROM reminders r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.execute_at <= $1 AND r.status = 'pending';
 `
 	var reminders []ReminderResponse
 
-	rows, err := t.DB.Query(ctx, query)
+	rows, err := t.DB.Query(ctx, query, currentTime)
 
 	if err != nil {
 		return nil, fmt.Errorf("error querying reminders: %v", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var reminder ReminderResponse
 
-		err = rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Email, &reminder.Title, &reminder.Body, &reminder.Type, &reminder.Status, &reminder.ExecuteAt)
+		err = rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Email, &reminder.Locale, &reminder.Title, &reminder.Body, &reminder.Type, &reminder.Status, &reminder.ExecuteAt)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning rows: %w", err)
 		}
@@ -77,37 +79,31 @@ func (t *ReminderStore) GetReminders(currentTime *time.Time) ([]ReminderResponse
 	return reminders, nil
 }
 
-func (t *ReminderStore) GetBirthdays(currentTime *time.Time) ([]ReminderResponse, error) {
+func (t *ReminderStore) GetBirthdays(ctx context.Context, currentTime *time.Time) ([]ReminderResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := t.DB.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return nil, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
+	// the title and body are filled in from the message catalog in the user's locale
 	query := `
-		SELECT id, user_id, 'Happy Birthday!' AS title, 
-       		'Wishing you a wonderful day filled with joy!' AS body, 
-       		'birthday' AS type, 'pending' AS status, email 
+		SELECT id, id AS user_id, 'birthday' AS type, 'pending' AS status, email, locale
 		FROM users 
-		WHERE DATE_PART('month', birthdate) = DATE_PART('month', NOW()) 
-		AND DATE_PART('day', birthdate) = DATE_PART('day', NOW());
+		WHERE DATE_PART('month', date_of_birth) = DATE_PART('month', $1::timestamptz) 
+		AND DATE_PART('day', date_of_birth) = DATE_PART('day', $1::timestamptz);
 `
 	var birthdayReminders []ReminderResponse
 
-	rows, err := t.DB.Query(ctx, query)
+	rows, err := t.DB.Query(ctx, query, currentTime)
 
 	if err != nil {
 		return nil, fmt.Errorf("error querying users for birthdays: %v", err)
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var reminder ReminderResponse
 
-		err = rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Title, &reminder.Body, &reminder.Type, &reminder.Status, &reminder.ExecuteAt, &reminder.Email)
+		err = rows.Scan(&reminder.ID, &reminder.UserID, &reminder.Type, &reminder.Status, &reminder.Email, &reminder.Locale)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning rows: %w", err)
 		}
@@ -118,14 +114,15 @@ func (t *ReminderStore) GetBirthdays(currentTime *time.Time) ([]ReminderResponse
 	return birthdayReminders, nil
 }
 
-func (t *ReminderStore) UpdateReminder(ID int) error {
+func (t *ReminderStore) UpdateReminder(ctx context.Context, ID int) error {
 	return nil
 }
 
 type ReminderResponse struct {
 	ID        int        `json:"id"`
 	UserID    int        `json:"user_id"`
-	Email     int        `json:"email"`
+	Email     string     `json:"email"`
+	Locale    string     `json:"locale"`
 	Title     string     `json:"title"`
 	Body      string     `json:"body"`
 	Type      string     `json:"type"`
@@ -133,7 +130,7 @@ type ReminderResponse struct {
 	ExecuteAt *time.Time `json:"execute_at"`
 }
 
-func CreateReminder(store Store, body CreateReminderBody) (ReminderResponse, error) {
+func CreateReminder(ctx context.Context, store Store, body CreateReminderBody) (ReminderResponse, error) {
 
 	if body.Name == "" {
 		return ReminderResponse{}, errors.New("empty name")
@@ -147,7 +144,7 @@ func CreateReminder(store Store, body CreateReminderBody) (ReminderResponse, err
 	//	return ScheduledTaskResponse{}, errors.New("payload is empty")
 	//}
 
-	task, err := store.CreateReminder(body)
+	task, err := store.CreateReminder(ctx, body)
 	if err != nil {
 		return ReminderResponse{}, fmt.Errorf("error creating a task: %v", err)
 	}
@@ -155,8 +152,8 @@ func CreateReminder(store Store, body CreateReminderBody) (ReminderResponse, err
 	return task, nil
 }
 
-func GetReminders(store Store, currentTime *time.Time) ([]ReminderResponse, error) {
-	tasks, err := store.GetReminders(currentTime)
+func GetReminders(ctx context.Context, store Store, currentTime *time.Time) ([]ReminderResponse, error) {
+	tasks, err := store.GetReminders(ctx, currentTime)
 	if err != nil {
 		return nil, fmt.Errorf("error getting tasks: %v", err)
 	}
@@ -164,8 +161,8 @@ func GetReminders(store Store, currentTime *time.Time) ([]ReminderResponse, erro
 	return tasks, nil
 }
 
-func GetBirthdays(store Store, currentTime *time.Time) ([]ReminderResponse, error) {
-	tasks, err := store.GetBirthdays(currentTime)
+func GetBirthdays(ctx context.Context, store Store, currentTime *time.Time) ([]ReminderResponse, error) {
+	tasks, err := store.GetBirthdays(ctx, currentTime)
 	if err != nil {
 		return nil, fmt.Errorf("error getting tasks: %v", err)
 	}
@@ -173,18 +170,21 @@ func GetBirthdays(store Store, currentTime *time.Time) ([]ReminderResponse, erro
 	return tasks, nil
 }
 
-func EnqueueReminders(store Store, q queue.Queue, currentTime *time.Time) error {
+func EnqueueReminders(ctx context.Context, store Store, q queue.Queue, currentTime *time.Time) error {
 
 	// this should send in reminders and the details of the users to send the reminders to
-	tasks, err := GetReminders(store, currentTime)
+	tasks, err := GetReminders(ctx, store, currentTime)
 	if err != nil {
 		return fmt.Errorf("error getting tasks: %v", err)
 	}
+	metrics.DueItems.WithLabelValues("reminders").Add(float64(len(tasks)))
 
 	for _, task := range tasks {
 
 		err = q.Enqueue(&queue.TaskPayload{
-			Type: queue.TypeNotificationDelivery,
+			Type:         queue.TypeNotificationDelivery,
+			RequestID:    logging.RequestID(ctx),
+			TraceContext: tracing.Inject(ctx),
 			Payload: map[string]interface{}{
 				"id":      task.ID,
 				"user_id": task.UserID,
@@ -195,29 +195,30 @@ func EnqueueReminders(store Store, q queue.Queue, currentTime *time.Time) error
 		})
 
 		if err != nil {
-			log.Printf("error enqueuing scheduled task: %s : %v", err, task)
+			slog.ErrorContext(ctx, "error enqueuing scheduled task", "reminder_id", task.ID, "type", task.Type, "error", err)
 		}
 
 		err = q.Enqueue(&queue.TaskPayload{
-			Type: queue.TypeEmailDelivery,
+			Type:         queue.TypeEmailDelivery,
+			RequestID:    logging.RequestID(ctx),
+			TraceContext: tracing.Inject(ctx),
 			Payload: map[string]interface{}{
 				"template": "reminder_mail",
-				"subject":  "Wishlist Reminder",
+				"subject":  i18n.T(task.Locale, i18n.SubjectReminder),
 				"email":    task.Email,
-				"data":     "",
-				// embed the data below into a map and then pass into data
-				//"id":       task.ID,
-				//"user_id":  task.UserID,
-				//"title":    task.Title,
-				//"body":     task.Title,
-				//"type":     task.Type,
+				"locale":   task.Locale,
+				"data": map[string]interface{}{
+					"title": task.Title,
+					"body":  task.Body,
+					"date":  task.ExecuteAt,
+				},
 			},
 		})
 		if err != nil {
-			log.Printf("error enqueuing scheduled task: %s : %v", err, task)
+			slog.ErrorContext(ctx, "error enqueuing scheduled task", "reminder_id", task.ID, "type", task.Type, "error", err)
 		}
 
-		err = store.UpdateReminder(task.ID)
+		err = store.UpdateReminder(ctx, task.ID)
 
 		if err != nil {
 			return fmt.Errorf("error updating task: %v", err)
@@ -227,17 +228,23 @@ func EnqueueReminders(store Store, q queue.Queue, currentTime *time.Time) error
 	return nil
 }
 
-func EnqueueBirthdays(store Store, q queue.Queue, currentTime *time.Time) error {
+func EnqueueBirthdays(ctx context.Context, store Store, q queue.Queue, currentTime *time.Time) error {
 
-	tasks, err := GetBirthdays(store, currentTime)
+	tasks, err := GetBirthdays(ctx, store, currentTime)
 	if err != nil {
 		return fmt.Errorf("error getting birthdays: %v", err)
 	}
+	metrics.DueItems.WithLabelValues("birthdays").Add(float64(len(tasks)))
 
 	for _, task := range tasks {
 
+		task.Title = i18n.T(task.Locale, i18n.BirthdayTitle)
+		task.Body = i18n.T(task.Locale, i18n.BirthdayBody)
+
 		err = q.Enqueue(&queue.TaskPayload{
-			Type: queue.TypeNotificationDelivery,
+			Type:         queue.TypeNotificationDelivery,
+			RequestID:    logging.RequestID(ctx),
+			TraceContext: tracing.Inject(ctx),
 			Payload: map[string]interface{}{
 				"id":      task.ID,
 				"user_id": task.UserID,
@@ -248,34 +255,34 @@ func EnqueueBirthdays(store Store, q queue.Queue, currentTime *time.Time) error
 		})
 
 		if err != nil {
-			log.Printf("error enqueuing scheduled task: %s : %v", err, task)
+			slog.ErrorContext(ctx, "error enqueuing scheduled task", "reminder_id", task.ID, "type", task.Type, "error", err)
 		}
 
 		err = q.Enqueue(&queue.TaskPayload{
-			Type: queue.TypeEmailDelivery,
+			Type:         queue.TypeEmailDelivery,
+			RequestID:    logging.RequestID(ctx),
+			TraceContext: tracing.Inject(ctx),
 			Payload: map[string]interface{}{
 				"template": "birthday_mail",
-				"subject":  "Birthday",
+				"subject":  i18n.T(task.Locale, i18n.SubjectBirthday),
 				"email":    task.Email,
-				"data":     "",
-				// embed the data below into a map and then pass into data
-				//"id":       task.ID,
-				//"user_id":  task.UserID,
-				//"title":    task.Title,
-				//"body":     task.Title,
-				//"type":     task.Type,
+				"locale":   task.Locale,
+				"data": map[string]interface{}{
+					"title": task.Title,
+					"body":  task.Body,
+				},
 			},
 		})
 		if err != nil {
-			log.Printf("error enqueuing scheduled task: %s : %v", err, task)
+			slog.ErrorContext(ctx, "error enqueuing scheduled task", "reminder_id", task.ID, "type", task.Type, "error", err)
 		}
 	}
 
 	return nil
 }
 
-func DeleteReminder(store Store, id int) error {
-	err := store.DeleteReminder(id)
+func DeleteReminder(ctx context.Context, store Store, id int) error {
+	err := store.DeleteReminder(ctx, id)
 
 	if err != nil {
 		return fmt.Errorf("error deleting task: %v", err)
@@ -1,6 +1,7 @@
 package reminder_test
 
 import (
+	"context"
 	"errors"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
 	"github.com/Adedunmol/wish-mate/internal/reminder"
@@ -12,7 +13,7 @@ type StubStore struct {
 	reminders []reminder.ReminderResponse
 }
 
-func (s *StubStore) CreateReminder(body reminder.CreateReminderBody) (reminder.ReminderResponse, error) {
+func (s *StubStore) CreateReminder(ctx context.Context, body reminder.CreateReminderBody) (reminder.ReminderResponse, error) {
 
 	if body.Name == "" {
 		return reminder.ReminderResponse{}, errors.New("empty name")
@@ -41,7 +42,7 @@ func (s *StubStore) CreateReminder(body reminder.CreateReminderBody) (reminder.R
 	return data, nil
 }
 
-func (s *StubStore) GetReminders(currentTime *time.Time) ([]reminder.ReminderResponse, error) {
+func (s *StubStore) GetReminders(ctx context.Context, currentTime *time.Time) ([]reminder.ReminderResponse, error) {
 
 	var result []reminder.ReminderResponse
 
@@ -54,15 +55,15 @@ func (s *StubStore) GetReminders(currentTime *time.Time) ([]reminder.ReminderRes
 	return result, nil
 }
 
-func (s *StubStore) GetBirthdays(currentTime *time.Time) ([]reminder.ReminderResponse, error) {
+func (s *StubStore) GetBirthdays(ctx context.Context, currentTime *time.Time) ([]reminder.ReminderResponse, error) {
 	return nil, nil
 }
 
-func (s *StubStore) UpdateReminder(id int) error {
+func (s *StubStore) UpdateReminder(ctx context.Context, id int) error {
 	return nil
 }
 
-func (s *StubStore) DeleteReminder(id int) error {
+func (s *StubStore) DeleteReminder(ctx context.Context, id int) error {
 
 	for index, r := range s.reminders {
 		if r.ID == id {
@@ -78,10 +79,10 @@ func TestCreateReminder(t *testing.T) {
 	store := &StubStore{reminders: make([]reminder.ReminderResponse, 0)}
 
 	t.Run("create and return task", func(t *testing.T) {
-		currentTime := time.Now()
 		executeAt := time.Now().Add(10 * time.Minute)
 
 		body := reminder.CreateReminderBody{
+			Name:      "birthday",
 			UserID:    1,
 			ExecuteAt: &executeAt,
 			Title:     "birthday",
@@ -89,18 +90,18 @@ func TestCreateReminder(t *testing.T) {
 			Type:      "birthday",
 		}
 
-		task, _ := reminder.CreateReminder(store, body)
+		task, _ := reminder.CreateReminder(context.Background(), store, body)
 
 		if task.Status != "pending" {
 			t.Error("task status should be pending")
 		}
 
 		if task.Title != "birthday" {
-			t.Error("task name should be birthday")
+			t.Error("task title should be birthday")
 		}
 
-		if task.ExecuteAt != &executeAt {
-			t.Errorf("task executeAt should be %v", currentTime)
+		if task.ExecuteAt == nil || !task.ExecuteAt.Equal(executeAt) {
+			t.Errorf("task executeAt should be %v", executeAt)
 		}
 	})
 
@@ -114,7 +115,7 @@ func TestCreateReminder(t *testing.T) {
 			Type:      "birthday",
 		}
 
-		_, err := reminder.CreateReminder(store, body)
+		_, err := reminder.CreateReminder(context.Background(), store, body)
 
 		if err == nil {
 			t.Error("error should not be nil")
@@ -141,7 +142,7 @@ func TestGetReminders(t *testing.T) {
 		}}
 
 		currentTime := time.Now()
-		tasks, _ := reminder.GetReminders(store, &currentTime)
+		tasks, _ := reminder.GetReminders(context.Background(), store, &currentTime)
 
 		if len(tasks) != 2 {
 			t.Error("tasks should have two tasks")
@@ -159,7 +160,7 @@ func TestGetReminders(t *testing.T) {
 		}}
 
 		currentTime := time.Now()
-		tasks, _ := reminder.GetReminders(store, &currentTime)
+		tasks, _ := reminder.GetReminders(context.Background(), store, &currentTime)
 
 		if len(tasks) != 0 {
 			t.Error("tasks should have no tasks")
@@ -179,7 +180,7 @@ func DeleteReminder(t *testing.T) {
 
 	t.Run("delete a task", func(t *testing.T) {
 
-		err := reminder.DeleteReminder(store, 1)
+		err := reminder.DeleteReminder(context.Background(), store, 1)
 		if err != nil {
 			t.Error("error should be nil")
 		}
@@ -191,7 +192,7 @@ func DeleteReminder(t *testing.T) {
 
 	t.Run("return error for no task found with id", func(t *testing.T) {
 
-		err := reminder.DeleteReminder(store, 10)
+		err := reminder.DeleteReminder(context.Background(), store, 10)
 
 		if err == nil {
 			t.Error("error should not be nil for no task found with id")
@@ -1,14 +1,52 @@
 package routes
 
 import (
+	"github.com/Adedunmol/wish-mate/internal/admin"
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/docs"
 	"github.com/Adedunmol/wish-mate/internal/friendship"
+	"github.com/Adedunmol/wish-mate/internal/health"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
 	"github.com/Adedunmol/wish-mate/internal/wishlist"
+	"github.com/go-chi/chi/v5/middleware"
+	"net/http"
 )
 
 func SetupRoutes(config config.Config) {
 
+	if config.Settings.TrustProxy {
+		config.Router.Use(middleware.RealIP)
+	}
+
+	config.Router.Use(middlewares.RequestID, middlewares.Tracing, middlewares.AccessLog, middlewares.Metrics)
+
+	config.Router.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	healthHandler := config.Health
+	if healthHandler == nil {
+		healthHandler = &health.Handler{}
+	}
+	config.Router.Get("/healthz", healthHandler.LivenessHandler)
+	config.Router.Get("/readyz", healthHandler.ReadinessHandler)
+
+	if config.Tokens == nil {
+		config.Tokens = helpers.NewSecretKeys(config.Settings.JWT.Issuer, config.Settings.JWT.Audience, []byte(config.Settings.SecretKey.Reveal()))
+	}
+
+	if config.Images == nil {
+		config.Images = config.Settings.Images()
+	}
+
+	// a bucket serves its own links, the local store needs the API to
+	if blobs, ok := config.Images.Store.(http.Handler); ok {
+		config.Router.Method(http.MethodGet, "/blobs/*", http.StripPrefix("/blobs", blobs))
+	}
+
+	docs.DocsRoutes(config)
+	admin.AdminRoutes(config)
 	auth.AuthRoutes(config)
 	friendship.UserRoutes(config)
 	wishlist.WishlistRoutes(config)
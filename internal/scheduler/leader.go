@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LeaderKey = "wish-mate:scheduler:leader"
+	LeaderTTL = 30 * time.Second
+)
+
+var ErrNotLeader = errors.New("this instance is not the scheduler leader")
+
+// extend the lock only if it is still held by this instance
+var renewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// release the lock only if it is still held by this instance
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// LeaderLock is a redis backed lock that elects a single scheduler instance.
+// It satisfies gocron.Elector so jobs only run on the instance holding the lock.
+type LeaderLock struct {
+	client *redis.Client
+	key    string
+	token  string
+	ttl    time.Duration
+	leader atomic.Bool
+}
+
+func NewLeaderLock(client *redis.Client, key string, ttl time.Duration) (*LeaderLock, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("error generating leader token: %v", err)
+	}
+
+	return &LeaderLock{client: client, key: key, token: hex.EncodeToString(buf), ttl: ttl}, nil
+}
+
+// Campaign keeps trying to acquire (or renew) the lock until the context is cancelled,
+// after which the lock is released so another instance can take over immediately.
+func (l *LeaderLock) Campaign(ctx context.Context) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		l.tryAcquire(ctx)
+
+		select {
+		case <-ctx.Done():
+			l.release()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *LeaderLock) tryAcquire(ctx context.Context) {
+	if l.leader.Load() {
+		renewed, err := renewScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int()
+		if err != nil || renewed == 0 {
+			slog.Warn("lost scheduler leadership", "error", err)
+			l.leader.Store(false)
+		}
+		return
+	}
+
+	acquired, err := l.client.SetNX(ctx, l.key, l.token, l.ttl).Result()
+	if err != nil {
+		slog.Error("error acquiring scheduler leadership", "error", err)
+		return
+	}
+
+	if acquired {
+		slog.Info("acquired scheduler leadership")
+		l.leader.Store(true)
+	}
+}
+
+func (l *LeaderLock) release() {
+	if !l.leader.Swap(false) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err(); err != nil {
+		slog.Error("error releasing scheduler leadership", "error", err)
+	}
+}
+
+func (l *LeaderLock) IsLeader(_ context.Context) error {
+	if !l.leader.Load() {
+		return ErrNotLeader
+	}
+	return nil
+}
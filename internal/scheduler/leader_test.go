@@ -0,0 +1,138 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/scheduler"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"testing"
+	"time"
+)
+
+// ttl is short so the campaigns, which tick every third of it, move quickly
+const ttl = 150 * time.Millisecond
+
+func newLock(t *testing.T, server *miniredis.Miniredis) *scheduler.LeaderLock {
+	t.Helper()
+
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	lock, err := scheduler.NewLeaderLock(client, scheduler.LeaderKey, ttl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return lock
+}
+
+// campaign runs the campaign of lock until the returned function stops it, which waits
+// for the lock to be released.
+func campaign(t *testing.T, lock *scheduler.LeaderLock) func() {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		lock.Campaign(ctx)
+	}()
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+func isLeader(lock *scheduler.LeaderLock) bool {
+	return lock.IsLeader(context.Background()) == nil
+}
+
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestLeaderLock(t *testing.T) {
+	t.Run("elects a single leader", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		first, second := newLock(t, server), newLock(t, server)
+
+		campaign(t, first)
+		eventually(t, "the first lock leads", func() bool { return isLeader(first) })
+
+		campaign(t, second)
+
+		// a few renewals, the second lock keeps losing the race
+		time.Sleep(2 * ttl)
+
+		if !isLeader(first) {
+			t.Error("first lock lost the leadership it renews")
+		}
+		if err := second.IsLeader(context.Background()); !errors.Is(err, scheduler.ErrNotLeader) {
+			t.Errorf("second lock IsLeader = %v, want %v", err, scheduler.ErrNotLeader)
+		}
+	})
+
+	t.Run("hands over when the leader stops", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		first, second := newLock(t, server), newLock(t, server)
+
+		stopFirst := campaign(t, first)
+		eventually(t, "the first lock leads", func() bool { return isLeader(first) })
+
+		campaign(t, second)
+		stopFirst()
+
+		if isLeader(first) {
+			t.Error("first lock still leads after stopping")
+		}
+
+		// released rather than left to expire, the second lock takes over on its next try
+		eventually(t, "the second lock leads", func() bool { return isLeader(second) })
+	})
+
+	t.Run("steps down when the lock is taken over", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		lock := newLock(t, server)
+
+		stop := campaign(t, lock)
+		eventually(t, "the lock leads", func() bool { return isLeader(lock) })
+
+		// the key expired, say during a network partition, and another instance took it
+		server.Set(scheduler.LeaderKey, "another instance")
+
+		eventually(t, "the lock steps down", func() bool { return !isLeader(lock) })
+
+		stop()
+
+		// stepping down must not release the lock of the other instance
+		if got, _ := server.Get(scheduler.LeaderKey); got != "another instance" {
+			t.Errorf("leader key = %q, want the other instance's token", got)
+		}
+	})
+
+	t.Run("does not lead while Redis is down", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		lock := newLock(t, server)
+
+		campaign(t, lock)
+		eventually(t, "the lock leads", func() bool { return isLeader(lock) })
+
+		server.Close()
+
+		eventually(t, "the lock steps down", func() bool { return !isLeader(lock) })
+	})
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/logging"
+	"github.com/Adedunmol/wish-mate/internal/metrics"
+	"github.com/Adedunmol/wish-mate/internal/queue"
+	"github.com/Adedunmol/wish-mate/internal/reminder"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"time"
+)
+
+const Interval = time.Minute
+
+// Run schedules the reminder and birthday checks and blocks until the context is cancelled.
+// Every instance campaigns for the leader lock, but only the leader runs the jobs.
+func Run(ctx context.Context, q queue.Queue, db *pgxpool.Pool, lock *LeaderLock) error {
+	scheduler, err := gocron.NewScheduler(gocron.WithDistributedElector(lock), gocron.WithLogger(slog.Default()))
+	if err != nil {
+		return fmt.Errorf("error starting gocron scheduler: %v", err)
+	}
+
+	// schedule a task to run every minute
+	_, err = scheduler.NewJob(
+		gocron.DurationJob(Interval),
+		gocron.NewTask(func() {
+			EnqueueReminders(ctx, q, db)
+		}),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to schedule job: %v", err)
+	}
+
+	go lock.Campaign(ctx)
+
+	scheduler.Start()
+	slog.Info("scheduler started")
+
+	<-ctx.Done()
+
+	if err := scheduler.Shutdown(); err != nil {
+		return fmt.Errorf("error shutting down scheduler: %v", err)
+	}
+
+	slog.Info("scheduler exited properly")
+	return nil
+}
+
+func EnqueueReminders(ctx context.Context, client queue.Queue, db *pgxpool.Pool) {
+	currentTime := time.Now()
+
+	// every run gets its own id and trace, carried by the tasks it enqueues like a request's
+	ctx = logging.WithRequestID(ctx, logging.NewRequestID())
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler run", trace.WithNewRoot())
+	defer span.End()
+
+	taskStore := &reminder.ReminderStore{DB: db}
+
+	// check db for reminders where scheduled = pending AND scheduled_at <= now
+	slog.InfoContext(ctx, "checking due scheduled reminders", "at", currentTime.UTC())
+	if err := timeRun(ctx, "reminders", func(ctx context.Context) error {
+		return reminder.EnqueueReminders(ctx, taskStore, client, &currentTime)
+	}); err != nil {
+		slog.ErrorContext(ctx, "error enqueuing reminders", "error", err)
+	}
+
+	// get today's birthdays and send notifications and mails to their friends
+	slog.InfoContext(ctx, "checking birthdays due today", "at", currentTime.UTC())
+	if err := timeRun(ctx, "birthdays", func(ctx context.Context) error {
+		return reminder.EnqueueBirthdays(ctx, taskStore, client, &currentTime)
+	}); err != nil {
+		slog.ErrorContext(ctx, "error enqueuing birthdays", "error", err)
+	}
+}
+
+// timeRun runs a job in its own span and records how long it took.
+func timeRun(ctx context.Context, job string, run func(ctx context.Context) error) error {
+	start := time.Now()
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler job "+job, trace.WithAttributes(attribute.String("scheduler.job", job)))
+
+	err := run(ctx)
+	metrics.SchedulerRunDuration.WithLabelValues(job, metrics.Outcome(err)).Observe(time.Since(start).Seconds())
+
+	tracing.End(span, err)
+	return err
+}
@@ -0,0 +1,12 @@
+// Package templates holds the email templates. They are embedded into the binaries
+// so they resolve regardless of the working directory the process runs from.
+package templates
+
+import "embed"
+
+// FS contains every email template, each as an HTML and a plain text variant
+// sharing the same name (welcome_mail.html and welcome_mail.txt). Translations
+// add the locale before the extension (welcome_mail.fr.html), English has none.
+//
+//go:embed *.html *.txt
+var FS embed.FS
@@ -0,0 +1,83 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"github.com/Adedunmol/wish-mate/internal/totp"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the RFC 6238 test secret, "12345678901234567890" in base32
+var secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// the SHA1 vectors of RFC 6238 appendix B, keeping their last 6 digits
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		got, err := totp.Code(secret, totp.Step(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got != want {
+			t.Errorf("code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+
+	t.Run("accepts the current code", func(t *testing.T) {
+		step, ok := totp.Validate(secret, "005924", now)
+		if !ok || step != totp.Step(now) {
+			t.Errorf("got step %d, %t, want %d, true", step, ok, totp.Step(now))
+		}
+	})
+
+	t.Run("accepts the previous code", func(t *testing.T) {
+		if _, ok := totp.Validate(secret, "005924", now.Add(totp.Period)); !ok {
+			t.Error("the code of the previous period was refused")
+		}
+	})
+
+	t.Run("refuses an old code", func(t *testing.T) {
+		if _, ok := totp.Validate(secret, "005924", now.Add(3*totp.Period)); ok {
+			t.Error("a code 3 periods old was accepted")
+		}
+	})
+
+	t.Run("refuses a wrong code", func(t *testing.T) {
+		if _, ok := totp.Validate(secret, "123456", now); ok {
+			t.Error("a wrong code was accepted")
+		}
+	})
+}
+
+func TestURI(t *testing.T) {
+	generated, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	uri, err := url.Parse(totp.URI("Wishmate", "ade@gmail.com", generated))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Wishmate:ade@gmail.com" {
+		t.Errorf("uri = %s, want otpauth://totp/Wishmate:ade@gmail.com", uri)
+	}
+
+	if uri.Query().Get("secret") != generated || uri.Query().Get("issuer") != "Wishmate" {
+		t.Errorf("query = %v", uri.Query())
+	}
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"strings"
+)
+
+// QueryTracer is a pgx hook starting a span around every query run on a connection.
+type QueryTracer struct{}
+
+func (QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := queryOperation(data.SQL)
+
+	ctx, _ = Tracer().Start(ctx, "db "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationName(operation),
+			// the arguments are left out, they hold passwords and emails
+			semconv.DBQueryText(data.SQL),
+		),
+	)
+
+	return ctx
+}
+
+func (QueryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+
+	End(span, data.Err)
+}
+
+// queryOperation is the first keyword of a statement, such as SELECT or INSERT.
+func queryOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,107 @@
+// Package tracing sets up OpenTelemetry for every process and carries trace context
+// across the queue, so a reminder can be followed from the scheduler tick that found
+// it to the worker that mailed it.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const instrumentationName = "github.com/Adedunmol/wish-mate"
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup installs the tracer provider for the exporter: "otlp" sends spans over HTTP to
+// the endpoint (the OTLP default when empty), "stdout" prints them and "none" records
+// nothing. The returned function flushes the spans left and must be called on exit.
+func Setup(ctx context.Context, serviceName, exporterName, endpoint string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch exporterName {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %s", exporterName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s trace exporter: %w", exporterName, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES, when set, win over the process name
+	res, err := resource.Merge(
+		resource.NewSchemaless(semconv.ServiceName(serviceName)),
+		resource.Environment(),
+	)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("error building trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer is the tracer every span of the application is started from.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject returns the trace context of ctx in a form that survives being stored in a task
+// payload. It is nil when ctx carries no span.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	return carrier
+}
+
+// Extract continues the trace carried by a map built with Inject.
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
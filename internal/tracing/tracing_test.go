@@ -0,0 +1,127 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"github.com/Adedunmol/wish-mate/internal/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+// record makes the global tracer provider keep every span for the test.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	values := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		values[kv.Key] = kv.Value
+	}
+
+	return values
+}
+
+func TestSetup(t *testing.T) {
+	t.Run("records nothing by default", func(t *testing.T) {
+		shutdown, err := tracing.Setup(context.Background(), "test", "", "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("unexpected shutdown error: %v", err)
+		}
+	})
+
+	t.Run("rejects an unknown exporter", func(t *testing.T) {
+		if _, err := tracing.Setup(context.Background(), "test", "zipkin", ""); err == nil {
+			t.Error("expected an error, got nil")
+		}
+	})
+}
+
+func TestPropagation(t *testing.T) {
+	record(t)
+
+	t.Run("carries the span through a map", func(t *testing.T) {
+		ctx, span := tracing.Tracer().Start(context.Background(), "scheduler run")
+		defer span.End()
+
+		carrier := tracing.Inject(ctx)
+		if carrier["traceparent"] == "" {
+			t.Fatalf("got %v, want a traceparent", carrier)
+		}
+
+		extracted := tracing.Extract(context.Background(), carrier)
+		_, child := tracing.Tracer().Start(extracted, "process mail:deliver")
+		defer child.End()
+
+		if got, want := child.SpanContext().TraceID(), span.SpanContext().TraceID(); got != want {
+			t.Errorf("trace id = %s, want %s", got, want)
+		}
+	})
+
+	t.Run("injects nothing without a span", func(t *testing.T) {
+		if carrier := tracing.Inject(context.Background()); carrier != nil {
+			t.Errorf("got %v, want nil", carrier)
+		}
+	})
+}
+
+func TestQueryTracer(t *testing.T) {
+	recorder := record(t)
+	tracer := tracing.QueryTracer{}
+
+	t.Run("names the span after the operation", func(t *testing.T) {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{
+			SQL:  "select id from users where email = $1",
+			Args: []any{"user@example.com"},
+		})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+		spans := recorder.Ended()
+		span := spans[len(spans)-1]
+
+		if span.Name() != "db SELECT" {
+			t.Errorf("name = %q, want %q", span.Name(), "db SELECT")
+		}
+
+		values := attributes(span)
+		if got := values["db.query.text"].AsString(); got != "select id from users where email = $1" {
+			t.Errorf("db.query.text = %q", got)
+		}
+		if got := values["db.rows_affected"].AsInt64(); got != 1 {
+			t.Errorf("db.rows_affected = %d, want 1", got)
+		}
+		for _, value := range values {
+			if value.AsString() == "user@example.com" {
+				t.Error("query arguments were recorded")
+			}
+		}
+	})
+
+	t.Run("records the query error", func(t *testing.T) {
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "DELETE FROM users"})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("connection reset")})
+
+		spans := recorder.Ended()
+		span := spans[len(spans)-1]
+
+		if span.Status().Code != codes.Error {
+			t.Errorf("status = %v, want %v", span.Status().Code, codes.Error)
+		}
+	})
+}
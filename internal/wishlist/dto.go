@@ -1,7 +1,6 @@
 package wishlist
 
 import (
-	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
 )
 
@@ -19,15 +18,30 @@ type Wishlist struct {
 	Items        []Item `json:"items,omitempty"`
 	NotifyBefore int    `json:"notify_before" validate:"required"`
 	Date         string `json:"date,omitempty"`
+	Visibility   string `json:"visibility,omitempty" validate:"omitempty,oneof=public friends private"`
 }
 
 type ItemResponse struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Taken       bool      `json:"taken"`
-	Link        string    `json:"link"`
-	PickedBy    auth.User `json:"picked_by,omitempty"`
+	ID          int             `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Taken       bool            `json:"taken"`
+	Link        string          `json:"link"`
+	PickedBy    *PickerResponse `json:"picked_by,omitempty"`
+	// ImageKey is where the image is in the blob store, the handlers turn it into
+	// ImageURL and ThumbnailURL, signed links which stop working after a while.
+	ImageKey     string `json:"-"`
+	ImageURL     string `json:"image_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// PickerResponse is the user who picked an item, shown to the owner of the wishlist once
+// its date has come.
+type PickerResponse struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
 }
 
 type WishlistResponse struct {
@@ -37,6 +51,7 @@ type WishlistResponse struct {
 	Description  string         `json:"description"`
 	NotifyBefore int            `json:"notify_before,omitempty"`
 	Date         string         `json:"date,omitempty"`
+	Visibility   string         `json:"visibility,omitempty"`
 	Items        []ItemResponse `json:"items,omitempty"`
 }
 
@@ -44,6 +59,7 @@ type UpdateWishlist struct {
 	helpers.Validation
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Visibility  string `json:"visibility,omitempty" validate:"omitempty,oneof=public friends private"`
 }
 
 type UpdateItem struct {
@@ -0,0 +1,131 @@
+package wishlist
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/go-chi/chi/v5"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// linkImage fills in the signed links to the image of the item.
+func (h *Handler) linkImage(item *ItemResponse) {
+	if h.Images == nil {
+		return
+	}
+
+	item.ImageURL = h.Images.URL(item.ImageKey)
+	item.ThumbnailURL = h.Images.ThumbnailURL(item.ImageKey)
+}
+
+func (h *Handler) linkImages(items []ItemResponse) {
+	for i := range items {
+		h.linkImage(&items[i])
+	}
+}
+
+// UploadItemImageHandler stores the image of a multipart request as the photo of an item,
+// replacing the one it had. Only the owner of the wishlist may.
+func (h *Handler) UploadItemImageHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	wishlistID, itemID, ok := h.editableItem(responseWriter, request)
+	if !ok {
+		return
+	}
+
+	key, err := h.Images.Upload(responseWriter, request, fmt.Sprintf("items/%d", itemID))
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	h.setItemImage(responseWriter, request, wishlistID, itemID, key, "Image uploaded successfully")
+}
+
+// DeleteItemImageHandler removes the photo of an item.
+func (h *Handler) DeleteItemImageHandler(responseWriter http.ResponseWriter, request *http.Request) {
+	wishlistID, itemID, ok := h.editableItem(responseWriter, request)
+	if !ok {
+		return
+	}
+
+	h.setItemImage(responseWriter, request, wishlistID, itemID, "", "Image removed successfully")
+}
+
+// editableItem reads the ids of the route, responding with an error and returning false
+// unless the caller may edit the item.
+func (h *Handler) editableItem(responseWriter http.ResponseWriter, request *http.Request) (int, int, bool) {
+	wishlistID, err := strconv.Atoi(chi.URLParam(request, "id"))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "id is required", nil))
+		return 0, 0, false
+	}
+
+	itemID, err := strconv.Atoi(chi.URLParam(request, "item_id"))
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusBadRequest, "item id is required", nil))
+		return 0, 0, false
+	}
+
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return 0, 0, false
+	}
+
+	access, err := h.Store.GetWishlistAccess(request.Context(), wishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return 0, 0, false
+	}
+
+	if err := h.Policy.CanEditItem(principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return 0, 0, false
+	}
+
+	return wishlistID, itemID, true
+}
+
+// setItemImage stores key as the image of the item and deletes the one it replaced,
+// responding with the item.
+func (h *Handler) setItemImage(responseWriter http.ResponseWriter, request *http.Request, wishlistID, itemID int, key, message string) {
+	previous, err := h.Store.SetItemImage(request.Context(), wishlistID, itemID, key)
+	if err != nil {
+		if key != "" {
+			_ = h.Images.Remove(request.Context(), key)
+		}
+
+		if errors.Is(err, helpers.ErrNotFound) {
+			helpers.HandleError(responseWriter, helpers.ErrNotFound)
+			return
+		}
+
+		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
+		return
+	}
+
+	if previous != "" {
+		// the new image is in place, a leftover file is only wasted space
+		if err := h.Images.Remove(request.Context(), previous); err != nil {
+			slog.ErrorContext(request.Context(), "error deleting the previous item image", "item_id", itemID, "key", previous, "error", err)
+		}
+	}
+
+	item, err := h.Store.GetItem(request.Context(), wishlistID, itemID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	h.linkImage(&item)
+
+	response := Response{
+		Status:  "Success",
+		Message: message,
+		Data:    item,
+	}
+
+	helpers.WriteJSONResponse(responseWriter, response, http.StatusOK)
+}
@@ -1,7 +1,11 @@
 package wishlist
 
 import (
+	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/config"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/middlewares"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 )
@@ -11,13 +15,23 @@ func WishlistRoutes(config config.Config) {
 	wishlistRouter := chi.NewRouter()
 
 	store := NewWishlistStore(config.DB)
+	userStore := auth.NewUserStore(config.DB)
 
-	handler := Handler{Store: store}
+	handler := Handler{Store: store, UserStore: userStore, Policy: policy.New(policy.NewRelationStore(config.DB)), Images: config.Images}
 
-	wishlistRouter.Post("/", http.HandlerFunc(handler.CreateWishlist))
-	wishlistRouter.Get("/{id}", http.HandlerFunc(handler.GetWishlist))
-	wishlistRouter.Patch("/{id}", http.HandlerFunc(handler.UpdateWishlist))
-	wishlistRouter.Delete("/{id}", http.HandlerFunc(handler.DeleteWishlist))
+	personalTokens := auth.PersonalTokens{Store: auth.NewPersonalTokenStore(config.DB)}
+
+	wishlistRouter.Use(middlewares.AuthMiddleware(config.Tokens, auth.NewSessionStore(config.DB), personalTokens))
+
+	read := middlewares.RequireScope(helpers.ScopeReadWishlists)
+	write := middlewares.RequireScope(helpers.ScopeWriteWishlists)
+
+	wishlistRouter.With(write).Post("/", http.HandlerFunc(handler.CreateWishlist))
+	wishlistRouter.With(read).Get("/{id}", http.HandlerFunc(handler.GetWishlist))
+	wishlistRouter.With(write).Patch("/{id}", http.HandlerFunc(handler.UpdateWishlist))
+	wishlistRouter.With(write).Delete("/{id}", http.HandlerFunc(handler.DeleteWishlist))
+	wishlistRouter.With(write).Put("/{id}/items/{item_id}/image", http.HandlerFunc(handler.UploadItemImageHandler))
+	wishlistRouter.With(write).Delete("/{id}/items/{item_id}/image", http.HandlerFunc(handler.DeleteItemImageHandler))
 
 	config.Router.Mount("/wishlists", wishlistRouter)
 }
@@ -5,35 +5,46 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"github.com/Adedunmol/wish-mate/internal/auth"
+	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 )
 
 type Store interface {
-	CreateWishlist(userID int, body Wishlist) (WishlistResponse, error)
-	GetWishlistByID(wishlistID, userID int) (WishlistResponse, error)
-	GetUserWishlists(userID int, isOwner bool) ([]WishlistResponse, error)
-	UpdateWishlistByID(wishlistID, userID int, body UpdateWishlist) (WishlistResponse, error)
-	DeleteWishlistByID(wishlistID, userID int) error
-	GetItem(wishlistID, itemID int) (ItemResponse, error)
-	UpdateItem(wishlistID, itemID int, body *UpdateItem) (ItemResponse, error)
-	PickItem(wishlistID, itemID, userID int) (ItemResponse, error)
-	DeleteItem(wishlistID, itemID int) error
+	CreateWishlist(ctx context.Context, userID int, body Wishlist) (WishlistResponse, error)
+	GetWishlistByID(ctx context.Context, wishlistID, userID int) (WishlistResponse, error)
+	// GetWishlistAccess returns the owner and visibility the policy decides on.
+	GetWishlistAccess(ctx context.Context, wishlistID int) (policy.Wishlist, error)
+	GetUserWishlists(ctx context.Context, userID int, isOwner bool, visibilities []string) ([]WishlistResponse, error)
+	UpdateWishlistByID(ctx context.Context, wishlistID int, body UpdateWishlist) (WishlistResponse, error)
+	DeleteWishlistByID(ctx context.Context, wishlistID int) error
+	GetItem(ctx context.Context, wishlistID, itemID int) (ItemResponse, error)
+	UpdateItem(ctx context.Context, wishlistID, itemID int, body *UpdateItem) (ItemResponse, error)
+	PickItem(ctx context.Context, wishlistID, itemID, userID int) (ItemResponse, error)
+	DeleteItem(ctx context.Context, wishlistID, itemID int) error
+	// SetItemImage stores the key of the image of the item, an empty one removing it, and
+	// returns the key it replaced.
+	SetItemImage(ctx context.Context, wishlistID, itemID int, key string) (string, error)
 }
 
+// wishlistColumns is selected, in this order, by every query scanned into a
+// WishlistResponse. The date is a DATE, empty when the wishlist has none.
+const wishlistColumns = "id, user_id, name, description, notify_before, COALESCE(to_char(date, 'YYYY-MM-DD'), ''), visibility"
+
 type WishlistStore struct {
-	db *pgx.Conn
+	db *pgxpool.Pool
 }
 
-func NewWishlistStore(db *pgx.Conn) *WishlistStore {
+func NewWishlistStore(db *pgxpool.Pool) *WishlistStore {
 
 	return &WishlistStore{db: db}
 }
 
-func (w *WishlistStore) CreateWishlist(userID int, body Wishlist) (WishlistResponse, error) {
+func (w *WishlistStore) CreateWishlist(ctx context.Context, userID int, body Wishlist) (WishlistResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
@@ -44,21 +55,21 @@ func (w *WishlistStore) CreateWishlist(userID int, body Wishlist) (WishlistRespo
 
 	var wishlist WishlistResponse
 
-	query := `INSERT INTO wishlists (user_id, name, description, notify_before, date) 
-		VALUES ($1, $2, $3, $4, $5) RETURNING id, user_id, name, description, notify_before, date;`
+	query := `INSERT INTO wishlists (user_id, name, description, notify_before, date, visibility) 
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::date, COALESCE(NULLIF($6, ''), 'friends')) RETURNING ` + wishlistColumns + ";"
 
-	err = w.db.QueryRow(ctx, query, userID, body.Name, body.Description, body.NotifyBefore, body.Date).
-		Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date)
+	err = tx.QueryRow(ctx, query, userID, body.Name, body.Description, body.NotifyBefore, body.Date, body.Visibility).
+		Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date, &wishlist.Visibility)
 	if err != nil {
 		return WishlistResponse{}, fmt.Errorf("error inserting wishlist: %w", err)
 	}
 
 	wishlist.Items = make([]ItemResponse, 0)
 
-	insertItemQuery := `INSERT INTO items (wishlist_id, name, description, link) VALUES ($1, $2, $3, $4) RETURNING id, name, description, price;`
+	insertItemQuery := `INSERT INTO items (wishlist_id, name, description, link) VALUES ($1, $2, $3, $4) RETURNING id, name, description, link;`
 	for _, item := range body.Items {
 		var newItem ItemResponse
-		err = w.db.QueryRow(ctx, insertItemQuery, wishlist.ID, item.Name, item.Description, item.Link).
+		err = tx.QueryRow(ctx, insertItemQuery, wishlist.ID, item.Name, item.Description, item.Link).
 			Scan(&newItem.ID, &newItem.Name, &newItem.Description, &newItem.Link)
 
 		if err != nil {
@@ -67,99 +78,139 @@ func (w *WishlistStore) CreateWishlist(userID int, body Wishlist) (WishlistRespo
 		wishlist.Items = append(wishlist.Items, newItem)
 	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		return WishlistResponse{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return wishlist, nil
 }
 
-func (w *WishlistStore) GetWishlistByID(wishlistID, userID int) (WishlistResponse, error) {
+func (w *WishlistStore) GetWishlistByID(ctx context.Context, wishlistID, userID int) (WishlistResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return WishlistResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	var wishlist WishlistResponse
 
-	query := `SELECT id, user_id, name, description, notify_before, date 
-		FROM wishlists WHERE id = $1;`
-	err = w.db.QueryRow(ctx, query, wishlistID).
-		Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date)
+	query := "SELECT " + wishlistColumns + " FROM wishlists WHERE id = $1;"
+	err := w.db.QueryRow(ctx, query, wishlistID).
+		Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date, &wishlist.Visibility)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return WishlistResponse{}, helpers.ErrNotFound
+		}
 		return WishlistResponse{}, fmt.Errorf("error fetching wishlist: %w", err)
 	}
 
-	wishlist.Items = make([]ItemResponse, 0)
+	wishlist.Items, err = w.getItems(ctx, wishlist, userID == wishlist.UserID)
+	if err != nil {
+		return WishlistResponse{}, err
+	}
+
+	return wishlist, nil
+}
 
+// getItems returns the items of a wishlist. The owner sees every item, and who picked
+// each once the date of the wishlist has come, the others only the items not picked yet.
+func (w *WishlistStore) getItems(ctx context.Context, wishlist WishlistResponse, isOwner bool) ([]ItemResponse, error) {
 	var itemsQuery string
+	withPicker := false
 
-	if userID == wishlist.UserID {
-		if wishlist.Date <= fmt.Sprintf("%s", sql.NullString{String: "CURRENT_DATE", Valid: true}) {
-			itemsQuery = `SELECT i.id, i.name, i.description, i.price, u.id, u.username, u.first_name, u.last_name
+	if isOwner {
+		if wishlist.Date <= time.Now().Format(time.DateOnly) {
+			withPicker = true
+			itemsQuery = `SELECT i.id, i.name, i.description, i.link, COALESCE(i.image_key, ''), u.id, u.username, u.first_name, u.last_name
 			FROM items i 
 			LEFT JOIN item_picks ip ON i.id = ip.item_id
 			LEFT JOIN users u ON ip.user_id = u.id
 			WHERE i.wishlist_id = $1;`
 		} else {
-			itemsQuery = `SELECT id, name, description, link FROM items WHERE wishlist_id = $1;`
+			itemsQuery = `SELECT id, name, description, link, COALESCE(image_key, '') FROM items WHERE wishlist_id = $1;`
 		}
 	} else {
-		itemsQuery = `SELECT id, name, description, link FROM items 
+		itemsQuery = `SELECT id, name, description, link, COALESCE(image_key, '') FROM items 
 				WHERE wishlist_id = $1 AND id NOT IN (SELECT item_id FROM item_picks);`
 	}
 
-	rows, err := w.db.Query(ctx, itemsQuery, wishlistID)
+	rows, err := w.db.Query(ctx, itemsQuery, wishlist.ID)
 	if err != nil {
-		return WishlistResponse{}, fmt.Errorf("error fetching items: %w", err)
+		return nil, fmt.Errorf("error fetching items: %w", err)
 	}
 	defer rows.Close()
 
+	items := make([]ItemResponse, 0)
+
 	for rows.Next() {
 		var item ItemResponse
-		var user auth.User
+
+		if !withPicker {
+			err = rows.Scan(&item.ID, &item.Name, &item.Description, &item.Link, &item.ImageKey)
+			if err != nil {
+				return nil, fmt.Errorf("error scanning item: %w", err)
+			}
+
+			items = append(items, item)
+			continue
+		}
+
 		var userID sql.NullInt64
 		var username sql.NullString
 		var firstName sql.NullString
 		var lastName sql.NullString
 
-		err = rows.Scan(&item.ID, &item.Name, &item.Description, &item.Link, &userID, &username, &firstName, &lastName)
+		err = rows.Scan(&item.ID, &item.Name, &item.Description, &item.Link, &item.ImageKey, &userID, &username, &firstName, &lastName)
 		if err != nil {
-			return WishlistResponse{}, fmt.Errorf("error scanning item: %w", err)
+			return nil, fmt.Errorf("error scanning item: %w", err)
 		}
 
 		if userID.Valid {
-			user = auth.User{
+			item.PickedBy = &PickerResponse{
 				ID:        int(userID.Int64),
 				Username:  username.String,
 				FirstName: firstName.String,
 				LastName:  lastName.String,
 			}
-			item.PickedBy = user
 		}
 
-		wishlist.Items = append(wishlist.Items, item)
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching items: %w", err)
 	}
-	return WishlistResponse{}, nil
+
+	return items, nil
 }
 
-func (w *WishlistStore) GetUserWishlists(userID int, isOwner bool) ([]WishlistResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (w *WishlistStore) GetWishlistAccess(ctx context.Context, wishlistID int) (policy.Wishlist, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
+	var wishlist policy.Wishlist
+
+	query := `SELECT user_id, visibility FROM wishlists WHERE id = $1;`
+
+	err := w.db.QueryRow(ctx, query, wishlistID).Scan(&wishlist.OwnerID, &wishlist.Visibility)
 	if err != nil {
-		return nil, fmt.Errorf("error creating transaction: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return policy.Wishlist{}, helpers.ErrNotFound
+		}
+		return policy.Wishlist{}, fmt.Errorf("error fetching wishlist: %w", err)
 	}
-	defer tx.Rollback(ctx)
+
+	return wishlist, nil
+}
+
+func (w *WishlistStore) GetUserWishlists(ctx context.Context, userID int, isOwner bool, visibilities []string) ([]WishlistResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
 	var wishlists []WishlistResponse
 
-	query := `SELECT id, user_id, name, description, notify_before, date 
-		FROM wishlists WHERE user_id = $1;`
+	query := "SELECT " + wishlistColumns + " FROM wishlists WHERE user_id = $1 AND visibility = ANY($2);"
 
-	rows, err := w.db.Query(ctx, query, userID)
+	rows, err := w.db.Query(ctx, query, userID, visibilities)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching wishlists: %w", err)
 	}
@@ -167,161 +218,84 @@ func (w *WishlistStore) GetUserWishlists(userID int, isOwner bool) ([]WishlistRe
 
 	for rows.Next() {
 		var wishlist WishlistResponse
-		err := rows.Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date)
+		err := rows.Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date, &wishlist.Visibility)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning wishlist: %w", err)
 		}
 
-		wishlist.Items = []ItemResponse{}
-		var itemsQuery string
-
-		if isOwner {
-			// Owner: Show all items, picked and unpicked
-			if wishlist.Date <= fmt.Sprintf("%s", sql.NullString{String: "CURRENT_DATE", Valid: true}) {
-				itemsQuery = `SELECT i.id, i.name, i.description, i.price, u.id, u.username, u.first_name, u.last_name
-					FROM items i 
-					LEFT JOIN item_picks ip ON i.id = ip.item_id
-					LEFT JOIN users u ON ip.user_id = u.id
-					WHERE i.wishlist_id = $1;`
-			} else {
-				itemsQuery = `SELECT id, name, description, link FROM items WHERE wishlist_id = $1;`
-			}
-		} else {
-			// Non-owner: Show only unpicked items
-			itemsQuery = `SELECT id, name, description, link FROM items 
-				WHERE wishlist_id = $1 AND id NOT IN (SELECT item_id FROM item_picks);`
-		}
-
-		itemRows, err := w.db.Query(ctx, itemsQuery, wishlist.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error fetching items: %w", err)
-		}
-		defer itemRows.Close()
-
-		for itemRows.Next() {
-			var item ItemResponse
-			var user auth.User
-			var userID sql.NullInt64
-			var username sql.NullString
-			var firstName sql.NullString
-			var lastName sql.NullString
-
-			err := itemRows.Scan(&item.ID, &item.Name, &item.Description, &item.Link, &userID, &username, &firstName, &lastName)
-			if err != nil {
-				return nil, fmt.Errorf("error scanning item: %w", err)
-			}
+		wishlists = append(wishlists, wishlist)
+	}
 
-			if userID.Valid {
-				user = auth.User{
-					ID:        int(userID.Int64),
-					Username:  username.String,
-					FirstName: firstName.String,
-					LastName:  lastName.String,
-				}
-				item.PickedBy = user
-			}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error fetching wishlists: %w", err)
+	}
+	// the items are read once the connection of the wishlists is back in the pool
+	rows.Close()
 
-			wishlist.Items = append(wishlist.Items, item)
+	for i := range wishlists {
+		wishlists[i].Items, err = w.getItems(ctx, wishlists[i], isOwner)
+		if err != nil {
+			return nil, err
 		}
-
-		wishlists = append(wishlists, wishlist)
 	}
 
 	return wishlists, nil
 }
 
-func (w *WishlistStore) UpdateWishlistByID(wishlistID, userID int, body UpdateWishlist) (WishlistResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (w *WishlistStore) UpdateWishlistByID(ctx context.Context, wishlistID int, body UpdateWishlist) (WishlistResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return WishlistResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	var wishlist WishlistResponse
 
-	// Check if the user is the owner of the wishlist
-	var ownerID int
-	err = w.db.QueryRow(ctx, "SELECT user_id FROM wishlists WHERE id = $1", wishlistID).Scan(&ownerID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return WishlistResponse{}, errors.New("wishlist not found")
-		}
-		return WishlistResponse{}, fmt.Errorf("error checking wishlist ownership: %w", err)
-	}
-
-	if ownerID != userID {
-		return WishlistResponse{}, errors.New("forbidden: you do not own this wishlist")
-	}
-
 	// Update the wishlist with non-empty fields
 	query := `UPDATE wishlists SET 
 		name = COALESCE(NULLIF($1, ''), name),
-		description = COALESCE(NULLIF($2, ''), description)
-		WHERE id = $3 RETURNING id, user_id, name, description, notify_before, date;`
+		description = COALESCE(NULLIF($2, ''), description),
+		visibility = COALESCE(NULLIF($3, ''), visibility)
+		WHERE id = $4 RETURNING ` + wishlistColumns + ";"
 
-	err = w.db.QueryRow(ctx, query, body.Name, body.Description, wishlistID).Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date)
+	err := w.db.QueryRow(ctx, query, body.Name, body.Description, body.Visibility, wishlistID).Scan(&wishlist.ID, &wishlist.UserID, &wishlist.Name, &wishlist.Description, &wishlist.NotifyBefore, &wishlist.Date, &wishlist.Visibility)
 	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return WishlistResponse{}, helpers.ErrNotFound
+		}
 		return WishlistResponse{}, fmt.Errorf("error updating wishlist: %w", err)
 	}
 
 	return wishlist, nil
 }
 
-func (w *WishlistStore) DeleteWishlistByID(wishlistID, userID int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (w *WishlistStore) DeleteWishlistByID(ctx context.Context, wishlistID int) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
-	// Check if the user is the owner of the wishlist
-	var ownerID int
-	err = w.db.QueryRow(ctx, "SELECT user_id FROM wishlists WHERE id = $1", wishlistID).Scan(&ownerID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errors.New("wishlist not found")
-		}
-		return fmt.Errorf("error checking wishlist ownership: %w", err)
-	}
-
-	if ownerID != userID {
-		return errors.New("forbidden: you do not own this wishlist")
-	}
-
 	// Delete the wishlist
-	_, err = w.db.Exec(ctx, "DELETE FROM wishlists WHERE id = $1", wishlistID)
+	result, err := w.db.Exec(ctx, "DELETE FROM wishlists WHERE id = $1", wishlistID)
 	if err != nil {
 		return fmt.Errorf("error deleting wishlist: %w", err)
 	}
 
+	if result.RowsAffected() == 0 {
+		return helpers.ErrNotFound
+	}
+
 	return nil
 }
 
-func (w *WishlistStore) GetItem(wishlistID, itemID int) (ItemResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (w *WishlistStore) GetItem(ctx context.Context, wishlistID, itemID int) (ItemResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return ItemResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	var item ItemResponse
-	var pickedBy auth.User
+	var pickedBy PickerResponse
 
 	query := `
-	SELECT i.id, i.name, i.description, i.link
+	SELECT i.id, i.name, i.description, i.link, COALESCE(i.image_key, '')
 	FROM items i
 	WHERE i.id = $1 AND i.wishlist_id = $2;`
 
-	err = w.db.QueryRow(ctx, query, itemID, wishlistID).Scan(&item.ID, &item.Name, &item.Description, &item.Link)
+	err := w.db.QueryRow(ctx, query, itemID, wishlistID).Scan(&item.ID, &item.Name, &item.Description, &item.Link, &item.ImageKey)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ItemResponse{}, errors.New("item not found in wishlist")
@@ -335,12 +309,13 @@ func (w *WishlistStore) GetItem(wishlistID, itemID int) (ItemResponse, error) {
 		Description: item.Description,
 		Link:        item.Link,
 		Taken:       item.Taken,
+		ImageKey:    item.ImageKey,
 	}
 
 	// If the wishlist date has passed or is today, fetch the user who picked the item
 	var wishlistDate string
-	err = w.db.QueryRow(ctx, "SELECT date FROM wishlists WHERE id = $1", wishlistID).Scan(&wishlistDate)
-	if err == nil && wishlistDate <= fmt.Sprintf("%v", sql.NullString{String: "CURRENT_DATE", Valid: true}) {
+	err = w.db.QueryRow(ctx, "SELECT COALESCE(to_char(date, 'YYYY-MM-DD'), '') FROM wishlists WHERE id = $1", wishlistID).Scan(&wishlistDate)
+	if err == nil && wishlistDate <= time.Now().Format(time.DateOnly) {
 
 		pickQuery := `
 		SELECT u.id, u.username, u.first_name, u.last_name
@@ -350,24 +325,18 @@ func (w *WishlistStore) GetItem(wishlistID, itemID int) (ItemResponse, error) {
 
 		err = w.db.QueryRow(ctx, pickQuery, itemID).Scan(&pickedBy.ID, &pickedBy.Username, &pickedBy.FirstName, &pickedBy.LastName)
 		if err == nil {
-			item.PickedBy = pickedBy
+			itemResponse.PickedBy = &pickedBy
 		}
 	}
 
 	return itemResponse, nil
 }
 
-func (w *WishlistStore) UpdateItem(wishlistID, itemID int, body *UpdateItem) (ItemResponse, error) {
+func (w *WishlistStore) UpdateItem(ctx context.Context, wishlistID, itemID int, body *UpdateItem) (ItemResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return ItemResponse{}, fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	var item ItemResponse
 
 	query := `
@@ -376,10 +345,10 @@ func (w *WishlistStore) UpdateItem(wishlistID, itemID int, body *UpdateItem) (It
 		description = COALESCE(NULLIF($2, ''), description),
 		link = COALESCE(NULLIF($3, ''), link)
 	WHERE id = $4 AND wishlist_id = $5
-	RETURNING id, name, description, link;`
+	RETURNING id, name, description, link, COALESCE(image_key, '');`
 
-	err = w.db.QueryRow(ctx, query, body.Name, body.Description, body.Link, itemID, wishlistID).
-		Scan(&item.ID, &item.Name, &item.Description, &item.Link)
+	err := w.db.QueryRow(ctx, query, body.Name, body.Description, body.Link, itemID, wishlistID).
+		Scan(&item.ID, &item.Name, &item.Description, &item.Link, &item.ImageKey)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -391,9 +360,9 @@ func (w *WishlistStore) UpdateItem(wishlistID, itemID int, body *UpdateItem) (It
 	return item, nil
 }
 
-func (w *WishlistStore) PickItem(wishlistID, itemID, userID int) (ItemResponse, error) {
+func (w *WishlistStore) PickItem(ctx context.Context, wishlistID, itemID, userID int) (ItemResponse, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
@@ -407,7 +376,7 @@ func (w *WishlistStore) PickItem(wishlistID, itemID, userID int) (ItemResponse,
 	// Ensure item is not already picked
 	var existingItemID int
 
-	err = w.db.QueryRow(ctx, "SELECT id FROM items WHERE id = $1 AND wishlist_id = $2", itemID, wishlistID).Scan(&existingItemID)
+	err = tx.QueryRow(ctx, "SELECT id FROM items WHERE id = $1 AND wishlist_id = $2", itemID, wishlistID).Scan(&existingItemID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return ItemResponse{}, errors.New("item not found in wishlist")
@@ -417,32 +386,33 @@ func (w *WishlistStore) PickItem(wishlistID, itemID, userID int) (ItemResponse,
 
 	pickedQuery := `SELECT item_id FROM item_picks WHERE item_id = $1 LIMIT 1;`
 
-	err = w.db.QueryRow(ctx, pickedQuery, itemID).Scan(&existingItemID)
+	err = tx.QueryRow(ctx, pickedQuery, itemID).Scan(&existingItemID)
 	if err == nil {
 		return ItemResponse{}, errors.New("item already picked by another user")
 	}
 
-	query := `INSERT INTO item_picks (item_id, user_id) VALUES ($1, $2) RETURNING id, name, description, link;`
+	// item_picks only links the item to the user, the item is read back from items
+	query := `WITH pick AS (INSERT INTO item_picks (item_id, user_id) VALUES ($1, $2) RETURNING item_id)
+		SELECT i.id, i.name, i.description, i.link, COALESCE(i.image_key, '') FROM items i JOIN pick ON i.id = pick.item_id;`
 
-	err = w.db.QueryRow(ctx, query, userID, itemID).Scan(&item.ID, &item.Name, &item.Description, &item.Link)
+	err = tx.QueryRow(ctx, query, itemID, userID).Scan(&item.ID, &item.Name, &item.Description, &item.Link, &item.ImageKey)
 	if err != nil {
 		return ItemResponse{}, fmt.Errorf("error picking item: %w", err)
 	}
 
+	err = tx.Commit(ctx)
+	if err != nil {
+		return ItemResponse{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
 	return item, nil
 }
 
-func (w *WishlistStore) DeleteItem(wishlistID, itemID int) error {
+func (w *WishlistStore) DeleteItem(ctx context.Context, wishlistID, itemID int) error {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	tx, err := w.db.BeginTx(ctx, pgx.TxOptions{})
-	if err != nil {
-		return fmt.Errorf("error creating transaction: %w", err)
-	}
-	defer tx.Rollback(ctx)
-
 	query := "DELETE FROM items WHERE id = $1 AND wishlist_id = $2"
 	result, err := w.db.Exec(ctx, query, itemID, wishlistID)
 	if err != nil {
@@ -451,21 +421,31 @@ func (w *WishlistStore) DeleteItem(wishlistID, itemID int) error {
 
 	rowsAffected := result.RowsAffected()
 
+	// its pick, if any, goes with it
 	if rowsAffected == 0 {
 		return errors.New("item not found in wishlist")
 	}
 
-	query = "DELETE FROM item_picks WHERE id = $1 AND wishlist_id = $2"
-	result, err = w.db.Exec(ctx, query, itemID, wishlistID)
-	if err != nil {
-		return fmt.Errorf("error deleting item from join table: %w", err)
-	}
+	return nil
+}
 
-	rowsAffected = result.RowsAffected()
+func (w *WishlistStore) SetItemImage(ctx context.Context, wishlistID, itemID int, key string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	if rowsAffected == 0 {
-		return errors.New("item not found in item_picks")
+	query := `UPDATE items i SET image_key = NULLIF($3, '')
+		FROM (SELECT id, image_key FROM items WHERE id = $1 AND wishlist_id = $2 FOR UPDATE) previous
+		WHERE i.id = previous.id RETURNING COALESCE(previous.image_key, '');`
+
+	var previous string
+
+	err := w.db.QueryRow(ctx, query, itemID, wishlistID, key).Scan(&previous)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", helpers.ErrNotFound
+		}
+		return "", fmt.Errorf("error setting item image: %w", err)
 	}
 
-	return nil
+	return previous, nil
 }
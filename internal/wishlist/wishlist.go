@@ -4,6 +4,8 @@ import (
 	"errors"
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/Adedunmol/wish-mate/internal/reminder"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -20,6 +22,9 @@ type Handler struct {
 	Store         Store
 	UserStore     auth.Store
 	ReminderStore reminder.ReminderStore
+	Policy        *policy.Policy
+	// Images stores the photos of the items, none are linked to when nil.
+	Images *media.Images
 }
 
 func (h *Handler) CreateWishlist(responseWriter http.ResponseWriter, request *http.Request) {
@@ -38,14 +43,13 @@ func (h *Handler) CreateWishlist(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
-	email := request.Context().Value("email")
-
-	if email == nil || email == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
 
-	userData, err := h.UserStore.FindUserByEmail(email.(string))
+	userData, err := h.UserStore.FindUserByID(request.Context(), principal.UserID)
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
@@ -61,9 +65,10 @@ func (h *Handler) CreateWishlist(responseWriter http.ResponseWriter, request *ht
 		Items:        body.Items,
 		NotifyBefore: body.NotifyBefore,
 		Date:         body.Date,
+		Visibility:   body.Visibility,
 	}
 
-	data, err := h.Store.CreateWishlist(userData.ID, wishlist)
+	data, err := h.Store.CreateWishlist(request.Context(), userData.ID, wishlist)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrInternalServerError)
@@ -113,9 +118,8 @@ func (h *Handler) GetAllWishlists(responseWriter http.ResponseWriter, request *h
 		return
 	}
 
-	currentUserID := request.Context().Value("user_id")
-
-	if currentUserID == nil || currentUserID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -126,23 +130,35 @@ func (h *Handler) GetAllWishlists(responseWriter http.ResponseWriter, request *h
 		return
 	}
 
-	newCurrentUserID := currentUserID.(int)
+	_, err = h.UserStore.FindUserByID(request.Context(), newUserID)
 
-	_, err = h.UserStore.FindUserByID(newUserID)
+	if errors.Is(err, helpers.ErrNotFound) {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusNotFound, "no friendship found with the id", nil))
+		return
+	}
+	if err != nil {
+		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusInternalServerError, "internal server error", nil))
+		return
+	}
 
+	visibilities, err := h.Policy.VisibleWishlists(request.Context(), principal, newUserID)
 	if err != nil {
-		helpers.HandleError(responseWriter, helpers.NewHTTPError(err, http.StatusNotFound, "no friendship found with the id", nil))
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
 	// add verbose boolean to indicate getting the username and name of the friends who picked an item
-	wishlists, err := h.Store.GetUserWishlists(newUserID, newCurrentUserID == newUserID)
+	wishlists, err := h.Store.GetUserWishlists(request.Context(), newUserID, principal.UserID == newUserID, visibilities)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, helpers.ErrNotFound)
 		return
 	}
 
+	for i := range wishlists {
+		h.linkImages(wishlists[i].Items)
+	}
+
 	response := Response{
 		Status:  "Success",
 		Message: "Wishlists retrieved successfully",
@@ -160,9 +176,8 @@ func (h *Handler) GetWishlist(responseWriter http.ResponseWriter, request *http.
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -173,18 +188,29 @@ func (h *Handler) GetWishlist(responseWriter http.ResponseWriter, request *http.
 		return
 	}
 
-	newUserID := userID.(int)
+	access, err := h.Store.GetWishlistAccess(request.Context(), wishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if err := h.Policy.CanViewWishlist(request.Context(), principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
 
 	// add verbose boolean to indicate getting the username and name of the friends who picked an item.
 	// should be verbose (include the details of those who picked an item) if due date >= current date.
 	// should not include items that have been picked for other users but should include for the creator.
-	wishlist, err := h.Store.GetWishlistByID(wishlistID, newUserID)
+	wishlist, err := h.Store.GetWishlistByID(request.Context(), wishlistID, principal.UserID)
 
 	if err != nil {
-		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
+	h.linkImages(wishlist.Items)
+
 	response := Response{
 		Status:  "Success",
 		Message: "Wishlist retrieved successfully",
@@ -217,9 +243,8 @@ func (h *Handler) UpdateWishlist(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -230,17 +255,21 @@ func (h *Handler) UpdateWishlist(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
-	newUserID := userID.(int)
-
-	wishlist, err := h.Store.UpdateWishlistByID(wishlistID, newUserID, *body)
+	access, err := h.Store.GetWishlistAccess(request.Context(), wishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
 
-	if err != nil && errors.Is(err, helpers.ErrForbidden) {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanEditWishlist(principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if err != nil && errors.Is(err, helpers.ErrNotFound) {
-		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+	wishlist, err := h.Store.UpdateWishlistByID(request.Context(), wishlistID, *body)
+
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
@@ -261,9 +290,8 @@ func (h *Handler) DeleteWishlist(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -274,17 +302,21 @@ func (h *Handler) DeleteWishlist(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
-	newUserID := userID.(int)
-
-	err = h.Store.DeleteWishlistByID(wishlistID, newUserID)
+	access, err := h.Store.GetWishlistAccess(request.Context(), wishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
 
-	if err != nil && errors.Is(err, helpers.ErrForbidden) {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanEditWishlist(principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if err != nil && errors.Is(err, helpers.ErrNotFound) {
-		helpers.HandleError(responseWriter, helpers.ErrNotFound)
+	err = h.Store.DeleteWishlistByID(request.Context(), wishlistID)
+
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
@@ -331,14 +363,33 @@ func (h *Handler) GetItemHandler(responseWriter http.ResponseWriter, request *ht
 		return
 	}
 
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
+		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
+		return
+	}
+
+	access, err := h.Store.GetWishlistAccess(request.Context(), newWishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	if err := h.Policy.CanViewWishlist(request.Context(), principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
 	// add verbose boolean to indicate getting the username and name of the friends who picked an item
-	data, err := h.Store.GetItem(newWishlistID, newItemID)
+	data, err := h.Store.GetItem(request.Context(), newWishlistID, newItemID)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
+	h.linkImage(&data)
+
 	response := Response{
 		Status:  "Success",
 		Message: "Item retrieved successfully",
@@ -364,9 +415,8 @@ func (h *Handler) DeleteItemHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -383,21 +433,18 @@ func (h *Handler) DeleteItemHandler(responseWriter http.ResponseWriter, request
 		return
 	}
 
-	newUserID := userID.(int)
-
-	wishlist, err := h.Store.GetWishlistByID(newWishlistID, newUserID)
-
+	access, err := h.Store.GetWishlistAccess(request.Context(), newWishlistID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if wishlist.UserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanEditItem(principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	err = h.Store.DeleteItem(newWishlistID, newItemID)
+	err = h.Store.DeleteItem(request.Context(), newWishlistID, newItemID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
@@ -442,9 +489,8 @@ func (h *Handler) UpdateWishlistItemHandler(responseWriter http.ResponseWriter,
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -461,26 +507,25 @@ func (h *Handler) UpdateWishlistItemHandler(responseWriter http.ResponseWriter,
 		return
 	}
 
-	newUserID := userID.(int)
-
-	wishlist, err := h.Store.GetWishlistByID(newWishlistID, newUserID)
-
+	access, err := h.Store.GetWishlistAccess(request.Context(), newWishlistID)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	if wishlist.UserID != newUserID {
-		helpers.HandleError(responseWriter, helpers.ErrForbidden)
+	if err := h.Policy.CanEditItem(principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
 		return
 	}
 
-	data, err := h.Store.UpdateItem(newWishlistID, newItemID, body)
+	data, err := h.Store.UpdateItem(request.Context(), newWishlistID, newItemID, body)
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
+	h.linkImage(&data)
+
 	response := Response{
 		Status:  "Success",
 		Message: "Item updated successfully",
@@ -506,9 +551,8 @@ func (h *Handler) PickWishlistItemHandler(responseWriter http.ResponseWriter, re
 		return
 	}
 
-	userID := request.Context().Value("user_id")
-
-	if userID == nil || userID == "" {
+	principal, ok := helpers.PrincipalFrom(request.Context())
+	if !ok {
 		helpers.HandleError(responseWriter, helpers.ErrUnauthorized)
 		return
 	}
@@ -525,15 +569,26 @@ func (h *Handler) PickWishlistItemHandler(responseWriter http.ResponseWriter, re
 		return
 	}
 
-	newUserID := userID.(int)
+	access, err := h.Store.GetWishlistAccess(request.Context(), newWishlistID)
+	if err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
 
-	data, err := h.Store.PickItem(newWishlistID, newItemID, newUserID)
+	if err := h.Policy.CanPickItem(request.Context(), principal, access); err != nil {
+		helpers.HandleError(responseWriter, err)
+		return
+	}
+
+	data, err := h.Store.PickItem(request.Context(), newWishlistID, newItemID, principal.UserID)
 
 	if err != nil {
 		helpers.HandleError(responseWriter, err)
 		return
 	}
 
+	h.linkImage(&data)
+
 	response := Response{
 		Status:  "Success",
 		Message: "Item picked successfully",
@@ -7,19 +7,28 @@ import (
 	"fmt"
 	"github.com/Adedunmol/wish-mate/internal/auth"
 	"github.com/Adedunmol/wish-mate/internal/helpers"
+	"github.com/Adedunmol/wish-mate/internal/media"
+	"github.com/Adedunmol/wish-mate/internal/policy"
 	"github.com/Adedunmol/wish-mate/internal/wishlist"
 	"github.com/go-chi/chi/v5"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type StubUserStore struct {
 	users []auth.User
 }
 
-func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
+func (s *StubUserStore) CreateUser(ctx context.Context, body *auth.CreateUserBody) (auth.CreateUserResponse, error) {
 
 	for _, u := range s.users {
 		if u.Email == body.Email {
@@ -34,7 +43,7 @@ func (s *StubUserStore) CreateUser(body *auth.CreateUserBody) (auth.CreateUserRe
 	return auth.CreateUserResponse{ID: userData.ID, FirstName: userData.FirstName, LastName: userData.LastName, Username: userData.Username}, nil
 }
 
-func (s *StubUserStore) FindUserByEmail(email string) (auth.User, error) {
+func (s *StubUserStore) FindUserByEmail(ctx context.Context, email string) (auth.User, error) {
 
 	for _, u := range s.users {
 		if u.Email == email {
@@ -44,7 +53,7 @@ func (s *StubUserStore) FindUserByEmail(email string) (auth.User, error) {
 	return auth.User{}, helpers.ErrNotFound
 }
 
-func (s *StubUserStore) FindUserByID(id int) (auth.User, error) {
+func (s *StubUserStore) FindUserByID(ctx context.Context, id int) (auth.User, error) {
 
 	for _, u := range s.users {
 		if u.ID == id {
@@ -54,15 +63,93 @@ func (s *StubUserStore) FindUserByID(id int) (auth.User, error) {
 	return auth.User{}, helpers.ErrNotFound
 }
 
+func (s *StubUserStore) UpdateUser(ctx context.Context, id int, data auth.UpdateUserBody) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users[i].Verified = u.Verified || data.Verified
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DisableUser(ctx context.Context, id int) (auth.User, error) {
+	for i, u := range s.users {
+		if u.ID == id {
+			disabledAt := time.Now()
+			s.users[i].DisabledAt = &disabledAt
+
+			return s.users[i], nil
+		}
+	}
+
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) DeleteUser(ctx context.Context, id int) error {
+	for i, u := range s.users {
+		if u.ID == id {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return helpers.ErrNotFound
+}
+
 func (s *StubUserStore) ComparePasswords(storedPassword, candidatePassword string) bool {
 	return storedPassword == candidatePassword
 }
 
+func (s *StubUserStore) ChangePassword(ctx context.Context, id int, password string) error {
+	return nil
+}
+
+func (s *StubUserStore) SetPendingEmail(ctx context.Context, id int, email string) error {
+	return nil
+}
+
+func (s *StubUserStore) ConfirmEmail(ctx context.Context, id int) (auth.User, error) {
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) SetAvatar(ctx context.Context, id int, key string) (string, error) {
+	return "", nil
+}
+
+func (s *StubUserStore) RecordFailedLogin(ctx context.Context, id int) (int, int, error) {
+	return 1, 0, nil
+}
+
+func (s *StubUserStore) LockUser(ctx context.Context, id int, until time.Time, unlockToken string) (bool, error) {
+	return true, nil
+}
+
+func (s *StubUserStore) UnlockUser(ctx context.Context, unlockToken string) (auth.User, error) {
+	return auth.User{}, helpers.ErrNotFound
+}
+
+func (s *StubUserStore) RecordLogin(ctx context.Context, id int, device, ip string) (auth.LoginSighting, error) {
+	return auth.LoginSighting{First: true}, nil
+}
+
+// StubRelationStore makes every two users friends.
+type StubRelationStore struct{}
+
+func (s *StubRelationStore) Relation(ctx context.Context, userID, otherID int) (policy.Relation, error) {
+	return policy.RelationFriends, nil
+}
+
+var rules = policy.New(&StubRelationStore{})
+
 type StubWishlistStore struct {
 	wishlists []wishlist.WishlistResponse
 }
 
-func (s *StubWishlistStore) CreateWishlist(userID int, body wishlist.Wishlist) (wishlist.WishlistResponse, error) {
+func (s *StubWishlistStore) CreateWishlist(ctx context.Context, userID int, body wishlist.Wishlist) (wishlist.WishlistResponse, error) {
 
 	var items []wishlist.ItemResponse
 	id := 1
@@ -93,7 +180,7 @@ func (s *StubWishlistStore) CreateWishlist(userID int, body wishlist.Wishlist) (
 	return wishlistData, nil
 }
 
-func (s *StubWishlistStore) GetWishlistByID(wishlistID, userID int) (wishlist.WishlistResponse, error) {
+func (s *StubWishlistStore) GetWishlistByID(ctx context.Context, wishlistID, userID int) (wishlist.WishlistResponse, error) {
 	var response wishlist.WishlistResponse
 
 	for _, w := range s.wishlists {
@@ -128,12 +215,22 @@ func (s *StubWishlistStore) GetWishlistByID(wishlistID, userID int) (wishlist.Wi
 	return wishlist.WishlistResponse{}, helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) GetUserWishlists(userID int, isOwner bool) ([]wishlist.WishlistResponse, error) {
+func (s *StubWishlistStore) GetWishlistAccess(ctx context.Context, wishlistID int) (policy.Wishlist, error) {
+	for _, w := range s.wishlists {
+		if w.ID == wishlistID {
+			return policy.Wishlist{OwnerID: w.UserID, Visibility: w.Visibility}, nil
+		}
+	}
+
+	return policy.Wishlist{}, helpers.ErrNotFound
+}
+
+func (s *StubWishlistStore) GetUserWishlists(ctx context.Context, userID int, isOwner bool, visibilities []string) ([]wishlist.WishlistResponse, error) {
 	response := make([]wishlist.WishlistResponse, 0)
 
 	for _, w := range s.wishlists {
 		var data wishlist.WishlistResponse
-		if w.UserID == userID {
+		if w.UserID == userID && visible(w.Visibility, visibilities) {
 
 			data.UserID = w.UserID
 			data.ID = w.ID
@@ -166,16 +263,12 @@ func (s *StubWishlistStore) GetUserWishlists(userID int, isOwner bool) ([]wishli
 	return response, nil
 }
 
-func (s *StubWishlistStore) UpdateWishlistByID(wishlistID, userID int, body wishlist.UpdateWishlist) (wishlist.WishlistResponse, error) {
+func (s *StubWishlistStore) UpdateWishlistByID(ctx context.Context, wishlistID int, body wishlist.UpdateWishlist) (wishlist.WishlistResponse, error) {
 	var response wishlist.WishlistResponse
 
 	for _, w := range s.wishlists {
 
-		if w.ID == wishlistID && w.UserID != userID {
-			return response, helpers.ErrForbidden
-		}
-
-		if w.ID == wishlistID && w.UserID == userID {
+		if w.ID == wishlistID {
 
 			if body.Name != "" {
 				response.Name = body.Name
@@ -196,15 +289,11 @@ func (s *StubWishlistStore) UpdateWishlistByID(wishlistID, userID int, body wish
 	return wishlist.WishlistResponse{}, helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) DeleteWishlistByID(wishlistID, userID int) error {
+func (s *StubWishlistStore) DeleteWishlistByID(ctx context.Context, wishlistID int) error {
 
 	for _, w := range s.wishlists {
 
-		if w.ID == wishlistID && w.UserID != userID {
-			return helpers.ErrForbidden
-		}
-
-		if w.ID == wishlistID && w.UserID == userID {
+		if w.ID == wishlistID {
 			return nil
 		}
 	}
@@ -212,7 +301,7 @@ func (s *StubWishlistStore) DeleteWishlistByID(wishlistID, userID int) error {
 	return helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) GetItem(wishlistID, itemID int) (wishlist.ItemResponse, error) {
+func (s *StubWishlistStore) GetItem(ctx context.Context, wishlistID, itemID int) (wishlist.ItemResponse, error) {
 
 	for _, w := range s.wishlists {
 		if w.ID == wishlistID {
@@ -227,7 +316,7 @@ func (s *StubWishlistStore) GetItem(wishlistID, itemID int) (wishlist.ItemRespon
 	return wishlist.ItemResponse{}, helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) UpdateItem(wishlistID, itemID int, body *wishlist.UpdateItem) (wishlist.ItemResponse, error) {
+func (s *StubWishlistStore) UpdateItem(ctx context.Context, wishlistID, itemID int, body *wishlist.UpdateItem) (wishlist.ItemResponse, error) {
 
 	var wish wishlist.WishlistResponse
 
@@ -262,7 +351,7 @@ func (s *StubWishlistStore) UpdateItem(wishlistID, itemID int, body *wishlist.Up
 	return wishlist.ItemResponse{}, helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) DeleteItem(wishlistID, itemID int) error {
+func (s *StubWishlistStore) DeleteItem(ctx context.Context, wishlistID, itemID int) error {
 
 	for _, w := range s.wishlists {
 		if w.ID == wishlistID {
@@ -277,7 +366,7 @@ func (s *StubWishlistStore) DeleteItem(wishlistID, itemID int) error {
 	return helpers.ErrNotFound
 }
 
-func (s *StubWishlistStore) PickItem(wishlistID, itemID, userID int) (wishlist.ItemResponse, error) {
+func (s *StubWishlistStore) PickItem(ctx context.Context, wishlistID, itemID, userID int) (wishlist.ItemResponse, error) {
 
 	for _, w := range s.wishlists {
 		if w.ID == wishlistID {
@@ -296,12 +385,44 @@ func (s *StubWishlistStore) PickItem(wishlistID, itemID, userID int) (wishlist.I
 	return wishlist.ItemResponse{}, helpers.ErrNotFound
 }
 
+func (s *StubWishlistStore) SetItemImage(ctx context.Context, wishlistID, itemID int, key string) (string, error) {
+	for _, w := range s.wishlists {
+		if w.ID == wishlistID {
+			for i, item := range w.Items {
+				if item.ID == itemID {
+					w.Items[i].ImageKey = key
+
+					return item.ImageKey, nil
+				}
+			}
+		}
+	}
+
+	return "", helpers.ErrNotFound
+}
+
+// visible reports whether a wishlist shows up for the visibilities, an unset one
+// being shown to friends.
+func visible(visibility string, visibilities []string) bool {
+	if visibility == "" {
+		visibility = policy.VisibilityFriends
+	}
+
+	for _, v := range visibilities {
+		if v == visibility {
+			return true
+		}
+	}
+
+	return false
+}
+
 func TestCreateWishlist(t *testing.T) {
 	store := StubWishlistStore{wishlists: make([]wishlist.WishlistResponse, 0)}
 	userStore := StubUserStore{users: []auth.User{
 		{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola", DateOfBirth: "2020-01-01"},
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("create and return a wishlist (with items)", func(t *testing.T) {
 
@@ -316,7 +437,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola@gmail.com")
+		request := createWishlistRequest(body, 1)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -335,8 +456,8 @@ func TestCreateWishlist(t *testing.T) {
 				"notify_before": float64(7),
 				"date":          "2020-01-01",
 				"items": []map[string]interface{}{
-					{"id": float64(1), "name": "phone", "description": "", "taken": false},
-					{"id": float64(2), "name": "bag", "description": "", "taken": false},
+					{"id": float64(1), "name": "phone", "description": "", "taken": false, "link": ""},
+					{"id": float64(2), "name": "bag", "description": "", "taken": false, "link": ""},
 				},
 			},
 		}
@@ -364,7 +485,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola@gmail.com")
+		request := createWishlistRequest(body, 1)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -411,7 +532,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola@gmail.com")
+		request := createWishlistRequest(body, 1)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -454,7 +575,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola@gmail.com")
+		request := createWishlistRequest(body, 1)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -488,7 +609,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola123@gmail.com")
+		request := createWishlistRequest(body, 10)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -516,7 +637,7 @@ func TestCreateWishlist(t *testing.T) {
 		}
 
 		body, _ := json.Marshal(data)
-		request := createWishlistRequest(body, "adedunmola@gmail.com")
+		request := createWishlistRequest(body, 1)
 		response := httptest.NewRecorder()
 
 		server.CreateWishlist(response, request)
@@ -559,7 +680,7 @@ func TestGetUserWishlists(t *testing.T) {
 		user1,
 		user2,
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("get friendship's wishlists (owner)", func(t *testing.T) {
 
@@ -611,7 +732,7 @@ func TestGetUserWishlists(t *testing.T) {
 
 	t.Run("get friendship's wishlists (others)", func(t *testing.T) {
 
-		ctx := context.WithValue(context.Background(), "user_id", user2.ID)
+		ctx := authenticated(user2.ID)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("users/%s/wishlists", fmt.Sprint(user1.ID)), nil)
 
 		rctx := chi.NewRouteContext()
@@ -700,7 +821,7 @@ func TestGetWishlist(t *testing.T) {
 		user1,
 		user2,
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("return a wishlist (owner)", func(t *testing.T) {
 
@@ -722,8 +843,8 @@ func TestGetWishlist(t *testing.T) {
 				"description":   "some random description",
 				"notify_before": float64(7),
 				"items": []map[string]interface{}{
-					{"id": float64(1), "name": "phone", "description": "", "taken": true},
-					{"id": float64(2), "name": "bag", "description": "", "taken": false},
+					{"id": float64(1), "name": "phone", "description": "", "taken": true, "link": ""},
+					{"id": float64(2), "name": "bag", "description": "", "taken": false, "link": ""},
 				},
 			},
 		}
@@ -755,7 +876,7 @@ func TestGetWishlist(t *testing.T) {
 				"name":        "Birthday list",
 				"description": "some random description",
 				"items": []map[string]interface{}{
-					{"id": float64(2), "name": "bag", "description": "", "taken": false},
+					{"id": float64(2), "name": "bag", "description": "", "taken": false, "link": ""},
 				},
 			},
 		}
@@ -829,7 +950,7 @@ func TestUpdateWishlist(t *testing.T) {
 		user1,
 		user2,
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("update and return a wishlist", func(t *testing.T) {
 		data := []byte(`{ "name": "Birthday list 2" }`)
@@ -945,7 +1066,7 @@ func TestDeleteWishlist(t *testing.T) {
 		user1,
 		user2,
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("delete a wishlist", func(t *testing.T) {
 
@@ -1054,7 +1175,7 @@ func TestUpdateItem(t *testing.T) {
 		user1,
 		user2,
 	}}
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("update and return item", func(t *testing.T) {
 		data := []byte(`{ "link": "https://random.com/item" }`)
@@ -1138,11 +1259,11 @@ func TestPickItem(t *testing.T) {
 		user2,
 	}}
 
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("pick and return item", func(t *testing.T) {
 
-		request := pickItemRequest(user1.ID, 1, 2)
+		request := pickItemRequest(user2.ID, 1, 2)
 		response := httptest.NewRecorder()
 
 		server.PickWishlistItemHandler(response, request)
@@ -1168,7 +1289,7 @@ func TestPickItem(t *testing.T) {
 
 	t.Run("return 409 for trying to pick a picked item", func(t *testing.T) {
 
-		request := pickItemRequest(user1.ID, 1, 1)
+		request := pickItemRequest(user2.ID, 1, 1)
 		response := httptest.NewRecorder()
 
 		server.PickWishlistItemHandler(response, request)
@@ -1186,7 +1307,7 @@ func TestPickItem(t *testing.T) {
 
 	t.Run("return 404 for no item found with id", func(t *testing.T) {
 
-		request := pickItemRequest(user1.ID, 10, 10)
+		request := pickItemRequest(user2.ID, 10, 10)
 		response := httptest.NewRecorder()
 
 		server.PickWishlistItemHandler(response, request)
@@ -1218,7 +1339,7 @@ func TestGetItem(t *testing.T) {
 		user2,
 	}}
 
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("return item", func(t *testing.T) {
 		request := getItemRequest(user1.ID, 1, 1)
@@ -1246,7 +1367,7 @@ func TestGetItem(t *testing.T) {
 	})
 
 	t.Run("return a 400 for no item/wishlist id", func(t *testing.T) {
-		ctx := context.WithValue(context.Background(), "user_id", user1.ID)
+		ctx := authenticated(user1.ID)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(1), ""), nil)
 
 		rctx := chi.NewRouteContext()
@@ -1301,7 +1422,7 @@ func TestDeleteItem(t *testing.T) {
 		user2,
 	}}
 
-	server := wishlist.Handler{Store: &store, UserStore: &userStore}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules}
 
 	t.Run("delete item", func(t *testing.T) {
 		request := deleteItemRequest(user1.ID, 1, 1)
@@ -1339,7 +1460,7 @@ func TestDeleteItem(t *testing.T) {
 	})
 
 	t.Run("return a 400 for no item/wishlist id", func(t *testing.T) {
-		ctx := context.WithValue(context.Background(), "user_id", user1.ID)
+		ctx := authenticated(user1.ID)
 		request, _ := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(1), ""), nil)
 
 		rctx := chi.NewRouteContext()
@@ -1379,6 +1500,94 @@ func TestDeleteItem(t *testing.T) {
 	})
 }
 
+func TestItemImage(t *testing.T) {
+	user1 := auth.User{ID: 1, FirstName: "Adedunmola", LastName: "Oyewale", Password: "password", Email: "adedunmola@gmail.com", Username: "Adedunmola"}
+	user2 := auth.User{ID: 2, FirstName: "Ade", LastName: "Oyewale", Password: "password", Email: "ade@gmail.com", Username: "Ade"}
+
+	store := StubWishlistStore{wishlists: []wishlist.WishlistResponse{
+		{ID: 1, UserID: user1.ID, Name: "Birthday list", Description: "some random description", NotifyBefore: 7, Items: []wishlist.ItemResponse{
+			{ID: 1, Name: "phone", Description: ""},
+		}},
+	}}
+	userStore := StubUserStore{users: []auth.User{user1, user2}}
+	dir := t.TempDir()
+	images := &media.Images{Store: media.NewLocalStore(dir, "http://localhost:5000/blobs", []byte("secret")), MaxBytes: 1 << 20, LinkTTL: time.Minute}
+	server := wishlist.Handler{Store: &store, UserStore: &userStore, Policy: rules, Images: images}
+
+	item := func(t *testing.T, response *httptest.ResponseRecorder) wishlist.ItemResponse {
+		t.Helper()
+
+		var got wishlist.ItemResponse
+		if err := json.Unmarshal(response.Body.Bytes(), &wishlist.Response{Data: &got}); err != nil {
+			t.Fatalf("error decoding %s: %v", response.Body.String(), err)
+		}
+		return got
+	}
+
+	var key string
+
+	t.Run("stores the photo of an item", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.UploadItemImageHandler(response, itemImageRequest(t, user1.ID, 1, 1, true))
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		got := item(t, response)
+		if !strings.HasPrefix(got.ImageURL, "http://localhost:5000/blobs/items/1/") || !strings.Contains(got.ThumbnailURL, "_thumb.png?") {
+			t.Errorf("got %+v, want links to the image", got)
+		}
+
+		key = store.wishlists[0].Items[0].ImageKey
+		if _, err := os.Stat(filepath.Join(dir, key)); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("replaces the previous photo", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.UploadItemImageHandler(response, itemImageRequest(t, user1.ID, 1, 1, true))
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if _, err := os.Stat(filepath.Join(dir, key)); !os.IsNotExist(err) {
+			t.Errorf("the previous photo is still stored: %v", err)
+		}
+	})
+
+	t.Run("only lets the owner change the photo", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.UploadItemImageHandler(response, itemImageRequest(t, user2.ID, 1, 1, true))
+
+		assertResponseCode(t, response.Code, http.StatusForbidden)
+	})
+
+	t.Run("refuses an unknown item and keeps nothing", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.UploadItemImageHandler(response, itemImageRequest(t, user1.ID, 1, 10, true))
+
+		assertResponseCode(t, response.Code, http.StatusNotFound)
+
+		if entries, _ := os.ReadDir(filepath.Join(dir, "items", "10")); len(entries) != 0 {
+			t.Errorf("left %v", entries)
+		}
+	})
+
+	t.Run("removes the photo", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		server.DeleteItemImageHandler(response, itemImageRequest(t, user1.ID, 1, 1, false))
+
+		assertResponseCode(t, response.Code, http.StatusOK)
+
+		if got := item(t, response); got.ImageURL != "" || got.ThumbnailURL != "" {
+			t.Errorf("got %+v, want no image", got)
+		}
+
+		if entries, _ := os.ReadDir(filepath.Join(dir, "items", "1")); len(entries) != 0 {
+			t.Errorf("left %v", entries)
+		}
+	})
+}
+
 func assertResponseCode(t *testing.T, got, want int) {
 	t.Helper()
 	if got != want {
@@ -1393,9 +1602,14 @@ func assertResponseBody(t *testing.T, got, want map[string]interface{}) {
 	}
 }
 
-func createWishlistRequest(data []byte, email string) *http.Request {
+// authenticated is the context AuthMiddleware gives the requests of the user.
+func authenticated(userID int) context.Context {
+	return helpers.WithPrincipal(context.Background(), helpers.Principal{UserID: userID, Verified: true})
+}
+
+func createWishlistRequest(data []byte, userID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "email", email)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/wishlist", bytes.NewReader(data))
 
 	return request
@@ -1403,7 +1617,7 @@ func createWishlistRequest(data []byte, email string) *http.Request {
 
 func getWishlistRequest(userID, wishlistID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/wishlist/%s", fmt.Sprint(wishlistID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1416,7 +1630,7 @@ func getWishlistRequest(userID, wishlistID int) *http.Request {
 
 func getUserWishlistsRequest(userID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("users/%s/wishlists", fmt.Sprint(userID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1429,7 +1643,7 @@ func getUserWishlistsRequest(userID int) *http.Request {
 
 func getItemRequest(userID, wishlistID, itemID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(wishlistID), fmt.Sprint(itemID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1443,7 +1657,7 @@ func getItemRequest(userID, wishlistID, itemID int) *http.Request {
 
 func deleteItemRequest(userID, wishlistID, itemID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(wishlistID), fmt.Sprint(itemID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1457,7 +1671,7 @@ func deleteItemRequest(userID, wishlistID, itemID int) *http.Request {
 
 func updateWishlistRequest(userID, wishlistID int, body []byte) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/wishlist/%s", fmt.Sprint(wishlistID)), bytes.NewReader(body))
 
 	rctx := chi.NewRouteContext()
@@ -1470,7 +1684,7 @@ func updateWishlistRequest(userID, wishlistID int, body []byte) *http.Request {
 
 func updateItemRequest(userID, wishlistID, itemID int, body []byte) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(wishlistID), fmt.Sprint(itemID)), bytes.NewReader(body))
 
 	rctx := chi.NewRouteContext()
@@ -1484,7 +1698,7 @@ func updateItemRequest(userID, wishlistID, itemID int, body []byte) *http.Reques
 
 func pickItemRequest(userID, wishlistID, itemID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodPatch, fmt.Sprintf("/wishlists/%s/items/%s", fmt.Sprint(wishlistID), fmt.Sprint(itemID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1498,7 +1712,7 @@ func pickItemRequest(userID, wishlistID, itemID int) *http.Request {
 
 func deleteWishlistRequest(userID, wishlistID int) *http.Request {
 
-	ctx := context.WithValue(context.Background(), "user_id", userID)
+	ctx := authenticated(userID)
 	request, _ := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("/wishlist/%s", fmt.Sprint(wishlistID)), nil)
 
 	rctx := chi.NewRouteContext()
@@ -1508,3 +1722,31 @@ func deleteWishlistRequest(userID, wishlistID int) *http.Request {
 
 	return request
 }
+
+// itemImageRequest uploads a PNG as the photo of the item, or sends no body.
+func itemImageRequest(t *testing.T, userID, wishlistID, itemID int, upload bool) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	contentType := ""
+
+	if upload {
+		writer := multipart.NewWriter(&body)
+		part, _ := writer.CreateFormFile(media.FormField, "phone.png")
+		if err := png.Encode(part, image.NewNRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+		contentType = writer.FormDataContentType()
+	}
+
+	ctx := authenticated(userID)
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("/wishlists/%d/items/%d/image", wishlistID, itemID), &body)
+	request.Header.Set("Content-Type", contentType)
+
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", fmt.Sprint(wishlistID))
+	rctx.URLParams.Add("item_id", fmt.Sprint(itemID))
+
+	return request.WithContext(context.WithValue(request.Context(), chi.RouteCtxKey, rctx))
+}